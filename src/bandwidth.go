@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"xget/src/storage"
+)
+
+// tokenBucket limits the combined read rate of every download from one
+// host. Tokens are bytes; the bucket holds at most one second of rate.
+type tokenBucket struct {
+	rate int64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// wait takes n tokens, going into debt if there are not enough, and sleeps
+// until the debt is repaid. Concurrent readers queue behind each other's
+// debt, so they share the rate.
+func (bucket *tokenBucket) wait(ctx context.Context, n int) error {
+	bucket.mu.Lock()
+
+	now := time.Now()
+	rate := float64(bucket.rate)
+
+	bucket.tokens = min(bucket.tokens+now.Sub(bucket.last).Seconds()*rate, rate)
+	bucket.last = now
+	bucket.tokens -= float64(n)
+
+	debt := -bucket.tokens
+
+	bucket.mu.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(debt / rate * float64(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// hostLimits hands out the token bucket of each host limited by
+// settings.per_host_bandwidth, creating it on first use.
+type hostLimits struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (limits *hostLimits) bucket(host string, rate int64) *tokenBucket {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+
+	if limits.buckets == nil {
+		limits.buckets = make(map[string]*tokenBucket)
+	}
+
+	bucket, ok := limits.buckets[host]
+	if !ok {
+		bucket = newTokenBucket(rate)
+		limits.buckets[host] = bucket
+	}
+
+	return bucket
+}
+
+// limitedReader reads through a token bucket.
+type limitedReader struct {
+	ctx    context.Context //nolint:containedctx // a Read cannot take a context
+	reader io.ReadCloser
+	bucket *tokenBucket
+}
+
+// Read implements io.Reader. A read is capped at one second of rate, so
+// no single read runs up more debt than the bucket can hold.
+func (reader *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > reader.bucket.rate {
+		p = p[:reader.bucket.rate]
+	}
+
+	n, err := reader.reader.Read(p)
+	if n > 0 {
+		waitErr := reader.bucket.wait(reader.ctx, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer.
+func (reader *limitedReader) Close() error {
+	return reader.reader.Close()
+}
+
+// limitedSource wraps the body readers of a source in a token bucket.
+type limitedSource struct {
+	storage.Source
+
+	bucket *tokenBucket
+}
+
+// Download implements storage.Source.
+func (source *limitedSource) Download(ctx context.Context, offset int64) (io.ReadCloser, int64, error) {
+	reader, size, err := source.Source.Download(ctx, offset)
+	if err != nil {
+		return nil, size, err
+	}
+
+	return &limitedReader{ctx: ctx, reader: reader, bucket: source.bucket}, size, nil
+}
+
+// limitedRangeSource is a limitedSource for sources that accept ranges, so
+// segmented and byte-range downloads share the limit.
+type limitedRangeSource struct {
+	limitedSource
+
+	ranges storage.RangeSource
+}
+
+// DownloadRange implements storage.RangeSource.
+func (source *limitedRangeSource) DownloadRange(ctx context.Context, start, end int64) (io.ReadCloser, error) {
+	reader, err := source.ranges.DownloadRange(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &limitedReader{ctx: ctx, reader: reader, bucket: source.bucket}, nil
+}
+
+// AcceptsRanges implements storage.RangeSource.
+func (source *limitedRangeSource) AcceptsRanges(ctx context.Context) (bool, error) {
+	return source.ranges.AcceptsRanges(ctx)
+}
+
+// limitSource applies settings.per_host_bandwidth to the transfers of
+// source, which downloads url. Sources of unlisted hosts are returned as is.
+func (downloader *Downloader) limitSource(url string, source storage.Source) storage.Source {
+	host, rate := downloader.cfg.HostBandwidth(url)
+	if rate <= 0 {
+		return source
+	}
+
+	limited := limitedSource{Source: source, bucket: downloader.limits.bucket(host, rate)}
+
+	ranges, ok := source.(storage.RangeSource)
+	if ok {
+		return &limitedRangeSource{limitedSource: limited, ranges: ranges}
+	}
+
+	return &limited
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+func TestLimitedReader(t *testing.T) {
+	const rate = 100_000
+
+	bucket := newTokenBucket(rate)
+	content := bytes.Repeat([]byte("x"), rate+rate/2)
+
+	reader := &limitedReader{ctx: context.Background(), reader: io.NopCloser(bytes.NewReader(content)), bucket: bucket}
+
+	start := time.Now()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	elapsed := time.Since(start)
+
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected %d bytes, got %d", len(content), len(data))
+	}
+
+	// The full bucket covers the first second of rate; the rest is paced.
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected about 500ms for 1.5s of rate with a full bucket, took %v", elapsed)
+	}
+}
+
+func TestLimitedReaderCancelled(t *testing.T) {
+	bucket := newTokenBucket(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	reader := &limitedReader{ctx: ctx, reader: io.NopCloser(bytes.NewReader(make([]byte, 100))), bucket: bucket}
+
+	_, err := io.ReadAll(reader)
+	if err == nil {
+		t.Fatal("expected the cancelled context to stop the read")
+	}
+}
+
+func TestLimitSource(t *testing.T) {
+	cfg := &config.Config{
+		Aliases: map[string]config.Alias{"store": {Endpoint: "https://minio.example.com:9000", Bucket: "artifacts"}},
+		Settings: config.Settings{PerHostBandwidth: map[string]int64{
+			"minio.example.com": 1000,
+			"cdn.example.com":   2000,
+		}},
+	}
+	downloader := NewDownloader(cfg, nil)
+
+	tests := []struct {
+		url         string
+		wantLimited bool
+	}{
+		{url: "s3://store/file.bin", wantLimited: true},
+		{url: "https://CDN.example.com/file.bin", wantLimited: true},
+		{url: "https://other.example.com/file.bin", wantLimited: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			source := downloader.limitSource(tt.url, storage.NewHTTPSource(tt.url, time.Second))
+
+			_, limited := source.(*limitedRangeSource)
+			if limited != tt.wantLimited {
+				t.Errorf("expected limited %t, got %T", tt.wantLimited, source)
+			}
+		})
+	}
+
+	// Files of one host share a bucket.
+	if downloader.limits.bucket("cdn.example.com", 2000) != downloader.limits.bucket("cdn.example.com", 2000) {
+		t.Error("expected one bucket per host")
+	}
+}
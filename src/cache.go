@@ -2,20 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"sync"
 
 	"xget/src/config"
+	"xget/src/segment"
 	"xget/src/storage"
+	"xget/src/tracing"
 
 	"github.com/vbauerster/mpb/v8"
 )
 
+// errCacheChecksumMismatch is returned by Cache.Get when the cache object
+// does not hash to its key.
+var errCacheChecksumMismatch = errors.New("checksum mismatch from cache")
+
+// cacheHashMetadataKey is the object metadata key holding the SHA256 of a
+// cached file.
+const cacheHashMetadataKey = "sha256"
+
 // Cache provides caching functionality using S3 storage.
 type Cache struct {
-	alias config.Alias
+	alias    config.Alias
+	options  config.CacheConfig
+	settings config.Settings
+	puts     putDedup
 }
 
 // NewCache creates a new Cache from config.
@@ -26,19 +40,36 @@ func NewCache(cfg *config.Config) *Cache {
 		return nil
 	}
 
-	return &Cache{alias: alias}
+	return &Cache{alias: alias, options: cfg.Cache, settings: cfg.Settings}
+}
+
+// Get retrieves file from cache by its SHA256 hash into its dest, verified
+// against every checksum of file. Returns true if file was found in cache
+// and downloaded successfully.
+func (cache *Cache) Get(ctx context.Context, file config.FileEntry, progress *mpb.Progress) (bool, error) {
+	ctx, span := tracing.Start(ctx, "cache.get", tracing.String("xget.sha256", file.SHA256))
+	defer span.End()
+
+	found, err := cache.get(ctx, file, progress)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	span.SetAttributes(tracing.String("xget.cache.hit", fmt.Sprint(found)))
+
+	return found, err
 }
 
-// Get retrieves a file from cache by its SHA256 hash.
-// Returns true if file was found in cache and downloaded successfully.
-func (cache *Cache) Get(ctx context.Context, sha256Hash, destPath string, progress *mpb.Progress) (bool, error) {
-	source, err := storage.NewS3SourceFromAlias(ctx, cache.alias, sha256Hash)
+func (cache *Cache) get(ctx context.Context, file config.FileEntry, progress *mpb.Progress) (bool, error) {
+	source, err := storage.NewS3SourceFromAlias(ctx, cache.alias, cache.options.ObjectKey(file.SHA256))
 	if err != nil {
 		return false, fmt.Errorf("creating S3 source: %w", err)
 	}
 
 	// Check if file exists in cache.
-	exists, err := source.Exists(ctx)
+	exists, err := retryMetadata(ctx, cache.settings, func() (bool, error) {
+		return source.Exists(ctx)
+	})
 	if err != nil {
 		return false, fmt.Errorf("checking cache: %w", err)
 	}
@@ -47,75 +78,242 @@ func (cache *Cache) Get(ctx context.Context, sha256Hash, destPath string, progre
 		return false, nil
 	}
 
-	// Download from cache.
-	reader, totalSize, err := source.Download(ctx, 0)
+	// Ensure destination directory exists.
+	err = ensureDestDir(file.Dest)
 	if err != nil {
-		return false, fmt.Errorf("downloading from cache: %w", err)
+		return false, err
 	}
 
-	defer reader.Close()
+	// The object is restored into the partial the source download uses, so
+	// an interrupted restore is resumed by the next restore or download:
+	// both write the same bytes.
+	partialPath := file.Dest + ".partial"
+	cache.discardStalePartial(ctx, source, partialPath)
+
+	offset, err := cache.restore(ctx, source, file, progress)
+
+	// A resumed partial may have been left by a source download of another
+	// upstream version, so a mismatch proves nothing about the object: the
+	// partial is already discarded, and the restore starts over from 0.
+	if errors.Is(err, errCacheChecksumMismatch) && offset > 0 {
+		_, err = cache.restore(ctx, source, file, progress)
+	}
 
-	// Ensure destination directory exists.
-	err = os.MkdirAll(filepath.Dir(destPath), 0o755)
 	if err != nil {
-		return false, fmt.Errorf("creating destination directory: %w", err)
+		return false, cache.evictCorrupt(ctx, source, err)
 	}
 
-	// Create destination file.
-	file, err := os.Create(destPath)
+	return true, nil
+}
+
+// restore copies the cache object into the partial of the dest of file,
+// resuming the partial, and renames it into place once it matches every
+// checksum of file. It returns the offset it resumed from. A mismatching
+// partial is discarded.
+func (cache *Cache) restore(
+	ctx context.Context,
+	source *storage.S3Source,
+	file config.FileEntry,
+	progress *mpb.Progress,
+) (int64, error) {
+	partialPath := file.Dest + ".partial"
+
+	partial, offset, err := openPartialFile(partialPath)
 	if err != nil {
-		return false, fmt.Errorf("creating destination file: %w", err)
+		return 0, fmt.Errorf("creating destination file: %w", err)
 	}
 
-	defer file.Close()
+	defer partial.Close()
 
-	progressWriter := NewProgressWriter(progress, totalSize, "[cache] "+destPath)
-	defer progressWriter.Abort()
+	// Hash while copying so the restored file is verified without a second read.
+	hasher, err := resumePartialHash(partialPath, file, offset)
+	if err != nil {
+		return offset, err
+	}
 
-	// Copy content.
-	_, err = io.Copy(io.MultiWriter(file, progressWriter), reader)
+	reader, totalSize, err := source.Download(ctx, offset)
 	if err != nil {
-		os.Remove(destPath)
+		return offset, fmt.Errorf("downloading from cache: %w", err)
+	}
+
+	defer reader.Close()
+
+	progressWriter := NewProgressWriter(progress, totalSize, "[cache] "+file.Dest, cache.settings.ProgressSmoothing)
+	defer progressWriter.Abort()
+
+	progressWriter.SetCurrent(offset)
 
-		return false, fmt.Errorf("writing file: %w", err)
+	written, err := io.Copy(io.MultiWriter(partial, hasher, progressWriter), reader)
+	if err != nil {
+		return offset, errors.Join(fmt.Errorf("writing file: %w", err), hasher.save(partialPath))
 	}
 
 	progressWriter.Finish()
 
-	// Verify checksum.
-	valid, err := VerifyFileSHA256(destPath, sha256Hash)
+	err = partial.Close()
+	if err != nil {
+		return offset, fmt.Errorf("closing file: %w", err)
+	}
+
+	err = verifyCacheCopy(offset+written, totalSize, hasher.checksumVerifier, file)
 	if err != nil {
-		os.Remove(destPath)
+		// A cut-off transfer leaves a valid prefix to resume from.
+		if !errors.Is(err, errCacheChecksumMismatch) && !errors.Is(err, errChecksumMismatch) && offset+written < totalSize {
+			return offset, errors.Join(err, hasher.save(partialPath))
+		}
 
-		return false, fmt.Errorf("verifying checksum: %w", err)
+		discardPartial(partialPath)
+
+		return offset, err
+	}
+
+	os.Remove(hashStatePath(partialPath))
+
+	return offset, renamePartial(partialPath, file.Dest)
+}
+
+// discardStalePartial removes a partial that cannot be resumed from the
+// cache object: any partial when resume is disabled, one pre-allocated by a
+// segmented download, and one larger than the object.
+func (cache *Cache) discardStalePartial(ctx context.Context, source *storage.S3Source, partialPath string) {
+	info, err := os.Stat(partialPath)
+	if err != nil {
+		return
 	}
 
-	if !valid {
-		os.Remove(destPath)
+	_, statErr := os.Stat(segment.StatePath(partialPath))
+	if statErr == nil || !cache.settings.IsResume() {
+		discardPartial(partialPath)
 
-		return false, fmt.Errorf("checksum mismatch from cache")
+		return
 	}
 
-	return true, nil
+	size, err := retryMetadata(ctx, cache.settings, func() (int64, error) {
+		return source.GetSize(ctx)
+	})
+	if err == nil && info.Size() > size {
+		discardPartial(partialPath)
+	}
+}
+
+// evictCorrupt implements cache.auto_evict_corrupt. When the whole object
+// was read from the cache and its content does not match its key, it is
+// deleted, so the source download that follows can upload a verified copy.
+// A size mismatch is more likely a cut-off transfer than a corrupt object,
+// and is not evicted. It returns verifyErr, noting the outcome of the
+// eviction.
+func (cache *Cache) evictCorrupt(ctx context.Context, source *storage.S3Source, verifyErr error) error {
+	if !errors.Is(verifyErr, errCacheChecksumMismatch) || !cache.options.IsAutoEvictCorrupt() {
+		return verifyErr
+	}
+
+	err := source.Delete(ctx)
+	if err != nil {
+		return fmt.Errorf("%w, and evicting the object failed: %w", verifyErr, err)
+	}
+
+	return fmt.Errorf("%w, object evicted", verifyErr)
 }
 
-// Put uploads a file to cache with its SHA256 hash as the key.
+// verifyCacheCopy checks a restored cache object against the size reported
+// by the cache, the SHA256 key it was stored under and the other checksums
+// of file. A size of zero or less means the cache did not report one. An
+// object that matches its key but not the other checksums is sound; the
+// checksums of file disagree with each other, so errChecksumMismatch is
+// returned rather than errCacheChecksumMismatch.
+func verifyCacheCopy(written, expectedSize int64, verifier *checksumVerifier, file config.FileEntry) error {
+	if expectedSize > 0 && written != expectedSize {
+		return fmt.Errorf("size mismatch from cache: got %d bytes, expected %d", written, expectedSize)
+	}
+
+	if !verifier.matchesSHA256(file) {
+		return errCacheChecksumMismatch
+	}
+
+	if !verifier.matches() {
+		return fmt.Errorf("%w for %s: the cache object matches its sha256 but not the other checksums",
+			errChecksumMismatch, file.Dest)
+	}
+
+	return nil
+}
+
+// StoredHash returns the SHA256 recorded in the metadata of the cache object
+// for key. It reports false when the object does not exist or was uploaded
+// without the metadata.
+func (cache *Cache) StoredHash(ctx context.Context, key string) (string, bool, error) {
+	source, err := storage.NewS3SourceFromAlias(ctx, cache.alias, cache.options.ObjectKey(key))
+	if err != nil {
+		return "", false, fmt.Errorf("creating S3 source: %w", err)
+	}
+
+	exists, err := retryMetadata(ctx, cache.settings, func() (bool, error) {
+		return source.Exists(ctx)
+	})
+	if err != nil || !exists {
+		return "", false, err
+	}
+
+	metadata, err := retryMetadata(ctx, cache.settings, func() (map[string]string, error) {
+		return source.GetMetadata(ctx)
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("reading cache metadata: %w", err)
+	}
+
+	hash, ok := metadata[cacheHashMetadataKey]
+
+	return hash, ok, nil
+}
+
+// Put uploads a file to cache with its SHA256 hash as the key. Concurrent
+// calls for the same key share one upload, and a key uploaded once is not
+// checked again for the rest of the process.
 func (cache *Cache) Put(ctx context.Context, sha256Hash, sourcePath string) error {
-	source, err := storage.NewS3SourceFromAlias(ctx, cache.alias, sha256Hash)
+	return cache.puts.do(ctx, sha256Hash, func() error {
+		ctx, span := tracing.Start(ctx, "cache.put", tracing.String("xget.sha256", sha256Hash))
+		defer span.End()
+
+		err := cache.put(ctx, sha256Hash, sourcePath)
+		if err != nil {
+			span.RecordError(err)
+		}
+
+		return err
+	})
+}
+
+func (cache *Cache) put(ctx context.Context, sha256Hash, sourcePath string) error {
+	source, err := storage.NewS3SourceFromAlias(ctx, cache.alias, cache.options.ObjectKey(sha256Hash))
 	if err != nil {
 		return fmt.Errorf("creating S3 source: %w", err)
 	}
 
 	// Check if already in cache.
-	exists, err := source.Exists(ctx)
+	exists, err := retryMetadata(ctx, cache.settings, func() (bool, error) {
+		return source.Exists(ctx)
+	})
 	if err != nil {
 		return fmt.Errorf("checking cache: %w", err)
 	}
 
-	if exists {
+	if exists && !cache.options.IsVerifyOnPut() {
 		return nil
 	}
 
+	if exists {
+		reason, err := cache.divergence(ctx, source, sha256Hash, sourcePath)
+		if err != nil {
+			return fmt.Errorf("verifying cache object: %w", err)
+		}
+
+		if reason == "" {
+			return nil
+		}
+
+		fmt.Printf("replacing cache object for %s: %s\n", sourcePath, reason)
+	}
+
 	// Open source file.
 	file, err := os.Open(sourcePath)
 	if err != nil {
@@ -124,11 +322,158 @@ func (cache *Cache) Put(ctx context.Context, sha256Hash, sourcePath string) erro
 
 	defer file.Close()
 
-	// Upload to cache.
-	err = source.Upload(ctx, file)
+	// Upload to cache, recording the hash so cached objects can be checked
+	// for drift without downloading them.
+	err = uploadFile(ctx, cache.settings, source, file, sha256Hash)
 	if err != nil {
 		return fmt.Errorf("uploading to cache: %w", err)
 	}
 
 	return nil
 }
+
+// uploadFile uploads file to source with sha256Hash recorded in its
+// metadata. Failed requests, or failed parts of a large file, are retried
+// as many times and as far apart as s3 downloads, and each retry is logged.
+func uploadFile(
+	ctx context.Context,
+	settings config.Settings,
+	source *storage.S3Source,
+	file *os.File,
+	sha256Hash string,
+) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("checking source file: %w", err)
+	}
+
+	source.SetUploadRetryPolicy(settings.RetriesFor("s3://"), settings.RetryDelay, func(attempt, attempts int, err error) {
+		fmt.Printf("upload attempt %d/%d for %s failed: %v, retrying...\n", attempt, attempts, file.Name(), err)
+	})
+
+	return source.Upload(ctx, file, info.Size(), map[string]string{cacheHashMetadataKey: sha256Hash})
+}
+
+// divergence implements cache.verify_on_put for an existing cache object:
+// it returns why the object does not hold the verified file at sourcePath,
+// or "" when its recorded hash matches the key and its size the file.
+// Objects without a recorded hash cannot be confirmed and are replaced.
+func (cache *Cache) divergence(
+	ctx context.Context,
+	source *storage.S3Source,
+	sha256Hash, sourcePath string,
+) (string, error) {
+	metadata, err := retryMetadata(ctx, cache.settings, func() (map[string]string, error) {
+		return source.GetMetadata(ctx)
+	})
+	if err != nil {
+		return "", fmt.Errorf("reading cache metadata: %w", err)
+	}
+
+	stored, ok := metadata[cacheHashMetadataKey]
+	if !ok {
+		return "no sha256 recorded", nil
+	}
+
+	if stored != sha256Hash {
+		return fmt.Sprintf("sha256 %s recorded", stored), nil
+	}
+
+	size, err := retryMetadata(ctx, cache.settings, func() (int64, error) {
+		return source.GetSize(ctx)
+	})
+	if err != nil {
+		return "", fmt.Errorf("reading cache object size: %w", err)
+	}
+
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("reading file size: %w", err)
+	}
+
+	if size != info.Size() {
+		return fmt.Sprintf("%d bytes cached, %d expected", size, info.Size()), nil
+	}
+
+	return "", nil
+}
+
+// putCall is an upload in progress or done, shared by every Put of its key.
+type putCall struct {
+	done chan struct{}
+	err  error
+}
+
+// putDedup ensures a key is uploaded by only one Put at a time. Files with
+// the same content finishing together would otherwise all pass the Exists
+// check and upload duplicates.
+type putDedup struct {
+	mu    sync.Mutex
+	calls map[string]*putCall
+}
+
+// do runs upload for key unless another call for key is in flight or has
+// succeeded, in which case it waits for and returns that result. A failed
+// upload is forgotten, so a later Put tries again.
+func (dedup *putDedup) do(ctx context.Context, key string, upload func() error) error {
+	dedup.mu.Lock()
+
+	pending, ok := dedup.calls[key]
+	if ok {
+		dedup.mu.Unlock()
+
+		select {
+		case <-pending.done:
+			return pending.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if dedup.calls == nil {
+		dedup.calls = make(map[string]*putCall)
+	}
+
+	call := &putCall{done: make(chan struct{})}
+	dedup.calls[key] = call
+	dedup.mu.Unlock()
+
+	call.err = upload()
+
+	if call.err != nil {
+		dedup.mu.Lock()
+		delete(dedup.calls, key)
+		dedup.mu.Unlock()
+	}
+
+	close(call.done)
+
+	return call.err
+}
+
+// cacheUploads runs cache uploads in the background, at most parallel at a
+// time, so a slow cache does not hold download slots and a busy download
+// queue does not stall cache population.
+type cacheUploads struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newCacheUploads(parallel int) *cacheUploads {
+	return &cacheUploads{slots: make(chan struct{}, max(parallel, 1))}
+}
+
+// start runs upload once a slot is free. It does not block the caller.
+func (uploads *cacheUploads) start(upload func()) {
+	uploads.wg.Go(func() {
+		uploads.slots <- struct{}{}
+		defer func() { <-uploads.slots }()
+
+		upload()
+	})
+}
+
+// wait blocks until every started upload has finished.
+func (uploads *cacheUploads) wait() {
+	uploads.wg.Wait()
+}
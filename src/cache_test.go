@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xget/src/config"
+
+	"github.com/vbauerster/mpb/v8"
+)
+
+func TestVerifyCacheCopy(t *testing.T) {
+	const hash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	tests := []struct {
+		name         string
+		written      int64
+		expectedSize int64
+		content      string
+		md5          string
+		wantInError  string
+	}{
+		{name: "matching size and hash", written: 10, expectedSize: 10},
+		{name: "size unknown", written: 10, expectedSize: 0},
+		{name: "truncated object", written: 5, expectedSize: 10, wantInError: "size mismatch"},
+		{name: "corrupt object", written: 10, expectedSize: 10, content: "abc", wantInError: "checksum mismatch from cache"},
+		{name: "matching md5", written: 10, expectedSize: 10, md5: "d41d8cd98f00b204e9800998ecf8427e"},
+		{name: "stale md5", written: 10, expectedSize: 10, md5: strings.Repeat("0", 32), wantInError: "not the other checksums"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := config.FileEntry{Dest: "file.bin", SHA256: hash, MD5: tt.md5}
+
+			verifier := newChecksumVerifier(file)
+			verifier.Write([]byte(tt.content))
+
+			err := verifyCacheCopy(tt.written, tt.expectedSize, verifier, file)
+			if tt.wantInError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantInError) {
+				t.Errorf("expected error containing %q, got %v", tt.wantInError, err)
+			}
+		})
+	}
+}
+
+func TestCacheUploadsParallelLimit(t *testing.T) {
+	const limit = 2
+
+	uploads := newCacheUploads(limit)
+
+	var running, peak, done atomic.Int32
+
+	for range 8 {
+		uploads.start(func() {
+			current := running.Add(1)
+			for {
+				seen := peak.Load()
+				if current <= seen || peak.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			done.Add(1)
+		})
+	}
+
+	uploads.wait()
+
+	if done.Load() != 8 {
+		t.Errorf("expected 8 uploads to finish before wait returned, got %d", done.Load())
+	}
+
+	if peak.Load() > limit {
+		t.Errorf("expected at most %d concurrent uploads, got %d", limit, peak.Load())
+	}
+}
+
+func TestPutDedup(t *testing.T) {
+	var dedup putDedup
+
+	var uploads atomic.Int32
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	upload := func() error {
+		if uploads.Add(1) == 1 {
+			close(started)
+		}
+
+		<-release
+
+		return nil
+	}
+
+	errs := make(chan error, 5)
+
+	go func() { errs <- dedup.do(context.Background(), "abc", upload) }()
+
+	<-started
+
+	for range 4 {
+		go func() { errs <- dedup.do(context.Background(), "abc", upload) }()
+	}
+
+	// Give the waiting calls time to find the in-flight upload.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	for range 5 {
+		if err := <-errs; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if uploads.Load() != 1 {
+		t.Errorf("expected 1 upload for concurrent puts of one key, got %d", uploads.Load())
+	}
+
+	// A key that succeeded is not uploaded again.
+	_ = dedup.do(context.Background(), "abc", upload)
+
+	if uploads.Load() != 1 {
+		t.Errorf("expected a completed key to be skipped, got %d uploads", uploads.Load())
+	}
+}
+
+func TestPutDedupRetriesAfterFailure(t *testing.T) {
+	var dedup putDedup
+
+	calls := 0
+	failing := func() error {
+		calls++
+
+		return errors.New("upload refused")
+	}
+
+	if err := dedup.do(context.Background(), "abc", failing); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := dedup.do(context.Background(), "abc", failing); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if calls != 2 {
+		t.Errorf("expected a failed upload to be retried, got %d calls", calls)
+	}
+}
+
+func TestPutVerifyOnPut(t *testing.T) {
+	content := []byte("verified download")
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		verifyOnPut string
+		storedHash  string
+		storedSize  int
+		wantUpload  bool
+	}{
+		{name: "matching object", verifyOnPut: "true", storedHash: key, storedSize: len(content)},
+		{name: "poisoned hash", verifyOnPut: "true", storedHash: strings.Repeat("0", 64), storedSize: len(content), wantUpload: true},
+		{name: "truncated object", verifyOnPut: "true", storedHash: key, storedSize: 3, wantUpload: true},
+		{name: "no recorded hash", verifyOnPut: "true", storedSize: len(content), wantUpload: true},
+		{name: "disabled", storedHash: strings.Repeat("0", 64), storedSize: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var uploads atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					_, _ = io.Copy(io.Discard, r.Body)
+
+					uploads.Add(1)
+
+					return
+				}
+
+				if tt.storedHash != "" {
+					w.Header().Set("X-Amz-Meta-Sha256", tt.storedHash)
+				}
+
+				w.Header().Set("Content-Length", strconv.Itoa(tt.storedSize))
+			}))
+			defer server.Close()
+
+			path := filepath.Join(t.TempDir(), "file.bin")
+
+			err := os.WriteFile(path, content, 0o644)
+			if err != nil {
+				t.Fatalf("writing file: %v", err)
+			}
+
+			cache := &Cache{
+				alias: config.Alias{
+					Endpoint: server.URL, Region: "us-east-1", Bucket: "cache", AccessKey: "key", SecretKey: "secret",
+				},
+				options:  config.CacheConfig{VerifyOnPut: tt.verifyOnPut},
+				settings: config.Settings{MetadataRetries: 1},
+			}
+
+			err = cache.Put(context.Background(), key, path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := uploads.Load() == 1; got != tt.wantUpload {
+				t.Errorf("expected upload %t, got %d uploads", tt.wantUpload, uploads.Load())
+			}
+		})
+	}
+}
+
+func TestGetResumesInterruptedRestore(t *testing.T) {
+	content := []byte(strings.Repeat("large cached artifact ", 64))
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+	cut := len(content) / 3
+
+	var (
+		gets   atomic.Int32
+		ranges []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+
+			return
+		}
+
+		ranges = append(ranges, r.Header.Get("Range"))
+
+		// The first restore is cut off after a third of the object.
+		if gets.Add(1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:cut])
+			w.(http.Flusher).Flush()
+
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "object", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	cache := &Cache{
+		alias: config.Alias{
+			Endpoint: server.URL, Region: "us-east-1", Bucket: "cache", AccessKey: "key", SecretKey: "secret",
+		},
+		settings: config.Settings{MetadataRetries: 1},
+	}
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	found, err := cache.Get(context.Background(), config.FileEntry{Dest: dest, SHA256: key}, progress)
+	if found || err == nil {
+		t.Fatalf("expected the cut-off restore to fail, got %v, %v", found, err)
+	}
+
+	if info, statErr := os.Stat(dest + ".partial"); statErr != nil || info.Size() != int64(cut) {
+		t.Fatalf("expected a partial of %d bytes to be kept, got %v, %v", cut, info, statErr)
+	}
+
+	found, err = cache.Get(context.Background(), config.FileEntry{Dest: dest, SHA256: key}, progress)
+	if !found || err != nil {
+		t.Fatalf("expected the resumed restore to succeed, got %v, %v", found, err)
+	}
+
+	if want := fmt.Sprintf("bytes=%d-", cut); len(ranges) != 2 || ranges[1] != want {
+		t.Errorf("expected the second request to ask for %q, got %q", want, ranges)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil || string(got) != string(content) {
+		t.Errorf("expected the restored object, got %d bytes, %v", len(got), err)
+	}
+
+	for _, leftover := range []string{dest + ".partial", hashStatePath(dest + ".partial")} {
+		if _, statErr := os.Stat(leftover); !os.IsNotExist(statErr) {
+			t.Errorf("expected %s to be removed, got %v", leftover, statErr)
+		}
+	}
+}
+
+func TestGetDiscardsForeignPartial(t *testing.T) {
+	content := []byte("cached content of the current version")
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+
+	var (
+		deletes atomic.Int32
+		ranges  []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			deletes.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodHead:
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		default:
+			ranges = append(ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, "object", time.Time{}, strings.NewReader(string(content)))
+		}
+	}))
+	defer server.Close()
+
+	cache := &Cache{
+		alias: config.Alias{
+			Endpoint: server.URL, Region: "us-east-1", Bucket: "cache", AccessKey: "key", SecretKey: "secret",
+		},
+		options:  config.CacheConfig{AutoEvictCorrupt: "true"},
+		settings: config.Settings{MetadataRetries: 1},
+	}
+
+	// A source download of another upstream version left this partial.
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	err := os.WriteFile(dest+".partial", []byte("previous version"), 0o644)
+	if err != nil {
+		t.Fatalf("writing partial: %v", err)
+	}
+
+	found, err := cache.Get(context.Background(), config.FileEntry{Dest: dest, SHA256: key}, mpb.New(mpb.WithOutput(io.Discard)))
+	if !found || err != nil {
+		t.Fatalf("expected the restore to start over and succeed, got %v, %v", found, err)
+	}
+
+	if got := deletes.Load(); got != 0 {
+		t.Errorf("expected the valid object to be kept, got %d deletes", got)
+	}
+
+	if len(ranges) != 2 || ranges[1] != "" {
+		t.Errorf("expected a resumed request and one from the start, got %q", ranges)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil || string(got) != string(content) {
+		t.Errorf("expected the restored object, got %q, %v", got, err)
+	}
+}
+
+func TestGetAutoEvictCorrupt(t *testing.T) {
+	content := []byte("cached content")
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		evict       string
+		body        []byte
+		wantDeletes int32
+		wantInError string
+	}{
+		{name: "corrupt object", evict: "true", body: []byte("poisoned bytes"), wantDeletes: 1, wantInError: "object evicted"},
+		{name: "disabled", body: []byte("poisoned bytes"), wantInError: "checksum mismatch"},
+		{name: "truncated object", evict: "true", body: content[:4], wantInError: "size mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deletes atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodDelete:
+					deletes.Add(1)
+					w.WriteHeader(http.StatusNoContent)
+				case http.MethodHead:
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				default:
+					// The listed size is that of the intact object.
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+					_, _ = w.Write(tt.body)
+				}
+			}))
+			defer server.Close()
+
+			cache := &Cache{
+				alias: config.Alias{
+					Endpoint: server.URL, Region: "us-east-1", Bucket: "cache", AccessKey: "key", SecretKey: "secret",
+				},
+				options:  config.CacheConfig{AutoEvictCorrupt: tt.evict},
+				settings: config.Settings{MetadataRetries: 1},
+			}
+
+			dest := filepath.Join(t.TempDir(), "file.bin")
+			progress := mpb.New(mpb.WithOutput(io.Discard))
+
+			found, err := cache.Get(context.Background(), config.FileEntry{Dest: dest, SHA256: key}, progress)
+			if found || err == nil || !strings.Contains(err.Error(), tt.wantInError) {
+				t.Fatalf("expected a miss with error containing %q, got %v, %v", tt.wantInError, found, err)
+			}
+
+			if got := deletes.Load(); got != tt.wantDeletes {
+				t.Errorf("expected %d deletes, got %d", tt.wantDeletes, got)
+			}
+
+			if _, statErr := os.Stat(dest); !os.IsNotExist(statErr) {
+				t.Errorf("expected the corrupt copy to be removed, got %v", statErr)
+			}
+		})
+	}
+}
+
+func TestGetChecksAllChecksums(t *testing.T) {
+	content := []byte("cached artifact with a stale md5")
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+
+	var deletes atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deletes.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		http.ServeContent(w, r, "object", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	cache := &Cache{
+		alias: config.Alias{
+			Endpoint: server.URL, Region: "us-east-1", Bucket: "cache", AccessKey: "key", SecretKey: "secret",
+		},
+		options:  config.CacheConfig{AutoEvictCorrupt: "true"},
+		settings: config.Settings{MetadataRetries: 1},
+	}
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	file := config.FileEntry{Dest: dest, SHA256: key, MD5: strings.Repeat("0", 32)}
+
+	found, err := cache.Get(context.Background(), file, mpb.New(mpb.WithOutput(io.Discard)))
+	if found || !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v, %v", found, err)
+	}
+
+	_, statErr := os.Stat(dest)
+	if !os.IsNotExist(statErr) {
+		t.Errorf("expected no dest from a restore with a stale md5, got %v", statErr)
+	}
+
+	// The object matches its key, so it is not evicted.
+	if deletes.Load() != 0 {
+		t.Error("expected the object to be kept")
+	}
+}
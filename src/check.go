@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"xget/src/config"
+)
+
+// runCheck validates the structure of the configs without expanding
+// environment variables in aliases, so configs can be linted where the
+// credentials they reference are not available. Nothing is contacted.
+func runCheck() int {
+	configPaths := os.Args[2:]
+	if len(configPaths) == 0 {
+		fmt.Fprintf(os.Stderr, "error: check command requires at least one config file\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s check <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
+
+		return 1
+	}
+
+	cfg, err := config.CheckMultiple(configPaths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+
+		return 1
+	}
+
+	refs := cfg.AliasEnvRefs()
+	if len(refs) > 0 {
+		fmt.Println("\nresolved at run time, not checked:")
+
+		for _, ref := range refs {
+			fmt.Printf("  %s\n", ref)
+		}
+	}
+
+	fmt.Printf("\nconfig OK: %d files, %d aliases\n", len(cfg.Files), len(cfg.Aliases))
+
+	return 0
+}
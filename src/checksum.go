@@ -1,12 +1,18 @@
 package main
 
 import (
+	"crypto/md5"  //nolint:gosec // md5 is only checked next to sha256, for legacy manifests
+	"crypto/sha1" //nolint:gosec // sha1 is accepted for interop with tools that publish nothing else
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
 	"os"
+	"path/filepath"
+
+	"xget/src/config"
 )
 
 // VerifyFileSHA256 checks if a file matches the expected SHA256 hash.
@@ -30,6 +36,112 @@ func VerifyFileSHA256(path, expectedHash string) (bool, error) {
 	return actualHash == expectedHash, nil
 }
 
+// VerifyFileChecksums checks if a file matches every checksum of file, e.g.
+// both its sha256 and md5, hashing it in a single pass.
+func VerifyFileChecksums(path string, file config.FileEntry) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("opening file: %w", err)
+	}
+
+	defer f.Close()
+
+	verifier := newChecksumVerifier(file)
+
+	_, err = io.Copy(verifier, f)
+	if err != nil {
+		return false, fmt.Errorf("reading file: %w", err)
+	}
+
+	return verifier.matches(), nil
+}
+
+// checksumVerifier hashes written data with every algorithm a file entry has
+// a checksum for.
+type checksumVerifier struct {
+	writer io.Writer
+	hashes []expectedHash
+}
+
+// expectedHash is one running hash and the hex digest it must end with.
+type expectedHash struct {
+	hash     hash.Hash
+	expected string
+}
+
+// newChecksumVerifier returns a verifier for every checksum of file. The
+// sha256, if any, is always the first of its hashes.
+func newChecksumVerifier(file config.FileEntry) *checksumVerifier {
+	verifier := &checksumVerifier{}
+
+	if file.SHA256 != "" {
+		verifier.hashes = append(verifier.hashes, expectedHash{hash: sha256.New(), expected: file.SHA256})
+	}
+
+	if file.SHA512 != "" {
+		verifier.hashes = append(verifier.hashes, expectedHash{hash: sha512.New(), expected: file.SHA512})
+	}
+
+	if file.SHA1 != "" {
+		sha1Hash := sha1.New() //nolint:gosec // see import
+		verifier.hashes = append(verifier.hashes, expectedHash{hash: sha1Hash, expected: file.SHA1})
+	}
+
+	if file.MD5 != "" {
+		md5Hash := md5.New() //nolint:gosec // see import
+		verifier.hashes = append(verifier.hashes, expectedHash{hash: md5Hash, expected: file.MD5})
+	}
+
+	writers := make([]io.Writer, 0, len(verifier.hashes))
+	for _, expected := range verifier.hashes {
+		writers = append(writers, expected.hash)
+	}
+
+	verifier.writer = io.MultiWriter(writers...)
+
+	return verifier
+}
+
+// Write implements io.Writer.
+func (verifier *checksumVerifier) Write(p []byte) (int, error) {
+	return verifier.writer.Write(p)
+}
+
+// matches reports whether every hash ended with its expected digest.
+func (verifier *checksumVerifier) matches() bool {
+	for _, expected := range verifier.hashes {
+		if hex.EncodeToString(expected.hash.Sum(nil)) != expected.expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesSHA256 reports whether the data hashed to the sha256 of its file,
+// ignoring the other checksums. A file without a sha256 never matches.
+func (verifier *checksumVerifier) matchesSHA256(file config.FileEntry) bool {
+	if file.SHA256 == "" || len(verifier.hashes) == 0 {
+		return false
+	}
+
+	return hex.EncodeToString(verifier.hashes[0].hash.Sum(nil)) == file.SHA256
+}
+
+// writeChecksumSidecar writes dest.sha256 in sha256sum format, so the file
+// can be checked independently with `sha256sum -c`. The hash is the already
+// verified one, so the file is not read again.
+func writeChecksumSidecar(dest, sha256Hash string) error {
+	line := sha256Hash + "  " + filepath.Base(dest) + "\n"
+
+	err := os.WriteFile(dest+".sha256", []byte(line), 0o644) //nolint:gosec // sidecar is as readable as the file
+	if err != nil {
+		return fmt.Errorf("writing checksum sidecar: %w", err)
+	}
+
+	return nil
+}
+
 // SHA256Writer wraps a writer and computes SHA256 hash of written data.
 type SHA256Writer struct {
 	writer io.Writer
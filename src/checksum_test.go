@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestWriteChecksumSidecar(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "app.tar.gz")
+	hash := "3a7bd3e2360a3d29eea436fcfb7e44c735d117c42d1c1835420b6b9942dd4f1b"
+
+	err := writeChecksumSidecar(dest, hash)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(dest + ".sha256")
+	if err != nil {
+		t.Fatalf("reading sidecar: %v", err)
+	}
+
+	want := hash + "  app.tar.gz\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+}
+
+func TestVerifyFileChecksums(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+
+	err := os.WriteFile(path, []byte("hello"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		sha256Hello = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+		md5Hello    = "5d41402abc4b2a76b9719d911017c592"
+		md5Other    = "d41d8cd98f00b204e9800998ecf8427e"
+		sha512Hello = "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca7" +
+			"2323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"
+		sha1Hello = "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"
+	)
+
+	tests := []struct {
+		name string
+		file config.FileEntry
+		want bool
+	}{
+		{"sha256 only", config.FileEntry{SHA256: sha256Hello}, true},
+		{"md5 only", config.FileEntry{MD5: md5Hello}, true},
+		{"both match", config.FileEntry{SHA256: sha256Hello, MD5: md5Hello}, true},
+		{"md5 mismatch", config.FileEntry{SHA256: sha256Hello, MD5: md5Other}, false},
+		{"sha256 mismatch", config.FileEntry{SHA256: sha256Hex("other"), MD5: md5Hello}, false},
+		{"sha512 only", config.FileEntry{SHA512: sha512Hello}, true},
+		{"sha1 only", config.FileEntry{SHA1: sha1Hello}, true},
+		{"sha1 mismatch", config.FileEntry{SHA512: sha512Hello, SHA1: strings.Repeat("0", 40)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyFileChecksums(path, tt.file)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
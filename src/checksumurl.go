@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"xget/src/tracing"
+)
+
+// maxChecksumFileSize caps how much of a checksum file is read, so a
+// misconfigured sha256_url pointing at the artifact itself is not downloaded.
+const maxChecksumFileSize = 1 << 20
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// checksumCacheEntry is a checksum resolved from a sha256_url, with the ETag
+// it was served under.
+type checksumCacheEntry struct {
+	ETag   string `json:"etag"`
+	SHA256 string `json:"sha256"`
+}
+
+// checksumCache persists resolved checksums across runs, keyed by checksum
+// URL and file name. Entries are revalidated with If-None-Match, so a cached
+// checksum is reused until the checksum file changes.
+type checksumCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]checksumCacheEntry
+	dirty   bool
+}
+
+// loadChecksumCache reads the cache at cachePath. A missing or unreadable
+// cache starts empty; it is only an optimization.
+func loadChecksumCache(cachePath string) *checksumCache {
+	cache := &checksumCache{path: cachePath, entries: make(map[string]checksumCacheEntry)}
+
+	data, err := os.ReadFile(cachePath) //nolint:gosec // path is from config
+	if err == nil {
+		_ = json.Unmarshal(data, &cache.entries)
+	}
+
+	return cache
+}
+
+// defaultChecksumCachePath returns the checksum cache location used when
+// settings.checksum_cache is unset.
+func defaultChecksumCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "xget", "checksums.json")
+}
+
+// urlBasename returns the last element of the URL path, ignoring any query.
+func urlBasename(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return path.Base(rawURL)
+	}
+
+	return path.Base(parsed.Path)
+}
+
+func checksumCacheKey(checksumURL, name string) string {
+	return checksumURL + "#" + name
+}
+
+func (cache *checksumCache) get(key string) (checksumCacheEntry, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[key]
+
+	return entry, ok
+}
+
+func (cache *checksumCache) put(key string, entry checksumCacheEntry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.entries[key] != entry {
+		cache.entries[key] = entry
+		cache.dirty = true
+	}
+}
+
+// save writes the cache back to disk if any entry changed.
+func (cache *checksumCache) save() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if !cache.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(cache.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling checksum cache: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(cache.path), 0o755)
+	if err != nil {
+		return fmt.Errorf("creating checksum cache directory: %w", err)
+	}
+
+	err = os.WriteFile(cache.path, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing checksum cache: %w", err)
+	}
+
+	cache.dirty = false
+
+	return nil
+}
+
+// checksumResolver resolves sha256_url entries into checksums.
+type checksumResolver struct {
+	client *http.Client
+	cache  *checksumCache
+
+	// headers are settings.http_headers, sent with every checksum request.
+	headers map[string]string
+}
+
+func newChecksumResolver(cachePath string, timeout time.Duration) *checksumResolver {
+	return &checksumResolver{
+		client: &http.Client{Timeout: timeout, Transport: tracing.WrapTransport(http.DefaultTransport)},
+		cache:  loadChecksumCache(cachePath),
+	}
+}
+
+// resolve returns the checksum for the file named name from the checksum file
+// at checksumURL. A cached checksum is sent with its ETag and reused when the
+// server answers 304 Not Modified.
+func (resolver *checksumResolver) resolve(ctx context.Context, checksumURL, name string) (string, error) {
+	key := checksumCacheKey(checksumURL, name)
+	cached, hasCached := resolver.cache.get(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checksumURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("creating checksum request: %w", err)
+	}
+
+	for name, value := range resolver.headers {
+		req.Header.Set(name, value)
+	}
+
+	if hasCached && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := resolver.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching checksum %s: %w", redactURL(checksumURL), err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && hasCached {
+		return cached.SHA256, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching checksum %s: unexpected status code: %d", redactURL(checksumURL), resp.StatusCode)
+	}
+
+	sha, err := parseChecksumFile(io.LimitReader(resp.Body, maxChecksumFileSize), name)
+	if err != nil {
+		return "", fmt.Errorf("parsing checksum %s: %w", redactURL(checksumURL), err)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag != "" {
+		resolver.cache.put(key, checksumCacheEntry{ETag: etag, SHA256: sha})
+	}
+
+	return sha, nil
+}
+
+// resolveCached returns the checksum for name cached from an earlier
+// resolution of checksumURL, without contacting the server, for -offline.
+func (resolver *checksumResolver) resolveCached(checksumURL, name string) (string, error) {
+	cached, ok := resolver.cache.get(checksumCacheKey(checksumURL, name))
+	if !ok {
+		return "", fmt.Errorf("%w: no cached checksum from %s", errNotCached, redactURL(checksumURL))
+	}
+
+	return cached.SHA256, nil
+}
+
+// parseChecksumFile extracts the SHA256 for name from a checksum file. It
+// accepts a bare hash, or sha256sum output ("<hash>  <file>") where the line
+// whose file name matches name is used.
+func parseChecksumFile(reader io.Reader, name string) (string, error) {
+	scanner := bufio.NewScanner(reader)
+
+	var lines [][]string
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return "", fmt.Errorf("reading checksum file: %w", err)
+	}
+
+	if len(lines) == 1 && len(lines[0]) == 1 {
+		return validChecksum(lines[0][0])
+	}
+
+	for _, fields := range lines {
+		if len(fields) < 2 {
+			continue
+		}
+
+		// sha256sum marks binary-mode entries with a leading '*'.
+		if path.Base(strings.TrimPrefix(fields[len(fields)-1], "*")) == name {
+			return validChecksum(fields[0])
+		}
+	}
+
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+func validChecksum(value string) (string, error) {
+	if !sha256Pattern.MatchString(value) {
+		return "", fmt.Errorf("invalid sha256 %q", value)
+	}
+
+	return strings.ToLower(value), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testSHA1 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	testSHA2 = "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+)
+
+func TestParseChecksumFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		file        string
+		want        string
+		expectError bool
+	}{
+		{name: "bare hash", content: testSHA1 + "\n", file: "tool.tar.gz", want: testSHA1},
+		{
+			name:    "sha256sum listing",
+			content: testSHA1 + "  other.zip\n" + testSHA2 + "  tool.tar.gz\n",
+			file:    "tool.tar.gz",
+			want:    testSHA2,
+		},
+		{name: "binary mode marker", content: testSHA2 + " *dist/tool.tar.gz\n", file: "tool.tar.gz", want: testSHA2},
+		{name: "uppercase normalized", content: strings.ToUpper(testSHA1), file: "x", want: testSHA1},
+		{name: "file not listed", content: testSHA1 + "  other.zip\n", file: "tool.tar.gz", expectError: true},
+		{name: "not a hash", content: "not-a-hash\n", file: "tool.tar.gz", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChecksumFile(strings.NewReader(tt.content), tt.file)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestChecksumResolverCachesByETag(t *testing.T) {
+	var fullResponses atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		fullResponses.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(testSHA1 + "  tool.tar.gz\n"))
+	}))
+	defer server.Close()
+
+	cachePath := filepath.Join(t.TempDir(), "checksums.json")
+
+	for run := range 2 {
+		resolver := newChecksumResolver(cachePath, 5*time.Second)
+
+		got, err := resolver.resolve(context.Background(), server.URL+"/SHA256SUMS", "tool.tar.gz")
+		if err != nil {
+			t.Fatalf("run %d: unexpected error: %v", run, err)
+		}
+
+		if got != testSHA1 {
+			t.Errorf("run %d: expected %s, got %s", run, testSHA1, got)
+		}
+
+		err = resolver.cache.save()
+		if err != nil {
+			t.Fatalf("run %d: unexpected error saving cache: %v", run, err)
+		}
+	}
+
+	if got := fullResponses.Load(); got != 1 {
+		t.Errorf("expected the second run to be served from cache, got %d full responses", got)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ciProgressInterval is how often progress_mode=ci reports progress.
+const ciProgressInterval = 2 * time.Second
+
+// ciProgress reports aggregate download progress as plain "PROGRESS: <n>"
+// lines, which some CI systems render as a progress widget. Totals grow as
+// downloads start, so the percentage covers the bytes of started downloads.
+type ciProgress struct {
+	out   io.Writer
+	total atomic.Int64
+	done  atomic.Int64
+
+	mu   sync.Mutex
+	last int
+}
+
+func newCIProgress(out io.Writer) *ciProgress {
+	return &ciProgress{out: out, last: -1}
+}
+
+// AddTotal implements segment.ProgressTap.
+func (progress *ciProgress) AddTotal(total int64) {
+	progress.total.Add(total)
+}
+
+// AddDone implements segment.ProgressTap.
+func (progress *ciProgress) AddDone(done int64) {
+	progress.done.Add(done)
+}
+
+// percent returns the overall completion in whole percent, clamped to 0..100.
+func (progress *ciProgress) percent() int {
+	total := progress.total.Load()
+	if total <= 0 {
+		return 0
+	}
+
+	return int(min(max(progress.done.Load()*100/total, 0), 100))
+}
+
+// report prints the current percentage unless it is unchanged since the
+// last line, so a stalled download does not flood the CI log.
+func (progress *ciProgress) report() {
+	progress.print(progress.percent())
+}
+
+// finish prints the final percentage. A run that transferred nothing, e.g.
+// because every file was already present or cached, is complete.
+func (progress *ciProgress) finish() {
+	if progress.total.Load() <= 0 {
+		progress.print(100)
+
+		return
+	}
+
+	progress.report()
+}
+
+func (progress *ciProgress) print(percent int) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	if percent == progress.last {
+		return
+	}
+
+	progress.last = percent
+
+	fmt.Fprintf(progress.out, "PROGRESS: %d\n", percent)
+}
+
+// start reports every interval until the returned stop function is called.
+// stop prints the final line and returns once reporting has ended.
+func (progress *ciProgress) start(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		for {
+			select {
+			case <-ticker.C:
+				progress.report()
+			case <-done:
+				return
+			}
+		}
+	})
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		wg.Wait()
+		progress.finish()
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCIProgressReport(t *testing.T) {
+	var out bytes.Buffer
+
+	progress := newCIProgress(&out)
+
+	progress.AddTotal(200)
+	progress.AddDone(50)
+	progress.report()
+	progress.report() // unchanged, not printed again
+
+	progress.AddDone(150)
+	progress.report()
+
+	want := "PROGRESS: 25\nPROGRESS: 100\n"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestCIProgressAbortedBarWithdraws(t *testing.T) {
+	progress := newCIProgress(&bytes.Buffer{})
+
+	// A first attempt that fails halfway must not count towards the retry.
+	progress.AddTotal(100)
+	progress.AddDone(50)
+	progress.AddDone(-50)
+	progress.AddTotal(-100)
+
+	progress.AddTotal(100)
+	progress.AddDone(100)
+
+	if got := progress.percent(); got != 100 {
+		t.Errorf("expected 100, got %d", got)
+	}
+}
+
+func TestCIProgressStopNothingTransferred(t *testing.T) {
+	var out bytes.Buffer
+
+	stop := newCIProgress(&out).start(time.Hour)
+	stop()
+
+	if out.String() != "PROGRESS: 100\n" {
+		t.Errorf("expected a final 100, got %q", out.String())
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// defaultS3Host is the host checked against settings.allowed_hosts for
+// aliases that use AWS S3 rather than a custom endpoint.
+const defaultS3Host = "s3.amazonaws.com"
+
+// allowedSchemeValues are the schemes settings.allowed_schemes may list.
+var allowedSchemeValues = []string{"http", "https", "s3", "data"}
+
+// CheckURLAllowed returns an error if rawURL's scheme is not listed in
+// settings.allowed_schemes, or, for http and https URLs, if its host is not
+// listed in settings.allowed_hosts. An empty list allows everything.
+func (settings Settings) CheckURLAllowed(rawURL string) error {
+	// Stdin is local input, not an origin.
+	if rawURL == StdinURL {
+		return nil
+	}
+
+	// A data: URL carries its content, so it has no host to check, and its
+	// base64 may be wrapped over lines url.Parse rejects.
+	if IsDataURL(rawURL) {
+		return settings.checkSchemeAllowed("data")
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing url: %w", err)
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+
+	err = settings.checkSchemeAllowed(scheme)
+	if err != nil {
+		return err
+	}
+
+	// The host of an s3:// URL is an alias name; its endpoint is checked
+	// separately by CheckHostAllowed.
+	if scheme == "s3" {
+		return nil
+	}
+
+	return settings.CheckHostAllowed(parsed.Hostname())
+}
+
+// checkSchemeAllowed returns an error if scheme is not listed in
+// settings.allowed_schemes. An empty list allows every scheme.
+func (settings Settings) checkSchemeAllowed(scheme string) error {
+	if len(settings.AllowedSchemes) > 0 && !slices.Contains(settings.AllowedSchemes, scheme) {
+		return fmt.Errorf("scheme %q is not in settings.allowed_schemes", scheme)
+	}
+
+	return nil
+}
+
+// CheckHostAllowed returns an error if host does not match any entry of
+// settings.allowed_hosts. Entries match exactly, or as "*.example.com" to
+// allow any subdomain of example.com.
+func (settings Settings) CheckHostAllowed(host string) error {
+	if len(settings.AllowedHosts) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(host)
+
+	for _, allowed := range settings.AllowedHosts {
+		suffix, ok := strings.CutPrefix(allowed, "*")
+		if ok {
+			if strings.HasSuffix(host, suffix) {
+				return nil
+			}
+
+			continue
+		}
+
+		if host == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("host %q is not in settings.allowed_hosts", host)
+}
+
+// aliasHost returns the host S3 requests for alias are sent to.
+func aliasHost(alias Alias) (string, error) {
+	if alias.Endpoint == "" {
+		return defaultS3Host, nil
+	}
+
+	parsed, err := url.Parse(alias.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("parsing endpoint: %w", err)
+	}
+
+	return parsed.Hostname(), nil
+}
+
+// validateAllowlist checks settings.allowed_schemes and settings.allowed_hosts
+// against every alias endpoint and file URL, so a config that would reach an
+// unapproved origin is rejected before anything is downloaded.
+func validateAllowlist(cfg *Config) error {
+	for _, scheme := range cfg.Settings.AllowedSchemes {
+		if !slices.Contains(allowedSchemeValues, scheme) {
+			return fmt.Errorf("settings.allowed_schemes: unknown scheme %q, must be one of %q", scheme, allowedSchemeValues)
+		}
+	}
+
+	for name, alias := range cfg.Aliases {
+		if cfg.checkOnly && envVarPattern.MatchString(alias.Endpoint) {
+			continue
+		}
+
+		host, err := aliasHost(alias)
+		if err != nil {
+			return fmt.Errorf("alias %q: %w", name, err)
+		}
+
+		err = cfg.Settings.CheckHostAllowed(host)
+		if err != nil {
+			return fmt.Errorf("alias %q: %w", name, err)
+		}
+	}
+
+	for i, file := range cfg.Files {
+		for j, part := range file.Parts {
+			err := cfg.Settings.CheckURLAllowed(part.URL)
+			if err != nil {
+				return fmt.Errorf("file %d: part %d: url: %w", i, j+1, err)
+			}
+		}
+
+		if len(file.Parts) > 0 {
+			continue
+		}
+
+		err := cfg.Settings.CheckURLAllowed(file.URL)
+		if err != nil {
+			return fmt.Errorf("file %d: url: %w", i, err)
+		}
+
+		if file.SHA256URL == "" {
+			continue
+		}
+
+		err = cfg.Settings.CheckURLAllowed(file.SHA256URL)
+		if err != nil {
+			return fmt.Errorf("file %d: sha256_url: %w", i, err)
+		}
+	}
+
+	return nil
+}
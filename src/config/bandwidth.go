@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseBandwidthSetting expands env vars in the settings.per_host_bandwidth
+// rates and parses them as bytes per second, keyed by lowercase host.
+func parseBandwidthSetting(raw map[string]string, target *map[string]int64) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	limits := make(map[string]int64, len(raw))
+
+	for host, rate := range raw {
+		host = strings.ToLower(strings.TrimSpace(host))
+		value := strings.TrimSpace(expandEnvVars(rate))
+
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing settings.per_host_bandwidth.%s %q: %w", host, value, err)
+		}
+
+		limits[host] = parsed
+	}
+
+	*target = limits
+
+	return nil
+}
+
+// validateBandwidth rejects rates that would stall every download of a host.
+func validateBandwidth(settings *Settings) error {
+	for host, rate := range settings.PerHostBandwidth {
+		if rate <= 0 {
+			return fmt.Errorf("settings.per_host_bandwidth.%s must be positive, got %d", host, rate)
+		}
+	}
+
+	return nil
+}
+
+// HostBandwidth returns the origin host of rawURL, the alias endpoint for
+// s3:// URLs, and its settings.per_host_bandwidth rate in bytes per second,
+// or 0 when the host is not limited.
+func (config *Config) HostBandwidth(rawURL string) (string, int64) {
+	if len(config.Settings.PerHostBandwidth) == 0 {
+		return "", 0
+	}
+
+	host := config.sourceHost(rawURL)
+	if host == "" {
+		return "", 0
+	}
+
+	return host, config.Settings.PerHostBandwidth[host]
+}
+
+// sourceHost returns the lowercase host requests for rawURL are sent to,
+// or "" when it cannot be determined.
+func (config *Config) sourceHost(rawURL string) string {
+	aliasName, _, ok := splitS3URL(rawURL)
+	if ok {
+		alias, exists := config.Aliases[aliasName]
+		if !exists {
+			return ""
+		}
+
+		host, err := aliasHost(alias)
+		if err != nil {
+			return ""
+		}
+
+		return strings.ToLower(host)
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(parsed.Hostname())
+}
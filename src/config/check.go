@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// CheckMultiple reads, merges and validates configs like LoadMultiple, but
+// leaves environment variables in aliases unexpanded. Configs can then be
+// linted where the credentials and endpoints they reference are not
+// available. Alias fields holding a ${VAR} reference are not validated; see
+// AliasEnvRefs.
+func CheckMultiple(paths []string) (*Config, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no config files specified")
+	}
+
+	var baseConfig *Config
+
+	for _, path := range paths {
+		cfg, err := checkWithoutValidation(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+
+		if baseConfig == nil {
+			baseConfig = cfg
+
+			continue
+		}
+
+		mergeConfigs(baseConfig, cfg)
+	}
+
+	baseConfig.checkOnly = true
+
+	err := applyCredentialsFile(baseConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	applyDefaults(baseConfig)
+
+	err = validate(baseConfig)
+	if err != nil {
+		return nil, fmt.Errorf("validating merged config: %w", err)
+	}
+
+	return baseConfig, nil
+}
+
+func checkWithoutValidation(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	return decodeConfig(data)
+}
+
+// AliasEnvRefs lists the alias fields that hold a ${VAR} reference, as
+// "aliases.<name>.<field>: <value>" sorted by alias and field. For a config
+// from CheckMultiple these are the values resolved only at run time.
+func (config *Config) AliasEnvRefs() []string {
+	var refs []string
+
+	for name, alias := range config.Aliases {
+		for _, field := range aliasFields(alias) {
+			if envVarPattern.MatchString(field.value) {
+				refs = append(refs, fmt.Sprintf("aliases.%s.%s: %s", name, field.name, field.value))
+			}
+		}
+	}
+
+	sort.Strings(refs)
+
+	return refs
+}
+
+type aliasField struct {
+	name  string
+	value string
+}
+
+func aliasFields(alias Alias) []aliasField {
+	return []aliasField{
+		{name: "endpoint", value: alias.Endpoint},
+		{name: "region", value: alias.Region},
+		{name: "bucket", value: alias.Bucket},
+		{name: "prefix", value: alias.Prefix},
+		{name: "access_key", value: alias.AccessKey},
+		{name: "secret_key", value: alias.SecretKey},
+		{name: "no_sign_request", value: alias.NoSignRequest},
+		{name: "timeout", value: alias.Timeout},
+		{name: "connect_timeout", value: alias.ConnectTimeout},
+		{name: "fallback_alias", value: alias.FallbackAlias},
+		{name: "credential_process", value: alias.CredentialProcess},
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -14,8 +18,14 @@ const (
 	defaultRetries         = 3
 	defaultRetryDelay      = 5 * time.Second
 	defaultTimeout         = 10 * time.Minute
+	defaultConnectTimeout  = 30 * time.Second
 	defaultSegmentsPerFile = 4
 	defaultSegmentMinSize  = 10 * 1024 * 1024 // 10 MB.
+
+	defaultMetadataRetries    = 3
+	defaultMetadataRetryDelay = 500 * time.Millisecond
+
+	defaultMinSpeedWindow = time.Minute
 )
 
 // Load reads and parses a YAML config file.
@@ -46,6 +56,11 @@ func Load(path string) (*Config, error) {
 		expandFileEntryEnvVars(&cfg.Files[i])
 	}
 
+	err = applyCredentialsFile(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Apply defaults.
 	applyDefaults(&cfg)
 
@@ -66,20 +81,14 @@ func LoadMultiple(paths []string) (*Config, error) {
 		return nil, fmt.Errorf("no config files specified")
 	}
 
-	// Load first config without validation.
-	baseConfig, err := loadWithoutValidation(paths[0])
+	baseConfig, err := loadMerged(paths)
 	if err != nil {
-		return nil, fmt.Errorf("loading %s: %w", paths[0], err)
+		return nil, err
 	}
 
-	// Merge remaining configs.
-	for _, path := range paths[1:] {
-		cfg, err := loadWithoutValidation(path)
-		if err != nil {
-			return nil, fmt.Errorf("loading %s: %w", path, err)
-		}
-
-		mergeConfigs(baseConfig, cfg)
+	err = applyCredentialsFile(baseConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	// Apply defaults.
@@ -94,6 +103,62 @@ func LoadMultiple(paths []string) (*Config, error) {
 	return baseConfig, nil
 }
 
+// LoadRetry loads the configs at paths for their aliases, cache and
+// settings, but downloads only the files of reportPath, a failure report
+// written by an earlier run. The files of the configs are ignored, and
+// paths may be empty when the report needs no aliases.
+func LoadRetry(paths []string, reportPath string) (*Config, error) {
+	report, err := loadWithoutValidation(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", reportPath, err)
+	}
+
+	baseConfig := &Config{}
+
+	if len(paths) > 0 {
+		baseConfig, err = loadMerged(paths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	baseConfig.Files = report.Files
+
+	err = applyCredentialsFile(baseConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	applyDefaults(baseConfig)
+
+	err = validate(baseConfig)
+	if err != nil {
+		return nil, fmt.Errorf("validating retry config: %w", err)
+	}
+
+	return baseConfig, nil
+}
+
+// loadMerged loads paths without validation, merging later configs into
+// the first.
+func loadMerged(paths []string) (*Config, error) {
+	baseConfig, err := loadWithoutValidation(paths[0])
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", paths[0], err)
+	}
+
+	for _, path := range paths[1:] {
+		cfg, err := loadWithoutValidation(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+
+		mergeConfigs(baseConfig, cfg)
+	}
+
+	return baseConfig, nil
+}
+
 // ParseMultiple parses and merges multiple YAML config contents.
 // Later configs override earlier ones for aliases, cache, and settings.
 // Files are accumulated across all configs.
@@ -118,6 +183,11 @@ func ParseMultiple(configs [][]byte) (*Config, error) {
 		mergeConfigs(baseConfig, cfg)
 	}
 
+	err = applyCredentialsFile(baseConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	// Apply defaults.
 	applyDefaults(baseConfig)
 
@@ -140,11 +210,9 @@ func loadWithoutValidation(path string) (*Config, error) {
 }
 
 func parseWithoutValidation(data []byte) (*Config, error) {
-	var cfg Config
-
-	err := yaml.Unmarshal(data, &cfg)
+	cfg, err := decodeConfig(data)
 	if err != nil {
-		return nil, fmt.Errorf("parsing config: %w", err)
+		return nil, err
 	}
 
 	// Expand environment variables in aliases.
@@ -153,6 +221,19 @@ func parseWithoutValidation(data []byte) (*Config, error) {
 		cfg.Aliases[name] = alias
 	}
 
+	return cfg, nil
+}
+
+// decodeConfig parses data and expands environment variables everywhere but
+// in aliases, which may reference credentials.
+func decodeConfig(data []byte) (*Config, error) {
+	var cfg Config
+
+	err := yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+
 	// Expand environment variables in cache config.
 	expandCacheEnvVars(&cfg.Cache)
 
@@ -181,6 +262,26 @@ func mergeConfigs(base *Config, override *Config) {
 		base.Cache.Enabled = override.Cache.Enabled
 	}
 
+	if override.Cache.UploadParallel != "" {
+		base.Cache.UploadParallel = override.Cache.UploadParallel
+	}
+
+	if override.Cache.VerifyExisting != "" {
+		base.Cache.VerifyExisting = override.Cache.VerifyExisting
+	}
+
+	if override.Cache.VerifyOnPut != "" {
+		base.Cache.VerifyOnPut = override.Cache.VerifyOnPut
+	}
+
+	if override.Cache.AutoEvictCorrupt != "" {
+		base.Cache.AutoEvictCorrupt = override.Cache.AutoEvictCorrupt
+	}
+
+	if override.Cache.KeyLayout != "" {
+		base.Cache.KeyLayout = override.Cache.KeyLayout
+	}
+
 	mergeSettings(&base.Settings, &override.Settings)
 
 	// Accumulate files.
@@ -196,6 +297,14 @@ func mergeSettings(base *Settings, override *Settings) {
 		base.Retries = override.Retries
 	}
 
+	if override.HTTPRetries > 0 {
+		base.HTTPRetries = override.HTTPRetries
+	}
+
+	if override.S3Retries > 0 {
+		base.S3Retries = override.S3Retries
+	}
+
 	if override.RetryDelay > 0 {
 		base.RetryDelay = override.RetryDelay
 	}
@@ -212,9 +321,207 @@ func mergeSettings(base *Settings, override *Settings) {
 		base.SegmentMinSize = override.SegmentMinSize
 	}
 
+	mergeTuningSettings(base, override)
+	mergeToggleSettings(base, override)
+}
+
+// mergeTuningSettings merges the numeric settings added on top of the core
+// download settings, where a zero override keeps the base value.
+func mergeTuningSettings(base *Settings, override *Settings) {
+	if override.MaxErrors > 0 {
+		base.MaxErrors = override.MaxErrors
+	}
+
+	if override.VerifyParallel > 0 {
+		base.VerifyParallel = override.VerifyParallel
+	}
+
+	if override.PerAliasParallel > 0 {
+		base.PerAliasParallel = override.PerAliasParallel
+	}
+
+	if override.MaxOpenFiles > 0 {
+		base.MaxOpenFiles = override.MaxOpenFiles
+	}
+
+	if override.ProgressSmoothing > 0 {
+		base.ProgressSmoothing = override.ProgressSmoothing
+	}
+
+	if override.ProgressRefresh > 0 {
+		base.ProgressRefresh = override.ProgressRefresh
+	}
+
+	if override.ConnectTimeout > 0 {
+		base.ConnectTimeout = override.ConnectTimeout
+	}
+
+	if override.ParallelSmall > 0 {
+		base.ParallelSmall = override.ParallelSmall
+	}
+
+	if override.ParallelLarge > 0 {
+		base.ParallelLarge = override.ParallelLarge
+	}
+
+	if override.SizeThreshold > 0 {
+		base.SizeThreshold = override.SizeThreshold
+	}
+
+	if override.MinFreeSpace > 0 {
+		base.MinFreeSpace = override.MinFreeSpace
+	}
+
+	if override.MinSpeed > 0 {
+		base.MinSpeed = override.MinSpeed
+	}
+
+	if override.MinSpeedWindow > 0 {
+		base.MinSpeedWindow = override.MinSpeedWindow
+	}
+
+	if override.MaxAge > 0 {
+		base.MaxAge = override.MaxAge
+	}
+
+	if override.MetadataRetries > 0 {
+		base.MetadataRetries = override.MetadataRetries
+	}
+
+	if override.MetadataRetryDelay > 0 {
+		base.MetadataRetryDelay = override.MetadataRetryDelay
+	}
+}
+
+// mergeToggleSettings merges the string-valued settings, where an empty
+// override keeps the base value.
+func mergeToggleSettings(base *Settings, override *Settings) {
 	if override.SingleStream != "" {
 		base.SingleStream = override.SingleStream
 	}
+
+	if override.Resume != "" {
+		base.Resume = override.Resume
+	}
+
+	if override.SkipIfNewer != "" {
+		base.SkipIfNewer = override.SkipIfNewer
+	}
+
+	if override.SkipIfUnchanged != "" {
+		base.SkipIfUnchanged = override.SkipIfUnchanged
+	}
+
+	if override.RetryOnChecksumMismatch != "" {
+		base.RetryOnChecksumMismatch = override.RetryOnChecksumMismatch
+	}
+
+	if override.ChecksumCache != "" {
+		base.ChecksumCache = override.ChecksumCache
+	}
+
+	if override.HTTPVersion != "" {
+		base.HTTPVersion = override.HTTPVersion
+	}
+
+	if override.VerifyAfterRename != "" {
+		base.VerifyAfterRename = override.VerifyAfterRename
+	}
+
+	if override.DestDir != "" {
+		base.DestDir = override.DestDir
+	}
+
+	if override.Flatten != "" {
+		base.Flatten = override.Flatten
+	}
+
+	if override.ConfineDests != "" {
+		base.ConfineDests = override.ConfineDests
+	}
+
+	if override.Transactional != "" {
+		base.Transactional = override.Transactional
+	}
+
+	if override.HeaderCheck != "" {
+		base.HeaderCheck = override.HeaderCheck
+	}
+
+	if override.StripComponents > 0 {
+		base.StripComponents = override.StripComponents
+	}
+
+	if override.Preflight != "" {
+		base.Preflight = override.Preflight
+	}
+
+	if override.DirectIO != "" {
+		base.DirectIO = override.DirectIO
+	}
+
+	if override.InferExtension != "" {
+		base.InferExtension = override.InferExtension
+	}
+
+	if override.WriteChecksumSidecar != "" {
+		base.WriteChecksumSidecar = override.WriteChecksumSidecar
+	}
+
+	if override.ProgressMode != "" {
+		base.ProgressMode = override.ProgressMode
+	}
+
+	if override.ProgressFD != "" {
+		base.ProgressFD = override.ProgressFD
+	}
+
+	if override.FailureReport != "" {
+		base.FailureReport = override.FailureReport
+	}
+
+	if override.RemoteManifestURL != "" {
+		base.RemoteManifestURL = override.RemoteManifestURL
+	}
+
+	if override.CredentialsFile != "" {
+		base.CredentialsFile = override.CredentialsFile
+	}
+
+	if override.VersionMarker.Path != "" {
+		base.VersionMarker.Path = override.VersionMarker.Path
+	}
+
+	if override.VersionMarker.Value != "" {
+		base.VersionMarker.Value = override.VersionMarker.Value
+	}
+
+	if len(override.AllowedHosts) > 0 {
+		base.AllowedHosts = override.AllowedHosts
+	}
+
+	// Headers are merged by name, like the rates below.
+	for name, value := range override.HTTPHeaders {
+		if base.HTTPHeaders == nil {
+			base.HTTPHeaders = make(map[string]string, len(override.HTTPHeaders))
+		}
+
+		base.HTTPHeaders[name] = value
+	}
+
+	// Rates are merged per host, so an override config can adjust one host
+	// without repeating the others.
+	for host, rate := range override.PerHostBandwidth {
+		if base.PerHostBandwidth == nil {
+			base.PerHostBandwidth = make(map[string]int64, len(override.PerHostBandwidth))
+		}
+
+		base.PerHostBandwidth[host] = rate
+	}
+
+	if len(override.AllowedSchemes) > 0 {
+		base.AllowedSchemes = override.AllowedSchemes
+	}
 }
 
 func applyDefaults(cfg *Config) {
@@ -234,6 +541,10 @@ func applyDefaults(cfg *Config) {
 		cfg.Settings.Timeout = defaultTimeout
 	}
 
+	if cfg.Settings.ConnectTimeout <= 0 {
+		cfg.Settings.ConnectTimeout = defaultConnectTimeout
+	}
+
 	if cfg.Settings.SegmentsPerFile <= 0 {
 		cfg.Settings.SegmentsPerFile = defaultSegmentsPerFile
 	}
@@ -241,9 +552,115 @@ func applyDefaults(cfg *Config) {
 	if cfg.Settings.SegmentMinSize <= 0 {
 		cfg.Settings.SegmentMinSize = defaultSegmentMinSize
 	}
+
+	applyTuningDefaults(&cfg.Settings)
+
+	// Inherited timeouts take precedence over the global defaults.
+	resolveAliasInheritance(cfg.Aliases)
+	applyAliasDefaults(cfg)
+}
+
+// applyTuningDefaults fills settings whose defaults derive from other
+// settings, so it runs after the core defaults are applied.
+func applyTuningDefaults(settings *Settings) {
+	if settings.ParallelSmall <= 0 {
+		settings.ParallelSmall = settings.Parallel
+	}
+
+	if settings.ParallelLarge <= 0 {
+		settings.ParallelLarge = settings.Parallel
+	}
+
+	// HTTP/1.1 stays the default: Cloudflare R2 resets multiplexed HTTP/2
+	// streams under concurrent range load.
+	if settings.HTTPVersion == "" {
+		settings.HTTPVersion = HTTPVersion1
+	}
+
+	if settings.ProgressMode == "" {
+		settings.ProgressMode = ProgressModeBars
+	}
+
+	if settings.MetadataRetries <= 0 {
+		settings.MetadataRetries = defaultMetadataRetries
+	}
+
+	if settings.MetadataRetryDelay <= 0 {
+		settings.MetadataRetryDelay = defaultMetadataRetryDelay
+	}
+
+	if settings.MinSpeed > 0 && settings.MinSpeedWindow <= 0 {
+		settings.MinSpeedWindow = defaultMinSpeedWindow
+	}
+}
+
+// applyAliasDefaults gives aliases without their own timeouts the global ones.
+func applyAliasDefaults(cfg *Config) {
+	for name, alias := range cfg.Aliases {
+		if strings.TrimSpace(alias.Timeout) == "" {
+			alias.Timeout = cfg.Settings.Timeout.String()
+		}
+
+		if strings.TrimSpace(alias.ConnectTimeout) == "" {
+			alias.ConnectTimeout = cfg.Settings.ConnectTimeout.String()
+		}
+
+		cfg.Aliases[name] = alias
+	}
 }
 
 func validate(cfg *Config) error {
+	err := validateSettings(&cfg.Settings)
+	if err != nil {
+		return err
+	}
+
+	err = validateAliases(cfg.Aliases, cfg.checkOnly)
+	if err != nil {
+		return err
+	}
+
+	err = validateCache(cfg)
+	if err != nil {
+		return err
+	}
+
+	return cfg.ValidateFiles()
+}
+
+// ValidateFiles checks the files of the config: each entry, the allowlists
+// and the dest layout. Load runs it; callers that add or change files after
+// loading, such as the remote manifest merge, run it again.
+func (config *Config) ValidateFiles() error {
+	err := validateFiles(config.Files, &config.Settings)
+	if err != nil {
+		return err
+	}
+
+	err = validateAllowlist(config)
+	if err != nil {
+		return err
+	}
+
+	return validateDestLayout(config.Files)
+}
+
+func validateCache(cfg *Config) error {
+	value := strings.TrimSpace(cfg.Cache.UploadParallel)
+	if value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("cache.upload_parallel must be a positive integer, got %q", cfg.Cache.UploadParallel)
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(cfg.Cache.KeyLayout)) {
+	case "", CacheKeyLayoutFlat, CacheKeyLayoutSharded:
+	default:
+		return fmt.Errorf("cache.key_layout %q must be one of %q, %q",
+			cfg.Cache.KeyLayout, CacheKeyLayoutFlat, CacheKeyLayoutSharded)
+	}
+
 	// Validate cache alias exists if cache is enabled.
 	if cfg.Cache.IsEnabled() {
 		if cfg.Cache.Alias == "" {
@@ -255,24 +672,649 @@ func validate(cfg *Config) error {
 		}
 	}
 
-	// Validate files.
-	for i, file := range cfg.Files {
-		if file.URL == "" {
-			return fmt.Errorf("file %d: url is required", i)
+	return nil
+}
+
+func validateFiles(files []FileEntry, settings *Settings) error {
+	for i, file := range files {
+		if file.destErr != nil {
+			return fmt.Errorf("file %d: %w", i, file.destErr)
+		}
+
+		err := validateFile(i, file, settings)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Checked again by ApplyDestDir, as -output-dir may replace dest_dir.
+	if settings.IsConfineDests() && settings.DestDir != "" {
+		err := validateConfinedDests(files, settings.DestDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return validateStdinFiles(files)
+}
+
+// validateStdinFiles checks entries that read from stdin. Stdin can be read
+// only once, and its content must be verifiable as it has no other identity.
+func validateStdinFiles(files []FileEntry) error {
+	stdinIndex := -1
+
+	for i, file := range files {
+		if file.URL != StdinURL {
+			continue
+		}
+
+		if stdinIndex >= 0 {
+			return fmt.Errorf("file %d: url %q is already used by file %d, stdin can be read only once", i, StdinURL, stdinIndex)
+		}
+
+		stdinIndex = i
+
+		if file.SHA256 == "" && file.SHA256URL == "" {
+			return fmt.Errorf("file %d: sha256 or sha256_url is required to read from stdin", i)
 		}
 
-		if file.Dest == "" {
-			return fmt.Errorf("file %d: dest is required", i)
+		if file.Range != "" {
+			return fmt.Errorf("file %d: range does not apply to stdin", i)
 		}
 
-		if file.SHA256 == "" {
-			return fmt.Errorf("file %d: sha256 is required", i)
+		if file.Magic != "" {
+			return fmt.Errorf("file %d: magic does not apply to stdin", i)
 		}
 	}
 
 	return nil
 }
 
+func validateFile(index int, file FileEntry, settings *Settings) error {
+	if len(file.Parts) > 0 {
+		return validatePartsFile(index, file)
+	}
+
+	if file.URL == "" {
+		return fmt.Errorf("file %d: url is required", index)
+	}
+
+	if file.Dest == "" {
+		return fmt.Errorf("file %d: dest is required", index)
+	}
+
+	if IsPrefixURL(file.URL) {
+		return validatePrefixFile(index, file)
+	}
+
+	if !file.HasChecksum() && file.SHA256URL == "" && !settings.IsSkipIfNewer() && !settings.IsSkipIfUnchanged() {
+		return fmt.Errorf("file %d: one of sha256, sha256_url, sha512 or sha1 is required "+
+			"unless settings.skip_if_newer or settings.skip_if_unchanged is enabled", index)
+	}
+
+	return validateFileOptions(index, file)
+}
+
+// validatePrefixFile checks an entry that mirrors an S3 prefix. Its objects
+// are identified by their listed ETag and size, so per-file checksums and
+// ranges do not apply.
+func validatePrefixFile(index int, file FileEntry) error {
+	if file.HasChecksum() || file.SHA256URL != "" || file.MD5 != "" || file.ETag != "" {
+		return fmt.Errorf("file %d: sha256, sha256_url, sha512, sha1, md5 and etag do not apply to a prefix url", index)
+	}
+
+	if file.Range != "" {
+		return fmt.Errorf("file %d: range does not apply to a prefix url", index)
+	}
+
+	if file.Magic != "" {
+		return fmt.Errorf("file %d: magic does not apply to a prefix url", index)
+	}
+
+	return validateFileOptions(index, file)
+}
+
+// validatePartsFile checks an entry joined from parts. Every part is
+// verified on its own, and the joined dest against the entry's sha256.
+func validatePartsFile(index int, file FileEntry) error {
+	if file.URL != "" {
+		return fmt.Errorf("file %d: url and parts are mutually exclusive", index)
+	}
+
+	if file.Dest == "" {
+		return fmt.Errorf("file %d: dest is required", index)
+	}
+
+	if file.SHA256 == "" {
+		return fmt.Errorf("file %d: sha256 of the joined file is required with parts", index)
+	}
+
+	if file.SHA256URL != "" || file.Range != "" || file.ETag != "" || file.IsAnonymous() || file.Magic != "" {
+		return fmt.Errorf("file %d: sha256_url, range, etag, anonymous and magic do not apply to a file with parts", index)
+	}
+
+	err := validateMD5(index, file.MD5)
+	if err != nil {
+		return err
+	}
+
+	err = validateDigests(index, file)
+	if err != nil {
+		return err
+	}
+
+	err = validateHeaders(fmt.Sprintf("file %d: headers", index), file.Headers)
+	if err != nil {
+		return err
+	}
+
+	err = validateFileTimeouts(index, file)
+	if err != nil {
+		return err
+	}
+
+	for i, part := range file.Parts {
+		err := validatePart(part)
+		if err != nil {
+			return fmt.Errorf("file %d: part %d: %w", index, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func validatePart(part FilePart) error {
+	if part.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+
+	if part.URL == StdinURL || IsPrefixURL(part.URL) {
+		return fmt.Errorf("url %q cannot be a part", part.URL)
+	}
+
+	if part.SHA256 == "" {
+		return fmt.Errorf("sha256 is required")
+	}
+
+	if IsDataURL(part.URL) {
+		_, _, err := ParseDataURL(part.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	aliasName, _, ok := splitS3URL(part.URL)
+	if ok && envVarPattern.MatchString(aliasName) {
+		return fmt.Errorf("alias %q references an unset environment variable", aliasName)
+	}
+
+	return nil
+}
+
+// validateFileOptions checks the optional per-file fields.
+func validateFileOptions(index int, file FileEntry) error {
+	if file.SHA256URL != "" && !isHTTPURL(file.SHA256URL) {
+		return fmt.Errorf("file %d: sha256_url must be an http:// or https:// url", index)
+	}
+
+	err := validateMD5(index, file.MD5)
+	if err != nil {
+		return err
+	}
+
+	err = validateDigests(index, file)
+	if err != nil {
+		return err
+	}
+
+	// An alias reference that still holds ${VAR} would otherwise surface
+	// only at download time as an unknown alias.
+	aliasName, _, ok := splitS3URL(file.URL)
+	if ok && envVarPattern.MatchString(aliasName) {
+		return fmt.Errorf("file %d: alias %q references an unset environment variable", index, aliasName)
+	}
+
+	if file.IsAnonymous() && !strings.HasPrefix(file.URL, "s3://") {
+		return fmt.Errorf("file %d: anonymous applies only to s3:// urls", index)
+	}
+
+	if len(file.Headers) > 0 && (strings.HasPrefix(file.URL, "s3://") || IsDataURL(file.URL)) {
+		return fmt.Errorf("file %d: headers apply only to http:// and https:// urls", index)
+	}
+
+	if IsDataURL(file.URL) {
+		_, _, err := ParseDataURL(file.URL)
+		if err != nil {
+			return fmt.Errorf("file %d: %w", index, err)
+		}
+	}
+
+	err = validateHeaders(fmt.Sprintf("file %d: headers", index), file.Headers)
+	if err != nil {
+		return err
+	}
+
+	if file.Range != "" {
+		_, err := ParseByteRange(file.Range)
+		if err != nil {
+			return fmt.Errorf("file %d: %w", index, err)
+		}
+	}
+
+	err = validateMagic(index, file)
+	if err != nil {
+		return err
+	}
+
+	return validateFileTimeouts(index, file)
+}
+
+// validateMagic checks that the magic of file is hex encoded and, for a
+// file with a range, fits in the range.
+func validateMagic(index int, file FileEntry) error {
+	magic, err := file.MagicBytes()
+	if err != nil {
+		return fmt.Errorf("file %d: %w", index, err)
+	}
+
+	if file.Range != "" && magic != nil {
+		byteRange, err := ParseByteRange(file.Range)
+		if err == nil && int64(len(magic)) > byteRange.Size() {
+			return fmt.Errorf("file %d: magic is longer than range %s", index, file.Range)
+		}
+	}
+
+	return nil
+}
+
+// validateFileTimeouts checks the per-file timeouts. Zero leaves the timeout
+// to the settings, like an unset one.
+func validateFileTimeouts(index int, file FileEntry) error {
+	for _, field := range []struct{ name, value string }{
+		{name: "connect_timeout", value: file.ConnectTimeout},
+		{name: "download_timeout", value: file.DownloadTimeout},
+	} {
+		if strings.TrimSpace(field.value) == "" {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(strings.TrimSpace(field.value))
+		if err != nil {
+			return fmt.Errorf("file %d: parsing %s %q: %w", index, field.name, field.value, err)
+		}
+
+		if parsed < 0 {
+			return fmt.Errorf("file %d: %s must not be negative, got %s", index, field.name, field.value)
+		}
+	}
+
+	return nil
+}
+
+// validateMD5 checks that an md5 checksum, verified next to sha256, is
+// written like the output of md5sum.
+func validateMD5(index int, md5 string) error {
+	if md5 == "" {
+		return nil
+	}
+
+	if len(md5) != 32 || strings.Trim(md5, "0123456789abcdef") != "" {
+		return fmt.Errorf("file %d: md5 must be 32 lowercase hex characters", index)
+	}
+
+	return nil
+}
+
+// validateDigests checks that the sha512 and sha1 checksums are written like
+// the output of sha512sum and sha1sum.
+func validateDigests(index int, file FileEntry) error {
+	for _, digest := range []struct {
+		name   string
+		value  string
+		length int
+	}{
+		{name: "sha512", value: file.SHA512, length: 128},
+		{name: "sha1", value: file.SHA1, length: 40},
+	} {
+		if digest.value == "" {
+			continue
+		}
+
+		if len(digest.value) != digest.length || strings.Trim(digest.value, "0123456789abcdef") != "" {
+			return fmt.Errorf("file %d: %s must be %d lowercase hex characters", index, digest.name, digest.length)
+		}
+	}
+
+	return nil
+}
+
+func isHTTPURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+// validateDestLayout rejects configs where one dest is an ancestor of
+// another, which would require the same path to be both a file and a
+// directory, where a dest resolved from URL placeholders is shared with
+// another file, as two urls were unexpectedly mapped to one path, and where
+// a part of a split file is downloaded to the dest of another file.
+func validateDestLayout(files []FileEntry) error {
+	dests := make(map[string]int, len(files))
+
+	for i, file := range files {
+		dest := filepath.Clean(file.Dest)
+
+		other, exists := dests[dest]
+		if exists && (file.placeholderDest || files[other].placeholderDest) {
+			return fmt.Errorf("file %d: dest %q collides with file %d", i, file.Dest, other)
+		}
+
+		dests[dest] = i
+	}
+
+	for i, file := range files {
+		for j := range file.Parts {
+			part := filepath.Clean(PartDest(file.Dest, j))
+
+			other, exists := dests[part]
+			if exists {
+				return fmt.Errorf("file %d: part %d is downloaded to %q, the dest of file %d", i, j+1, part, other)
+			}
+		}
+	}
+
+	for i, file := range files {
+		dir := filepath.Dir(filepath.Clean(file.Dest))
+
+		for filepath.Dir(dir) != dir {
+			other, exists := dests[dir]
+			if exists {
+				return fmt.Errorf("file %d: dest %q needs %q to be a directory, but file %d downloads to it",
+					i, file.Dest, dir, other)
+			}
+
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	return nil
+}
+
+func validateSettings(settings *Settings) error {
+	switch settings.HTTPVersion {
+	case HTTPVersionAuto, HTTPVersion1, HTTPVersion2:
+	default:
+		return fmt.Errorf("settings.http_version %q must be one of %q, %q, %q",
+			settings.HTTPVersion, HTTPVersionAuto, HTTPVersion1, HTTPVersion2)
+	}
+
+	switch settings.ProgressMode {
+	case ProgressModeBars, ProgressModeCI:
+	default:
+		return fmt.Errorf("settings.progress_mode %q must be one of %q, %q",
+			settings.ProgressMode, ProgressModeBars, ProgressModeCI)
+	}
+
+	if settings.HTTPRetries < 0 {
+		return fmt.Errorf("settings.http_retries must not be negative, got %d", settings.HTTPRetries)
+	}
+
+	if settings.S3Retries < 0 {
+		return fmt.Errorf("settings.s3_retries must not be negative, got %d", settings.S3Retries)
+	}
+
+	if settings.MaxErrors < 0 {
+		return fmt.Errorf("settings.max_errors must not be negative, got %d", settings.MaxErrors)
+	}
+
+	if settings.VerifyParallel < 0 {
+		return fmt.Errorf("settings.verify_parallel must not be negative, got %d", settings.VerifyParallel)
+	}
+
+	if settings.PerAliasParallel < 0 {
+		return fmt.Errorf("settings.per_alias_parallel must not be negative, got %d", settings.PerAliasParallel)
+	}
+
+	if settings.MaxOpenFiles < 0 {
+		return fmt.Errorf("settings.max_open_files must not be negative, got %d", settings.MaxOpenFiles)
+	}
+
+	if settings.ProgressSmoothing < 0 {
+		return fmt.Errorf("settings.progress_smoothing must not be negative, got %d", settings.ProgressSmoothing)
+	}
+
+	if settings.ProgressRefresh < 0 {
+		return fmt.Errorf("settings.progress_refresh must not be negative, got %s", settings.ProgressRefresh)
+	}
+
+	if settings.SizeThreshold < 0 {
+		return fmt.Errorf("settings.size_threshold must not be negative, got %d", settings.SizeThreshold)
+	}
+
+	if settings.MinFreeSpace < 0 {
+		return fmt.Errorf("settings.min_free_space must not be negative, got %d", settings.MinFreeSpace)
+	}
+
+	if settings.StripComponents < 0 {
+		return fmt.Errorf("settings.strip_components must not be negative, got %d", settings.StripComponents)
+	}
+
+	// flatten keeps only the basename, leaving nothing to strip.
+	if settings.StripComponents > 0 && settings.IsFlatten() {
+		return fmt.Errorf("settings.strip_components cannot be combined with flatten")
+	}
+
+	if settings.MinSpeed < 0 {
+		return fmt.Errorf("settings.min_speed must not be negative, got %d", settings.MinSpeed)
+	}
+
+	if settings.MinSpeedWindow < 0 {
+		return fmt.Errorf("settings.min_speed_window must not be negative, got %s", settings.MinSpeedWindow)
+	}
+
+	if settings.MaxAge < 0 {
+		return fmt.Errorf("settings.max_age must not be negative, got %s", settings.MaxAge)
+	}
+
+	// skip_if_newer stamps dests with the remote Last-Modified, so their age
+	// is that of the remote version and they would be fetched on every run.
+	if settings.MaxAge > 0 && settings.IsSkipIfNewer() {
+		return fmt.Errorf("settings.max_age cannot be combined with skip_if_newer")
+	}
+
+	err := validateVersionMarker(settings.VersionMarker)
+	if err != nil {
+		return err
+	}
+
+	if settings.RemoteManifestURL != "" && !isHTTPURL(settings.RemoteManifestURL) &&
+		!strings.HasPrefix(settings.RemoteManifestURL, "s3://") {
+		return fmt.Errorf("settings.remote_manifest_url must be an http://, https:// or s3:// url")
+	}
+
+	err = validateHeaders("settings.http_headers", settings.HTTPHeaders)
+	if err != nil {
+		return err
+	}
+
+	return validateBandwidth(settings)
+}
+
+// validateVersionMarker requires settings.version_marker to have both a
+// path and a value, or neither.
+func validateVersionMarker(marker VersionMarker) error {
+	if marker.Path == "" && marker.Value == "" {
+		return nil
+	}
+
+	if marker.Path == "" || marker.Value == "" {
+		return fmt.Errorf("settings.version_marker needs both path and value")
+	}
+
+	if strings.ContainsAny(marker.Value, "\r\n") {
+		return fmt.Errorf("settings.version_marker.value must be a single line")
+	}
+
+	return nil
+}
+
+// validateAliases checks alias fields. With skipEnvRefs, fields holding a
+// ${VAR} reference are left to be checked once the reference is expanded.
+func validateAliases(aliases map[string]Alias, skipEnvRefs bool) error {
+	for name, alias := range aliases {
+		durations := []aliasField{
+			{name: "timeout", value: alias.Timeout},
+			{name: "connect_timeout", value: alias.ConnectTimeout},
+		}
+
+		for _, field := range durations {
+			if skipEnvRefs && envVarPattern.MatchString(field.value) {
+				continue
+			}
+
+			err := validateAliasDuration(name, field.name, field.value)
+			if err != nil {
+				return err
+			}
+		}
+
+		if alias.CredentialProcess != "" && (alias.AccessKey != "" || alias.SecretKey != "" || alias.IsNoSignRequest()) {
+			return fmt.Errorf("alias %q: credential_process cannot be combined with access_key, secret_key "+
+				"or no_sign_request", name)
+		}
+
+		err := validateInherits(name, aliases)
+		if err != nil {
+			return err
+		}
+
+		if skipEnvRefs && envVarPattern.MatchString(alias.FallbackAlias) {
+			continue
+		}
+
+		err = validateFallbackAlias(name, aliases)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateFallbackAlias checks that the fallback_alias chain starting at
+// name only references existing aliases and does not loop back on itself.
+func validateFallbackAlias(name string, aliases map[string]Alias) error {
+	seen := map[string]bool{name: true}
+
+	for current := name; aliases[current].FallbackAlias != ""; {
+		next := aliases[current].FallbackAlias
+
+		_, exists := aliases[next]
+		if !exists {
+			return fmt.Errorf("alias %q: fallback_alias %q not found in aliases", current, next)
+		}
+
+		if seen[next] {
+			return fmt.Errorf("alias %q: fallback_alias chain loops back to %q", name, next)
+		}
+
+		seen[next] = true
+		current = next
+	}
+
+	return nil
+}
+
+// validateAliasDuration checks that an alias duration field is a positive duration.
+func validateAliasDuration(aliasName, field, value string) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("alias %q: parsing %s %q: %w", aliasName, field, value, err)
+	}
+
+	if parsed <= 0 {
+		return fmt.Errorf("alias %q: %s must be positive, got %s", aliasName, field, value)
+	}
+
+	return nil
+}
+
+// FallbackURL returns rawURL pointed at the fallback_alias of its alias, for
+// retrying an s3:// download whose credentials were rejected. It reports
+// false for other URLs and for aliases without a fallback.
+func (config *Config) FallbackURL(rawURL string) (string, bool) {
+	aliasName, key, ok := splitS3URL(rawURL)
+	if !ok {
+		return "", false
+	}
+
+	fallback := config.Aliases[aliasName].FallbackAlias
+	if fallback == "" {
+		return "", false
+	}
+
+	return "s3://" + fallback + "/" + key, true
+}
+
+// FallbackChain returns rawURL followed by each url of its fallback_alias
+// chain, in order. Validation rules out loops, so the chain ends.
+func (config *Config) FallbackChain(rawURL string) []string {
+	chain := []string{rawURL}
+
+	for url, ok := config.FallbackURL(rawURL); ok; url, ok = config.FallbackURL(url) {
+		chain = append(chain, url)
+	}
+
+	return chain
+}
+
+// URLAlias returns the alias name of an s3:// url, and false for other urls.
+func URLAlias(rawURL string) (string, bool) {
+	aliasName, _, ok := splitS3URL(rawURL)
+
+	return aliasName, ok
+}
+
+// ApplyDestDir prefixes settings.dest_dir onto every relative dest. It runs
+// once, after command-line overrides, so -output-dir can replace dest_dir.
+// With settings.confine_dests, it fails without changing any dest when a
+// dest resolves outside dest_dir, or when there is no dest_dir to confine
+// the dests to. It also fails without changing any dest when the prefixed
+// dests clash with the absolute ones, e.g. a relative "data" and an
+// absolute "<dest_dir>/data/file.bin".
+func (config *Config) ApplyDestDir() error {
+	if config.Settings.IsConfineDests() {
+		if config.Settings.DestDir == "" {
+			return fmt.Errorf("settings.confine_dests requires dest_dir or -output-dir")
+		}
+
+		err := validateConfinedDests(config.Files, config.Settings.DestDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Settings.DestDir == "" {
+		return nil
+	}
+
+	files := slices.Clone(config.Files)
+
+	for i, file := range files {
+		if !filepath.IsAbs(file.Dest) {
+			files[i].Dest = filepath.Join(config.Settings.DestDir, file.Dest)
+		}
+	}
+
+	err := validateDestLayout(files)
+	if err != nil {
+		return fmt.Errorf("applying dest_dir: %w", err)
+	}
+
+	config.Files = files
+
+	return nil
+}
+
 // GetAlias returns an alias by name.
 func (config *Config) GetAlias(name string) (Alias, bool) {
 	alias, exists := config.Aliases[name]
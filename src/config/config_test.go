@@ -1,7 +1,12 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -1144,3 +1149,2697 @@ files:
 		})
 	}
 }
+
+func TestSettingsIsResume(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "empty defaults to enabled", value: "", want: true},
+		{name: "true", value: "true", want: true},
+		{name: "false", value: "false", want: false},
+		{name: "uppercase false", value: "FALSE", want: false},
+		{name: "no", value: "no", want: false},
+		{name: "zero", value: "0", want: false},
+		{name: "garbage keeps resume", value: "maybe", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := Settings{Resume: tt.value}
+
+			if settings.IsResume() != tt.want {
+				t.Errorf("IsResume() with %q: expected %v", tt.value, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMultiple_ResumeOverride(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  resume: true\n",
+		`
+settings:
+  resume: false
+
+files:
+  - url: http://example.com/file1.txt
+    dest: /tmp/file1.txt
+    sha256: abc123
+`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.IsResume() {
+		t.Errorf("expected resume disabled, got %q", cfg.Settings.Resume)
+	}
+}
+
+func TestSettingsHTTPVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		want        string
+		expectError bool
+	}{
+		{name: "unset defaults to 1.1", value: "", want: HTTPVersion1},
+		{name: "auto", value: "auto", want: HTTPVersionAuto},
+		{name: "http2", value: `"2"`, want: HTTPVersion2},
+		{name: "http1", value: `"1.1"`, want: HTTPVersion1},
+		{name: "invalid", value: "3", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{fmt.Sprintf(`
+settings:
+  http_version: %s
+
+files:
+  - url: http://example.com/file1.txt
+    dest: /tmp/file1.txt
+    sha256: abc123
+`, tt.value)})
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error for invalid http_version, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Settings.HTTPVersion != tt.want {
+				t.Errorf("expected http_version %q, got %q", tt.want, cfg.Settings.HTTPVersion)
+			}
+		})
+	}
+}
+
+func TestSettingsMaxErrors(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  max_errors: 2\n",
+		`
+settings:
+  parallel: 8
+
+files:
+  - url: http://example.com/file1.txt
+    dest: /tmp/file1.txt
+    sha256: abc123
+`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MaxErrors != 2 {
+		t.Errorf("expected max_errors 2, got %d", cfg.Settings.MaxErrors)
+	}
+
+	_, err = parseConfigs(t, []string{`
+settings:
+  max_errors: -1
+
+files:
+  - url: http://example.com/file1.txt
+    dest: /tmp/file1.txt
+    sha256: abc123
+`})
+	if err == nil {
+		t.Fatal("expected error for negative max_errors, got nil")
+	}
+}
+
+func TestAliasTimeouts(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+aliases:
+  inherits:
+    endpoint: http://localhost:9000
+    bucket: bucket-a
+  overrides:
+    endpoint: http://localhost:9000
+    bucket: bucket-b
+    timeout: 90s
+    connect_timeout: 3s
+
+settings:
+  timeout: 5m
+  connect_timeout: 10s
+
+files:
+  - url: s3://inherits/file1.txt
+    dest: /tmp/file1.txt
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	inherits := cfg.Aliases["inherits"]
+	if inherits.TimeoutDuration() != 5*time.Minute {
+		t.Errorf("expected inherited timeout 5m, got %v", inherits.TimeoutDuration())
+	}
+
+	if inherits.ConnectTimeoutDuration() != 10*time.Second {
+		t.Errorf("expected inherited connect_timeout 10s, got %v", inherits.ConnectTimeoutDuration())
+	}
+
+	overrides := cfg.Aliases["overrides"]
+	if overrides.TimeoutDuration() != 90*time.Second {
+		t.Errorf("expected alias timeout 90s, got %v", overrides.TimeoutDuration())
+	}
+
+	if overrides.ConnectTimeoutDuration() != 3*time.Second {
+		t.Errorf("expected alias connect_timeout 3s, got %v", overrides.ConnectTimeoutDuration())
+	}
+}
+
+func TestAliasTimeoutDefaults(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+aliases:
+  minio:
+    endpoint: http://localhost:9000
+    bucket: bucket
+
+files:
+  - url: s3://minio/file1.txt
+    dest: /tmp/file1.txt
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	alias := cfg.Aliases["minio"]
+	if alias.TimeoutDuration() != defaultTimeout {
+		t.Errorf("expected timeout %v, got %v", defaultTimeout, alias.TimeoutDuration())
+	}
+
+	if alias.ConnectTimeoutDuration() != defaultConnectTimeout {
+		t.Errorf("expected connect_timeout %v, got %v", defaultConnectTimeout, alias.ConnectTimeoutDuration())
+	}
+}
+
+func TestAliasTimeoutInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value string
+	}{
+		{name: "unparseable timeout", field: "timeout", value: "soon"},
+		{name: "zero connect timeout", field: "connect_timeout", value: "0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigs(t, []string{fmt.Sprintf(`
+aliases:
+  minio:
+    endpoint: http://localhost:9000
+    bucket: bucket
+    %s: %s
+
+files:
+  - url: s3://minio/file1.txt
+    dest: /tmp/file1.txt
+    sha256: abc123
+`, tt.field, tt.value)})
+			if err == nil {
+				t.Fatalf("expected error for %s %q, got nil", tt.field, tt.value)
+			}
+
+			if !strings.Contains(err.Error(), tt.field) {
+				t.Errorf("expected error mentioning %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestValidateDestLayout(t *testing.T) {
+	tests := []struct {
+		name        string
+		dests       []string
+		expectError bool
+	}{
+		{name: "siblings", dests: []string{"out/a.bin", "out/b.bin"}},
+		{name: "shared parent dirs", dests: []string{"out/x/a.bin", "out/y/b.bin"}},
+		{name: "dest used as directory", dests: []string{"out/data", "out/data/file.bin"}, expectError: true},
+		{name: "deep ancestor conflict", dests: []string{"out/deep/a/b.bin", "out/deep"}, expectError: true},
+		{name: "unclean paths still conflict", dests: []string{"./out/data", "out//data/file.bin"}, expectError: true},
+		{name: "shared dest without placeholders", dests: []string{"out/a.bin", "./out/a.bin"}},
+		{name: "placeholder dest shared", dests: []string{"out/f", "out/${basename}"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var builder strings.Builder
+
+			builder.WriteString("files:\n")
+
+			for _, dest := range tt.dests {
+				fmt.Fprintf(&builder, "  - url: http://example.com/f\n    dest: %s\n    sha256: abc123\n", dest)
+			}
+
+			_, err := parseConfigs(t, []string{builder.String()})
+			if tt.expectError && err == nil {
+				t.Fatal("expected dest layout error, got nil")
+			}
+
+			if !tt.expectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDestPlaceholders(t *testing.T) {
+	t.Setenv("OUT_DIR", "/data")
+
+	tests := []struct {
+		name string
+		url  string
+		dest string
+		want string
+	}{
+		{name: "basename", url: "https://example.com/releases/v1/tool.tar.gz", dest: "out/${basename}", want: "out/tool.tar.gz"},
+		{name: "dir and basename", url: "https://example.com/releases/v1/tool.tar.gz", dest: "out/${dir}/${basename}", want: "out/releases/v1/tool.tar.gz"},
+		{name: "ext", url: "https://example.com/a/archive.zip?token=x", dest: "out/latest${ext}", want: "out/latest.zip"},
+		{name: "s3 key", url: "s3://minio/builds/app.bin", dest: "${dir}/${basename}", want: "builds/app.bin"},
+		{name: "root level url has empty dir", url: "https://example.com/file.bin", dest: "out/${dir}/${basename}", want: "out/file.bin"},
+		{name: "combined with env var", url: "https://example.com/x/file.bin", dest: "${OUT_DIR}/${basename}", want: "/data/file.bin"},
+		{name: "no placeholders untouched", url: "https://example.com/x/file.bin", dest: "./out//file.bin", want: "./out//file.bin"},
+		{name: "dot dot stays inside", url: "https://example.com/../../etc/passwd", dest: "out/${dir}/${basename}", want: "out/etc/passwd"},
+		{name: "escaped dot dot stays inside", url: "https://example.com/a/..%2F..%2F..%2Fx.bin", dest: "out/${dir}/${basename}", want: "out/x.bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{fmt.Sprintf(`
+files:
+  - url: %s
+    dest: %s
+    sha256: abc123
+`, tt.url, tt.dest)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Files[0].Dest != tt.want {
+				t.Errorf("expected dest %q, got %q", tt.want, cfg.Files[0].Dest)
+			}
+		})
+	}
+}
+
+func TestDestPlaceholderCollision(t *testing.T) {
+	_, err := parseConfigs(t, []string{`
+files:
+  - url: https://mirror-a.example.com/file.bin
+    dest: out/${basename}
+    sha256: abc123
+  - url: https://mirror-b.example.com/other/file.bin
+    dest: out/${basename}
+    sha256: def456
+`})
+	if err == nil {
+		t.Fatal("expected collision error for resolved dests, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "collides") {
+		t.Errorf("expected collision error, got %v", err)
+	}
+}
+
+func TestDestPlaceholdersWithoutURLPath(t *testing.T) {
+	for _, url := range []string{"https://example.com/", "https://example.com", "data:,hello"} {
+		_, err := parseConfigs(t, []string{fmt.Sprintf(`
+files:
+  - url: %s
+    dest: out/${basename}
+    sha256: abc123
+`, url)})
+		if err == nil || !strings.Contains(err.Error(), "no path") {
+			t.Errorf("expected %s to be rejected for placeholders, got %v", url, err)
+		}
+	}
+}
+
+func TestSkipIfNewerOptionalSHA256(t *testing.T) {
+	tests := []struct {
+		name        string
+		skipIfNewer string
+		expectError bool
+	}{
+		{name: "sha256 required by default", skipIfNewer: "false", expectError: true},
+		{name: "sha256 optional with skip_if_newer", skipIfNewer: "true", expectError: false},
+		{name: "yes is truthy", skipIfNewer: "YES", expectError: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{fmt.Sprintf(`
+settings:
+  skip_if_newer: %s
+
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+`, tt.skipIfNewer)})
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error for missing sha256, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cfg.Settings.IsSkipIfNewer() {
+				t.Errorf("expected skip_if_newer to be enabled for %q", tt.skipIfNewer)
+			}
+		})
+	}
+}
+
+func TestSkipIfUnchangedOptionalSHA256(t *testing.T) {
+	t.Setenv("XGET_TEST_SKIP_IF_UNCHANGED", "1")
+
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  skip_if_unchanged: ${XGET_TEST_SKIP_IF_UNCHANGED}
+
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsSkipIfUnchanged() {
+		t.Error("expected skip_if_unchanged to be enabled")
+	}
+}
+
+func TestParseMultiple_SkipIfNewerOverride(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  skip_if_newer: true\n",
+		`
+files:
+  - url: http://example.com/file1.txt
+    dest: /tmp/file1.txt
+`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsSkipIfNewer() {
+		t.Error("expected skip_if_newer from the first config to be kept")
+	}
+}
+
+func TestFileAnonymous(t *testing.T) {
+	t.Setenv("XGET_TEST_ANON", "yes")
+
+	tests := []struct {
+		name          string
+		url           string
+		anonymous     string
+		wantAnonymous bool
+		expectError   bool
+	}{
+		{name: "unset", url: "s3://mycloud/file.bin", anonymous: `""`, wantAnonymous: false},
+		{name: "s3 anonymous", url: "s3://mycloud/file.bin", anonymous: "true", wantAnonymous: true},
+		{name: "env expanded", url: "s3://mycloud/file.bin", anonymous: "${XGET_TEST_ANON}", wantAnonymous: true},
+		{name: "http rejected", url: "https://example.com/file.bin", anonymous: "true", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{fmt.Sprintf(`
+aliases:
+  mycloud:
+    bucket: data
+
+files:
+  - url: %s
+    dest: /tmp/file.bin
+    sha256: abc123
+    anonymous: %s
+`, tt.url, tt.anonymous)})
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Files[0].IsAnonymous() != tt.wantAnonymous {
+				t.Errorf("expected IsAnonymous() %v, got %v", tt.wantAnonymous, cfg.Files[0].IsAnonymous())
+			}
+		})
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	t.Setenv("XGET_TEST_FILE_CACHE", "no")
+
+	tests := []struct {
+		name      string
+		cache     string
+		wantCache bool
+	}{
+		{name: "unset", cache: `""`, wantCache: true},
+		{name: "enabled", cache: "true", wantCache: true},
+		{name: "disabled", cache: "false", wantCache: false},
+		{name: "env expanded", cache: "${XGET_TEST_FILE_CACHE}", wantCache: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{fmt.Sprintf(`
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+    cache: %s
+`, tt.cache)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Files[0].UsesCache() != tt.wantCache {
+				t.Errorf("expected UsesCache() %v, got %v", tt.wantCache, cfg.Files[0].UsesCache())
+			}
+		})
+	}
+}
+
+func TestFileDigests(t *testing.T) {
+	sha512 := strings.Repeat("ab", 64)
+
+	cfg, err := parseConfigs(t, []string{"files:\n  - url: https://example.com/file.bin\n    dest: /tmp/file.bin\n    sha512: " + sha512 + "\n"})
+	if err != nil {
+		t.Fatalf("expected a sha512 to stand in for the sha256: %v", err)
+	}
+
+	if !cfg.Files[0].HasChecksum() || cfg.Files[0].SHA512 != sha512 {
+		t.Errorf("expected the sha512 checksum, got %+v", cfg.Files[0])
+	}
+
+	for _, field := range []string{"sha512: abc123", "sha1: " + strings.ToUpper(strings.Repeat("ab", 20))} {
+		_, err := parseConfigs(t, []string{"files:\n  - url: https://example.com/file.bin\n    dest: /tmp/file.bin\n    " + field + "\n"})
+		if err == nil || !strings.Contains(err.Error(), "lowercase hex characters") {
+			t.Errorf("expected %q to be rejected, got %v", field, err)
+		}
+	}
+}
+
+func TestFileTimeouts(t *testing.T) {
+	tests := []struct {
+		name            string
+		fields          string
+		wantConnect     time.Duration
+		wantTimeout     time.Duration
+		expectErrorText string
+	}{
+		{name: "unset", fields: "", wantConnect: 30 * time.Second, wantTimeout: 5 * time.Minute},
+		{name: "overridden", fields: "\n    connect_timeout: 2s\n    download_timeout: 1h", wantConnect: 2 * time.Second, wantTimeout: time.Hour},
+		{name: "zero follows settings", fields: "\n    download_timeout: 0s", wantConnect: 30 * time.Second, wantTimeout: 5 * time.Minute},
+		{name: "negative", fields: "\n    connect_timeout: -1s", expectErrorText: "connect_timeout must not be negative"},
+		{name: "malformed", fields: "\n    download_timeout: soon", expectErrorText: "parsing download_timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{`
+settings:
+  timeout: 5m
+  connect_timeout: 30s
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123` + tt.fields + "\n"})
+			if tt.expectErrorText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErrorText) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErrorText, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := cfg.Settings.ConnectTimeoutFor(cfg.Files[0])
+			if got != tt.wantConnect {
+				t.Errorf("expected connect timeout %s, got %s", tt.wantConnect, got)
+			}
+
+			got = cfg.Settings.TimeoutFor(cfg.Files[0])
+			if got != tt.wantTimeout {
+				t.Errorf("expected timeout %s, got %s", tt.wantTimeout, got)
+			}
+		})
+	}
+}
+
+func TestSettingsFlatten(t *testing.T) {
+	t.Setenv("XGET_TEST_FLATTEN", "yes")
+
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  flatten: false\n",
+		"settings:\n  flatten: ${XGET_TEST_FLATTEN}\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsFlatten() {
+		t.Error("expected flatten to be enabled")
+	}
+
+	var defaults Settings
+	if defaults.IsFlatten() {
+		t.Error("expected flatten to default to false")
+	}
+}
+
+func TestSettingsPreflight(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  preflight: true\n",
+		"settings:\n  retries: 5\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsPreflight() {
+		t.Error("expected preflight to be enabled")
+	}
+
+	var defaults Settings
+	if defaults.IsPreflight() {
+		t.Error("expected preflight to default to false")
+	}
+}
+
+func TestSettingsMinFreeSpace(t *testing.T) {
+	t.Setenv("XGET_TEST_MIN_FREE_SPACE", "1073741824")
+
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  min_free_space: ${XGET_TEST_MIN_FREE_SPACE}\n",
+		"settings:\n  retries: 5\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MinFreeSpace != 1<<30 {
+		t.Errorf("expected min_free_space 1073741824, got %d", cfg.Settings.MinFreeSpace)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  min_free_space: -1\n"})
+	if err == nil || !strings.Contains(err.Error(), "min_free_space must not be negative") {
+		t.Errorf("expected a negative min_free_space to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsMaxAge(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  max_age: 30d\n",
+		"settings:\n  retries: 5\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MaxAge != 30*24*time.Hour {
+		t.Errorf("expected max_age 720h, got %s", cfg.Settings.MaxAge)
+	}
+
+	cfg, err = parseConfigs(t, []string{"settings:\n  max_age: 36h\n"})
+	if err != nil || cfg.Settings.MaxAge != 36*time.Hour {
+		t.Errorf("expected max_age 36h, got %v, %v", cfg, err)
+	}
+
+	invalid := map[string]string{
+		"settings:\n  max_age: soon\n":                      "parsing settings.max_age",
+		"settings:\n  max_age: xd\n":                        "parsing settings.max_age",
+		"settings:\n  max_age: -1d\n":                       "max_age must not be negative",
+		"settings:\n  max_age: 7d\n  skip_if_newer: true\n": "cannot be combined with skip_if_newer",
+	}
+
+	for content, want := range invalid {
+		_, err := parseConfigs(t, []string{content})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", content, want, err)
+		}
+	}
+}
+
+func TestSettingsVerifyParallel(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  verify_parallel: 2\n",
+		"settings:\n  parallel: 16\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.VerifyParallel != 2 || cfg.Settings.Parallel != 16 {
+		t.Errorf("expected verify_parallel 2 next to parallel 16, got %d and %d",
+			cfg.Settings.VerifyParallel, cfg.Settings.Parallel)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  verify_parallel: -1\n"})
+	if err == nil || !strings.Contains(err.Error(), "verify_parallel must not be negative") {
+		t.Errorf("expected a negative verify_parallel to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsDirectIO(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  direct_io: true\n",
+		"settings:\n  retries: 5\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsDirectIO() {
+		t.Error("expected direct_io to be enabled")
+	}
+
+	var defaults Settings
+	if defaults.IsDirectIO() {
+		t.Error("expected direct_io to default to false")
+	}
+}
+
+func TestSettingsRetryOnChecksumMismatch(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  retry_on_checksum_mismatch: true\n",
+		"settings:\n  retries: 5\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsRetryOnChecksumMismatch() {
+		t.Error("expected retry_on_checksum_mismatch to be enabled")
+	}
+
+	var defaults Settings
+	if defaults.IsRetryOnChecksumMismatch() {
+		t.Error("expected retry_on_checksum_mismatch to default to false")
+	}
+}
+
+func TestSettingsMaxOpenFiles(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  max_open_files: 512\n",
+		"settings:\n  parallel: 16\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MaxOpenFiles != 512 {
+		t.Errorf("expected max_open_files 512, got %d", cfg.Settings.MaxOpenFiles)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  max_open_files: -1\n"})
+	if err == nil || !strings.Contains(err.Error(), "max_open_files must not be negative") {
+		t.Errorf("expected a negative max_open_files to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsRetriesFor(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  retries: 4\n  s3_retries: 8\n",
+		"settings:\n  http_retries: 2\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]int{
+		"s3://minio/bucket/file.bin":   8,
+		"https://example.com/file.bin": 2,
+		"http://example.com/file.bin":  2,
+		StdinURL:                       4,
+	}
+
+	for url, want := range tests {
+		if got := cfg.Settings.RetriesFor(url); got != want {
+			t.Errorf("RetriesFor(%q) = %d, want %d", url, got, want)
+		}
+	}
+
+	cfg, err = parseConfigs(t, []string{"settings:\n  retries: 4\n"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.Settings.RetriesFor("s3://minio/bucket/file.bin"); got != 4 {
+		t.Errorf("expected s3 urls to fall back to retries, got %d", got)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  http_retries: -1\n"})
+	if err == nil || !strings.Contains(err.Error(), "http_retries must not be negative") {
+		t.Errorf("expected a negative http_retries to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsHTTPHeaders(t *testing.T) {
+	t.Setenv("XGET_TEST_TOKEN", "secret")
+
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  http_headers:
+    authorization: Bearer ${XGET_TEST_TOKEN}
+    User-Agent: xget
+files:
+  - url: https://example.com/a.bin
+    dest: a.bin
+    sha256: ` + strings.Repeat("a", 64) + `
+    headers:
+      User-Agent: custom
+      X-Trace: "1"
+`,
+		"settings:\n  http_headers:\n    X-Team: data\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{"Authorization": "Bearer secret", "User-Agent": "xget", "X-Team": "data"}
+	if !maps.Equal(cfg.Settings.HTTPHeaders, want) {
+		t.Errorf("http_headers = %v, want %v", cfg.Settings.HTTPHeaders, want)
+	}
+
+	got := cfg.Settings.HTTPHeadersFor(cfg.Files[0])
+	want = map[string]string{"Authorization": "Bearer secret", "User-Agent": "custom", "X-Team": "data", "X-Trace": "1"}
+
+	if !maps.Equal(got, want) {
+		t.Errorf("HTTPHeadersFor() = %v, want %v", got, want)
+	}
+
+	if cfg.Settings.HTTPHeaders["User-Agent"] != "xget" {
+		t.Error("expected file headers to leave settings.http_headers unchanged")
+	}
+
+	_, err = parseConfigs(t, []string{`
+files:
+  - url: s3://store/a.bin
+    dest: a.bin
+    sha256: ` + strings.Repeat("a", 64) + `
+    headers:
+      X-Trace: "1"
+`})
+	if err == nil || !strings.Contains(err.Error(), "headers apply only to http") {
+		t.Errorf("expected headers on an s3:// url to be rejected, got %v", err)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  http_headers:\n    \"Bad Name\": x\n"})
+	if err == nil || !strings.Contains(err.Error(), "invalid header name") {
+		t.Errorf("expected an invalid header name to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsProgressSmoothing(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  progress_smoothing: 90\n",
+		"settings:\n  parallel: 2\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.ProgressSmoothing != 90 {
+		t.Errorf("expected progress_smoothing 90, got %d", cfg.Settings.ProgressSmoothing)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  progress_smoothing: -5\n"})
+	if err == nil || !strings.Contains(err.Error(), "progress_smoothing must not be negative") {
+		t.Errorf("expected a negative progress_smoothing to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsPerAliasParallel(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  per_alias_parallel: 3\n",
+		"settings:\n  parallel: 16\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.PerAliasParallel != 3 {
+		t.Errorf("expected per_alias_parallel 3, got %d", cfg.Settings.PerAliasParallel)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  per_alias_parallel: -1\n"})
+	if err == nil || !strings.Contains(err.Error(), "per_alias_parallel must not be negative") {
+		t.Errorf("expected a negative per_alias_parallel to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsMinSpeed(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{"settings:\n  min_speed: 102400\n"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MinSpeed != 102400 || cfg.Settings.MinSpeedWindow != time.Minute {
+		t.Errorf("expected min_speed 102400 over the default 1m window, got %d over %s",
+			cfg.Settings.MinSpeed, cfg.Settings.MinSpeedWindow)
+	}
+
+	cfg, err = parseConfigs(t, []string{
+		"settings:\n  min_speed: 102400\n",
+		"settings:\n  min_speed_window: 2m\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MinSpeedWindow != 2*time.Minute {
+		t.Errorf("expected min_speed_window 2m, got %s", cfg.Settings.MinSpeedWindow)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  min_speed: -1\n"})
+	if err == nil || !strings.Contains(err.Error(), "min_speed must not be negative") {
+		t.Errorf("expected a negative min_speed to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsProgressRefresh(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  progress_refresh: 1s\n",
+		"settings:\n  progress_smoothing: 60\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.ProgressRefresh != time.Second {
+		t.Errorf("expected progress_refresh 1s, got %s", cfg.Settings.ProgressRefresh)
+	}
+
+	cfg, err = parseConfigs(t, []string{"settings:\n  parallel: 2\n"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.ProgressRefresh != 0 {
+		t.Errorf("expected progress_refresh to default to mpb's rate, got %s", cfg.Settings.ProgressRefresh)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  progress_refresh: -1s\n"})
+	if err == nil || !strings.Contains(err.Error(), "progress_refresh must not be negative") {
+		t.Errorf("expected a negative progress_refresh to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsStripComponents(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{"settings:\n  strip_components: 2\n"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.StripComponents != 2 {
+		t.Errorf("expected strip_components 2, got %d", cfg.Settings.StripComponents)
+	}
+
+	for _, text := range []string{
+		"settings:\n  strip_components: -1\n",
+		"settings:\n  strip_components: 1\n  flatten: true\n",
+	} {
+		_, err := parseConfigs(t, []string{text})
+		if err == nil || !strings.Contains(err.Error(), "strip_components") {
+			t.Errorf("expected %q to be rejected, got %v", text, err)
+		}
+	}
+}
+
+func TestSettingsRemoteManifestURL(t *testing.T) {
+	t.Setenv("XGET_TEST_RELEASE", "1.2")
+
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  remote_manifest_url: https://example.com/${XGET_TEST_RELEASE}/SHA256SUMS\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.RemoteManifestURL != "https://example.com/1.2/SHA256SUMS" {
+		t.Errorf("unexpected remote_manifest_url %q", cfg.Settings.RemoteManifestURL)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  remote_manifest_url: ftp://example.com/SHA256SUMS\n"})
+	if err == nil || !strings.Contains(err.Error(), "remote_manifest_url must be") {
+		t.Errorf("expected an ftp:// manifest to be rejected, got %v", err)
+	}
+}
+
+func TestSettingsInferExtension(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		"settings:\n  infer_extension: yes\n",
+		"settings:\n  retries: 5\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsInferExtension() {
+		t.Error("expected infer_extension to be enabled")
+	}
+
+	var defaults Settings
+	if defaults.IsInferExtension() {
+		t.Error("expected infer_extension to default to false")
+	}
+}
+
+func TestSettingsSizeSplit(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  parallel: 8
+  size_threshold: 1048576
+  parallel_large: 2
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.SizeThreshold != 1048576 {
+		t.Errorf("expected size_threshold 1048576, got %d", cfg.Settings.SizeThreshold)
+	}
+
+	if cfg.Settings.ParallelSmall != 8 {
+		t.Errorf("expected parallel_small to default to parallel (8), got %d", cfg.Settings.ParallelSmall)
+	}
+
+	if cfg.Settings.ParallelLarge != 2 {
+		t.Errorf("expected parallel_large 2, got %d", cfg.Settings.ParallelLarge)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  size_threshold: -1\n"})
+	if err == nil {
+		t.Error("expected error for negative size_threshold, got nil")
+	}
+}
+
+func TestSettingsReportsAllParseErrors(t *testing.T) {
+	_, err := parseConfigs(t, []string{"settings:\n  parallel: many\n  retries: few\n"})
+	if err == nil {
+		t.Fatal("expected parse error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "parallel") || !strings.Contains(err.Error(), "retries") {
+		t.Errorf("expected both malformed settings in error, got %v", err)
+	}
+}
+
+func TestFileSHA256URL(t *testing.T) {
+	tests := []struct {
+		name        string
+		sha256URL   string
+		expectError bool
+	}{
+		{name: "https checksum url", sha256URL: "https://example.com/SHA256SUMS"},
+		{name: "s3 checksum url rejected", sha256URL: "s3://mycloud/SHA256SUMS", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{fmt.Sprintf(`
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256_url: %s
+`, tt.sha256URL)})
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Files[0].SHA256URL != tt.sha256URL {
+				t.Errorf("expected sha256_url %q, got %q", tt.sha256URL, cfg.Files[0].SHA256URL)
+			}
+		})
+	}
+}
+
+func TestAliasCredentialProcess(t *testing.T) {
+	t.Setenv("XGET_TEST_VAULT_ROLE", "reader")
+
+	tests := []struct {
+		name        string
+		alias       string
+		expectError bool
+	}{
+		{name: "process only", alias: "credential_process: vault-creds --role ${XGET_TEST_VAULT_ROLE}"},
+		{name: "with static keys", alias: "credential_process: vault-creds\n    access_key: key", expectError: true},
+		{name: "with no_sign_request", alias: "credential_process: vault-creds\n    no_sign_request: true", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{fmt.Sprintf(`
+aliases:
+  vault:
+    bucket: data
+    %s
+`, tt.alias)})
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := cfg.Aliases["vault"].CredentialProcess; got != "vault-creds --role reader" {
+				t.Errorf("expected expanded credential_process, got %q", got)
+			}
+		})
+	}
+}
+
+func TestAliasRedaction(t *testing.T) {
+	alias := Alias{
+		Endpoint:  "https://minio.example.com",
+		Bucket:    "data",
+		AccessKey: "AKIAEXAMPLEKEY",
+		SecretKey: "supersecretvalue",
+	}
+
+	formatted := []string{
+		alias.String(),
+		fmt.Sprintf("%v", alias),
+		fmt.Sprintf("%+v", alias),
+		fmt.Sprintf("%#v", alias),
+		fmt.Errorf("connecting to %v: %w", alias, errors.New("refused")).Error(),
+	}
+
+	for _, out := range formatted {
+		if strings.Contains(out, "AKIAEXAMPLEKEY") || strings.Contains(out, "supersecretvalue") {
+			t.Errorf("expected credentials to be masked, got %s", out)
+		}
+
+		if !strings.Contains(out, "bucket=data") {
+			t.Errorf("expected non-secret fields to be kept, got %s", out)
+		}
+	}
+
+	if alias.Redacted().SecretKey != "****alue" {
+		t.Errorf("expected secret masked to its last 4 chars, got %s", alias.Redacted().SecretKey)
+	}
+
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{secret: "", want: "<not set>"},
+		{secret: "abc", want: "***"},
+		{secret: "${MINIO_SECRET}", want: "${MINIO_SECRET}"},
+	}
+
+	for _, tt := range tests {
+		if got := MaskSecret(tt.secret); got != tt.want {
+			t.Errorf("MaskSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		value       string
+		want        ByteRange
+		expectError bool
+	}{
+		{value: "0-1023", want: ByteRange{Start: 0, End: 1023}},
+		{value: " 512 - 512 ", want: ByteRange{Start: 512, End: 512}},
+		{value: "100", expectError: true},
+		{value: "10-5", expectError: true},
+		{value: "-5-10", expectError: true},
+		{value: "a-b", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseByteRange(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %+v", tt.value, got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+
+			if got.Size() != tt.want.End-tt.want.Start+1 {
+				t.Errorf("unexpected size %d", got.Size())
+			}
+		})
+	}
+
+	_, err := parseConfigs(t, []string{`
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/header.bin
+    sha256: abc123
+    range: 100-10
+`})
+	if err == nil {
+		t.Error("expected invalid range to be rejected at load time")
+	}
+}
+
+func TestCacheUploadParallel(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		want        int
+		expectError bool
+	}{
+		{name: "default", value: "", want: DefaultCacheUploadParallel},
+		{name: "explicit", value: "5", want: 5},
+		{name: "zero", value: "0", expectError: true},
+		{name: "not a number", value: "many", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := `
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`
+			if tt.value != "" {
+				yaml += "cache:\n  upload_parallel: \"" + tt.value + "\"\n"
+			}
+
+			cfg, err := parseConfigs(t, []string{yaml})
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := cfg.Cache.UploadParallelCount(); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	tests := []struct {
+		name        string
+		yaml        string
+		expectError bool
+	}{
+		{
+			name: "no allowlist",
+			yaml: `
+files:
+  - url: http://anywhere.example.org/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`,
+		},
+		{
+			name: "allowed host and scheme",
+			yaml: `
+settings:
+  allowed_schemes: [https]
+  allowed_hosts: [releases.example.com]
+files:
+  - url: https://releases.example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`,
+		},
+		{
+			name: "wildcard subdomain",
+			yaml: `
+settings:
+  allowed_hosts: ["*.example.com"]
+files:
+  - url: https://cdn.EXAMPLE.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`,
+		},
+		{
+			name: "disallowed scheme",
+			yaml: `
+settings:
+  allowed_schemes: [https]
+files:
+  - url: http://releases.example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`,
+			expectError: true,
+		},
+		{
+			name: "disallowed host",
+			yaml: `
+settings:
+  allowed_hosts: [releases.example.com]
+files:
+  - url: https://evil.example.org/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`,
+			expectError: true,
+		},
+		{
+			name: "disallowed sha256_url host",
+			yaml: `
+settings:
+  allowed_hosts: [releases.example.com]
+files:
+  - url: https://releases.example.com/file.bin
+    dest: /tmp/file.bin
+    sha256_url: https://evil.example.org/SHA256SUMS
+`,
+			expectError: true,
+		},
+		{
+			name: "disallowed alias endpoint",
+			yaml: `
+aliases:
+  store:
+    endpoint: https://minio.evil.example.org
+    bucket: data
+settings:
+  allowed_hosts: [releases.example.com]
+files:
+  - url: https://releases.example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`,
+			expectError: true,
+		},
+		{
+			name: "unknown scheme in allowlist",
+			yaml: `
+settings:
+  allowed_schemes: [ftp]
+files:
+  - url: https://releases.example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigs(t, []string{tt.yaml})
+			if tt.expectError && err == nil {
+				t.Fatal("expected error")
+			}
+
+			if !tt.expectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckURLAllowed_WildcardDoesNotMatchApex(t *testing.T) {
+	settings := Settings{AllowedHosts: []string{"*.example.com"}}
+
+	err := settings.CheckURLAllowed("https://example.com/file")
+	if err == nil {
+		t.Error("expected apex domain to be rejected by a subdomain wildcard")
+	}
+
+	err = settings.CheckURLAllowed("https://evilexample.com/file")
+	if err == nil {
+		t.Error("expected lookalike domain to be rejected")
+	}
+}
+
+func TestAliasReferenceEnvExpansion(t *testing.T) {
+	t.Setenv("XGET_TEST_STAGE", "prod")
+
+	cfg, err := parseConfigs(t, []string{`
+aliases:
+  store_prod:
+    bucket: prod-bucket
+  cache_prod:
+    bucket: prod-cache
+cache:
+  alias: cache_${XGET_TEST_STAGE}
+  enabled: true
+files:
+  - url: s3://store_${XGET_TEST_STAGE}/builds/${XGET_TEST_STAGE}.bin
+    dest: /tmp/app.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Cache.Alias != "cache_prod" {
+		t.Errorf("expected cache alias cache_prod, got %s", cfg.Cache.Alias)
+	}
+
+	// Only the alias name is expanded; the key is passed through verbatim.
+	want := "s3://store_prod/builds/${XGET_TEST_STAGE}.bin"
+	if cfg.Files[0].URL != want {
+		t.Errorf("expected url %s, got %s", want, cfg.Files[0].URL)
+	}
+}
+
+func TestAliasReferenceUnsetEnv(t *testing.T) {
+	_, err := parseConfigs(t, []string{`
+files:
+  - url: s3://store_${XGET_TEST_UNSET_STAGE}/app.bin
+    dest: /tmp/app.bin
+    sha256: abc123
+`})
+	if err == nil {
+		t.Fatal("expected error for alias reference with an unset env var")
+	}
+
+	if !strings.Contains(err.Error(), "unset environment variable") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestProgressMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		want        string
+		expectError bool
+	}{
+		{name: "default", value: "", want: ProgressModeBars},
+		{name: "ci", value: "ci", want: ProgressModeCI},
+		{name: "case-insensitive", value: "CI", want: ProgressModeCI},
+		{name: "unknown", value: "json", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{`
+settings:
+  progress_mode: "` + tt.value + `"
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Settings.ProgressMode != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, cfg.Settings.ProgressMode)
+			}
+		})
+	}
+}
+
+func TestWriteChecksumSidecarSetting(t *testing.T) {
+	t.Setenv("XGET_TEST_SIDECAR", "yes")
+
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  write_checksum_sidecar: ${XGET_TEST_SIDECAR}
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsWriteChecksumSidecar() {
+		t.Error("expected write_checksum_sidecar to be enabled")
+	}
+}
+
+func TestApplyDestDir(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  dest_dir: /srv/artifacts
+files:
+  - url: https://example.com/a.bin
+    dest: builds/a.bin
+    sha256: abc123
+  - url: https://example.com/b.bin
+    dest: /opt/b.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = cfg.ApplyDestDir()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := filepath.Join("/srv/artifacts", "builds/a.bin")
+	if cfg.Files[0].Dest != want {
+		t.Errorf("expected relative dest under dest_dir %s, got %s", want, cfg.Files[0].Dest)
+	}
+
+	if cfg.Files[1].Dest != "/opt/b.bin" {
+		t.Errorf("expected absolute dest to be kept, got %s", cfg.Files[1].Dest)
+	}
+}
+
+func TestApplyDestDirLayout(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+files:
+  - url: https://example.com/data
+    dest: data
+    sha256: abc123
+  - url: https://example.com/file.bin
+    dest: /srv/artifacts/data/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg.Settings.DestDir = "/srv/artifacts"
+
+	err = cfg.ApplyDestDir()
+	if err == nil || !strings.Contains(err.Error(), "to be a directory") {
+		t.Errorf("expected the prefixed dest to clash with the absolute one, got %v", err)
+	}
+
+	if cfg.Files[0].Dest != "data" {
+		t.Errorf("expected no dest to change on error, got %s", cfg.Files[0].Dest)
+	}
+}
+
+func TestConfineDests(t *testing.T) {
+	load := func(dests ...string) (*Config, error) {
+		text := "settings:\n  dest_dir: /srv/artifacts\n  confine_dests: true\nfiles:\n"
+		for i, dest := range dests {
+			text += fmt.Sprintf("  - url: https://example.com/%d.bin\n    dest: %q\n    sha256: abc123\n", i, dest)
+		}
+
+		return parseConfigs(t, []string{text})
+	}
+
+	cfg, err := load("builds/a.bin", "./b/../b.bin", "/srv/artifacts/c.bin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, dest := range []string{"../etc/passwd", "builds/../../x", "/etc/passwd", "/srv/artifacts-other/x"} {
+		_, err := load("ok.bin", dest)
+		if err == nil || !strings.Contains(err.Error(), "resolves outside dest_dir") {
+			t.Errorf("expected dest %q to be rejected, got %v", dest, err)
+		}
+	}
+
+	// -output-dir replaces dest_dir after loading, so the dests are checked
+	// again against the directory they end up in.
+	cfg.Settings.DestDir = "/tmp/out"
+
+	err = cfg.ApplyDestDir()
+	if err == nil || !strings.Contains(err.Error(), "/srv/artifacts/c.bin") {
+		t.Errorf("expected the absolute dest to be rejected under -output-dir, got %v", err)
+	}
+
+	if cfg.Files[0].Dest != "builds/a.bin" {
+		t.Errorf("expected no dest to change on error, got %s", cfg.Files[0].Dest)
+	}
+
+	cfg.Settings.DestDir = ""
+
+	err = cfg.ApplyDestDir()
+	if err == nil || !strings.Contains(err.Error(), "requires dest_dir") {
+		t.Errorf("expected confine_dests without dest_dir to fail, got %v", err)
+	}
+
+	// Without confine_dests, dests may point anywhere.
+	_, err = parseConfigs(t, []string{"settings:\n  dest_dir: /srv\nfiles:\n  - url: https://example.com/a\n    dest: ../a\n    sha256: abc123\n"})
+	if err != nil {
+		t.Errorf("unexpected error without confine_dests: %v", err)
+	}
+}
+
+func TestCacheVerifyExisting(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+cache:
+  verify_existing: "yes"
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`, `
+cache:
+  upload_parallel: "3"
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Cache.IsVerifyExisting() {
+		t.Error("expected verify_existing to survive a merge that does not set it")
+	}
+}
+
+func TestVerifyAfterRenameMerge(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  verify_after_rename: "no"
+`, `
+settings:
+  verify_after_rename: "1"
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsVerifyAfterRename() {
+		t.Error("expected verify_after_rename from the later config to win")
+	}
+}
+
+func TestTransactionalMerge(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{"settings:\n  transactional: yes\n", "settings:\n  parallel: 2\n"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Settings.IsTransactional() {
+		t.Error("expected transactional to survive a merge that does not set it")
+	}
+}
+
+func TestFileMagic(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   string
+		wantErr string
+	}{
+		{
+			name: "hex magic",
+			files: `
+  - url: https://example.com/image.png
+    dest: /tmp/image.png
+    sha256: abc123
+    magic: 0x89504E47
+`,
+		},
+		{
+			name: "not hex",
+			files: `
+  - url: https://example.com/doc.pdf
+    dest: /tmp/doc.pdf
+    sha256: abc123
+    magic: "%PDF"
+`,
+			wantErr: "must be hex encoded",
+		},
+		{
+			name: "longer than range",
+			files: `
+  - url: https://example.com/image.png
+    dest: /tmp/image.png
+    sha256: abc123
+    range: 0-1
+    magic: 89504e47
+`,
+			wantErr: "magic is longer than range",
+		},
+		{
+			name: "stdin",
+			files: `
+  - url: "-"
+    dest: /tmp/image.png
+    sha256: abc123
+    magic: 89504e47
+`,
+			wantErr: "magic does not apply to stdin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{"settings:\n  header_check: yes\nfiles:" + tt.files})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if !cfg.Settings.IsHeaderCheck() {
+					t.Error("expected header_check to be enabled")
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStdinFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   string
+		wantErr string
+	}{
+		{
+			name: "single stdin entry",
+			files: `
+  - url: "-"
+    dest: /tmp/out.bin
+    sha256: abc123
+`,
+		},
+		{
+			name: "two stdin entries",
+			files: `
+  - url: "-"
+    dest: /tmp/a.bin
+    sha256: abc123
+  - url: "-"
+    dest: /tmp/b.bin
+    sha256: abc123
+`,
+			wantErr: "stdin can be read only once",
+		},
+		{
+			name: "range",
+			files: `
+  - url: "-"
+    dest: /tmp/out.bin
+    sha256: abc123
+    range: 0-9
+`,
+			wantErr: "range does not apply to stdin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigs(t, []string{"files:" + tt.files})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStdinRequiresChecksumWithSkipIfNewer(t *testing.T) {
+	_, err := parseConfigs(t, []string{`
+settings:
+  skip_if_newer: true
+files:
+  - url: "-"
+    dest: /tmp/out.bin
+`})
+	if err == nil {
+		t.Fatal("expected error for stdin entry without sha256")
+	}
+}
+
+func TestDataURLFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   string
+		wantErr string
+	}{
+		{
+			name: "base64 wrapped over lines",
+			files: `
+  - url: >-
+      data:application/x-pem-file;base64,aGVs
+      bG8=
+    dest: /tmp/ca.pem
+    sha256: abc123
+`,
+		},
+		{
+			name: "invalid base64",
+			files: `
+  - url: data:;base64,not*base64
+    dest: /tmp/ca.pem
+    sha256: abc123
+`,
+			wantErr: "decoding base64 data url",
+		},
+		{
+			name: "no comma",
+			files: `
+  - url: data:text/plain
+    dest: /tmp/ca.pem
+    sha256: abc123
+`,
+			wantErr: "no comma",
+		},
+		{
+			name: "headers",
+			files: `
+  - url: data:,hello
+    dest: /tmp/hello.txt
+    sha256: abc123
+    headers:
+      X-Token: secret
+`,
+			wantErr: "headers apply only to http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigs(t, []string{"files:" + tt.files})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckURLAllowed_DataURL(t *testing.T) {
+	settings := Settings{AllowedSchemes: []string{"https"}, AllowedHosts: []string{"example.com"}}
+
+	if err := settings.CheckURLAllowed("data:,hello"); err == nil {
+		t.Error("expected data url to be rejected when data is not an allowed scheme")
+	}
+
+	settings.AllowedSchemes = append(settings.AllowedSchemes, "data")
+
+	if err := settings.CheckURLAllowed("data:;base64,aGVs\n bG8="); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMetadataRetries(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{`
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MetadataRetries != defaultMetadataRetries {
+		t.Errorf("expected default metadata_retries %d, got %d", defaultMetadataRetries, cfg.Settings.MetadataRetries)
+	}
+
+	if cfg.Settings.MetadataRetryDelay != defaultMetadataRetryDelay {
+		t.Errorf("expected default metadata_retry_delay %s, got %s", defaultMetadataRetryDelay, cfg.Settings.MetadataRetryDelay)
+	}
+
+	cfg, err = parseConfigs(t, []string{`
+settings:
+  retries: 5
+  metadata_retries: 2
+  metadata_retry_delay: 1s
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.MetadataRetries != 2 || cfg.Settings.MetadataRetryDelay != time.Second {
+		t.Errorf("expected 2 metadata retries every 1s, got %d every %s", cfg.Settings.MetadataRetries, cfg.Settings.MetadataRetryDelay)
+	}
+
+	if cfg.Settings.Retries != 5 {
+		t.Errorf("expected download retries to stay 5, got %d", cfg.Settings.Retries)
+	}
+}
+
+func TestCacheKeyLayout(t *testing.T) {
+	hash := "3a7bd3e2360a3d29eea436fcfb7e44c735d117c42d1c1835420b6b9942dd4f1b"
+
+	tests := []struct {
+		name   string
+		layout string
+		want   string
+	}{
+		{name: "default", layout: "", want: hash},
+		{name: "flat", layout: CacheKeyLayoutFlat, want: hash},
+		{name: "sharded", layout: CacheKeyLayoutSharded, want: "3a/7b/" + hash},
+		{name: "sharded mixed case", layout: " Sharded ", want: "3a/7b/" + hash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CacheConfig{KeyLayout: tt.layout}.ObjectKey(hash)
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCacheKeyLayoutValidation(t *testing.T) {
+	_, err := parseConfigs(t, []string{`
+cache:
+  key_layout: nested
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err == nil || !strings.Contains(err.Error(), "cache.key_layout") {
+		t.Fatalf("expected cache.key_layout error, got %v", err)
+	}
+}
+
+func TestSettingsCredentialsFile(t *testing.T) {
+	t.Setenv("XGET_TEST_VAULT_SECRET", "supersecret")
+
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials.yaml")
+
+	err := os.WriteFile(credentials, []byte(`
+aliases:
+  vault:
+    endpoint: https://vault.example.com
+    bucket: secrets
+    access_key: vault-key
+    secret_key: ${XGET_TEST_VAULT_SECRET}
+  store:
+    endpoint: https://shadowed.example.com
+    bucket: shadowed
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	configPath := filepath.Join(dir, "config.yaml")
+
+	err = os.WriteFile(configPath, []byte(`
+aliases:
+  store:
+    endpoint: https://store.example.com
+    bucket: artifacts
+settings:
+  credentials_file: `+credentials+`
+files:
+  - url: s3://vault/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg, err := LoadMultiple([]string{configPath})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.Aliases["vault"].SecretKey; got != "supersecret" {
+		t.Errorf("expected the secret_key of the credentials file to be expanded, got %q", got)
+	}
+
+	assertAliasFields(t, cfg.Aliases["store"], "https://store.example.com", "", "artifacts")
+
+	checked, err := CheckMultiple([]string{configPath})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := checked.Aliases["vault"].SecretKey; got != "${XGET_TEST_VAULT_SECRET}" {
+		t.Errorf("expected check to leave the credentials file unexpanded, got %q", got)
+	}
+
+	_, err = parseConfigs(t, []string{"settings:\n  credentials_file: " + filepath.Join(dir, "missing.yaml") + "\n"})
+	if err == nil || !strings.Contains(err.Error(), "settings.credentials_file") {
+		t.Errorf("expected a missing credentials file to fail, got %v", err)
+	}
+}
+
+func TestCheckMultipleSkipsAliasEnvVars(t *testing.T) {
+	t.Setenv("XGET_TEST_SECRET", "supersecret")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(path, []byte(`
+aliases:
+  store:
+    endpoint: ${XGET_TEST_UNSET_ENDPOINT}
+    bucket: artifacts
+    access_key: ${XGET_TEST_UNSET_KEY}
+    secret_key: ${XGET_TEST_SECRET}
+    timeout: ${XGET_TEST_UNSET_TIMEOUT}
+settings:
+  allowed_hosts: [example.com]
+files:
+  - url: s3://store/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = LoadMultiple([]string{path})
+	if err == nil {
+		t.Fatal("expected LoadMultiple to reject the unset timeout")
+	}
+
+	cfg, err := CheckMultiple([]string{path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.Aliases["store"].SecretKey; got != "${XGET_TEST_SECRET}" {
+		t.Errorf("expected secret_key to stay unexpanded, got %q", got)
+	}
+
+	want := []string{
+		"aliases.store.access_key: ${XGET_TEST_UNSET_KEY}",
+		"aliases.store.endpoint: ${XGET_TEST_UNSET_ENDPOINT}",
+		"aliases.store.secret_key: ${XGET_TEST_SECRET}",
+		"aliases.store.timeout: ${XGET_TEST_UNSET_TIMEOUT}",
+	}
+
+	if got := cfg.AliasEnvRefs(); !slices.Equal(got, want) {
+		t.Errorf("expected refs %q, got %q", want, got)
+	}
+}
+
+func TestCheckMultipleValidatesStructure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(path, []byte(`
+aliases:
+  store:
+    bucket: artifacts
+    timeout: forever
+files:
+  - url: s3://store/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = CheckMultiple([]string{path})
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func TestFallbackAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases string
+		wantErr string
+	}{
+		{
+			name: "chain",
+			aliases: `
+  primary: {bucket: a, fallback_alias: secondary}
+  secondary: {bucket: a, fallback_alias: readonly}
+  readonly: {bucket: a}
+`,
+		},
+		{
+			name: "unknown fallback",
+			aliases: `
+  primary: {bucket: a, fallback_alias: missing}
+`,
+			wantErr: `fallback_alias "missing" not found`,
+		},
+		{
+			name: "loop",
+			aliases: `
+  primary: {bucket: a, fallback_alias: secondary}
+  secondary: {bucket: a, fallback_alias: primary}
+`,
+			wantErr: "loops back",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{"aliases:" + tt.aliases + `
+files:
+  - url: s3://primary/builds/app.tar.gz
+    dest: /tmp/app.tar.gz
+    sha256: abc123
+`})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, ok := cfg.FallbackURL("s3://primary/builds/app.tar.gz")
+			if !ok || got != "s3://secondary/builds/app.tar.gz" {
+				t.Errorf("expected s3://secondary/builds/app.tar.gz, got %q, %v", got, ok)
+			}
+
+			if _, ok := cfg.FallbackURL("s3://readonly/builds/app.tar.gz"); ok {
+				t.Error("expected no fallback at the end of the chain")
+			}
+
+			chain := cfg.FallbackChain("s3://primary/builds/app.tar.gz")
+			want := []string{
+				"s3://primary/builds/app.tar.gz",
+				"s3://secondary/builds/app.tar.gz",
+				"s3://readonly/builds/app.tar.gz",
+			}
+
+			if !slices.Equal(chain, want) {
+				t.Errorf("expected chain %q, got %q", want, chain)
+			}
+		})
+	}
+}
+
+func TestProgressFD(t *testing.T) {
+	t.Setenv("XGET_TEST_PROGRESS_FD", "3")
+
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  progress_fd: /tmp/ignored.pipe
+`, `
+settings:
+  progress_fd: ${XGET_TEST_PROGRESS_FD}
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.ProgressFD != "3" {
+		t.Errorf("expected progress_fd 3, got %q", cfg.Settings.ProgressFD)
+	}
+}
+
+func TestPrefixFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   string
+		wantErr string
+	}{
+		{
+			name: "prefix without checksum",
+			files: `
+  - url: s3://store/releases/
+    dest: /tmp/mirror
+`,
+		},
+		{
+			name: "prefix with sha256",
+			files: `
+  - url: s3://store/releases/
+    dest: /tmp/mirror
+    sha256: abc123
+`,
+			wantErr: "do not apply to a prefix url",
+		},
+		{
+			name: "prefix with range",
+			files: `
+  - url: s3://store/releases/
+    dest: /tmp/mirror
+    range: 0-9
+`,
+			wantErr: "range does not apply to a prefix url",
+		},
+		{
+			name: "object still needs checksum",
+			files: `
+  - url: s3://store/releases/app.bin
+    dest: /tmp/app.bin
+`,
+			wantErr: "one of sha256, sha256_url, sha512 or sha1 is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigs(t, []string{"files:" + tt.files})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFileMD5(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   string
+		wantErr string
+	}{
+		{
+			name: "md5 next to sha256",
+			files: `
+  - url: https://example.com/app.bin
+    dest: /tmp/app.bin
+    sha256: abc123
+    md5: 5d41402abc4b2a76b9719d911017c592
+`,
+		},
+		{
+			name: "md5 of joined parts",
+			files: `
+  - dest: /tmp/data.zip
+    sha256: abc123
+    md5: 5d41402abc4b2a76b9719d911017c592
+    parts:
+      - url: https://example.com/data.zip.001
+        sha256: def456
+`,
+		},
+		{
+			name: "uppercase md5",
+			files: `
+  - url: https://example.com/app.bin
+    dest: /tmp/app.bin
+    sha256: abc123
+    md5: 5D41402ABC4B2A76B9719D911017C592
+`,
+			wantErr: "md5 must be 32 lowercase hex characters",
+		},
+		{
+			name: "short md5",
+			files: `
+  - url: https://example.com/app.bin
+    dest: /tmp/app.bin
+    sha256: abc123
+    md5: 5d41402a
+`,
+			wantErr: "md5 must be 32 lowercase hex characters",
+		},
+		{
+			name: "md5 on a prefix",
+			files: `
+  - url: s3://store/releases/
+    dest: /tmp/mirror
+    md5: 5d41402abc4b2a76b9719d911017c592
+`,
+			wantErr: "do not apply to a prefix url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigs(t, []string{"files:" + tt.files})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if cfg.Files[0].MD5 == "" {
+					t.Error("expected md5 to be loaded")
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPartsFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   string
+		wantErr string
+	}{
+		{
+			name: "parts",
+			files: `
+  - dest: /tmp/data.zip
+    sha256: abc123
+    parts:
+      - url: https://example.com/data.zip.001
+        sha256: def456
+      - url: s3://store/data.zip.002
+        sha256: ghi789
+`,
+		},
+		{
+			name: "parts with url",
+			files: `
+  - url: https://example.com/data.zip
+    dest: /tmp/data.zip
+    sha256: abc123
+    parts:
+      - url: https://example.com/data.zip.001
+        sha256: def456
+`,
+			wantErr: "url and parts are mutually exclusive",
+		},
+		{
+			name: "joined file needs checksum",
+			files: `
+  - dest: /tmp/data.zip
+    parts:
+      - url: https://example.com/data.zip.001
+        sha256: def456
+`,
+			wantErr: "sha256 of the joined file is required",
+		},
+		{
+			name: "part needs checksum",
+			files: `
+  - dest: /tmp/data.zip
+    sha256: abc123
+    parts:
+      - url: https://example.com/data.zip.001
+`,
+			wantErr: "part 1: sha256 is required",
+		},
+		{
+			name: "part from stdin",
+			files: `
+  - dest: /tmp/data.zip
+    sha256: abc123
+    parts:
+      - url: "-"
+        sha256: def456
+`,
+			wantErr: "cannot be a part",
+		},
+		{
+			name: "part on the dest of another file",
+			files: `
+  - dest: /tmp/data.zip
+    sha256: abc123
+    parts:
+      - url: https://example.com/data.zip.001
+        sha256: def456
+  - url: https://example.com/other.bin
+    dest: /tmp/data.zip.part001
+    sha256: abc123
+`,
+			wantErr: "the dest of file 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigs(t, []string{"files:" + tt.files})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFailureReport(t *testing.T) {
+	t.Setenv("XGET_TEST_FAILURE_REPORT", "/tmp/failures.yaml")
+
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  failure_report: /tmp/ignored.yaml
+`, `
+settings:
+  failure_report: ${XGET_TEST_FAILURE_REPORT}
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.FailureReport != "/tmp/failures.yaml" {
+		t.Errorf("expected failure_report /tmp/failures.yaml, got %q", cfg.Settings.FailureReport)
+	}
+}
+
+func TestLoadRetry(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.yaml")
+	reportPath := filepath.Join(dir, "failures.yaml")
+
+	err := os.WriteFile(basePath, []byte(`
+aliases:
+  store:
+    endpoint: https://s3.example.com
+    bucket: artifacts
+settings:
+  retries: 7
+files:
+  - url: s3://store/ok.bin
+    dest: /tmp/ok.bin
+    sha256: abc123
+  - url: s3://store/failed.bin
+    dest: /tmp/failed.bin
+    sha256: def456
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = os.WriteFile(reportPath, []byte(`
+files:
+  - url: s3://store/failed.bin
+    dest: /tmp/failed.bin
+    sha256: def456
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg, err := LoadRetry([]string{basePath}, reportPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Files) != 1 || cfg.Files[0].URL != "s3://store/failed.bin" {
+		t.Errorf("expected only the failed entry, got %+v", cfg.Files)
+	}
+
+	if cfg.Settings.Retries != 7 {
+		t.Errorf("expected retries from the base config, got %d", cfg.Settings.Retries)
+	}
+
+	// Without configs the defaults apply.
+	cfg, err = LoadRetry(nil, reportPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Settings.Retries != defaultRetries || len(cfg.Files) != 1 {
+		t.Errorf("expected the report with default settings, got %+v", cfg)
+	}
+}
+
+func TestPerHostBandwidth(t *testing.T) {
+	t.Setenv("XGET_TEST_CDN_RATE", "2097152")
+
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  per_host_bandwidth:
+    cdn.example.com: 1048576
+    mirror.example.com: 524288
+`, `
+settings:
+  per_host_bandwidth:
+    CDN.example.com: ${XGET_TEST_CDN_RATE}
+files:
+  - url: https://cdn.example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]int64{"cdn.example.com": 2097152, "mirror.example.com": 524288}
+	if !maps.Equal(cfg.Settings.PerHostBandwidth, want) {
+		t.Errorf("expected %v, got %v", want, cfg.Settings.PerHostBandwidth)
+	}
+
+	host, rate := cfg.HostBandwidth("https://cdn.example.com/file.bin")
+	if host != "cdn.example.com" || rate != 2097152 {
+		t.Errorf("expected cdn.example.com at 2097152, got %s at %d", host, rate)
+	}
+
+	for _, value := range []string{"0", "-1", "fast"} {
+		_, err = parseConfigs(t, []string{`
+settings:
+  per_host_bandwidth:
+    cdn.example.com: ` + value + `
+files:
+  - url: https://cdn.example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+		if err == nil || !strings.Contains(err.Error(), "per_host_bandwidth") {
+			t.Errorf("%s: expected per_host_bandwidth error, got %v", value, err)
+		}
+	}
+}
+
+func TestCacheVerifyOnPut(t *testing.T) {
+	t.Setenv("XGET_TEST_VERIFY_ON_PUT", "yes")
+
+	cfg, err := parseConfigs(t, []string{`
+cache:
+  verify_on_put: false
+`, `
+cache:
+  verify_on_put: ${XGET_TEST_VERIFY_ON_PUT}
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Cache.IsVerifyOnPut() {
+		t.Errorf("expected verify_on_put from the later config, got %q", cfg.Cache.VerifyOnPut)
+	}
+}
+
+func TestCacheAutoEvictCorrupt(t *testing.T) {
+	t.Setenv("XGET_TEST_AUTO_EVICT", "true")
+
+	cfg, err := parseConfigs(t, []string{`
+cache:
+  auto_evict_corrupt: ${XGET_TEST_AUTO_EVICT}
+`, `
+cache:
+  verify_on_put: true
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Cache.IsAutoEvictCorrupt() {
+		t.Errorf("expected auto_evict_corrupt to survive the merge, got %q", cfg.Cache.AutoEvictCorrupt)
+	}
+
+	var defaults CacheConfig
+	if defaults.IsAutoEvictCorrupt() {
+		t.Error("expected auto_evict_corrupt to default to false")
+	}
+}
+
+func TestVersionMarker(t *testing.T) {
+	t.Setenv("XGET_TEST_ASSET_VERSION", "v42")
+
+	cfg, err := parseConfigs(t, []string{`
+settings:
+  version_marker:
+    path: /srv/assets/.version
+    value: v1
+`, `
+settings:
+  version_marker:
+    value: ${XGET_TEST_ASSET_VERSION}
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := VersionMarker{Path: "/srv/assets/.version", Value: "v42"}
+	if cfg.Settings.VersionMarker != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Settings.VersionMarker)
+	}
+
+	_, err = parseConfigs(t, []string{`
+settings:
+  version_marker:
+    path: /srv/assets/.version
+files:
+  - url: https://example.com/file.bin
+    dest: /tmp/file.bin
+    sha256: abc123
+`})
+	if err == nil || !strings.Contains(err.Error(), "needs both path and value") {
+		t.Errorf("expected version_marker error, got %v", err)
+	}
+}
+
+func TestAliasInherits(t *testing.T) {
+	cfg, err := parseConfigs(t, []string{
+		`
+aliases:
+  base:
+    endpoint: https://s3.example.com
+    region: eu-west-1
+    access_key: AKIABASE
+    secret_key: base-secret
+    timeout: 90s
+`,
+		`
+aliases:
+  builds:
+    inherits: base
+    bucket: builds
+  media:
+    inherits: builds
+    bucket: media
+    region: us-east-1
+  public:
+    inherits: base
+    bucket: public
+    no_sign_request: "true"
+`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	builds := cfg.Aliases["builds"]
+	assertAliasFields(t, builds, "https://s3.example.com", "eu-west-1", "builds")
+
+	if builds.AccessKey != "AKIABASE" || builds.SecretKey != "base-secret" || builds.Timeout != "90s" {
+		t.Errorf("expected builds to inherit credentials and timeout, got %+v", builds)
+	}
+
+	media := cfg.Aliases["media"]
+	assertAliasFields(t, media, "https://s3.example.com", "us-east-1", "media")
+
+	if media.AccessKey != "AKIABASE" {
+		t.Errorf("expected media to inherit through builds, got %+v", media)
+	}
+
+	public := cfg.Aliases["public"]
+	if public.AccessKey != "" || public.SecretKey != "" || !public.IsNoSignRequest() {
+		t.Errorf("expected public to keep its own credentials only, got %+v", public)
+	}
+
+	invalid := map[string]string{
+		"aliases:\n  child: {inherits: missing}\n":                     `inherits "missing" not found`,
+		"aliases:\n  a: {inherits: b}\n  b: {inherits: a}\n":           "inherits chain loops back",
+		"aliases:\n  a: {bucket: x, inherits: a, region: us-east-1}\n": "inherits chain loops back",
+	}
+
+	for content, want := range invalid {
+		_, err := parseConfigs(t, []string{content})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", content, want, err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// validateConfinedDests implements settings.confine_dests: every dest of
+// files, relative ones resolved against dir as ApplyDestDir does, must lie
+// inside dir. The check is lexical, after filepath.Clean; symlinks inside
+// dir are not followed.
+func validateConfinedDests(files []FileEntry, dir string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("resolving dest_dir %q: %w", dir, err)
+	}
+
+	for i, file := range files {
+		dest := file.Dest
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(root, dest)
+		}
+
+		rel, err := filepath.Rel(root, filepath.Clean(dest))
+		if err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("file %d: dest %q resolves outside dest_dir %s (settings.confine_dests)", i, file.Dest, dir)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// credentialsFile is the part of settings.credentials_file that is read.
+// Any other section of the file is ignored.
+type credentialsFile struct {
+	Aliases map[string]Alias `yaml:"aliases"`
+}
+
+// applyCredentialsFile adds the aliases of settings.credentials_file to the
+// merged cfg. Aliases of the configs take precedence: an alias defined in
+// both is taken from the configs as a whole, not merged field by field.
+// Environment variables are expanded as in inline aliases, except for
+// configs from CheckMultiple.
+func applyCredentialsFile(cfg *Config) error {
+	path := cfg.Settings.CredentialsFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading settings.credentials_file: %w", err)
+	}
+
+	var credentials credentialsFile
+
+	err = yaml.Unmarshal(data, &credentials)
+	if err != nil {
+		return fmt.Errorf("parsing settings.credentials_file %s: %w", path, err)
+	}
+
+	if cfg.Aliases == nil {
+		cfg.Aliases = make(map[string]Alias, len(credentials.Aliases))
+	}
+
+	for name, alias := range credentials.Aliases {
+		_, exists := cfg.Aliases[name]
+		if exists {
+			continue
+		}
+
+		if !cfg.checkOnly {
+			expandAliasEnvVars(&alias)
+		}
+
+		cfg.Aliases[name] = alias
+	}
+
+	return nil
+}
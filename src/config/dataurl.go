@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// defaultDataMediaType is the media type of a data: URL that names none,
+// per RFC 2397.
+const defaultDataMediaType = "text/plain;charset=US-ASCII"
+
+// IsDataURL reports whether rawURL is a data: URL, whose content is inlined
+// in the URL itself rather than fetched.
+func IsDataURL(rawURL string) bool {
+	return len(rawURL) >= 5 && strings.EqualFold(rawURL[:5], "data:")
+}
+
+// ParseDataURL decodes a data: URL (RFC 2397) into its media type and
+// content. Base64 content may be wrapped over several lines, as YAML folds
+// long scalars; other content is percent-decoded.
+func ParseDataURL(rawURL string) (string, []byte, error) {
+	if !IsDataURL(rawURL) {
+		return "", nil, fmt.Errorf("not a data url")
+	}
+
+	header, data, found := strings.Cut(rawURL[5:], ",")
+	if !found {
+		return "", nil, fmt.Errorf("data url has no comma before its content")
+	}
+
+	mediaType, isBase64 := strings.CutSuffix(header, ";base64")
+	if mediaType == "" {
+		mediaType = defaultDataMediaType
+	}
+
+	if isBase64 {
+		content, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+		if err != nil {
+			return "", nil, fmt.Errorf("decoding base64 data url: %w", err)
+		}
+
+		return mediaType, content, nil
+	}
+
+	content, err := url.PathUnescape(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("decoding data url: %w", err)
+	}
+
+	return mediaType, []byte(content), nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"regexp"
+	"strings"
 )
 
 var envVarPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
@@ -32,15 +33,71 @@ func expandAliasEnvVars(alias *Alias) {
 	alias.AccessKey = expandEnvVars(alias.AccessKey)
 	alias.SecretKey = expandEnvVars(alias.SecretKey)
 	alias.NoSignRequest = expandEnvVars(alias.NoSignRequest)
+	alias.Timeout = expandEnvVars(alias.Timeout)
+	alias.ConnectTimeout = expandEnvVars(alias.ConnectTimeout)
+	alias.FallbackAlias = expandEnvVars(alias.FallbackAlias)
+	alias.CredentialProcess = expandEnvVars(alias.CredentialProcess)
 }
 
 // expandFileEntryEnvVars expands environment variables in file entry fields.
+// URL placeholders such as ${basename} are resolved first, so they are never
+// looked up as environment variables; a dest they cannot be resolved in is
+// left as it is and reported by validation.
 func expandFileEntryEnvVars(file *FileEntry) {
-	file.Dest = expandEnvVars(file.Dest)
+	file.URL = expandS3AliasRef(file.URL)
+
+	dest, err := resolveDestPlaceholders(file.Dest, file.URL)
+	if err != nil {
+		file.destErr = err
+	} else {
+		file.placeholderDest = usesDestPlaceholders(file.Dest)
+		file.Dest = expandEnvVars(dest)
+	}
+
+	file.SHA256URL = expandEnvVars(file.SHA256URL)
+	file.Anonymous = expandEnvVars(file.Anonymous)
+	file.Cache = expandEnvVars(file.Cache)
+	file.Range = expandEnvVars(file.Range)
+	file.ETag = expandEnvVars(file.ETag)
+	file.ConnectTimeout = expandEnvVars(file.ConnectTimeout)
+	file.DownloadTimeout = expandEnvVars(file.DownloadTimeout)
+	file.Magic = expandEnvVars(file.Magic)
+	file.Headers = parseHeaders(file.Headers)
+
+	for i := range file.Parts {
+		file.Parts[i].URL = expandS3AliasRef(file.Parts[i].URL)
+	}
+}
+
+// expandS3AliasRef expands environment variables in the alias name of an
+// s3:// URL, so s3://store_${ENV}/key picks the alias per environment. The
+// key and http(s) URLs are left untouched.
+func expandS3AliasRef(url string) string {
+	aliasName, key, ok := splitS3URL(url)
+	if !ok {
+		return url
+	}
+
+	return "s3://" + expandEnvVars(aliasName) + "/" + key
+}
+
+// splitS3URL splits s3://alias/key into the alias name and key.
+func splitS3URL(url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, "s3://")
+	if !ok {
+		return "", "", false
+	}
+
+	return strings.Cut(rest, "/")
 }
 
 // expandCacheEnvVars expands environment variables in cache config fields.
 func expandCacheEnvVars(cache *CacheConfig) {
 	cache.Alias = expandEnvVars(cache.Alias)
 	cache.Enabled = expandEnvVars(cache.Enabled)
+	cache.UploadParallel = expandEnvVars(cache.UploadParallel)
+	cache.VerifyExisting = expandEnvVars(cache.VerifyExisting)
+	cache.KeyLayout = expandEnvVars(cache.KeyLayout)
+	cache.VerifyOnPut = expandEnvVars(cache.VerifyOnPut)
+	cache.AutoEvictCorrupt = expandEnvVars(cache.AutoEvictCorrupt)
 }
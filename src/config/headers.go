@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// parseHeaders expands env vars in header values and canonicalizes the
+// names, so "authorization" and "Authorization" are the same header when
+// file headers override settings.http_headers.
+func parseHeaders(raw map[string]string) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(raw))
+
+	for name, value := range raw {
+		headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(expandEnvVars(value))
+	}
+
+	return headers
+}
+
+// validateHeaders rejects header names and values net/http would refuse to
+// send, naming them by field, e.g. settings.http_headers.
+func validateHeaders(field string, headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("%s: invalid header name %q", field, name)
+		}
+
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s.%s: header values must not contain line breaks", field, name)
+		}
+	}
+
+	return nil
+}
+
+// HTTPHeadersFor returns the headers sent with every HTTP request for file:
+// settings.http_headers, with the headers of the file replacing those of the
+// same name.
+func (settings Settings) HTTPHeadersFor(file FileEntry) map[string]string {
+	if len(file.Headers) == 0 {
+		return settings.HTTPHeaders
+	}
+
+	headers := maps.Clone(settings.HTTPHeaders)
+	if headers == nil {
+		headers = make(map[string]string, len(file.Headers))
+	}
+
+	maps.Copy(headers, file.Headers)
+
+	return headers
+}
@@ -0,0 +1,96 @@
+package config
+
+import "fmt"
+
+// resolveAliasInheritance fills the unset fields of every alias with an
+// inherits field from the alias it names, resolving chains parent first.
+// It runs on the merged config, so an alias may inherit from one defined in
+// an earlier config. Missing parents and loops are left unresolved for
+// validation to report.
+func resolveAliasInheritance(aliases map[string]Alias) {
+	resolved := make(map[string]bool, len(aliases))
+
+	var resolve func(name string, visiting map[string]bool) Alias
+
+	resolve = func(name string, visiting map[string]bool) Alias {
+		alias := aliases[name]
+		if resolved[name] || alias.Inherits == "" || visiting[name] {
+			return alias
+		}
+
+		visiting[name] = true
+
+		_, exists := aliases[alias.Inherits]
+		if exists {
+			alias = inheritAlias(alias, resolve(alias.Inherits, visiting))
+		}
+
+		aliases[name] = alias
+		resolved[name] = true
+
+		return alias
+	}
+
+	for name := range aliases {
+		resolve(name, map[string]bool{})
+	}
+}
+
+// inheritAlias returns child with its unset fields taken from parent. The
+// credential fields are inherited as a group: a child with any credentials
+// of its own keeps only those, so static keys of the parent cannot clash
+// with a credential_process of the child.
+func inheritAlias(child, parent Alias) Alias {
+	inherit(&child.Endpoint, parent.Endpoint)
+	inherit(&child.Region, parent.Region)
+	inherit(&child.Bucket, parent.Bucket)
+	inherit(&child.Prefix, parent.Prefix)
+	inherit(&child.Timeout, parent.Timeout)
+	inherit(&child.ConnectTimeout, parent.ConnectTimeout)
+	inherit(&child.FallbackAlias, parent.FallbackAlias)
+
+	if !child.hasCredentials() {
+		child.AccessKey = parent.AccessKey
+		child.SecretKey = parent.SecretKey
+		child.NoSignRequest = parent.NoSignRequest
+		child.CredentialProcess = parent.CredentialProcess
+	}
+
+	return child
+}
+
+// inherit sets an unset field to the parent's value.
+func inherit(field *string, parent string) {
+	if *field == "" {
+		*field = parent
+	}
+}
+
+// hasCredentials reports whether the alias sets any credential field.
+func (alias Alias) hasCredentials() bool {
+	return alias.AccessKey != "" || alias.SecretKey != "" || alias.NoSignRequest != "" || alias.CredentialProcess != ""
+}
+
+// validateInherits checks that the inherits chain starting at name only
+// references existing aliases and does not loop back on itself.
+func validateInherits(name string, aliases map[string]Alias) error {
+	seen := map[string]bool{name: true}
+
+	for current := name; aliases[current].Inherits != ""; {
+		parent := aliases[current].Inherits
+
+		_, exists := aliases[parent]
+		if !exists {
+			return fmt.Errorf("alias %q: inherits %q not found in aliases", current, parent)
+		}
+
+		if seen[parent] {
+			return fmt.Errorf("alias %q: inherits chain loops back to %q", name, parent)
+		}
+
+		seen[parent] = true
+		current = parent
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// destPlaceholders are the URL-derived placeholders a dest may use.
+var destPlaceholders = []string{"${basename}", "${dir}", "${ext}"}
+
+// resolveDestPlaceholders replaces the URL-derived placeholders in dest:
+//
+//   - ${basename}: last path element of the URL, e.g. "tool.tar.gz"
+//   - ${dir}: URL path without the basename, e.g. "releases/v1"
+//   - ${ext}: extension of the basename including the dot, e.g. ".gz"
+//
+// For s3://alias/key URLs the path is the key within the alias. The path is
+// cleaned as if rooted, so ".." elements cannot lead out of the directory
+// the placeholders are used in. URLs without a path to take the
+// placeholders from are rejected. Dests without placeholders are returned
+// unchanged.
+func resolveDestPlaceholders(dest, rawURL string) (string, error) {
+	if !usesDestPlaceholders(dest) {
+		return dest, nil
+	}
+
+	urlPath := rawURL
+
+	parsed, err := url.Parse(rawURL)
+	if err == nil {
+		urlPath = parsed.Path
+	}
+
+	urlPath = strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if urlPath == "" || !filepath.IsLocal(filepath.FromSlash(urlPath)) {
+		return "", fmt.Errorf("dest %q uses url placeholders, but url %q has no path to take them from", dest, rawURL)
+	}
+
+	basename := path.Base(urlPath)
+
+	dir := path.Dir(urlPath)
+	if dir == "." {
+		dir = ""
+	}
+
+	replacer := strings.NewReplacer(
+		"${basename}", basename,
+		"${dir}", dir,
+		"${ext}", path.Ext(basename),
+	)
+
+	return path.Clean(replacer.Replace(dest)), nil
+}
+
+func usesDestPlaceholders(dest string) bool {
+	for _, placeholder := range destPlaceholders {
+		if strings.Contains(dest, placeholder) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaskSecret masks a credential for display, keeping the last 4 characters
+// when the value is long enough. Unset values are reported as "<not set>",
+// and a value still holding an unexpanded ${VAR} placeholder is shown
+// verbatim, since it is not a real secret and surfaces the missing variable.
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return "<not set>"
+	}
+
+	if envVarPattern.MatchString(secret) {
+		return secret
+	}
+
+	if len(secret) > 4 {
+		return "****" + secret[len(secret)-4:]
+	}
+
+	return "***"
+}
+
+// Redacted returns a copy of the alias with its credentials masked, safe to
+// print or marshal.
+func (alias Alias) Redacted() Alias {
+	alias.AccessKey = MaskSecret(alias.AccessKey)
+	alias.SecretKey = MaskSecret(alias.SecretKey)
+
+	return alias
+}
+
+// String formats the alias with its credentials masked, so aliases passed to
+// fmt verbs or wrapped into errors never expose the raw secret.
+func (alias Alias) String() string {
+	redacted := alias.Redacted()
+
+	fields := []string{
+		"endpoint=" + redacted.Endpoint,
+		"region=" + redacted.Region,
+		"bucket=" + redacted.Bucket,
+		"prefix=" + redacted.Prefix,
+		"access_key=" + redacted.AccessKey,
+		"secret_key=" + redacted.SecretKey,
+	}
+
+	return fmt.Sprintf("Alias{%s}", strings.Join(fields, " "))
+}
+
+// GoString masks credentials for the %#v verb as well.
+func (alias Alias) GoString() string {
+	return alias.String()
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -15,17 +17,28 @@ type Config struct {
 	Cache    CacheConfig      `yaml:"cache"`
 	Settings Settings         `yaml:"settings"`
 	Files    []FileEntry      `yaml:"files"`
+
+	// checkOnly is set by CheckMultiple: aliases are not env-expanded, and
+	// their fields holding ${VAR} references are not validated.
+	checkOnly bool
 }
 
 // Alias represents an S3 storage backend configuration.
 type Alias struct {
-	Endpoint      string `yaml:"endpoint"`
-	Region        string `yaml:"region"`
-	Bucket        string `yaml:"bucket"`
-	Prefix        string `yaml:"prefix"`
-	AccessKey     string `yaml:"access_key"`
-	SecretKey     string `yaml:"secret_key"`
-	NoSignRequest string `yaml:"no_sign_request"`
+	Endpoint          string `yaml:"endpoint"`
+	Region            string `yaml:"region"`
+	Bucket            string `yaml:"bucket"`
+	Prefix            string `yaml:"prefix"`
+	AccessKey         string `yaml:"access_key"`
+	SecretKey         string `yaml:"secret_key"`
+	NoSignRequest     string `yaml:"no_sign_request"`
+	Timeout           string `yaml:"timeout"`
+	ConnectTimeout    string `yaml:"connect_timeout"`
+	FallbackAlias     string `yaml:"fallback_alias"`
+	CredentialProcess string `yaml:"credential_process"`
+
+	// Inherits names an alias whose fields fill the unset ones of this one.
+	Inherits string `yaml:"inherits"`
 }
 
 // IsNoSignRequest returns true if no_sign_request is enabled.
@@ -36,12 +49,51 @@ func (alias Alias) IsNoSignRequest() bool {
 	return v == "true" || v == "1" || v == "yes"
 }
 
+// TimeoutDuration returns the alias request timeout, or zero when unset.
+// Unset values are filled from settings.timeout when the config is loaded.
+func (alias Alias) TimeoutDuration() time.Duration {
+	return parseAliasDuration(alias.Timeout)
+}
+
+// ConnectTimeoutDuration returns the alias connect timeout, or zero when unset.
+// Unset values are filled from settings.connect_timeout when the config is loaded.
+func (alias Alias) ConnectTimeoutDuration() time.Duration {
+	return parseAliasDuration(alias.ConnectTimeout)
+}
+
+// parseAliasDuration parses an alias duration field, treating empty or
+// malformed values as unset. Malformed values are rejected by validation.
+func parseAliasDuration(value string) time.Duration {
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0
+	}
+
+	return parsed
+}
+
 // CacheConfig represents the cache configuration.
 type CacheConfig struct {
-	Alias   string `yaml:"alias"`
-	Enabled string `yaml:"enabled"`
+	Alias          string `yaml:"alias"`
+	Enabled        string `yaml:"enabled"`
+	UploadParallel string `yaml:"upload_parallel"`
+	VerifyExisting string `yaml:"verify_existing"`
+	KeyLayout      string `yaml:"key_layout"`
+	VerifyOnPut    string `yaml:"verify_on_put"`
+
+	AutoEvictCorrupt string `yaml:"auto_evict_corrupt"`
 }
 
+// Cache key layouts accepted by cache.key_layout.
+const (
+	CacheKeyLayoutFlat    = "flat"
+	CacheKeyLayoutSharded = "sharded"
+)
+
+// DefaultCacheUploadParallel is the cache upload pool size used when
+// cache.upload_parallel is unset.
+const DefaultCacheUploadParallel = 2
+
 // IsEnabled returns true if cache is enabled.
 // Accepts "true", "1", "yes" (case-insensitive) as truthy values.
 func (c CacheConfig) IsEnabled() bool {
@@ -50,15 +102,133 @@ func (c CacheConfig) IsEnabled() bool {
 	return v == "true" || v == "1" || v == "yes"
 }
 
+// IsVerifyExisting returns true if a dest that already matches its sha256 is
+// also checked against the hash recorded on the cache object.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (c CacheConfig) IsVerifyExisting() bool {
+	v := strings.ToLower(strings.TrimSpace(c.VerifyExisting))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsVerifyOnPut returns true if an upload that finds its cache object
+// already present checks the object's recorded hash and size, replacing it
+// when they do not match.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (c CacheConfig) IsVerifyOnPut() bool {
+	v := strings.ToLower(strings.TrimSpace(c.VerifyOnPut))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsAutoEvictCorrupt returns true if a cache object whose content does not
+// match its hash is deleted when a download finds it, so it cannot fail the
+// next consumer.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (c CacheConfig) IsAutoEvictCorrupt() bool {
+	v := strings.ToLower(strings.TrimSpace(c.AutoEvictCorrupt))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// ObjectKey returns the key of the cache object for a SHA256 hash. The flat
+// layout keys objects by the bare hash; the sharded layout prefixes it with
+// its first two bytes as "ab/cd/<hash>", spreading objects across prefixes.
+func (c CacheConfig) ObjectKey(sha256Hash string) string {
+	layout := strings.ToLower(strings.TrimSpace(c.KeyLayout))
+	if layout != CacheKeyLayoutSharded || len(sha256Hash) < 4 {
+		return sha256Hash
+	}
+
+	return sha256Hash[:2] + "/" + sha256Hash[2:4] + "/" + sha256Hash
+}
+
+// UploadParallelCount returns how many cache uploads may run at once.
+// Empty or malformed values fall back to the default; malformed values are
+// rejected by validation.
+func (c CacheConfig) UploadParallelCount() int {
+	parsed, err := strconv.Atoi(strings.TrimSpace(c.UploadParallel))
+	if err != nil || parsed <= 0 {
+		return DefaultCacheUploadParallel
+	}
+
+	return parsed
+}
+
+// HTTP protocol versions accepted by settings.http_version.
+const (
+	HTTPVersionAuto = "auto"
+	HTTPVersion1    = "1.1"
+	HTTPVersion2    = "2"
+)
+
+// Progress display modes accepted by settings.progress_mode.
+const (
+	ProgressModeBars = "bars"
+	ProgressModeCI   = "ci"
+)
+
 // Settings represents download settings.
 type Settings struct {
-	Parallel        int           `yaml:"parallel"`
-	Retries         int           `yaml:"retries"`
-	RetryDelay      time.Duration `yaml:"retry_delay"`
-	Timeout         time.Duration `yaml:"timeout"`
-	SegmentsPerFile int           `yaml:"segments_per_file"`
-	SegmentMinSize  int64         `yaml:"segment_min_size"`
-	SingleStream    string        `yaml:"single_stream"`
+	Parallel                int               `yaml:"parallel"`
+	ParallelSmall           int               `yaml:"parallel_small"`
+	ParallelLarge           int               `yaml:"parallel_large"`
+	SizeThreshold           int64             `yaml:"size_threshold"`
+	Retries                 int               `yaml:"retries"`
+	HTTPRetries             int               `yaml:"http_retries"`
+	S3Retries               int               `yaml:"s3_retries"`
+	RetryDelay              time.Duration     `yaml:"retry_delay"`
+	Timeout                 time.Duration     `yaml:"timeout"`
+	SegmentsPerFile         int               `yaml:"segments_per_file"`
+	SegmentMinSize          int64             `yaml:"segment_min_size"`
+	SingleStream            string            `yaml:"single_stream"`
+	Resume                  string            `yaml:"resume"`
+	HTTPVersion             string            `yaml:"http_version"`
+	MaxErrors               int               `yaml:"max_errors"`
+	ConnectTimeout          time.Duration     `yaml:"connect_timeout"`
+	SkipIfNewer             string            `yaml:"skip_if_newer"`
+	SkipIfUnchanged         string            `yaml:"skip_if_unchanged"`
+	RetryOnChecksumMismatch string            `yaml:"retry_on_checksum_mismatch"`
+	ChecksumCache           string            `yaml:"checksum_cache"`
+	AllowedHosts            []string          `yaml:"allowed_hosts"`
+	AllowedSchemes          []string          `yaml:"allowed_schemes"`
+	ProgressMode            string            `yaml:"progress_mode"`
+	WriteChecksumSidecar    string            `yaml:"write_checksum_sidecar"`
+	DestDir                 string            `yaml:"dest_dir"`
+	VerifyAfterRename       string            `yaml:"verify_after_rename"`
+	MetadataRetries         int               `yaml:"metadata_retries"`
+	MetadataRetryDelay      time.Duration     `yaml:"metadata_retry_delay"`
+	ProgressFD              string            `yaml:"progress_fd"`
+	FailureReport           string            `yaml:"failure_report"`
+	RemoteManifestURL       string            `yaml:"remote_manifest_url"`
+	CredentialsFile         string            `yaml:"credentials_file"`
+	PerHostBandwidth        map[string]int64  `yaml:"per_host_bandwidth"`
+	HTTPHeaders             map[string]string `yaml:"http_headers"`
+	VersionMarker           VersionMarker     `yaml:"version_marker"`
+	Flatten                 string            `yaml:"flatten"`
+	ConfineDests            string            `yaml:"confine_dests"`
+	StripComponents         int               `yaml:"strip_components"`
+	Transactional           string            `yaml:"transactional"`
+	Preflight               string            `yaml:"preflight"`
+	HeaderCheck             string            `yaml:"header_check"`
+	DirectIO                string            `yaml:"direct_io"`
+	InferExtension          string            `yaml:"infer_extension"`
+	MinFreeSpace            int64             `yaml:"min_free_space"`
+	MinSpeed                int64             `yaml:"min_speed"`
+	MinSpeedWindow          time.Duration     `yaml:"min_speed_window"`
+	MaxAge                  time.Duration     `yaml:"max_age"`
+	VerifyParallel          int               `yaml:"verify_parallel"`
+	PerAliasParallel        int               `yaml:"per_alias_parallel"`
+	MaxOpenFiles            int               `yaml:"max_open_files"`
+	ProgressSmoothing       int               `yaml:"progress_smoothing"`
+	ProgressRefresh         time.Duration     `yaml:"progress_refresh"`
+}
+
+// VersionMarker is settings.version_marker: a local file whose content
+// records which version of the file set is in place.
+type VersionMarker struct {
+	Path  string `yaml:"path"`
+	Value string `yaml:"value"`
 }
 
 // IsSingleStream returns true if segmented download is disabled.
@@ -69,19 +239,195 @@ func (settings Settings) IsSingleStream() bool {
 	return v == "true" || v == "1" || v == "yes"
 }
 
+// IsResume returns true unless resuming from existing partial files is disabled.
+// Accepts "false", "0", "no" (case-insensitive) as falsy values; anything else,
+// including an empty value, keeps resume enabled.
+func (settings Settings) IsResume() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.Resume))
+
+	return v != "false" && v != "0" && v != "no"
+}
+
+// IsSkipIfNewer returns true if downloads are skipped when the local file is
+// at least as new as the remote one.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsSkipIfNewer() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.SkipIfNewer))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsSkipIfUnchanged returns true if downloads are skipped when a HEAD request
+// reports the same ETag, modification time and size as recorded after the
+// last download.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsSkipIfUnchanged() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.SkipIfUnchanged))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsRetryOnChecksumMismatch returns true if a checksum mismatch is retried
+// with a fresh download instead of failing the file immediately.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsRetryOnChecksumMismatch() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.RetryOnChecksumMismatch))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsWriteChecksumSidecar returns true if a dest.sha256 file in sha256sum
+// format is written next to each verified download.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsWriteChecksumSidecar() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.WriteChecksumSidecar))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsVerifyAfterRename returns true if a downloaded file is hashed again
+// after it is renamed into place.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsVerifyAfterRename() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.VerifyAfterRename))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsFlatten returns true if the objects of a mirrored prefix are written
+// directly into the dest directory under their basename.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsFlatten() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.Flatten))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsConfineDests returns true if every dest must lie inside dest_dir.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsConfineDests() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.ConfineDests))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsTransactional returns true if the files written by a run are removed
+// again when any file of the run fails.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsTransactional() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.Transactional))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsHeaderCheck returns true if the first bytes of a file with a magic are
+// fetched and compared with it before the full download starts.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsHeaderCheck() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.HeaderCheck))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsPreflight returns true if the source of every file is checked before
+// the first download starts.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsPreflight() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.Preflight))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsDirectIO returns true if single-stream downloads write the partial with
+// O_DIRECT where the platform and file system support it.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsDirectIO() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.DirectIO))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// IsInferExtension returns true if dests without an extension get the one
+// matching the Content-Type of their source.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (settings Settings) IsInferExtension() bool {
+	v := strings.ToLower(strings.TrimSpace(settings.InferExtension))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// RetriesFor returns the download attempts for url: settings.s3_retries for
+// s3:// urls and settings.http_retries for http(s):// urls when set, and
+// settings.retries otherwise.
+func (settings Settings) RetriesFor(url string) int {
+	switch {
+	case strings.HasPrefix(url, "s3://") && settings.S3Retries > 0:
+		return settings.S3Retries
+	case (strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) && settings.HTTPRetries > 0:
+		return settings.HTTPRetries
+	default:
+		return settings.Retries
+	}
+}
+
 // UnmarshalYAML expands ${VAR} env vars in each setting before parsing it into
 // the typed field. Empty values are left as the zero value so defaults apply.
 func (settings *Settings) UnmarshalYAML(value *yaml.Node) error {
-	// raw mirrors Settings with all fields as strings so each value can be
+	// raw mirrors Settings with scalar fields as strings so each value can be
 	// env-expanded before parsing into the typed field. Keep in sync with Settings.
 	var raw struct {
-		Parallel        string `yaml:"parallel"`
-		Retries         string `yaml:"retries"`
-		RetryDelay      string `yaml:"retry_delay"`
-		Timeout         string `yaml:"timeout"`
-		SegmentsPerFile string `yaml:"segments_per_file"`
-		SegmentMinSize  string `yaml:"segment_min_size"`
-		SingleStream    string `yaml:"single_stream"`
+		Parallel                string            `yaml:"parallel"`
+		ParallelSmall           string            `yaml:"parallel_small"`
+		ParallelLarge           string            `yaml:"parallel_large"`
+		SizeThreshold           string            `yaml:"size_threshold"`
+		Retries                 string            `yaml:"retries"`
+		HTTPRetries             string            `yaml:"http_retries"`
+		S3Retries               string            `yaml:"s3_retries"`
+		RetryDelay              string            `yaml:"retry_delay"`
+		Timeout                 string            `yaml:"timeout"`
+		SegmentsPerFile         string            `yaml:"segments_per_file"`
+		SegmentMinSize          string            `yaml:"segment_min_size"`
+		SingleStream            string            `yaml:"single_stream"`
+		Resume                  string            `yaml:"resume"`
+		HTTPVersion             string            `yaml:"http_version"`
+		MaxErrors               string            `yaml:"max_errors"`
+		ConnectTimeout          string            `yaml:"connect_timeout"`
+		SkipIfNewer             string            `yaml:"skip_if_newer"`
+		SkipIfUnchanged         string            `yaml:"skip_if_unchanged"`
+		RetryOnChecksumMismatch string            `yaml:"retry_on_checksum_mismatch"`
+		ChecksumCache           string            `yaml:"checksum_cache"`
+		AllowedHosts            []string          `yaml:"allowed_hosts"`
+		AllowedSchemes          []string          `yaml:"allowed_schemes"`
+		ProgressMode            string            `yaml:"progress_mode"`
+		WriteChecksumSidecar    string            `yaml:"write_checksum_sidecar"`
+		DestDir                 string            `yaml:"dest_dir"`
+		VerifyAfterRename       string            `yaml:"verify_after_rename"`
+		Flatten                 string            `yaml:"flatten"`
+		ConfineDests            string            `yaml:"confine_dests"`
+		StripComponents         string            `yaml:"strip_components"`
+		Transactional           string            `yaml:"transactional"`
+		Preflight               string            `yaml:"preflight"`
+		HeaderCheck             string            `yaml:"header_check"`
+		DirectIO                string            `yaml:"direct_io"`
+		InferExtension          string            `yaml:"infer_extension"`
+		MinFreeSpace            string            `yaml:"min_free_space"`
+		MinSpeed                string            `yaml:"min_speed"`
+		MinSpeedWindow          string            `yaml:"min_speed_window"`
+		MaxAge                  string            `yaml:"max_age"`
+		VerifyParallel          string            `yaml:"verify_parallel"`
+		PerAliasParallel        string            `yaml:"per_alias_parallel"`
+		MaxOpenFiles            string            `yaml:"max_open_files"`
+		ProgressSmoothing       string            `yaml:"progress_smoothing"`
+		ProgressRefresh         string            `yaml:"progress_refresh"`
+		MetadataRetries         string            `yaml:"metadata_retries"`
+		MetadataRetryDelay      string            `yaml:"metadata_retry_delay"`
+		ProgressFD              string            `yaml:"progress_fd"`
+		FailureReport           string            `yaml:"failure_report"`
+		RemoteManifestURL       string            `yaml:"remote_manifest_url"`
+		CredentialsFile         string            `yaml:"credentials_file"`
+		PerHostBandwidth        map[string]string `yaml:"per_host_bandwidth"`
+		HTTPHeaders             map[string]string `yaml:"http_headers"`
+		VersionMarker           VersionMarker     `yaml:"version_marker"`
 	}
 
 	err := value.Decode(&raw)
@@ -89,39 +435,83 @@ func (settings *Settings) UnmarshalYAML(value *yaml.Node) error {
 		return fmt.Errorf("decoding settings: %w", err)
 	}
 
-	err = parseIntSetting("parallel", raw.Parallel, &settings.Parallel)
-	if err != nil {
-		return err
-	}
-
-	err = parseIntSetting("retries", raw.Retries, &settings.Retries)
+	// Report every malformed setting at once rather than one per run.
+	err = errors.Join(
+		parseIntSetting("parallel", raw.Parallel, &settings.Parallel),
+		parseIntSetting("parallel_small", raw.ParallelSmall, &settings.ParallelSmall),
+		parseIntSetting("parallel_large", raw.ParallelLarge, &settings.ParallelLarge),
+		parseInt64Setting("size_threshold", raw.SizeThreshold, &settings.SizeThreshold),
+		parseIntSetting("retries", raw.Retries, &settings.Retries),
+		parseIntSetting("http_retries", raw.HTTPRetries, &settings.HTTPRetries),
+		parseIntSetting("s3_retries", raw.S3Retries, &settings.S3Retries),
+		parseIntSetting("max_errors", raw.MaxErrors, &settings.MaxErrors),
+		parseIntSetting("verify_parallel", raw.VerifyParallel, &settings.VerifyParallel),
+		parseIntSetting("per_alias_parallel", raw.PerAliasParallel, &settings.PerAliasParallel),
+		parseIntSetting("strip_components", raw.StripComponents, &settings.StripComponents),
+		parseIntSetting("max_open_files", raw.MaxOpenFiles, &settings.MaxOpenFiles),
+		parseIntSetting("progress_smoothing", raw.ProgressSmoothing, &settings.ProgressSmoothing),
+		parseIntSetting("metadata_retries", raw.MetadataRetries, &settings.MetadataRetries),
+		parseIntSetting("segments_per_file", raw.SegmentsPerFile, &settings.SegmentsPerFile),
+		parseInt64Setting("segment_min_size", raw.SegmentMinSize, &settings.SegmentMinSize),
+		parseInt64Setting("min_free_space", raw.MinFreeSpace, &settings.MinFreeSpace),
+		parseInt64Setting("min_speed", raw.MinSpeed, &settings.MinSpeed),
+		parseDurationSetting("retry_delay", raw.RetryDelay, &settings.RetryDelay),
+		parseDurationSetting("timeout", raw.Timeout, &settings.Timeout),
+		parseDurationSetting("connect_timeout", raw.ConnectTimeout, &settings.ConnectTimeout),
+		parseDurationSetting("metadata_retry_delay", raw.MetadataRetryDelay, &settings.MetadataRetryDelay),
+		parseDurationSetting("min_speed_window", raw.MinSpeedWindow, &settings.MinSpeedWindow),
+		parseDurationSetting("progress_refresh", raw.ProgressRefresh, &settings.ProgressRefresh),
+		parseAgeSetting("max_age", raw.MaxAge, &settings.MaxAge),
+		parseBandwidthSetting(raw.PerHostBandwidth, &settings.PerHostBandwidth),
+	)
 	if err != nil {
 		return err
 	}
 
-	err = parseIntSetting("segments_per_file", raw.SegmentsPerFile, &settings.SegmentsPerFile)
-	if err != nil {
-		return err
-	}
+	settings.SingleStream = strings.TrimSpace(expandEnvVars(raw.SingleStream))
+	settings.Resume = strings.TrimSpace(expandEnvVars(raw.Resume))
+	settings.HTTPVersion = strings.TrimSpace(expandEnvVars(raw.HTTPVersion))
+	settings.SkipIfNewer = strings.TrimSpace(expandEnvVars(raw.SkipIfNewer))
+	settings.SkipIfUnchanged = strings.TrimSpace(expandEnvVars(raw.SkipIfUnchanged))
+	settings.RetryOnChecksumMismatch = strings.TrimSpace(expandEnvVars(raw.RetryOnChecksumMismatch))
+	settings.ChecksumCache = strings.TrimSpace(expandEnvVars(raw.ChecksumCache))
+	settings.WriteChecksumSidecar = strings.TrimSpace(expandEnvVars(raw.WriteChecksumSidecar))
+	settings.DestDir = strings.TrimSpace(expandEnvVars(raw.DestDir))
+	settings.VerifyAfterRename = strings.TrimSpace(expandEnvVars(raw.VerifyAfterRename))
+	settings.Flatten = strings.TrimSpace(expandEnvVars(raw.Flatten))
+	settings.ConfineDests = strings.TrimSpace(expandEnvVars(raw.ConfineDests))
+	settings.Transactional = strings.TrimSpace(expandEnvVars(raw.Transactional))
+	settings.Preflight = strings.TrimSpace(expandEnvVars(raw.Preflight))
+	settings.HeaderCheck = strings.TrimSpace(expandEnvVars(raw.HeaderCheck))
+	settings.DirectIO = strings.TrimSpace(expandEnvVars(raw.DirectIO))
+	settings.InferExtension = strings.TrimSpace(expandEnvVars(raw.InferExtension))
+	settings.ProgressFD = strings.TrimSpace(expandEnvVars(raw.ProgressFD))
+	settings.FailureReport = strings.TrimSpace(expandEnvVars(raw.FailureReport))
+	settings.RemoteManifestURL = strings.TrimSpace(expandEnvVars(raw.RemoteManifestURL))
+	settings.CredentialsFile = strings.TrimSpace(expandEnvVars(raw.CredentialsFile))
+	settings.VersionMarker.Path = strings.TrimSpace(expandEnvVars(raw.VersionMarker.Path))
+	settings.VersionMarker.Value = strings.TrimSpace(expandEnvVars(raw.VersionMarker.Value))
+	settings.ProgressMode = strings.ToLower(strings.TrimSpace(expandEnvVars(raw.ProgressMode)))
+	settings.HTTPHeaders = parseHeaders(raw.HTTPHeaders)
+	settings.AllowedHosts = parseListSetting(raw.AllowedHosts)
+	settings.AllowedSchemes = parseListSetting(raw.AllowedSchemes)
 
-	err = parseInt64Setting("segment_min_size", raw.SegmentMinSize, &settings.SegmentMinSize)
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	err = parseDurationSetting("retry_delay", raw.RetryDelay, &settings.RetryDelay)
-	if err != nil {
-		return err
-	}
+// parseListSetting expands env vars in each entry and lowercases it, dropping
+// entries that are empty after expansion.
+func parseListSetting(raw []string) []string {
+	var values []string
 
-	err = parseDurationSetting("timeout", raw.Timeout, &settings.Timeout)
-	if err != nil {
-		return err
+	for _, entry := range raw {
+		value := strings.ToLower(strings.TrimSpace(expandEnvVars(entry)))
+		if value != "" {
+			values = append(values, value)
+		}
 	}
 
-	settings.SingleStream = strings.TrimSpace(expandEnvVars(raw.SingleStream))
-
-	return nil
+	return values
 }
 
 // parseIntSetting expands env vars in raw and parses it into target.
@@ -176,9 +566,196 @@ func parseDurationSetting(name, raw string, target *time.Duration) error {
 	return nil
 }
 
+// parseAgeSetting is parseDurationSetting that also accepts a number of
+// days, e.g. 30d, as ages are usually counted in days.
+func parseAgeSetting(name, raw string, target *time.Duration) error {
+	value := strings.TrimSpace(expandEnvVars(raw))
+
+	days, ok := strings.CutSuffix(value, "d")
+	if !ok {
+		return parseDurationSetting(name, raw, target)
+	}
+
+	count, err := strconv.Atoi(days)
+	if err != nil {
+		return fmt.Errorf("parsing settings.%s %q: %w", name, value, err)
+	}
+
+	*target = time.Duration(count) * 24 * time.Hour
+
+	return nil
+}
+
+// StdinURL is the file url that reads the content from standard input.
+const StdinURL = "-"
+
+// IsPrefixURL reports whether url names an S3 prefix, s3://alias/prefix/,
+// whose objects are mirrored into the dest directory.
+func IsPrefixURL(url string) bool {
+	return strings.HasPrefix(url, "s3://") && strings.HasSuffix(url, "/")
+}
+
 // FileEntry represents a file to download.
 type FileEntry struct {
+	URL       string `yaml:"url"`
+	Dest      string `yaml:"dest"`
+	SHA256    string `yaml:"sha256,omitempty"`
+	SHA256URL string `yaml:"sha256_url,omitempty"`
+	SHA512    string `yaml:"sha512,omitempty"`
+	SHA1      string `yaml:"sha1,omitempty"`
+	MD5       string `yaml:"md5,omitempty"`
+	Anonymous string `yaml:"anonymous,omitempty"`
+	Cache     string `yaml:"cache,omitempty"`
+	Range     string `yaml:"range,omitempty"`
+	ETag      string `yaml:"etag,omitempty"`
+	Priority  int    `yaml:"priority,omitempty"`
+
+	// Metadata holds free-form labels, e.g. component or license. They are
+	// ignored by the downloader and passed through to the -json report.
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+
+	// Headers are sent with every HTTP request for the file, replacing
+	// those of settings.http_headers with the same name.
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// ConnectTimeout and DownloadTimeout replace settings.connect_timeout
+	// and settings.timeout (and the timeouts of its alias) for this file.
+	ConnectTimeout  string `yaml:"connect_timeout,omitempty"`
+	DownloadTimeout string `yaml:"download_timeout,omitempty"`
+
+	// Magic is the hex encoded start of the file content, checked with a
+	// range request before the download when settings.header_check is set.
+	Magic string `yaml:"magic,omitempty"`
+
+	// Parts lists the pieces of a file published split into parts. They are
+	// downloaded in order and joined into Dest, which then must match SHA256.
+	Parts []FilePart `yaml:"parts,omitempty"`
+
+	// placeholderDest is set when Dest was resolved from URL placeholders,
+	// and destErr when it could not be; see resolveDestPlaceholders.
+	placeholderDest bool
+	destErr         error
+}
+
+// PartDest returns the path part index of dest is downloaded to before the
+// parts are joined: <dest>.part001, <dest>.part002 and so on.
+func PartDest(dest string, index int) string {
+	return fmt.Sprintf("%s.part%03d", dest, index+1)
+}
+
+// FilePart is one piece of a split file, e.g. dataset.zip.001.
+type FilePart struct {
 	URL    string `yaml:"url"`
-	Dest   string `yaml:"dest"`
 	SHA256 string `yaml:"sha256"`
 }
+
+// ByteRange is an inclusive byte range of a source file.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// Size returns the number of bytes in the range.
+func (byteRange ByteRange) Size() int64 {
+	return byteRange.End - byteRange.Start + 1
+}
+
+// ParseByteRange parses an inclusive "start-end" byte range, e.g. "0-1023".
+func ParseByteRange(value string) (ByteRange, error) {
+	startText, endText, found := strings.Cut(strings.TrimSpace(value), "-")
+	if !found {
+		return ByteRange{}, fmt.Errorf("range %q must be start-end", value)
+	}
+
+	start, err := strconv.ParseInt(strings.TrimSpace(startText), 10, 64)
+	if err != nil {
+		return ByteRange{}, fmt.Errorf("parsing range start %q: %w", startText, err)
+	}
+
+	end, err := strconv.ParseInt(strings.TrimSpace(endText), 10, 64)
+	if err != nil {
+		return ByteRange{}, fmt.Errorf("parsing range end %q: %w", endText, err)
+	}
+
+	if start < 0 || end < start {
+		return ByteRange{}, fmt.Errorf("range %q must satisfy 0 <= start <= end", value)
+	}
+
+	return ByteRange{Start: start, End: end}, nil
+}
+
+// HasChecksum reports whether the entry has a checksum that identifies its
+// content on its own: a sha256, sha512 or sha1. An md5 is only verified next
+// to one of them.
+func (file FileEntry) HasChecksum() bool {
+	return file.SHA256 != "" || file.SHA512 != "" || file.SHA1 != ""
+}
+
+// IsAnonymous returns true if the s3:// entry must be fetched without
+// credentials, regardless of its alias.
+// Accepts "true", "1", "yes" (case-insensitive) as truthy values.
+func (file FileEntry) IsAnonymous() bool {
+	v := strings.ToLower(strings.TrimSpace(file.Anonymous))
+
+	return v == "true" || v == "1" || v == "yes"
+}
+
+// UsesCache returns true unless the entry opts out of the cache. It only
+// narrows the global cache setting: with the cache disabled nothing is cached.
+// Accepts "false", "0", "no" (case-insensitive) as falsy values; anything else,
+// including an empty value, follows the global setting.
+func (file FileEntry) UsesCache() bool {
+	v := strings.ToLower(strings.TrimSpace(file.Cache))
+
+	return v != "false" && v != "0" && v != "no"
+}
+
+// MagicBytes decodes the magic of the entry. It returns nil for an entry
+// without one.
+func (file FileEntry) MagicBytes() ([]byte, error) {
+	magic := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(file.Magic)), "0x")
+	if magic == "" {
+		return nil, nil
+	}
+
+	decoded, err := hex.DecodeString(magic)
+	if err != nil {
+		return nil, fmt.Errorf("magic %q must be hex encoded: %w", file.Magic, err)
+	}
+
+	return decoded, nil
+}
+
+// ConnectTimeoutDuration returns the connect timeout of the entry, or zero
+// when it follows the settings.
+func (file FileEntry) ConnectTimeoutDuration() time.Duration {
+	return parseAliasDuration(file.ConnectTimeout)
+}
+
+// DownloadTimeoutDuration returns the request timeout of the entry, or zero
+// when it follows the settings.
+func (file FileEntry) DownloadTimeoutDuration() time.Duration {
+	return parseAliasDuration(file.DownloadTimeout)
+}
+
+// ConnectTimeoutFor returns the connect timeout of file: its connect_timeout,
+// or settings.connect_timeout when it has none.
+func (settings Settings) ConnectTimeoutFor(file FileEntry) time.Duration {
+	timeout := file.ConnectTimeoutDuration()
+	if timeout > 0 {
+		return timeout
+	}
+
+	return settings.ConnectTimeout
+}
+
+// TimeoutFor returns the request timeout of file: its download_timeout, or
+// settings.timeout when it has none.
+func (settings Settings) TimeoutFor(file FileEntry) time.Duration {
+	timeout := file.DownloadTimeoutDuration()
+	if timeout > 0 {
+		return timeout
+	}
+
+	return settings.Timeout
+}
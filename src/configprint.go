@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"net/url"
-	"regexp"
+	"os"
+	"slices"
 	"sort"
 	"strings"
 
+	"gopkg.in/yaml.v3"
+
 	"xget/src/config"
 )
 
@@ -15,15 +19,150 @@ import (
 func printConfig(cfg config.Config) {
 	fmt.Println("\nsettings:")
 	fmt.Printf("  parallel:          %d\n", cfg.Settings.Parallel)
+
+	if cfg.Settings.SizeThreshold > 0 {
+		fmt.Printf("  parallel_small:    %d\n", cfg.Settings.ParallelSmall)
+		fmt.Printf("  parallel_large:    %d\n", cfg.Settings.ParallelLarge)
+		fmt.Printf("  size_threshold:    %d\n", cfg.Settings.SizeThreshold)
+	}
+
 	fmt.Printf("  retries:           %d\n", cfg.Settings.Retries)
+
+	if cfg.Settings.HTTPRetries > 0 {
+		fmt.Printf("  http_retries:      %d\n", cfg.Settings.HTTPRetries)
+	}
+
+	if cfg.Settings.S3Retries > 0 {
+		fmt.Printf("  s3_retries:        %d\n", cfg.Settings.S3Retries)
+	}
+
 	fmt.Printf("  retry_delay:       %s\n", cfg.Settings.RetryDelay)
 	fmt.Printf("  timeout:           %s\n", cfg.Settings.Timeout)
+	fmt.Printf("  connect_timeout:   %s\n", cfg.Settings.ConnectTimeout)
+	fmt.Printf("  metadata_retries:  %d\n", cfg.Settings.MetadataRetries)
+	fmt.Printf("  metadata_retry_delay: %s\n", cfg.Settings.MetadataRetryDelay)
 	fmt.Printf("  segments_per_file: %d\n", cfg.Settings.SegmentsPerFile)
 	fmt.Printf("  segment_min_size:  %d\n", cfg.Settings.SegmentMinSize)
+	fmt.Printf("  resume:            %t\n", cfg.Settings.IsResume())
+	fmt.Printf("  skip_if_newer:     %t\n", cfg.Settings.IsSkipIfNewer())
+	fmt.Printf("  skip_if_unchanged: %t\n", cfg.Settings.IsSkipIfUnchanged())
+	fmt.Printf("  retry_on_checksum_mismatch: %t\n", cfg.Settings.IsRetryOnChecksumMismatch())
+	fmt.Printf("  write_checksum_sidecar: %t\n", cfg.Settings.IsWriteChecksumSidecar())
+	fmt.Printf("  verify_after_rename: %t\n", cfg.Settings.IsVerifyAfterRename())
+	fmt.Printf("  flatten:           %t\n", cfg.Settings.IsFlatten())
+
+	if cfg.Settings.StripComponents > 0 {
+		fmt.Printf("  strip_components:  %d\n", cfg.Settings.StripComponents)
+	}
+
+	fmt.Printf("  confine_dests:     %t\n", cfg.Settings.IsConfineDests())
+	fmt.Printf("  transactional:     %t\n", cfg.Settings.IsTransactional())
+	fmt.Printf("  preflight:         %t\n", cfg.Settings.IsPreflight())
+	fmt.Printf("  header_check:      %t\n", cfg.Settings.IsHeaderCheck())
+	fmt.Printf("  direct_io:         %t\n", cfg.Settings.IsDirectIO())
+	fmt.Printf("  infer_extension:   %t\n", cfg.Settings.IsInferExtension())
+
+	if cfg.Settings.MinFreeSpace > 0 {
+		fmt.Printf("  min_free_space:    %d\n", cfg.Settings.MinFreeSpace)
+	}
+
+	if cfg.Settings.MinSpeed > 0 {
+		fmt.Printf("  min_speed:         %d B/s over %s\n", cfg.Settings.MinSpeed, cfg.Settings.MinSpeedWindow)
+	}
+
+	if cfg.Settings.MaxAge > 0 {
+		fmt.Printf("  max_age:           %s\n", cfg.Settings.MaxAge)
+	}
+
+	if cfg.Settings.ChecksumCache != "" {
+		fmt.Printf("  checksum_cache:    %s\n", cfg.Settings.ChecksumCache)
+	}
+
+	fmt.Printf("  http_version:      %s\n", cfg.Settings.HTTPVersion)
+	fmt.Printf("  max_errors:        %d\n", cfg.Settings.MaxErrors)
+
+	if cfg.Settings.VerifyParallel > 0 {
+		fmt.Printf("  verify_parallel:   %d\n", cfg.Settings.VerifyParallel)
+	}
+
+	if cfg.Settings.PerAliasParallel > 0 {
+		fmt.Printf("  per_alias_parallel: %d\n", cfg.Settings.PerAliasParallel)
+	}
+
+	if cfg.Settings.MaxOpenFiles > 0 {
+		fmt.Printf("  max_open_files:    %d\n", cfg.Settings.MaxOpenFiles)
+	}
+
+	fmt.Printf("  progress_mode:     %s\n", cfg.Settings.ProgressMode)
+
+	if cfg.Settings.ProgressSmoothing > 0 {
+		fmt.Printf("  progress_smoothing: %d\n", cfg.Settings.ProgressSmoothing)
+	}
+
+	if cfg.Settings.ProgressRefresh > 0 {
+		fmt.Printf("  progress_refresh:  %s\n", cfg.Settings.ProgressRefresh)
+	}
+
+	if cfg.Settings.DestDir != "" {
+		fmt.Printf("  dest_dir:          %s\n", cfg.Settings.DestDir)
+	}
+
+	if len(cfg.Settings.AllowedSchemes) > 0 {
+		fmt.Printf("  allowed_schemes:   %s\n", strings.Join(cfg.Settings.AllowedSchemes, ", "))
+	}
+
+	if cfg.Settings.ProgressFD != "" {
+		fmt.Printf("  progress_fd:       %s\n", cfg.Settings.ProgressFD)
+	}
+
+	if cfg.Settings.FailureReport != "" {
+		fmt.Printf("  failure_report:    %s\n", cfg.Settings.FailureReport)
+	}
+
+	if cfg.Settings.RemoteManifestURL != "" {
+		fmt.Printf("  remote_manifest_url: %s\n", redactURL(cfg.Settings.RemoteManifestURL))
+	}
+
+	if cfg.Settings.CredentialsFile != "" {
+		fmt.Printf("  credentials_file:  %s\n", cfg.Settings.CredentialsFile)
+	}
+
+	if cfg.Settings.VersionMarker.Path != "" {
+		fmt.Printf("  version_marker:    %s = %s\n", cfg.Settings.VersionMarker.Path, cfg.Settings.VersionMarker.Value)
+	}
+
+	if len(cfg.Settings.AllowedHosts) > 0 {
+		fmt.Printf("  allowed_hosts:     %s\n", strings.Join(cfg.Settings.AllowedHosts, ", "))
+	}
+
+	printHeaders("  http_headers:", "    ", cfg.Settings.HTTPHeaders)
+
+	if len(cfg.Settings.PerHostBandwidth) > 0 {
+		fmt.Println("  per_host_bandwidth:")
+
+		hosts := make([]string, 0, len(cfg.Settings.PerHostBandwidth))
+		for host := range cfg.Settings.PerHostBandwidth {
+			hosts = append(hosts, host)
+		}
+
+		sort.Strings(hosts)
+
+		for _, host := range hosts {
+			fmt.Printf("    %s: %d B/s\n", host, cfg.Settings.PerHostBandwidth[host])
+		}
+	}
 
 	fmt.Println("cache:")
-	fmt.Printf("  enabled: %t\n", cfg.Cache.IsEnabled())
-	fmt.Printf("  alias:   %s\n", cfg.Cache.Alias)
+	fmt.Printf("  enabled:         %t\n", cfg.Cache.IsEnabled())
+	fmt.Printf("  alias:           %s\n", cfg.Cache.Alias)
+	fmt.Printf("  upload_parallel: %d\n", cfg.Cache.UploadParallelCount())
+	fmt.Printf("  verify_existing: %t\n", cfg.Cache.IsVerifyExisting())
+	fmt.Printf("  verify_on_put:   %t\n", cfg.Cache.IsVerifyOnPut())
+	fmt.Printf("  auto_evict_corrupt: %t\n", cfg.Cache.IsAutoEvictCorrupt())
+
+	if cfg.Cache.KeyLayout != "" {
+		fmt.Printf("  key_layout:      %s\n", cfg.Cache.KeyLayout)
+	}
 
 	printAliases(cfg.Aliases)
 	printFiles(cfg.Files)
@@ -31,21 +170,93 @@ func printConfig(cfg config.Config) {
 	fmt.Println()
 }
 
+// runConfig prints the effective config of the given files as YAML: merged,
+// with defaults applied and env vars expanded, and with secrets redacted.
+func runConfig() int {
+	configPaths := os.Args[2:]
+	if len(configPaths) == 0 {
+		fmt.Fprintf(os.Stderr, "error: config command requires at least one config file\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s config <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
+
+		return 1
+	}
+
+	cfg, err := config.LoadMultiple(configPaths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+
+		return 1
+	}
+
+	data, err := yaml.Marshal(redactedConfig(*cfg))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error marshaling config: %v\n", err)
+
+		return 1
+	}
+
+	fmt.Print(string(data))
+
+	return 0
+}
+
+// redactedConfig returns a copy of cfg with alias credentials masked and URL
+// userinfo redacted, leaving cfg itself untouched.
+func redactedConfig(cfg config.Config) config.Config {
+	aliases := make(map[string]config.Alias, len(cfg.Aliases))
+
+	for name, alias := range cfg.Aliases {
+		aliases[name] = alias.Redacted()
+	}
+
+	files := make([]config.FileEntry, len(cfg.Files))
+
+	for i, file := range cfg.Files {
+		file.URL = redactURL(file.URL)
+		file.SHA256URL = redactURL(file.SHA256URL)
+		file.Headers = maskHeaders(file.Headers)
+		file.Parts = slices.Clone(file.Parts)
+
+		for j := range file.Parts {
+			file.Parts[j].URL = redactURL(file.Parts[j].URL)
+		}
+
+		files[i] = file
+	}
+
+	cfg.Aliases = aliases
+	cfg.Files = files
+	cfg.Settings.HTTPHeaders = maskHeaders(cfg.Settings.HTTPHeaders)
+	cfg.Settings.RemoteManifestURL = redactURL(cfg.Settings.RemoteManifestURL)
+
+	return cfg
+}
+
 // printAliases prints each alias with credentials masked.
 func printAliases(aliases map[string]config.Alias) {
 	fmt.Printf("aliases (%d):\n", len(aliases))
 
 	for _, name := range sortedAliasNames(aliases) {
-		alias := aliases[name]
+		alias := aliases[name].Redacted()
 
 		fmt.Printf("  %s:\n", name)
 		fmt.Printf("    endpoint:        %s\n", alias.Endpoint)
 		fmt.Printf("    region:          %s\n", alias.Region)
 		fmt.Printf("    bucket:          %s\n", alias.Bucket)
 		fmt.Printf("    prefix:          %s\n", alias.Prefix)
-		fmt.Printf("    access_key:      %s\n", maskTail(alias.AccessKey))
-		fmt.Printf("    secret_key:      %s\n", maskTail(alias.SecretKey))
+		fmt.Printf("    access_key:      %s\n", alias.AccessKey)
+		fmt.Printf("    secret_key:      %s\n", alias.SecretKey)
 		fmt.Printf("    no_sign_request: %t\n", alias.IsNoSignRequest())
+		fmt.Printf("    timeout:         %s\n", alias.Timeout)
+		fmt.Printf("    connect_timeout: %s\n", alias.ConnectTimeout)
+
+		if alias.FallbackAlias != "" {
+			fmt.Printf("    fallback_alias:  %s\n", alias.FallbackAlias)
+		}
+
+		if alias.CredentialProcess != "" {
+			fmt.Printf("    credential_process: %s\n", alias.CredentialProcess)
+		}
 	}
 }
 
@@ -54,12 +265,83 @@ func printFiles(files []config.FileEntry) {
 	fmt.Printf("files (%d):\n", len(files))
 
 	for _, file := range files {
-		fmt.Printf("  - url:  %s\n", redactURL(file.URL))
-		fmt.Printf("    dest: %s\n", file.Dest)
+		if len(file.Parts) > 0 {
+			fmt.Printf("  - dest: %s\n", file.Dest)
+		} else {
+			fmt.Printf("  - url:  %s\n", redactURL(file.URL))
+			fmt.Printf("    dest: %s\n", file.Dest)
+		}
 
 		if file.SHA256 != "" {
 			fmt.Printf("    sha256: %s\n", file.SHA256)
 		}
+
+		if file.SHA256URL != "" {
+			fmt.Printf("    sha256_url: %s\n", redactURL(file.SHA256URL))
+		}
+
+		if file.SHA512 != "" {
+			fmt.Printf("    sha512: %s\n", file.SHA512)
+		}
+
+		if file.SHA1 != "" {
+			fmt.Printf("    sha1: %s\n", file.SHA1)
+		}
+
+		if file.MD5 != "" {
+			fmt.Printf("    md5: %s\n", file.MD5)
+		}
+
+		if file.Range != "" {
+			fmt.Printf("    range: %s\n", file.Range)
+		}
+
+		if file.Priority != 0 {
+			fmt.Printf("    priority: %d\n", file.Priority)
+		}
+
+		if file.ConnectTimeout != "" {
+			fmt.Printf("    connect_timeout: %s\n", file.ConnectTimeout)
+		}
+
+		if file.DownloadTimeout != "" {
+			fmt.Printf("    download_timeout: %s\n", file.DownloadTimeout)
+		}
+
+		if file.Magic != "" {
+			fmt.Printf("    magic: %s\n", file.Magic)
+		}
+
+		if file.ETag != "" {
+			fmt.Printf("    etag: %s\n", file.ETag)
+		}
+
+		if file.IsAnonymous() {
+			fmt.Println("    anonymous: true")
+		}
+
+		if !file.UsesCache() {
+			fmt.Println("    cache: false")
+		}
+
+		if len(file.Metadata) > 0 {
+			fmt.Println("    metadata:")
+
+			for _, key := range slices.Sorted(maps.Keys(file.Metadata)) {
+				fmt.Printf("      %s: %s\n", key, file.Metadata[key])
+			}
+		}
+
+		printHeaders("    headers:", "      ", file.Headers)
+
+		if len(file.Parts) > 0 {
+			fmt.Printf("    parts (%d):\n", len(file.Parts))
+
+			for _, part := range file.Parts {
+				fmt.Printf("      - url:    %s\n", redactURL(part.URL))
+				fmt.Printf("        sha256: %s\n", part.SHA256)
+			}
+		}
 	}
 }
 
@@ -75,36 +357,52 @@ func sortedAliasNames(aliases map[string]config.Alias) []string {
 	return names
 }
 
-// mask hides a secret, keeping the last 4 chars when length allows.
-func mask(secret string) string {
-	if len(secret) > 4 {
-		return "****" + secret[len(secret)-4:]
+// maskHeaders returns a copy of headers with every value masked, as they
+// often carry tokens.
+func maskHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
 	}
 
-	return "***"
+	masked := make(map[string]string, len(headers))
+	for name, value := range headers {
+		masked[name] = mask(value)
+	}
+
+	return masked
 }
 
-// envPlaceholderPattern matches an unexpanded ${VAR} env var reference.
-var envPlaceholderPattern = regexp.MustCompile(`\$\{[^}]+\}`)
+// printHeaders prints headers sorted by name with their values masked,
+// under title.
+func printHeaders(title, indent string, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+
+	fmt.Println(title)
 
-// maskTail masks a credential, reporting unset values explicitly.
-// A value still holding an unexpanded ${VAR} placeholder is not a real secret,
-// so it is shown verbatim to surface the missing environment variable.
-func maskTail(secret string) string {
-	if secret == "" {
-		return "<not set>"
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		fmt.Printf("%s%s: %s\n", indent, name, mask(headers[name]))
 	}
+}
 
-	if envPlaceholderPattern.MatchString(secret) {
-		return secret
+// mask hides a secret, keeping the last 4 chars when length allows.
+func mask(secret string) string {
+	if len(secret) > 4 {
+		return "****" + secret[len(secret)-4:]
 	}
 
-	return mask(secret)
+	return "***"
 }
 
-// redactURL masks any user:password embedded in the URL.
-// The original string is returned when it has no userinfo or cannot be parsed.
+// redactURL masks any user:password embedded in the URL, and collapses the
+// content of a data: URL, which may be key material, to its length. The
+// original string is returned when it has no userinfo or cannot be parsed.
 func redactURL(raw string) string {
+	if config.IsDataURL(raw) {
+		return redactDataURL(raw)
+	}
+
 	parsed, err := url.Parse(raw)
 	if err != nil {
 		return raw
@@ -130,3 +428,16 @@ func redactURL(raw string) string {
 
 	return rest[:idx+2] + masked + "@" + rest[idx+2:]
 }
+
+// redactDataURL renders a data: URL as data:<mediatype>,<N bytes>, keeping
+// its header, with ;base64 if present, but not its content.
+func redactDataURL(raw string) string {
+	header, _, _ := strings.Cut(raw[len("data:"):], ",")
+
+	_, content, err := config.ParseDataURL(raw)
+	if err != nil {
+		return "data:" + header + ",<invalid>"
+	}
+
+	return fmt.Sprintf("data:%s,<%d bytes>", header, len(content))
+}
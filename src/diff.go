@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"xget/src/config"
+)
+
+// diffUsage is the synopsis of the diff command.
+const diffUsage = "diff <config.yaml> <directory> [-o text|json]"
+
+// diffReport lists how a directory differs from a config. Config dests are
+// reported as written in the config, extra files relative to the directory.
+type diffReport struct {
+	Missing    []string `json:"missing"`
+	Mismatched []string `json:"mismatched"`
+	Extra      []string `json:"extra"`
+	Matching   int      `json:"matching"`
+}
+
+func (report diffReport) inSync() bool {
+	return len(report.Missing) == 0 && len(report.Mismatched) == 0 && len(report.Extra) == 0
+}
+
+// stateSuffixes are the suffixes of the files xget keeps next to a dest:
+// partials, their hash and segment state, parts and sidecars.
+var stateSuffixes = []string{
+	hashStateSuffix,
+	".segments",
+	".partial",
+	".sha256",
+	etagSidecarSuffix,
+	headSidecarSuffix,
+}
+
+var partSuffix = regexp.MustCompile(`\.part\d{3,}$`)
+
+// Exit codes of the diff command, as with diff(1): drift is told apart from
+// a diff that could not be completed.
+const (
+	diffExitInSync = 0
+	diffExitDrift  = 1
+	diffExitError  = 2
+)
+
+func runDiff() int {
+	args, err := parseDiffArgs(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], diffUsage)
+
+		return diffExitError
+	}
+
+	cfg, err := config.CheckMultiple([]string{args.configPath})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+
+		return diffExitError
+	}
+
+	report, err := diffDirectory(cfg.Files, args.dirPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+		return diffExitError
+	}
+
+	if args.format == "json" {
+		err = writeDiffJSON(os.Stdout, report)
+	} else {
+		writeDiffText(os.Stdout, report)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+		return diffExitError
+	}
+
+	if !report.inSync() {
+		return diffExitDrift
+	}
+
+	return diffExitInSync
+}
+
+// diffDirectory compares the files of a config with the directory they are
+// downloaded to. The directory takes the place of settings.dest_dir, as with
+// -output-dir: relative dests are resolved against it. It is hashed once
+// with walkDirectory; dests outside it, or that the walk could not hash, are
+// verified on their own. Entries without a sha256 are only checked to exist,
+// and files under the dest of a prefix entry are never extra, since the
+// objects of the prefix are only known at run time.
+func diffDirectory(files []config.FileEntry, dirPath string) (diffReport, error) {
+	var report diffReport
+
+	dirPath = filepath.Clean(dirPath)
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return report, fmt.Errorf("accessing directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return report, fmt.Errorf("path is not a directory: %s", dirPath)
+	}
+
+	entries, warnings, err := walkDirectory(dirPath, generateOptions{
+		workers:    defaultGenerateWorkers,
+		bufferSize: defaultGenerateBufferSize,
+	})
+
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	if err != nil {
+		return report, err
+	}
+
+	onDisk := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		onDisk[filepath.Join(dirPath, entry.Dest)] = entry.SHA256
+	}
+
+	dests := make(map[string]bool, len(files))
+
+	var prefixDirs []string
+
+	for _, file := range files {
+		path := file.Dest
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dirPath, path)
+		}
+
+		path = filepath.Clean(path)
+		dests[path] = true
+
+		if config.IsPrefixURL(file.URL) {
+			prefixDirs = append(prefixDirs, path)
+
+			continue
+		}
+
+		state, err := diffFile(path, file, onDisk)
+		if err != nil {
+			return report, err
+		}
+
+		switch state {
+		case "missing":
+			report.Missing = append(report.Missing, file.Dest)
+		case "mismatched":
+			report.Mismatched = append(report.Mismatched, file.Dest)
+		default:
+			report.Matching++
+		}
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dirPath, entry.Dest)
+		if dests[path] || isStateFile(path, dests) || underAny(path, prefixDirs) {
+			continue
+		}
+
+		report.Extra = append(report.Extra, entry.Dest)
+	}
+
+	return report, nil
+}
+
+// diffFile returns "missing", "mismatched" or "" for the file at path,
+// using the sha256 of the walk when there is one. Files checked by other
+// algorithms only are hashed again.
+func diffFile(path string, file config.FileEntry, onDisk map[string]string) (string, error) {
+	actual, ok := onDisk[path]
+	if ok && (file.SHA256 != "" || !file.HasChecksum()) {
+		if file.SHA256 != "" && actual != file.SHA256 {
+			return "mismatched", nil
+		}
+
+		return "", nil
+	}
+
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "missing", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("accessing %s: %w", path, err)
+	}
+
+	if !file.HasChecksum() {
+		return "", nil
+	}
+
+	valid, err := VerifyFileChecksums(path, file)
+	if err != nil {
+		return "", fmt.Errorf("verifying %s: %w", path, err)
+	}
+
+	if !valid {
+		return "mismatched", nil
+	}
+
+	return "", nil
+}
+
+// isStateFile reports whether path is a file xget keeps next to one of
+// dests, such as a partial, a part or a checksum sidecar, rather than a file
+// missing from the config.
+func isStateFile(path string, dests map[string]bool) bool {
+	for {
+		trimmed := partSuffix.ReplaceAllString(path, "")
+
+		for _, suffix := range stateSuffixes {
+			base, ok := strings.CutSuffix(trimmed, suffix)
+			if ok {
+				trimmed = base
+
+				break
+			}
+		}
+
+		if trimmed == path {
+			return false
+		}
+
+		if dests[trimmed] {
+			return true
+		}
+
+		path = trimmed
+	}
+}
+
+// underAny reports whether path is inside one of dirs.
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeDiffText(out io.Writer, report diffReport) {
+	for _, dest := range report.Missing {
+		fmt.Fprintf(out, "missing     %s\n", dest)
+	}
+
+	for _, dest := range report.Mismatched {
+		fmt.Fprintf(out, "mismatched  %s\n", dest)
+	}
+
+	for _, path := range report.Extra {
+		fmt.Fprintf(out, "extra       %s\n", path)
+	}
+
+	if report.inSync() {
+		fmt.Fprintf(out, "in sync: %d files\n", report.Matching)
+
+		return
+	}
+
+	fmt.Fprintf(out, "\n%d missing, %d mismatched, %d extra, %d matching\n",
+		len(report.Missing), len(report.Mismatched), len(report.Extra), report.Matching)
+}
+
+func writeDiffJSON(out io.Writer, report diffReport) error {
+	// Empty lists are written as [] rather than null, for consumers like jq.
+	for _, list := range []*[]string{&report.Missing, &report.Mismatched, &report.Extra} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling diff: %w", err)
+	}
+
+	_, err = out.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("writing diff: %w", err)
+	}
+
+	return nil
+}
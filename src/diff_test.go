@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"xget/src/config"
+)
+
+func writeDiffFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	writeDiffFile(t, filepath.Join(dir, "ok.bin"), "ok")
+	writeDiffFile(t, filepath.Join(dir, "sub", "changed.bin"), "changed")
+	writeDiffFile(t, filepath.Join(dir, "unhashed.bin"), "anything")
+	writeDiffFile(t, filepath.Join(dir, "stray.txt"), "stray")
+	writeDiffFile(t, filepath.Join(dir, "pending.bin.partial"), "half")
+	writeDiffFile(t, filepath.Join(dir, "pending.bin.partial.sha256state"), "state")
+	writeDiffFile(t, filepath.Join(dir, "ok.bin.sha256"), "sidecar")
+	writeDiffFile(t, filepath.Join(dir, "mirror", "object.bin"), "object")
+
+	outside := filepath.Join(t.TempDir(), "outside.bin")
+	writeDiffFile(t, outside, "outside")
+
+	files := []config.FileEntry{
+		{URL: "https://example.com/ok.bin", Dest: "ok.bin", SHA256: sha256Hex("ok")},
+		{URL: "https://example.com/changed.bin", Dest: "sub/changed.bin", SHA256: sha256Hex("original")},
+		{URL: "https://example.com/unhashed.bin", Dest: "unhashed.bin"},
+		{URL: "https://example.com/pending.bin", Dest: "pending.bin", SHA256: sha256Hex("pending")},
+		{URL: "s3://minio/bucket/mirror/", Dest: "mirror"},
+		{URL: "https://example.com/outside.bin", Dest: outside, SHA256: sha256Hex("outside")},
+	}
+
+	report, err := diffDirectory(files, dir)
+	if err != nil {
+		t.Fatalf("diffDirectory: %v", err)
+	}
+
+	if !slices.Equal(report.Missing, []string{"pending.bin"}) {
+		t.Errorf("missing = %v, want [pending.bin]", report.Missing)
+	}
+
+	if !slices.Equal(report.Mismatched, []string{"sub/changed.bin"}) {
+		t.Errorf("mismatched = %v, want [sub/changed.bin]", report.Mismatched)
+	}
+
+	if !slices.Equal(report.Extra, []string{"stray.txt"}) {
+		t.Errorf("extra = %v, want [stray.txt]", report.Extra)
+	}
+
+	if report.Matching != 3 {
+		t.Errorf("matching = %d, want 3", report.Matching)
+	}
+
+	if report.inSync() {
+		t.Error("expected the directory to be out of sync")
+	}
+}
+
+func TestDiffDirectoryInSync(t *testing.T) {
+	dir := t.TempDir()
+
+	writeDiffFile(t, filepath.Join(dir, "a.bin"), "a")
+
+	report, err := diffDirectory([]config.FileEntry{
+		{URL: "https://example.com/a.bin", Dest: "a.bin", SHA256: sha256Hex("a")},
+	}, dir)
+	if err != nil {
+		t.Fatalf("diffDirectory: %v", err)
+	}
+
+	if !report.inSync() {
+		t.Fatalf("expected in sync, got %+v", report)
+	}
+
+	var text bytes.Buffer
+
+	writeDiffText(&text, report)
+
+	if text.String() != "in sync: 1 files\n" {
+		t.Errorf("unexpected text report %q", text.String())
+	}
+
+	var out bytes.Buffer
+
+	err = writeDiffJSON(&out, report)
+	if err != nil {
+		t.Fatalf("writeDiffJSON: %v", err)
+	}
+
+	if !strings.Contains(out.String(), `"missing": []`) {
+		t.Errorf("expected empty lists as [], got %s", out.String())
+	}
+
+	var decoded diffReport
+
+	err = json.Unmarshal(out.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("decoding report: %v", err)
+	}
+
+	if decoded.Matching != 1 {
+		t.Errorf("decoded matching = %d, want 1", decoded.Matching)
+	}
+}
+
+func TestDiffDirectoryNotADirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	writeDiffFile(t, path, "x")
+
+	_, err := diffDirectory(nil, path)
+	if err == nil {
+		t.Fatal("expected an error for a file instead of a directory")
+	}
+}
+
+func TestRunDiffExitCodes(t *testing.T) {
+	inSync := t.TempDir()
+	drifted := t.TempDir()
+
+	writeDiffFile(t, filepath.Join(inSync, "a.bin"), "a")
+	writeDiffFile(t, filepath.Join(drifted, "a.bin"), "a")
+	writeDiffFile(t, filepath.Join(drifted, "stray.txt"), "stray")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeDiffFile(t, configPath, "files:\n"+
+		"  - url: https://example.com/a.bin\n"+
+		"    dest: a.bin\n"+
+		"    sha256: "+sha256Hex("a")+"\n")
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer devNull.Close()
+
+	args, stdout, stderr := os.Args, os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = devNull, devNull
+
+	t.Cleanup(func() {
+		os.Args, os.Stdout, os.Stderr = args, stdout, stderr
+	})
+
+	tests := []struct {
+		name   string
+		config string
+		dir    string
+		want   int
+	}{
+		{"in sync", configPath, inSync, diffExitInSync},
+		{"drift", configPath, drifted, diffExitDrift},
+		{"missing directory", configPath, filepath.Join(inSync, "missing"), diffExitError},
+		{"missing config", filepath.Join(inSync, "missing.yaml"), inSync, diffExitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = []string{"xget", "diff", tt.config, tt.dir}
+
+			got := runDiff()
+			if got != tt.want {
+				t.Errorf("runDiff() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
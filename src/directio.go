@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+const (
+	// directIOAlignment is the block size O_DIRECT offsets, lengths and
+	// buffer addresses are aligned to. 4 KiB covers common file systems.
+	directIOAlignment = 4096
+
+	// directIOBufferSize is how much is collected before each direct write.
+	directIOBufferSize = 1 << 20
+)
+
+// errDirectIOUnsupported marks platforms without O_DIRECT.
+var errDirectIOUnsupported = errors.New("direct I/O is not supported on this platform")
+
+// directWriter implements settings.direct_io. It collects writes into an
+// aligned buffer and writes whole blocks through an O_DIRECT descriptor, so
+// they bypass the page cache. The tail that does not fill a block is written
+// through the buffered file on Close.
+type directWriter struct {
+	direct   *os.File
+	buffered *os.File
+	offset   int64
+	buf      []byte
+	n        int
+	closed   bool
+}
+
+// newDirectWriter opens partialPath with O_DIRECT to continue writing at
+// offset, which must be aligned. buffered is the partial as opened for
+// normal writes; it receives the tail.
+func newDirectWriter(partialPath string, buffered *os.File, offset int64) (*directWriter, error) {
+	if offset%directIOAlignment != 0 {
+		return nil, fmt.Errorf("offset %d is not aligned for direct I/O", offset)
+	}
+
+	direct, err := openDirect(partialPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &directWriter{
+		direct:   direct,
+		buffered: buffered,
+		offset:   offset,
+		buf:      alignedBuffer(directIOBufferSize),
+	}, nil
+}
+
+// alignedBuffer returns a buffer of size bytes whose address is a multiple
+// of directIOAlignment, as O_DIRECT requires.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directIOAlignment)
+	address := uintptr(unsafe.Pointer(unsafe.SliceData(buf))) //nolint:gosec // only the address is inspected
+	shift := int((directIOAlignment - address%directIOAlignment) % directIOAlignment)
+
+	return buf[shift : shift+size]
+}
+
+func (writer *directWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		copied := copy(writer.buf[writer.n:], p)
+		writer.n += copied
+		written += copied
+		p = p[copied:]
+
+		if writer.n == len(writer.buf) {
+			err := writer.flushBlocks()
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// flushBlocks writes the whole blocks of the buffer through the direct
+// descriptor and keeps the rest for the next write.
+func (writer *directWriter) flushBlocks() error {
+	blocks := writer.n - writer.n%directIOAlignment
+	if blocks == 0 {
+		return nil
+	}
+
+	_, err := writer.direct.WriteAt(writer.buf[:blocks], writer.offset)
+	if err != nil {
+		return fmt.Errorf("direct write: %w", err)
+	}
+
+	writer.offset += int64(blocks)
+	writer.n = copy(writer.buf, writer.buf[blocks:writer.n])
+
+	return nil
+}
+
+// Close writes what is buffered, the unaligned tail through the buffered
+// file, and closes both files. Closing again does nothing.
+func (writer *directWriter) Close() error {
+	if writer.closed {
+		return nil
+	}
+
+	writer.closed = true
+
+	err := writer.flushBlocks()
+	if err == nil && writer.n > 0 {
+		err = writer.writeTail()
+	}
+
+	err = errors.Join(err, writer.direct.Close(), writer.buffered.Close())
+	if err != nil {
+		return fmt.Errorf("closing direct writer: %w", err)
+	}
+
+	return nil
+}
+
+func (writer *directWriter) writeTail() error {
+	// The buffered file may be in append mode, which rules out WriteAt;
+	// after the direct writes its end is where the tail belongs.
+	_, err := writer.buffered.Seek(writer.offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("seeking to tail: %w", err)
+	}
+
+	_, err = writer.buffered.Write(writer.buf[:writer.n])
+	if err != nil {
+		return fmt.Errorf("writing tail: %w", err)
+	}
+
+	return nil
+}
+
+// partialWriter returns the writer a single-stream download writes the
+// partial through: the partial itself, or with settings.direct_io a
+// directWriter. Direct I/O falls back to buffered writes where it is not
+// available, e.g. on other platforms, on file systems such as tmpfs, or
+// when a resumed partial ends off a block boundary.
+func (downloader *Downloader) partialWriter(partialPath string, partial *os.File, offset int64) io.WriteCloser {
+	if !downloader.cfg.Settings.IsDirectIO() {
+		return partial
+	}
+
+	writer, err := newDirectWriter(partialPath, partial, offset)
+	if err != nil {
+		return partial
+	}
+
+	return writer
+}
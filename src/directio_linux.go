@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openDirect opens path for writing with O_DIRECT.
+func openDirect(path string) (*os.File, error) {
+	flags := os.O_WRONLY | syscall.O_DIRECT
+
+	file, err := os.OpenFile(path, flags, 0o644) //nolint:gosec // path is the partial of a configured dest
+	if err != nil {
+		return nil, fmt.Errorf("opening with O_DIRECT: %w", err)
+	}
+
+	return file, nil
+}
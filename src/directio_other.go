@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// openDirect reports that O_DIRECT is not available, so writes stay buffered.
+func openDirect(string) (*os.File, error) {
+	return nil, errDirectIOUnsupported
+}
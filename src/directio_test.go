@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestDirectWriter(t *testing.T) {
+	// A partial resumed at one block, written in uneven chunks that cross
+	// block and buffer boundaries and end with an unaligned tail.
+	prefix := bytes.Repeat([]byte{'p'}, directIOAlignment)
+	content := make([]byte, directIOBufferSize+3*directIOAlignment+123)
+
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	partialPath := filepath.Join(t.TempDir(), "file.partial")
+
+	err := os.WriteFile(partialPath, prefix, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partial, offset, err := openPartialFile(partialPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := newDirectWriter(partialPath, partial, offset)
+	if err != nil {
+		partial.Close()
+		t.Skipf("direct I/O unavailable here: %v", err)
+	}
+
+	for rest := content; len(rest) > 0; {
+		n := min(len(rest), 7777)
+
+		_, err = writer.Write(rest[:n])
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+
+		rest = rest[n:]
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Errorf("second close: %v", err)
+	}
+
+	got, err := os.ReadFile(partialPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, append(prefix, content...)) {
+		t.Errorf("partial has %d bytes, want %d with the written content", len(got), len(prefix)+len(content))
+	}
+}
+
+func TestPartialWriterFallback(t *testing.T) {
+	partialPath := filepath.Join(t.TempDir(), "file.partial")
+
+	partial, err := os.Create(partialPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer partial.Close()
+
+	buffered := NewDownloader(&config.Config{}, nil)
+	if writer := buffered.partialWriter(partialPath, partial, 0); writer != partial {
+		t.Error("expected buffered writes without direct_io")
+	}
+
+	direct := NewDownloader(&config.Config{Settings: config.Settings{DirectIO: "true"}}, nil)
+	if writer := direct.partialWriter(partialPath, partial, 100); writer != partial {
+		t.Error("expected buffered writes for an unaligned offset")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// Doctor check outcomes.
+const (
+	doctorOK          = "ok"
+	doctorAuthError   = "auth error"
+	doctorUnreachable = "unreachable"
+)
+
+// doctorCheck is the outcome of probing one alias or host.
+type doctorCheck struct {
+	target string
+	status string
+	detail string
+}
+
+// runDoctor checks that every alias and HTTP host referenced by the configs
+// is reachable and accepts the configured credentials, without downloading.
+func runDoctor() int {
+	configPaths := os.Args[2:]
+	if len(configPaths) == 0 {
+		fmt.Fprintf(os.Stderr, "error: doctor command requires at least one config file\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s doctor <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
+
+		return 1
+	}
+
+	cfg, err := config.LoadMultiple(configPaths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+
+		return 1
+	}
+
+	ctx := context.Background()
+
+	aliasChecks := checkAliases(ctx, cfg.Aliases)
+	hostChecks := checkHosts(ctx, cfg)
+
+	printDoctorChecks("aliases", aliasChecks)
+	printDoctorChecks("hosts", hostChecks)
+
+	failed := 0
+
+	for _, check := range append(aliasChecks, hostChecks...) {
+		if check.status != doctorOK {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d checks failed\n", failed)
+
+		return 1
+	}
+
+	fmt.Printf("\nAll %d checks passed\n", len(aliasChecks)+len(hostChecks))
+
+	return 0
+}
+
+// checkAliases lists one key of every alias bucket, in alias name order.
+func checkAliases(ctx context.Context, aliases map[string]config.Alias) []doctorCheck {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	checks := make([]doctorCheck, 0, len(names))
+
+	for _, name := range names {
+		alias := aliases[name]
+		check := doctorCheck{target: name, status: doctorOK, detail: alias.Endpoint + "/" + alias.Bucket}
+
+		err := storage.CheckAlias(ctx, alias)
+		if err != nil {
+			check.status = doctorUnreachable
+			if storage.IsAuthError(err) {
+				check.status = doctorAuthError
+			}
+
+			check.detail = err.Error()
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// checkHosts sends a HEAD request for the first file of every distinct
+// HTTP(S) host, in config order.
+func checkHosts(ctx context.Context, cfg *config.Config) []doctorCheck {
+	var checks []doctorCheck
+
+	seen := make(map[string]bool)
+
+	for _, file := range cfg.Files {
+		parsed, err := url.Parse(file.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			continue
+		}
+
+		host := parsed.Scheme + "://" + parsed.Host
+		if seen[host] {
+			continue
+		}
+
+		seen[host] = true
+
+		source := storage.NewHTTPSource(
+			file.URL,
+			cfg.Settings.Timeout,
+			storage.WithHTTPVersion(cfg.Settings.HTTPVersion),
+			storage.WithConnectTimeout(cfg.Settings.ConnectTimeout),
+			storage.WithHeaders(cfg.Settings.HTTPHeadersFor(file)),
+		)
+
+		checks = append(checks, probeHost(ctx, host, source))
+	}
+
+	return checks
+}
+
+// probeHost classifies the HEAD response of source. Any response below 400
+// counts as reachable, as does 405 from servers that refuse HEAD.
+func probeHost(ctx context.Context, host string, source *storage.HTTPSource) doctorCheck {
+	status, err := source.Probe(ctx)
+	if err != nil {
+		return doctorCheck{target: host, status: doctorUnreachable, detail: err.Error()}
+	}
+
+	check := doctorCheck{target: host, status: doctorOK, detail: fmt.Sprintf("HTTP %d", status)}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		check.status = doctorAuthError
+	case status >= http.StatusBadRequest && status != http.StatusMethodNotAllowed:
+		check.status = doctorUnreachable
+	}
+
+	return check
+}
+
+// printDoctorChecks prints one section of the doctor report.
+func printDoctorChecks(title string, checks []doctorCheck) {
+	fmt.Printf("\n%s:\n", title)
+
+	if len(checks) == 0 {
+		fmt.Println("  (none)")
+
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, check := range checks {
+		fmt.Fprintf(table, "  %s\t%s\t%s\n", check.target, check.status, check.detail)
+	}
+
+	table.Flush()
+}
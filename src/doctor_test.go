@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestCheckHosts(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus string
+	}{
+		{name: "ok", status: http.StatusOK, wantStatus: doctorOK},
+		{name: "head not allowed", status: http.StatusMethodNotAllowed, wantStatus: doctorOK},
+		{name: "forbidden", status: http.StatusForbidden, wantStatus: doctorAuthError},
+		{name: "unauthorized", status: http.StatusUnauthorized, wantStatus: doctorAuthError},
+		{name: "server error", status: http.StatusInternalServerError, wantStatus: doctorUnreachable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				if r.Method != http.MethodHead {
+					t.Errorf("expected HEAD, got %s", r.Method)
+				}
+
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{
+				Files: []config.FileEntry{
+					{URL: server.URL + "/a.bin"},
+					{URL: server.URL + "/b.bin"},
+					{URL: "s3://alias/key"},
+				},
+			}
+
+			checks := checkHosts(context.Background(), cfg)
+			if len(checks) != 1 {
+				t.Fatalf("expected 1 check, got %d", len(checks))
+			}
+
+			if checks[0].status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q (%s)", tt.wantStatus, checks[0].status, checks[0].detail)
+			}
+
+			if requests != 1 {
+				t.Errorf("expected 1 request per host, got %d", requests)
+			}
+		})
+	}
+}
+
+func TestCheckHostsUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	cfg := &config.Config{Files: []config.FileEntry{{URL: url + "/a.bin"}}}
+
+	checks := checkHosts(context.Background(), cfg)
+	if len(checks) != 1 || checks[0].status != doctorUnreachable {
+		t.Errorf("expected one unreachable check, got %+v", checks)
+	}
+}
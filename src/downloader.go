@@ -2,124 +2,761 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"xget/src/config"
 	"xget/src/segment"
 	"xget/src/storage"
+	"xget/src/tracing"
 
 	"github.com/vbauerster/mpb/v8"
 )
 
+// errChecksumMismatch marks a download whose content did not match its
+// sha256. It is retried only with settings.retry_on_checksum_mismatch.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// errNotCached marks a file that -offline could not restore from an existing
+// copy or the cache.
+var errNotCached = errors.New("not in cache")
+
+// errDeferred is returned by downloadFile for a file -resume-only defers.
+// runFile turns it into a deferred result.
+var errDeferred = errors.New("deferred by -resume-only")
+
 // DownloadResult represents the result of a single file download.
 type DownloadResult struct {
-	File  config.FileEntry
-	Error error
+	File    config.FileEntry
+	Error   error
+	Timings Timings
+	Size    int64
+
+	// Deferred is set for files -resume-only deferred: they neither failed
+	// nor are in place.
+	Deferred bool
 }
 
 // Downloader manages parallel file downloads.
 type Downloader struct {
-	cfg   *config.Config
-	cache *Cache
+	cfg       *config.Config
+	cache     *Cache
+	checksums *checksumResolver
+	uploads   *cacheUploads
+	ci        *ciProgress
+	events    *progressStream
+	limits    hostLimits
+	offline   bool
+	health    *mirrorHealth
+
+	// resumeOnly defers files without a partial, for -resume-only.
+	resumeOnly bool
+
+	// sequential starts each file only once the one before it has finished,
+	// in config order, for -sequential.
+	sequential bool
+
+	// verifySlots bounds how many existing dests are hashed at once, for
+	// settings.verify_parallel. It is nil when the hashing is unbounded.
+	verifySlots chan struct{}
+
+	// openFiles bounds the files and connections held open at once, for
+	// settings.max_open_files. It is nil when they are unbounded.
+	openFiles *fdBudget
+
+	// aliases bounds the downloads from each s3:// alias, for
+	// settings.per_alias_parallel. It is nil when they are unbounded.
+	aliases *aliasSlots
+
+	// queue holds the files of the running Download, for Enqueue.
+	queue atomic.Pointer[downloadQueue]
+
+	// tx records the dests written by the running Download, for
+	// settings.transactional. It holds nil when the setting is off.
+	tx atomic.Pointer[transaction]
+
+	// mirrored maps the dest of each object expanded from a prefix entry to
+	// its listing. It is filled before the downloads start.
+	mirrored map[string]mirroredObject
+
+	// inferredDests holds the dests of the running Download, so
+	// settings.infer_extension never renames a dest onto another one.
+	inferredDests *destClaims
+
+	warningsMu sync.Mutex
+	warnings   []string
 }
 
 // NewDownloader creates a new Downloader.
 func NewDownloader(cfg *config.Config, cache *Cache) *Downloader {
-	return &Downloader{
-		cfg:   cfg,
-		cache: cache,
+	downloader := &Downloader{
+		cfg:     cfg,
+		cache:   cache,
+		uploads: newCacheUploads(cfg.Cache.UploadParallelCount()),
+	}
+
+	if cfg.Settings.ProgressMode == config.ProgressModeCI {
+		downloader.ci = newCIProgress(os.Stderr)
+	}
+
+	if cfg.Settings.VerifyParallel > 0 {
+		downloader.verifySlots = make(chan struct{}, cfg.Settings.VerifyParallel)
+	}
+
+	downloader.openFiles = newFDBudget(cfg.Settings.MaxOpenFiles)
+	downloader.aliases = newAliasSlots(cfg.Settings.PerAliasParallel)
+
+	downloader.initChecksums(cfg.Files)
+
+	return downloader
+}
+
+// initChecksums creates the checksum resolver once any of files has a
+// sha256_url.
+func (downloader *Downloader) initChecksums(files []config.FileEntry) {
+	if downloader.checksums != nil {
+		return
+	}
+
+	settings := downloader.cfg.Settings
+
+	for _, file := range files {
+		if file.SHA256URL != "" {
+			cachePath := settings.ChecksumCache
+			if cachePath == "" {
+				cachePath = defaultChecksumCachePath()
+			}
+
+			downloader.checksums = newChecksumResolver(cachePath, settings.Timeout)
+			downloader.checksums.client.CheckRedirect = redirectPolicy(settings)
+			downloader.checksums.headers = settings.HTTPHeaders
+
+			return
+		}
 	}
 }
 
+// Warnings returns the warnings reported during Download, in report order.
+func (downloader *Downloader) Warnings() []string {
+	downloader.warningsMu.Lock()
+	defer downloader.warningsMu.Unlock()
+
+	return append([]string(nil), downloader.warnings...)
+}
+
+// warn prints a non-fatal problem and records it for -strict.
+func (downloader *Downloader) warn(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+
+	downloader.warningsMu.Lock()
+	downloader.warnings = append(downloader.warnings, message)
+	downloader.warningsMu.Unlock()
+
+	fmt.Println("warning: " + message)
+}
+
 // Download downloads all files from the config.
+// When settings.max_errors is set, the remaining downloads are cancelled once
+// that many files have failed.
 func (downloader *Downloader) Download(ctx context.Context) []DownloadResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	listFailures := downloader.expandPrefixes(ctx)
+
+	if downloader.cfg.Settings.IsInferExtension() {
+		downloader.inferredDests = newDestClaims(downloader.cfg.Files)
+	}
+
+	queue := newDownloadQueue(downloader.cfg.Files)
+	downloader.queue.Store(queue)
+
+	tx := newTransaction(downloader.cfg.Settings.IsTransactional())
+	downloader.tx.Store(tx)
+
 	results := make([]DownloadResult, len(downloader.cfg.Files))
 	resultCh := make(chan struct {
 		index  int
 		result DownloadResult
 	}, len(downloader.cfg.Files))
 
-	progress := mpb.NewWithContext(ctx)
-
-	// Create worker pool.
-	var wg sync.WaitGroup
-
-	semaphore := make(chan struct{}, downloader.cfg.Settings.Parallel)
+	progress, stopProgress := downloader.newProgress(ctx)
 
-	for i, file := range downloader.cfg.Files {
-		wg.Add(1)
+	slots := downloader.newSlots()
 
-		go func(index int, file config.FileEntry) {
-			defer wg.Done()
-
-			semaphore <- struct{}{}
+	// Dispatch in priority order, one batch of queued files at a time until
+	// the queue drains. Slots are reserved here rather than in the download
+	// goroutines, so a higher-priority file cannot lose the race for a free
+	// slot to a lower-priority one. Files limited by per_alias_parallel queue
+	// for their alias here too, but wait for it in their goroutine, so they
+	// hold no slot that files from other aliases or hosts could run in
+	// meanwhile. With
+	// verify_parallel, files with an existing dest hash it before they take a
+	// slot, so the verify pool does not eat into the download pools.
+	go func() {
+		var wg sync.WaitGroup
 
-			defer func() { <-semaphore }()
+		for {
+			start, files, ok := queue.take()
+			if !ok {
+				break
+			}
 
-			err := downloader.downloadFile(ctx, file, progress)
+			order := dispatchOrder(files)
+			if downloader.sequential {
+				order = configOrder(files)
+			}
 
-			resultCh <- struct {
-				index  int
-				result DownloadResult
-			}{
-				index:  index,
-				result: DownloadResult{File: file, Error: err},
+			for _, offset := range order {
+				index := start + offset
+				file := files[offset]
+
+				aliasPool := downloader.aliases.pool(file)
+				verifyFirst := downloader.verifiesFirst(file)
+
+				// Alias claims are queued here, in dispatch order; files
+				// that verify first queue theirs once they need fetching.
+				var claim *aliasClaim
+
+				switch {
+				case aliasPool != nil && !verifyFirst:
+					claim = aliasPool.enqueue(downloadConnections(downloader.cfg.Settings))
+				case aliasPool == nil && !verifyFirst:
+					slots.reserve()
+				}
+
+				wg.Go(func() {
+					defer queue.finished()
+
+					slot := &fileSlot{take: func() (func(), error) {
+						releaseAlias := func() {}
+
+						if aliasPool != nil {
+							if claim == nil {
+								claim = aliasPool.enqueue(downloadConnections(downloader.cfg.Settings))
+							}
+
+							release, err := aliasPool.wait(ctx, claim)
+							claim = nil
+
+							if err != nil {
+								return nil, err
+							}
+
+							releaseAlias = release
+						}
+
+						if aliasPool != nil || verifyFirst {
+							slots.reserve()
+						}
+
+						release := slots.admit(ctx, file, downloader.probeSize)
+
+						return func() {
+							release()
+							releaseAlias()
+						}, nil
+					}}
+					defer slot.free()
+
+					if !verifyFirst {
+						// A wait cut short by cancellation is taken up
+						// again, and reported, by fetchFile.
+						_ = slot.acquire()
+					}
+
+					result := downloader.runFile(withFileSlot(ctx, slot), file, progress)
+					if downloader.events != nil {
+						downloader.events.finish(result)
+					}
+
+					resultCh <- struct {
+						index  int
+						result DownloadResult
+					}{
+						index:  index,
+						result: result,
+					}
+				})
+
+				if downloader.sequential {
+					wg.Wait()
+				}
 			}
-		}(i, file)
-	}
+		}
 
-	// Wait for all downloads to complete.
-	go func() {
+		// Wait for all downloads to complete.
 		wg.Wait()
 		close(resultCh)
 	}()
 
 	// Collect results.
+	var failed int
+
 	for r := range resultCh {
+		// Files enqueued during the run are collected past the initial ones.
+		if r.index >= len(results) {
+			results = append(results, make([]DownloadResult, r.index+1-len(results))...)
+		}
+
 		results[r.index] = r.result
+
+		if r.result.Error == nil {
+			continue
+		}
+
+		failed++
+
+		maxErrors := downloader.cfg.Settings.MaxErrors
+		if maxErrors > 0 && failed == maxErrors {
+			fmt.Fprintf(os.Stderr, "%d downloads failed (max_errors), cancelling remaining downloads\n", failed)
+			cancel()
+		}
 	}
 
 	progress.Wait()
+	stopProgress()
+	downloader.uploads.wait()
+
+	if downloader.checksums != nil {
+		err := downloader.checksums.cache.save()
+		if err != nil {
+			downloader.warn("%v", err)
+		}
+	}
+
+	results = append(results, listFailures...)
+	downloader.rollBack(tx, results)
 
 	return results
 }
 
-func (downloader *Downloader) downloadFile(ctx context.Context, file config.FileEntry, progress *mpb.Progress) error {
+// newProgress creates the progress bar container, redrawn every
+// settings.progress_refresh, or at the mpb default when it is unset. With
+// progress_mode=ci the bars are discarded and aggregate progress is
+// reported on stderr instead; the returned function stops that reporting.
+func (downloader *Downloader) newProgress(ctx context.Context) (*mpb.Progress, func()) {
+	var options []mpb.ContainerOption
+
+	refresh := downloader.cfg.Settings.ProgressRefresh
+	if refresh > 0 {
+		options = append(options, mpb.WithRefreshRate(refresh))
+	}
+
+	if downloader.ci == nil {
+		return mpb.NewWithContext(ctx, options...), func() {}
+	}
+
+	options = append(options, mpb.WithOutput(io.Discard))
+
+	return mpb.NewWithContext(ctx, options...), downloader.ci.start(ciProgressInterval)
+}
+
+// SetOffline restricts the downloader to existing files and the cache, for
+// -offline: no origin is contacted, and files that are neither present nor
+// cached fail with errNotCached.
+func (downloader *Downloader) SetOffline() {
+	downloader.offline = true
+}
+
+// SetSequential makes the downloader finish each file before it starts the
+// next, in config order, for -sequential. Results, progress events and
+// cache uploads are then started in config order too.
+func (downloader *Downloader) SetSequential() {
+	downloader.sequential = true
+}
+
+// SetResumeOnly restricts the downloader to files with an existing partial,
+// for -resume-only: the others are deferred without being checked or
+// fetched, so a large interrupted job can be finished in phases.
+func (downloader *Downloader) SetResumeOnly() {
+	downloader.resumeOnly = true
+}
+
+// hasPartial reports whether a download of file was started and not
+// finished: its partial exists, or for split files the file or partial of
+// any part.
+func hasPartial(file config.FileEntry) bool {
+	paths := []string{file.Dest + ".partial"}
+
+	for i := range file.Parts {
+		part := config.PartDest(file.Dest, i)
+		paths = append(paths, part, part+".partial")
+	}
+
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetRetryFailedMirrorsLast makes fallback_alias chains prefer aliases
+// whose credentials have not been rejected during the run, for
+// -retry-failed-mirrors-last.
+func (downloader *Downloader) SetRetryFailedMirrorsLast() {
+	downloader.health = newMirrorHealth()
+}
+
+// SetProgressStream makes the downloader write progress events of every
+// file to stream, for settings.progress_fd.
+func (downloader *Downloader) SetProgressStream(stream *progressStream) {
+	downloader.events = stream
+}
+
+// progressTap returns the tap the progress writers of file mirror their
+// counts to, or nil when neither progress_mode=ci nor progress_fd is set.
+// Downloads of unknown size, total zero or less, only report to progress_fd,
+// as they cannot contribute to the percentage of progress_mode=ci.
+func (downloader *Downloader) progressTap(file config.FileEntry, total int64) segment.ProgressTap {
+	ci := downloader.ci
+	if total <= 0 {
+		ci = nil
+	}
+
+	switch {
+	case downloader.events == nil && ci == nil:
+		return nil
+	case downloader.events == nil:
+		return ci
+	case ci == nil:
+		return downloader.events.tap(file)
+	default:
+		return multiTap{ci, downloader.events.tap(file)}
+	}
+}
+
+// resolveChecksum fills file.SHA256 from file.SHA256URL when no inline
+// checksum is given. The checksum file entry is matched by the basename of
+// the file URL.
+func (downloader *Downloader) resolveChecksum(ctx context.Context, file config.FileEntry) (config.FileEntry, error) {
+	if file.SHA256 != "" || file.SHA256URL == "" {
+		return file, nil
+	}
+
+	var (
+		sha string
+		err error
+	)
+
+	if downloader.offline {
+		sha, err = downloader.checksums.resolveCached(file.SHA256URL, urlBasename(file.URL))
+	} else {
+		sha, err = downloader.checksums.resolve(ctx, file.SHA256URL, urlBasename(file.URL))
+	}
+
+	if err != nil {
+		return file, fmt.Errorf("resolving sha256_url: %w", err)
+	}
+
+	file.SHA256 = sha
+
+	return file, nil
+}
+
+// newSlots builds the concurrency limits for Download. Without
+// settings.size_threshold, a single pool of settings.parallel slots is used.
+func (downloader *Downloader) newSlots() *downloadSlots {
+	settings := downloader.cfg.Settings
+
+	if settings.SizeThreshold <= 0 {
+		return &downloadSlots{small: make(chan struct{}, settings.Parallel)}
+	}
+
+	return &downloadSlots{
+		small:     make(chan struct{}, settings.ParallelSmall),
+		large:     make(chan struct{}, settings.ParallelLarge),
+		threshold: settings.SizeThreshold,
+	}
+}
+
+// probeSize returns the source size of file, or -1 when it cannot be determined.
+func (downloader *Downloader) probeSize(ctx context.Context, file config.FileEntry) int64 {
+	if downloader.offline {
+		return -1
+	}
+
+	source, err := downloader.newSource(file)
+	if err != nil {
+		return -1
+	}
+
+	size, err := retryMetadata(ctx, downloader.cfg.Settings, func() (int64, error) {
+		return source.GetSize(ctx)
+	})
+	if err != nil {
+		return -1
+	}
+
+	return size
+}
+
+// runFile downloads a single file and records its result and timings.
+// Files whose turn comes after the run was cancelled are not started.
+func (downloader *Downloader) runFile(
+	ctx context.Context,
+	file config.FileEntry,
+	progress *mpb.Progress,
+) DownloadResult {
+	if ctx.Err() != nil {
+		return DownloadResult{File: file, Error: fmt.Errorf("not started: %w", ctx.Err())}
+	}
+
+	releaseFiles, err := downloader.openFiles.acquire(ctx, downloadOpenFiles(downloader.cfg.Settings))
+	if err != nil {
+		return DownloadResult{File: file, Error: fmt.Errorf("not started: %w", err)}
+	}
+
+	defer releaseFiles()
+
+	start := time.Now()
+	trace := &timingTrace{}
+
+	ctx, span := tracing.Start(ctx, "download",
+		tracing.String("xget.url", redactURL(file.URL)),
+		tracing.String("xget.dest", file.Dest),
+	)
+	defer span.End()
+
+	file, err = downloader.resolveChecksum(ctx, file)
+	if err == nil {
+		file = downloader.inferExtension(ctx, file)
+		err = downloader.downloadFile(ctx, file, progress, trace)
+	}
+
+	err = explainOpenFileError(err, downloader.cfg.Settings)
+
+	result := DownloadResult{File: file, Error: err}
+	trace.fill(&result.Timings)
+	result.Timings.Total = time.Since(start)
+
+	switch {
+	case errors.Is(err, errDeferred):
+		result.Error = nil
+		result.Deferred = true
+
+		span.SetAttributes(tracing.String("xget.status", "deferred"))
+	case err == nil:
+		info, statErr := os.Stat(file.Dest)
+		if statErr == nil {
+			result.Size = info.Size()
+		}
+
+		span.SetAttributes(tracing.String("xget.status", "ok"), tracing.Int64("xget.bytes", result.Size))
+	default:
+		span.SetAttributes(tracing.String("xget.status", "failed"))
+		span.RecordError(err)
+	}
+
+	return result
+}
+
+func (downloader *Downloader) downloadFile(
+	ctx context.Context,
+	file config.FileEntry,
+	progress *mpb.Progress,
+	trace *timingTrace,
+) error {
+	if downloader.resumeOnly && !hasPartial(file) {
+		fmt.Printf("deferring %s (no partial to resume)\n", file.Dest)
+
+		return errDeferred
+	}
+
+	pipe, err := isPipeDest(file.Dest)
+	if err != nil {
+		return err
+	}
+
+	// A pipe has no content to compare against and nothing to stamp.
+	if pipe {
+		return downloader.streamToPipe(ctx, file, progress)
+	}
+
+	remoteModTime, upToDate := downloader.checkModTime(ctx, file)
+	if upToDate {
+		fmt.Printf("skipping %s (local copy is not older than remote)\n", file.Dest)
+
+		return nil
+	}
+
+	remoteState, unchanged := downloader.checkUnchanged(ctx, file)
+	if unchanged {
+		fmt.Printf("skipping %s (remote is unchanged since the last download)\n", file.Dest)
+
+		return nil
+	}
+
+	err = downloader.fetchFile(ctx, file, progress, trace)
+	if err != nil {
+		return err
+	}
+
+	if downloader.cfg.Settings.IsSkipIfUnchanged() {
+		downloader.recordRemoteState(file, remoteState)
+	}
+
+	// Stamp the remote modification time so the next skip_if_newer run
+	// compares against the version that was actually downloaded.
+	if !remoteModTime.IsZero() {
+		err = os.Chtimes(file.Dest, time.Time{}, remoteModTime)
+		if err != nil {
+			downloader.warn("could not set modification time of %s: %v", file.Dest, err)
+		}
+	}
+
+	downloader.recordETag(ctx, file)
+
+	// Files without a sha256 (allowed with skip_if_newer and
+	// skip_if_unchanged) get no sidecar rather than one computed from
+	// unverified content.
+	if downloader.cfg.Settings.IsWriteChecksumSidecar() && file.SHA256 != "" {
+		err = writeChecksumSidecar(file.Dest, file.SHA256)
+		if err != nil {
+			downloader.warn("%s: %v", file.Dest, err)
+		}
+	}
+
+	return nil
+}
+
+// checkModTime implements settings.skip_if_newer. It returns the remote
+// modification time, and whether the local dest is at least that new.
+// Errors are reported as warnings and fall through to a normal download.
+func (downloader *Downloader) checkModTime(ctx context.Context, file config.FileEntry) (time.Time, bool) {
+	if !downloader.cfg.Settings.IsSkipIfNewer() {
+		return time.Time{}, false
+	}
+
+	// Offline, the remote time is unknown, so any local copy is kept.
+	if downloader.offline {
+		info, err := os.Stat(file.Dest)
+
+		return time.Time{}, err == nil && info.Mode().IsRegular()
+	}
+
+	source, err := downloader.newSource(file)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	modTimeSource, ok := source.(storage.ModTimeSource)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	remoteModTime, err := retryMetadata(ctx, downloader.cfg.Settings, func() (time.Time, error) {
+		return modTimeSource.GetModTime(ctx)
+	})
+	if err != nil {
+		downloader.warn("could not get modification time of %s: %v", redactURL(file.URL), err)
+
+		return time.Time{}, false
+	}
+
+	if remoteModTime.IsZero() {
+		return time.Time{}, false
+	}
+
+	info, err := os.Stat(file.Dest)
+	if err != nil || !info.Mode().IsRegular() {
+		return remoteModTime, false
+	}
+
+	return remoteModTime, !info.ModTime().Before(remoteModTime)
+}
+
+// fetchFile brings the dest up to date from an existing verified copy, the
+// cache, or the source (or its parts), in that order.
+func (downloader *Downloader) fetchFile(
+	ctx context.Context,
+	file config.FileEntry,
+	progress *mpb.Progress,
+	trace *timingTrace,
+) error {
 	// Check if destination file already exists with correct hash.
-	exists, err := downloader.checkExistingFile(file)
+	exists, err := downloader.checkExistingFile(ctx, file)
 	if err != nil {
 		return fmt.Errorf("checking existing file: %w", err)
 	}
 
+	if exists && !downloader.matchesCache(ctx, file) {
+		exists = false
+	}
+
 	if exists {
 		fmt.Printf("skipping %s (already exists with correct hash)\n", file.Dest)
 
 		return nil
 	}
 
+	// A file that verified its dest first, or whose wait for its alias was
+	// cut short, takes its download slot now.
+	err = acquireFileSlot(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for a download slot: %w", err)
+	}
+
+	// The recorded ETag and state describe the copy about to be replaced.
+	discardETagSidecar(file.Dest)
+	discardHeadSidecar(file.Dest)
+
+	err = downloader.replaceFile(ctx, file, progress, trace)
+	if err != nil {
+		return err
+	}
+
+	downloader.tx.Load().record(file.Dest)
+
+	return nil
+}
+
+// replaceFile writes the dest from the cache or the source (or its parts).
+func (downloader *Downloader) replaceFile(
+	ctx context.Context,
+	file config.FileEntry,
+	progress *mpb.Progress,
+	trace *timingTrace,
+) error {
 	// Try to get from cache first.
 	cached := downloader.tryGetFromCache(ctx, file, progress)
 	if cached {
 		return nil
 	}
 
+	// Parts are fetched one by one, so offline they may still come from
+	// existing part files or the cache.
+	if len(file.Parts) > 0 {
+		return downloader.downloadParts(ctx, file, progress, trace)
+	}
+
+	if downloader.offline {
+		return fmt.Errorf("%w, and -offline forbids downloading it", errNotCached)
+	}
+
 	// Download from source with retry.
-	return downloader.downloadWithRetry(ctx, file, progress)
+	return downloader.downloadWithRetry(ctx, file, progress, trace)
 }
 
 func (downloader *Downloader) tryGetFromCache(ctx context.Context, file config.FileEntry, progress *mpb.Progress) bool {
-	if downloader.cache == nil {
+	// The cache is keyed by checksum, so files without one bypass it.
+	if !downloader.cachesFile(file) {
 		return false
 	}
 
-	cached, err := downloader.cache.Get(ctx, file.SHA256, file.Dest, progress)
+	cached, err := downloader.cache.Get(ctx, file, progress)
 	if err != nil {
-		fmt.Printf("cache check error for %s: %v\n", file.Dest, err)
+		downloader.warn("cache check for %s: %v", file.Dest, err)
 
 		return false
 	}
@@ -127,15 +764,26 @@ func (downloader *Downloader) tryGetFromCache(ctx context.Context, file config.F
 	return cached
 }
 
+// cachesFile reports whether file takes part in the cache: the cache is
+// enabled, the file has a checksum to key it by and it does not opt out.
+func (downloader *Downloader) cachesFile(file config.FileEntry) bool {
+	return downloader.cache != nil && file.SHA256 != "" && file.UsesCache()
+}
+
 func (downloader *Downloader) downloadWithRetry(
 	ctx context.Context,
 	file config.FileEntry,
 	progress *mpb.Progress,
+	trace *timingTrace,
 ) error {
 	var lastErr error
 
-	for attempt := 1; attempt <= downloader.cfg.Settings.Retries; attempt++ {
-		err := downloader.downloadFromSource(ctx, file, progress)
+	retries := downloader.cfg.Settings.RetriesFor(file.URL)
+
+	for attempt := 1; attempt <= retries; attempt++ {
+		tracing.FromContext(ctx).SetAttributes(tracing.Int("xget.attempts", attempt))
+
+		err := downloader.downloadWithFallback(trace.attach(ctx), file, progress)
 		if err == nil {
 			downloader.uploadToCache(ctx, file)
 
@@ -148,27 +796,157 @@ func (downloader *Downloader) downloadWithRetry(
 			return ctx.Err()
 		}
 
-		if attempt < downloader.cfg.Settings.Retries {
+		// The partial is already discarded on mismatch, so a retry starts
+		// from offset 0 rather than resuming the corrupt copy.
+		if errors.Is(err, errChecksumMismatch) && !downloader.cfg.Settings.IsRetryOnChecksumMismatch() {
+			return err
+		}
+
+		// The source serves the wrong file; fetching it again cannot help.
+		if errors.Is(err, errHeaderMismatch) {
+			return err
+		}
+
+		// The partial is dropped to give the room back to other downloads.
+		if errors.Is(err, errLowDiskSpace) {
+			discardPartial(file.Dest + ".partial")
+
+			return err
+		}
+
+		if attempt < retries {
 			fmt.Printf("attempt %d/%d for %s failed: %v, retrying...\n",
-				attempt, downloader.cfg.Settings.Retries, file.URL, err)
+				attempt, retries, redactURL(file.URL), err)
 			time.Sleep(downloader.cfg.Settings.RetryDelay)
 		}
 	}
 
-	return fmt.Errorf("all %d attempts: %w", downloader.cfg.Settings.Retries, lastErr)
+	return fmt.Errorf("all %d attempts: %w", retries, lastErr)
 }
 
-func (downloader *Downloader) uploadToCache(ctx context.Context, file config.FileEntry) {
-	if downloader.cache == nil {
+// downloadWithFallback implements fallback_alias: when the credentials of an
+// s3:// alias are rejected, the download is repeated at once through its
+// fallback alias, following the chain, before the attempt counts as failed.
+//
+// With -retry-failed-mirrors-last the aliases of the chain are mirrors: the
+// chain is reordered so aliases that failed earlier in the run are tried
+// last, and it is followed on any error of the source, as the aliases after
+// the one that failed may include the primary.
+func (downloader *Downloader) downloadWithFallback(
+	ctx context.Context,
+	file config.FileEntry,
+	progress *mpb.Progress,
+) error {
+	urls := downloader.cfg.FallbackChain(file.URL)
+	if downloader.health != nil {
+		urls = downloader.health.order(urls)
+	}
+
+	var err error
+
+	for i, url := range urls {
+		if i > 0 {
+			downloader.warnFallback(urls[i-1], url, err)
+		}
+
+		file.URL = url
+		err = downloader.downloadFromSource(ctx, file, progress)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+
+		downloader.recordMirrorHealth(url, err)
+
+		if err == nil {
+			return nil
+		}
+
+		if !downloader.followsChain(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// followsChain reports whether a download that failed with err is repeated
+// through the next alias of its fallback chain.
+func (downloader *Downloader) followsChain(err error) bool {
+	if storage.IsAuthError(err) {
+		return true
+	}
+
+	// Out of disk space, every alias would fail alike.
+	return downloader.health != nil && !errors.Is(err, errLowDiskSpace)
+}
+
+// warnFallback reports that the download from url failed with err and is
+// repeated through next.
+func (downloader *Downloader) warnFallback(url, next string, err error) {
+	if storage.IsAuthError(err) {
+		downloader.warn("credentials for %s were rejected, retrying with %s", url, next)
+
 		return
 	}
 
-	if err := downloader.cache.Put(ctx, file.SHA256, file.Dest); err != nil {
-		fmt.Printf("warning: could not cache %s: %v\n", file.Dest, err)
+	downloader.warn("download from %s failed: %v, retrying with %s", url, err, next)
+}
+
+// recordMirrorHealth notes for -retry-failed-mirrors-last whether the alias
+// of url served the download. Rejected credentials and failures of the
+// endpoint count against the alias; other errors, such as a checksum
+// mismatch, say nothing about it.
+func (downloader *Downloader) recordMirrorHealth(url string, err error) {
+	if downloader.health == nil {
+		return
+	}
+
+	switch {
+	case err == nil:
+		downloader.health.markHealthy(url)
+	case storage.IsAuthError(err), storage.IsTransientError(err):
+		downloader.health.markFailed(url)
+	}
+}
+
+func (downloader *Downloader) uploadToCache(ctx context.Context, file config.FileEntry) {
+	if !downloader.cachesFile(file) {
+		return
 	}
+
+	downloader.uploads.start(func() {
+		release, err := downloader.openFiles.acquire(ctx, cacheUploadOpenFiles)
+		if err != nil {
+			downloader.warn("could not cache %s: %v", file.Dest, err)
+
+			return
+		}
+
+		defer release()
+
+		err = downloader.cache.Put(ctx, file.SHA256, file.Dest)
+		if err != nil {
+			downloader.warn("could not cache %s: %v", file.Dest, explainOpenFileError(err, downloader.cfg.Settings))
+		}
+	})
 }
 
-func (downloader *Downloader) checkExistingFile(file config.FileEntry) (bool, error) {
+func (downloader *Downloader) checkExistingFile(ctx context.Context, file config.FileEntry) (bool, error) {
+	if downloader.expired(file.Dest) {
+		fmt.Printf("refreshing %s (older than max_age)\n", file.Dest)
+
+		return false, nil
+	}
+
+	mirrored, ok := downloader.mirrored[file.Dest]
+	if ok {
+		return mirrorUpToDate(file.Dest, mirrored.object), nil
+	}
+
+	if !file.HasChecksum() {
+		return false, nil
+	}
+
 	info, err := os.Stat(file.Dest)
 	if os.IsNotExist(err) {
 		return false, nil
@@ -178,12 +956,28 @@ func (downloader *Downloader) checkExistingFile(file config.FileEntry) (bool, er
 		return false, err
 	}
 
+	if info.Mode().IsRegular() && etagMatches(file, info) {
+		return true, nil
+	}
+
 	// File exists, verify hash.
 	if info.IsDir() {
 		return false, fmt.Errorf("destination is a directory")
 	}
 
-	valid, err := VerifyFileSHA256(file.Dest, file.SHA256)
+	// Large dests hashed by every worker at once would starve the
+	// downloads of disk bandwidth.
+	if downloader.verifySlots != nil {
+		select {
+		case downloader.verifySlots <- struct{}{}:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+
+		defer func() { <-downloader.verifySlots }()
+	}
+
+	valid, err := VerifyFileChecksums(file.Dest, file)
 	if err != nil {
 		return false, err
 	}
@@ -191,49 +985,219 @@ func (downloader *Downloader) checkExistingFile(file config.FileEntry) (bool, er
 	return valid, nil
 }
 
+// verifiesFirst reports whether file hashes its existing dest before it
+// takes a download slot: with settings.verify_parallel, when its dest is a
+// regular file.
+func (downloader *Downloader) verifiesFirst(file config.FileEntry) bool {
+	if downloader.verifySlots == nil {
+		return false
+	}
+
+	info, err := os.Stat(file.Dest)
+	if err != nil {
+		return false
+	}
+
+	return info.Mode().IsRegular()
+}
+
+// expired reports whether dest is a file last modified longer than
+// settings.max_age ago, so it is fetched again however valid it is.
+func (downloader *Downloader) expired(dest string) bool {
+	maxAge := downloader.cfg.Settings.MaxAge
+	if maxAge <= 0 {
+		return false
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	return time.Since(info.ModTime()) > maxAge
+}
+
+// matchesCache implements cache.verify_existing: a verified dest is trusted
+// only if the cache object for its key records the same hash. On divergence
+// the file is fetched again, from the cache if it passes verification there,
+// otherwise from the source. Lookup errors keep the local copy.
+func (downloader *Downloader) matchesCache(ctx context.Context, file config.FileEntry) bool {
+	if !downloader.cachesFile(file) || !downloader.cfg.Cache.IsVerifyExisting() {
+		return true
+	}
+
+	stored, ok, err := downloader.cache.StoredHash(ctx, file.SHA256)
+	if err != nil {
+		downloader.warn("cache check for %s: %v", file.Dest, err)
+
+		return true
+	}
+
+	if !ok || stored == file.SHA256 {
+		return true
+	}
+
+	downloader.warn("cache records sha256 %s for %s, re-fetching", stored, file.Dest)
+
+	return false
+}
+
 func (downloader *Downloader) downloadFromSource(
 	ctx context.Context,
 	file config.FileEntry,
 	progress *mpb.Progress,
 ) error {
-	source, err := storage.NewSource(file.URL, downloader.cfg.Aliases, downloader.cfg.Settings.Timeout)
+	source, err := downloader.newSource(file)
 	if err != nil {
-		return fmt.Errorf("creating source: %w", err)
+		return err
+	}
+
+	if downloader.cfg.Settings.IsHeaderCheck() {
+		err = checkHeader(ctx, source, file)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = os.MkdirAll(filepath.Dir(file.Dest), 0o755)
+	source = downloader.limitSource(file.URL, source)
+
+	err = ensureDestDir(file.Dest)
 	if err != nil {
-		return fmt.Errorf("creating destination directory: %w", err)
+		return err
 	}
 
 	partialPath := file.Dest + ".partial"
 
+	// With resume disabled, drop any partial and segment state so the
+	// download starts from offset 0. Presigned URLs are never resumed: a
+	// Range request may not be covered by the signature. Stdin cannot seek.
+	if !downloader.cfg.Settings.IsResume() || storage.IsPresignedURL(file.URL) || file.URL == config.StdinURL {
+		discardPartial(partialPath)
+	}
+
+	if file.Range != "" {
+		err = downloader.rangeDownload(ctx, source, file, partialPath, progress)
+		if err != nil {
+			return err
+		}
+
+		return downloader.finalizeDownload(partialPath, file, nil)
+	}
+
 	// Try segmented download first.
 	segmented, err := downloader.trySegmentedDownload(ctx, source, file, partialPath, progress)
 	if err != nil {
 		return err
 	}
 
+	var streamed *checksumVerifier
+
 	if !segmented {
-		err = downloader.singleStreamDownload(ctx, source, file, partialPath, progress)
+		streamed, err = downloader.singleStreamDownload(ctx, source, file, partialPath, progress)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = finalizeDownload(partialPath, file)
+	err = downloader.finalizeDownload(partialPath, file, streamed)
 	if err != nil {
 		return err
 	}
 
-	// Clean up segment state file after successful finalization.
+	// Clean up segment and hash state files after successful finalization.
 	if segmented {
 		os.Remove(segment.StatePath(partialPath))
+		os.Remove(hashStatePath(partialPath))
 	}
 
 	return nil
 }
 
+// sourceAliases returns the aliases to resolve file's URL against. For
+// anonymous entries and entries with timeouts of their own it returns a copy
+// with every alias switched to unsigned requests or to those timeouts, so the
+// shared alias keeps its settings for other files.
+func sourceAliases(aliases map[string]config.Alias, file config.FileEntry) map[string]config.Alias {
+	connectTimeout := file.ConnectTimeoutDuration()
+	timeout := file.DownloadTimeoutDuration()
+
+	if !file.IsAnonymous() && connectTimeout == 0 && timeout == 0 {
+		return aliases
+	}
+
+	adjusted := make(map[string]config.Alias, len(aliases))
+
+	for name, alias := range aliases {
+		if file.IsAnonymous() {
+			alias.NoSignRequest = "true"
+		}
+
+		if connectTimeout > 0 {
+			alias.ConnectTimeout = connectTimeout.String()
+		}
+
+		if timeout > 0 {
+			alias.Timeout = timeout.String()
+		}
+
+		adjusted[name] = alias
+	}
+
+	return adjusted
+}
+
+// newSource creates the storage source for file with the configured
+// timeouts and HTTP version.
+func (downloader *Downloader) newSource(file config.FileEntry) (storage.Source, error) {
+	return newSource(downloader.cfg, file)
+}
+
+// newSource creates the storage source for file from the settings and
+// aliases of cfg, for sources fetched outside a Downloader such as the
+// remote manifest.
+func newSource(cfg *config.Config, file config.FileEntry) (storage.Source, error) {
+	err := cfg.Settings.CheckURLAllowed(file.URL)
+	if err != nil {
+		return nil, fmt.Errorf("creating source: %w", err)
+	}
+
+	source, err := storage.NewSource(
+		file.URL,
+		sourceAliases(cfg.Aliases, file),
+		cfg.Settings.TimeoutFor(file),
+		storage.WithHTTPVersion(cfg.Settings.HTTPVersion),
+		storage.WithConnectTimeout(cfg.Settings.ConnectTimeoutFor(file)),
+		storage.WithCheckRedirect(redirectPolicy(cfg.Settings)),
+		storage.WithHeaders(cfg.Settings.HTTPHeadersFor(file)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating source: %w", err)
+	}
+
+	return source, nil
+}
+
+// maxRedirects matches the limit of the default http.Client redirect policy.
+const maxRedirects = 10
+
+// redirectPolicy returns an http.Client redirect policy that also applies
+// settings.allowed_schemes and settings.allowed_hosts to every redirect
+// target, so an approved origin cannot bounce a request elsewhere.
+func redirectPolicy(settings config.Settings) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		err := settings.CheckURLAllowed(req.URL.String())
+		if err != nil {
+			return fmt.Errorf("redirect refused: %w", err)
+		}
+
+		return nil
+	}
+}
+
 func (downloader *Downloader) trySegmentedDownload(
 	ctx context.Context,
 	source storage.Source,
@@ -255,7 +1219,9 @@ func (downloader *Downloader) trySegmentedDownload(
 		return false, nil
 	}
 
-	totalSize, err := rangeSource.GetSize(ctx)
+	totalSize, err := retryMetadata(ctx, downloader.cfg.Settings, func() (int64, error) {
+		return rangeSource.GetSize(ctx)
+	})
 	if err != nil || totalSize <= 0 {
 		return false, nil //nolint:nilerr // fall back to single stream on size probe errors.
 	}
@@ -264,7 +1230,9 @@ func (downloader *Downloader) trySegmentedDownload(
 		return false, nil
 	}
 
-	acceptsRanges, err := rangeSource.AcceptsRanges(ctx)
+	acceptsRanges, err := retryMetadata(ctx, downloader.cfg.Settings, func() (bool, error) {
+		return rangeSource.AcceptsRanges(ctx)
+	})
 	if err != nil || !acceptsRanges {
 		return false, nil //nolint:nilerr // fall back to single stream when ranges unsupported.
 	}
@@ -277,30 +1245,130 @@ func (downloader *Downloader) trySegmentedDownload(
 		progress,
 		file.Dest,
 	)
+	segDownloader.SetProgressTap(downloader.progressTap(file, totalSize))
+	segDownloader.SetProgressSmoothing(downloader.cfg.Settings.ProgressSmoothing)
+	segDownloader.SetRetryPolicy(downloader.cfg.Settings.RetriesFor(file.URL), downloader.cfg.Settings.RetryDelay)
+
+	ctx, floor := downloader.watchSpeed(ctx)
+	defer floor.stop()
+
+	guard := downloader.writeGuard(file.Dest, floor)
+	if guard != nil {
+		segDownloader.SetWriteGuard(guard)
+	}
 
 	err = segDownloader.Download(ctx)
 	if err != nil {
-		return true, fmt.Errorf("segmented download: %w", err)
+		return true, fmt.Errorf("segmented download: %w", tooSlow(ctx, err))
 	}
 
 	return true, nil
 }
 
+// singleStreamDownload downloads file into the partial in one stream. It
+// returns the checksums of the complete partial, computed while writing.
 func (downloader *Downloader) singleStreamDownload(
 	ctx context.Context,
 	source storage.Source,
 	file config.FileEntry,
 	partialPath string,
 	progress *mpb.Progress,
-) error {
+) (*checksumVerifier, error) {
 	// If a segment state file exists, the partial file was pre-allocated by a
 	// segmented download and its size does not reflect sequential progress.
 	// Remove both to start a clean single-stream download.
 	statePath := segment.StatePath(partialPath)
 
-	if _, statErr := os.Stat(statePath); statErr == nil {
-		os.Remove(partialPath)
-		os.Remove(statePath)
+	_, statErr := os.Stat(statePath)
+	if statErr == nil {
+		discardPartial(partialPath)
+	}
+
+	downloader.discardOversizedPartial(ctx, source, file, partialPath)
+
+	destFile, offset, err := openPartialFile(partialPath)
+	if err != nil {
+		return nil, fmt.Errorf("creating destination file: %w", err)
+	}
+
+	defer destFile.Close()
+
+	dest := downloader.partialWriter(partialPath, destFile, offset)
+	defer dest.Close()
+
+	hasher, err := resumePartialHash(partialPath, file, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	err = downloader.performDownload(ctx, source, dest, file, offset, progress, hasher)
+	if err != nil {
+		// With direct I/O the hashed bytes are only all in the partial once
+		// the writer is closed.
+		dest.Close()
+
+		// Keep what was hashed so a resumed download need not re-read it.
+		saveErr := hasher.save(partialPath)
+		if saveErr != nil {
+			downloader.warn("%s: %v", file.Dest, saveErr)
+		}
+
+		return nil, err
+	}
+
+	os.Remove(hashStatePath(partialPath))
+
+	return hasher.checksumVerifier, nil
+}
+
+// discardOversizedPartial removes a partial that is larger than the source,
+// as left behind when the source was replaced by a smaller file. Resuming it
+// would request a range past the end of the source, so the download starts
+// from scratch instead. A source of unknown size keeps the partial.
+func (downloader *Downloader) discardOversizedPartial(
+	ctx context.Context,
+	source storage.Source,
+	file config.FileEntry,
+	partialPath string,
+) {
+	info, err := os.Stat(partialPath)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+
+	size, err := retryMetadata(ctx, downloader.cfg.Settings, func() (int64, error) {
+		return source.GetSize(ctx)
+	})
+	if err != nil || size < 0 || info.Size() <= size {
+		return
+	}
+
+	fmt.Printf("restarting %s from scratch (partial has %d bytes, source only %d)\n", file.Dest, info.Size(), size)
+	discardPartial(partialPath)
+}
+
+// rangeDownload fetches only the configured byte range of file into the
+// partial, resuming within the range when the partial already holds a prefix.
+func (downloader *Downloader) rangeDownload(
+	ctx context.Context,
+	source storage.Source,
+	file config.FileEntry,
+	partialPath string,
+	progress *mpb.Progress,
+) error {
+	byteRange, err := config.ParseByteRange(file.Range)
+	if err != nil {
+		return err
+	}
+
+	rangeSource, ok := source.(storage.RangeSource)
+	if !ok {
+		return fmt.Errorf("source of %s does not support byte ranges", redactURL(file.URL))
+	}
+
+	_, statErr := os.Stat(segment.StatePath(partialPath))
+	if statErr == nil {
+		discardPartial(partialPath)
 	}
 
 	destFile, offset, err := openPartialFile(partialPath)
@@ -310,7 +1378,88 @@ func (downloader *Downloader) singleStreamDownload(
 
 	defer destFile.Close()
 
-	return downloader.performDownload(ctx, source, destFile, file, offset, progress)
+	// A partial that already covers the range is left to checksum verification.
+	if offset >= byteRange.Size() {
+		return destFile.Close()
+	}
+
+	ctx, floor := downloader.watchSpeed(ctx)
+	defer floor.stop()
+
+	reader, err := rangeSource.DownloadRange(ctx, byteRange.Start+offset, byteRange.End)
+	if err != nil {
+		return fmt.Errorf("downloading range: %w", tooSlow(ctx, err))
+	}
+
+	defer reader.Close()
+
+	progressWriter := NewProgressWriter(progress, byteRange.Size(), file.Dest, downloader.cfg.Settings.ProgressSmoothing)
+	defer progressWriter.Abort()
+
+	progressWriter.SetTap(downloader.progressTap(file, byteRange.Size()))
+	progressWriter.SetCurrent(offset)
+
+	var writer io.Writer = io.MultiWriter(destFile, progressWriter)
+
+	guard := downloader.writeGuard(file.Dest, floor)
+	if guard != nil {
+		writer = io.MultiWriter(guard, writer)
+	}
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		return fmt.Errorf("writing file: %w", tooSlow(ctx, err))
+	}
+
+	progressWriter.Finish()
+
+	return destFile.Close()
+}
+
+// ensureDestDir creates the parent directory of dest. When an ancestor
+// already exists as a file, MkdirAll only reports a cryptic ENOTDIR, so that
+// case is reported explicitly.
+func ensureDestDir(dest string) error {
+	dir := filepath.Dir(dest)
+
+	err := os.MkdirAll(dir, 0o755)
+	if err == nil {
+		return nil
+	}
+
+	blocker := findFileAncestor(dir)
+	if blocker != "" {
+		return fmt.Errorf("creating destination directory for %s: parent %s exists as a file", dest, blocker)
+	}
+
+	return fmt.Errorf("creating destination directory: %w", err)
+}
+
+// findFileAncestor returns the nearest existing ancestor of dir (dir itself
+// included) when it is not a directory, or "" otherwise.
+func findFileAncestor(dir string) string {
+	for path := dir; ; path = filepath.Dir(path) {
+		info, err := os.Stat(path)
+		if err == nil {
+			if info.IsDir() {
+				return ""
+			}
+
+			return path
+		}
+
+		if filepath.Dir(path) == path {
+			return ""
+		}
+	}
+}
+
+// discardPartial removes a partial file together with its segment and hash
+// state.
+func discardPartial(partialPath string) {
+	os.Remove(partialPath)
+	os.Remove(segment.StatePath(partialPath))
+	os.Remove(hashStatePath(partialPath))
 }
 
 func openPartialFile(path string) (*os.File, int64, error) {
@@ -334,28 +1483,46 @@ func openPartialFile(path string) (*os.File, int64, error) {
 func (downloader *Downloader) performDownload(
 	ctx context.Context,
 	source storage.Source,
-	destFile *os.File,
+	destFile io.WriteCloser,
 	file config.FileEntry,
 	offset int64,
 	progressContainer *mpb.Progress,
+	hasher *partialHash,
 ) error {
+	ctx, floor := downloader.watchSpeed(ctx)
+	defer floor.stop()
+
 	reader, totalSize, err := source.Download(ctx, offset)
 	if err != nil {
-		return fmt.Errorf("downloading: %w", err)
+		return fmt.Errorf("downloading: %w", tooSlow(ctx, err))
 	}
 
 	defer reader.Close()
 
-	progressWriter := NewProgressWriter(progressContainer, totalSize, file.Dest)
+	progressWriter := NewProgressWriter(progressContainer, totalSize, file.Dest, downloader.cfg.Settings.ProgressSmoothing)
 	defer progressWriter.Abort()
 
+	progressWriter.SetTap(downloader.progressTap(file, totalSize))
+
 	if offset > 0 {
 		progressWriter.SetCurrent(offset)
 	}
 
-	_, err = io.Copy(io.MultiWriter(destFile, progressWriter), reader)
+	// The hasher follows the partial, so it only sees bytes that were
+	// written to it.
+	writer := io.MultiWriter(destFile, progressWriter)
+	if hasher != nil {
+		writer = io.MultiWriter(destFile, hasher, progressWriter)
+	}
+
+	guard := downloader.writeGuard(file.Dest, floor)
+	if guard != nil {
+		writer = io.MultiWriter(guard, writer)
+	}
+
+	_, err = io.Copy(writer, reader)
 	if err != nil {
-		return fmt.Errorf("writing file: %w", err)
+		return fmt.Errorf("writing file: %w", tooSlow(ctx, err))
 	}
 
 	progressWriter.Finish()
@@ -367,20 +1534,72 @@ func (downloader *Downloader) performDownload(
 	return nil
 }
 
-func finalizeDownload(partialPath string, file config.FileEntry) error {
-	valid, err := VerifyFileSHA256(partialPath, file.SHA256)
+// finalizeDownload verifies the partial and moves it into place. streamed
+// holds the checksums computed while downloading, if any; otherwise the
+// partial is hashed here.
+func (downloader *Downloader) finalizeDownload(
+	partialPath string,
+	file config.FileEntry,
+	streamed *checksumVerifier,
+) error {
+	// Without a checksum (allowed with skip_if_newer and skip_if_unchanged)
+	// there is nothing to verify.
+	if !file.HasChecksum() && file.MD5 == "" {
+		return renamePartial(partialPath, file.Dest)
+	}
+
+	var valid bool
+
+	if streamed != nil {
+		valid = streamed.matches()
+	} else {
+		var err error
+
+		valid, err = VerifyFileChecksums(partialPath, file)
+		if err != nil {
+			return fmt.Errorf("verifying checksum: %w", err)
+		}
+	}
+
+	if !valid {
+		discardPartial(partialPath)
+
+		return fmt.Errorf("%w for %s", errChecksumMismatch, file.Dest)
+	}
+
+	err := renamePartial(partialPath, file.Dest)
 	if err != nil {
-		return fmt.Errorf("verifying checksum: %w", err)
+		return err
+	}
+
+	if downloader.cfg.Settings.IsVerifyAfterRename() {
+		return verifyRenamed(file)
+	}
+
+	return nil
+}
+
+// verifyRenamed re-hashes the dest after the rename, for
+// settings.verify_after_rename. A dest that no longer matches is removed so
+// it is not mistaken for a good copy on the next run.
+func verifyRenamed(file config.FileEntry) error {
+	valid, err := VerifyFileChecksums(file.Dest, file)
+	if err != nil {
+		return fmt.Errorf("verifying checksum after rename: %w", err)
 	}
 
 	if !valid {
-		os.Remove(partialPath)
-		os.Remove(segment.StatePath(partialPath))
+		os.Remove(file.Dest)
 
-		return fmt.Errorf("checksum mismatch for %s", file.Dest)
+		return fmt.Errorf("%w for %s after rename", errChecksumMismatch, file.Dest)
 	}
 
-	err = os.Rename(partialPath, file.Dest)
+	return nil
+}
+
+// renamePartial moves a completed partial file into place.
+func renamePartial(partialPath, dest string) error {
+	err := os.Rename(partialPath, dest)
 	if err != nil {
 		return fmt.Errorf("renaming file: %w", err)
 	}
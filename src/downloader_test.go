@@ -0,0 +1,893 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // md5 is verified next to sha256
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xget/src/config"
+
+	"github.com/vbauerster/mpb/v8"
+)
+
+func TestEnsureDestDir(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	blocker := filepath.Join(tmpDir, "blocker")
+
+	err := os.WriteFile(blocker, []byte("not a directory"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to create blocker file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		dest        string
+		wantInError string
+	}{
+		{name: "creates missing parents", dest: filepath.Join(tmpDir, "a", "b", "file.bin")},
+		{name: "parent is a file", dest: filepath.Join(blocker, "file.bin"), wantInError: "parent " + blocker + " exists as a file"},
+		{name: "ancestor is a file", dest: filepath.Join(blocker, "x", "y", "file.bin"), wantInError: blocker},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ensureDestDir(tt.dest)
+
+			if tt.wantInError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				info, statErr := os.Stat(filepath.Dir(tt.dest))
+				if statErr != nil || !info.IsDir() {
+					t.Fatalf("expected %s to be a directory", filepath.Dir(tt.dest))
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+
+			if !strings.Contains(err.Error(), tt.wantInError) {
+				t.Errorf("expected error containing %q, got %v", tt.wantInError, err)
+			}
+		})
+	}
+}
+
+func TestSourceAliases(t *testing.T) {
+	aliases := map[string]config.Alias{
+		"mycloud": {Bucket: "data", AccessKey: "key", SecretKey: "secret"},
+	}
+
+	signed := sourceAliases(aliases, config.FileEntry{URL: "s3://mycloud/private.bin"})
+	if signed["mycloud"].IsNoSignRequest() {
+		t.Error("expected regular entry to keep signed requests")
+	}
+
+	anonymous := sourceAliases(aliases, config.FileEntry{URL: "s3://mycloud/public.bin", Anonymous: "true"})
+	if !anonymous["mycloud"].IsNoSignRequest() {
+		t.Error("expected anonymous entry to use unsigned requests")
+	}
+
+	if aliases["mycloud"].IsNoSignRequest() {
+		t.Error("expected shared alias to be left unchanged")
+	}
+
+	slow := sourceAliases(aliases, config.FileEntry{URL: "s3://mycloud/slow.bin", ConnectTimeout: "2s", DownloadTimeout: "1h"})
+	if slow["mycloud"].ConnectTimeoutDuration() != 2*time.Second || slow["mycloud"].TimeoutDuration() != time.Hour {
+		t.Errorf("expected the timeouts of the entry, got %+v", slow["mycloud"])
+	}
+
+	if slow["mycloud"].IsNoSignRequest() || aliases["mycloud"].Timeout != "" {
+		t.Error("expected only the timeouts to change, on a copy of the alias")
+	}
+}
+
+func TestDownloaderWarnings(t *testing.T) {
+	downloader := NewDownloader(&config.Config{}, nil)
+
+	downloader.warn("could not cache %s: %v", "a.bin", "denied")
+	downloader.warn("second")
+
+	warnings := downloader.Warnings()
+	if len(warnings) != 2 || warnings[0] != "could not cache a.bin: denied" {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+}
+
+func TestDownloadWithRetryChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		retry        string
+		wantRequests int32
+	}{
+		{name: "fails fast by default", retry: "", wantRequests: 1},
+		{name: "retries when enabled", retry: "true", wantRequests: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					requests.Add(1)
+				}
+
+				_, _ = w.Write([]byte("corrupt"))
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{Settings: config.Settings{
+				Retries:                 3,
+				HTTPVersion:             config.HTTPVersion1,
+				RetryOnChecksumMismatch: tt.retry,
+			}}
+			file := config.FileEntry{
+				URL:    server.URL + "/file.bin",
+				Dest:   filepath.Join(t.TempDir(), "file.bin"),
+				SHA256: "0000000000000000000000000000000000000000000000000000000000000000",
+			}
+
+			downloader := NewDownloader(cfg, nil)
+			progress := mpb.New(mpb.WithOutput(io.Discard))
+
+			err := downloader.downloadWithRetry(context.Background(), file, progress, &timingTrace{})
+			if !errors.Is(err, errChecksumMismatch) {
+				t.Fatalf("expected checksum mismatch error, got %v", err)
+			}
+
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("expected %d download requests, got %d", tt.wantRequests, got)
+			}
+		})
+	}
+}
+
+func TestDownloadFromSourceRange(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	slice := content[5:10]
+	sum := sha256.Sum256(slice)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Settings: config.Settings{Retries: 1, HTTPVersion: config.HTTPVersion1}}
+	file := config.FileEntry{
+		URL:    server.URL + "/file.bin",
+		Dest:   filepath.Join(t.TempDir(), "slice.bin"),
+		SHA256: hex.EncodeToString(sum[:]),
+		Range:  "5-9",
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	err := downloader.downloadFromSource(context.Background(), file, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(file.Dest)
+	if err != nil {
+		t.Fatalf("reading dest: %v", err)
+	}
+
+	if !bytes.Equal(got, slice) {
+		t.Errorf("expected slice %q, got %q", slice, got)
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	policy := redirectPolicy(config.Settings{AllowedHosts: []string{"releases.example.com"}})
+
+	allowed := httptest.NewRequest(http.MethodGet, "https://releases.example.com/file.bin", nil)
+
+	err := policy(allowed, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	refused := httptest.NewRequest(http.MethodGet, "https://mirror.example.org/file.bin", nil)
+
+	err = policy(refused, nil)
+	if err == nil {
+		t.Error("expected redirect to a host outside allowed_hosts to be refused")
+	}
+
+	via := make([]*http.Request, maxRedirects)
+
+	err = policy(allowed, via)
+	if err == nil {
+		t.Error("expected redirect limit to apply")
+	}
+}
+
+func TestDownloadFromSourceEmptyFile(t *testing.T) {
+	// SHA256 of empty content.
+	const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "empty.bin", time.Time{}, bytes.NewReader(nil))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Settings: config.Settings{Retries: 1, SegmentsPerFile: 4, HTTPVersion: config.HTTPVersion1}}
+	file := config.FileEntry{
+		URL:    server.URL + "/empty.bin",
+		Dest:   filepath.Join(t.TempDir(), "empty.bin"),
+		SHA256: emptySHA256,
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	// A leftover zero-byte partial must not be treated as resumable progress.
+	err := os.WriteFile(file.Dest+".partial", nil, 0o644)
+	if err != nil {
+		t.Fatalf("writing partial: %v", err)
+	}
+
+	err = downloader.downloadFromSource(context.Background(), file, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	progress.Wait()
+
+	info, err := os.Stat(file.Dest)
+	if err != nil {
+		t.Fatalf("stat dest: %v", err)
+	}
+
+	if info.Size() != 0 {
+		t.Errorf("expected empty dest, got %d bytes", info.Size())
+	}
+
+	exists, err := downloader.checkExistingFile(context.Background(), file)
+	if err != nil || !exists {
+		t.Errorf("expected empty dest to verify as existing, got %v, %v", exists, err)
+	}
+}
+
+func TestCheckExistingFileMaxAge(t *testing.T) {
+	content := []byte("valid but old")
+	dest := filepath.Join(t.TempDir(), "old.bin")
+
+	err := os.WriteFile(dest, content, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := config.FileEntry{Dest: dest, SHA256: sha256Hex(string(content))}
+	cfg := &config.Config{Settings: config.Settings{MaxAge: 30 * 24 * time.Hour}}
+	downloader := NewDownloader(cfg, nil)
+
+	exists, err := downloader.checkExistingFile(context.Background(), file)
+	if err != nil || !exists {
+		t.Fatalf("expected a fresh file to verify as existing, got %v, %v", exists, err)
+	}
+
+	old := time.Now().Add(-31 * 24 * time.Hour)
+
+	err = os.Chtimes(dest, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err = downloader.checkExistingFile(context.Background(), file)
+	if err != nil || exists {
+		t.Errorf("expected a file older than max_age to be stale, got %v, %v", exists, err)
+	}
+}
+
+func TestCheckExistingFileVerifyParallel(t *testing.T) {
+	content := []byte("existing content")
+	dest := filepath.Join(t.TempDir(), "existing.bin")
+
+	err := os.WriteFile(dest, content, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := config.FileEntry{Dest: dest, SHA256: sha256Hex(string(content))}
+	downloader := NewDownloader(&config.Config{Settings: config.Settings{VerifyParallel: 1}}, nil)
+
+	// Occupy the only verify slot, as a worker hashing another dest would.
+	downloader.verifySlots <- struct{}{}
+
+	done := make(chan bool)
+
+	go func() {
+		exists, _ := downloader.checkExistingFile(context.Background(), file)
+		done <- exists
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected the check to wait for a free verify slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-downloader.verifySlots
+
+	if exists := <-done; !exists {
+		t.Error("expected the dest to verify once the slot was free")
+	}
+}
+
+func TestDownloadVerifyHoldsNoDownloadSlot(t *testing.T) {
+	content := []byte("verified or downloaded")
+	sum := sha256.Sum256(content)
+	fetched := make(chan struct{}, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fetched <- struct{}{}
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "existing"), content, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel:        1,
+			VerifyParallel:  1,
+			Retries:         1,
+			MetadataRetries: 1,
+			SingleStream:    "true",
+			HTTPVersion:     config.HTTPVersion1,
+			ProgressMode:    config.ProgressModeCI,
+		},
+		Files: []config.FileEntry{
+			// Dispatched first, then waits for the verify slot.
+			{URL: server.URL + "/existing", Dest: filepath.Join(dir, "existing"), SHA256: hex.EncodeToString(sum[:]), Priority: 10},
+			{URL: server.URL + "/missing", Dest: filepath.Join(dir, "missing"), SHA256: hex.EncodeToString(sum[:])},
+		},
+	}
+
+	downloader := NewDownloader(cfg, nil)
+
+	// Occupy the only verify slot, as a worker hashing another dest would.
+	downloader.verifySlots <- struct{}{}
+
+	done := make(chan []DownloadResult)
+
+	go func() {
+		done <- downloader.Download(context.Background())
+	}()
+
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the missing file to download while the existing one waited to verify")
+	}
+
+	<-downloader.verifySlots
+
+	for _, result := range <-done {
+		if result.Error != nil {
+			t.Errorf("%s: unexpected error: %v", result.File.Dest, result.Error)
+		}
+	}
+
+	if len(fetched) != 0 {
+		t.Error("expected the existing dest to verify without a download")
+	}
+}
+
+func TestDownloadFromSourceCompletePartial(t *testing.T) {
+	content := []byte("already fully downloaded")
+	sum := sha256.Sum256(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Settings: config.Settings{Retries: 1, SingleStream: "true", HTTPVersion: config.HTTPVersion1}}
+	file := config.FileEntry{
+		URL:    server.URL + "/file.bin",
+		Dest:   filepath.Join(t.TempDir(), "file.bin"),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	// The resume request for bytes past the end is answered with 416.
+	err := os.WriteFile(file.Dest+".partial", content, 0o644)
+	if err != nil {
+		t.Fatalf("writing partial: %v", err)
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	err = downloader.downloadFromSource(context.Background(), file, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(file.Dest)
+	if err != nil {
+		t.Fatalf("reading dest: %v", err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Errorf("expected %q, got %q", content, got)
+	}
+}
+
+func TestDownloadFromSourceOversizedPartial(t *testing.T) {
+	content := []byte("replaced by a smaller file")
+	sum := sha256.Sum256(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Settings: config.Settings{Retries: 1, SingleStream: "true", HTTPVersion: config.HTTPVersion1}}
+	file := config.FileEntry{
+		URL:    server.URL + "/file.bin",
+		Dest:   filepath.Join(t.TempDir(), "file.bin"),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	// A partial of the previous, larger version of the file.
+	err := os.WriteFile(file.Dest+".partial", bytes.Repeat([]byte("x"), 2*len(content)), 0o644)
+	if err != nil {
+		t.Fatalf("writing partial: %v", err)
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	err = downloader.downloadFromSource(context.Background(), file, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(file.Dest)
+	if err != nil {
+		t.Fatalf("reading dest: %v", err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Errorf("expected %q, got %q", content, got)
+	}
+}
+
+func TestDownloadFromSourceMD5Mismatch(t *testing.T) {
+	content := []byte("published with two digests")
+	sum := sha256.Sum256(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Settings: config.Settings{Retries: 1, SingleStream: "true", HTTPVersion: config.HTTPVersion1}}
+	file := config.FileEntry{
+		URL:    server.URL + "/file.bin",
+		Dest:   filepath.Join(t.TempDir(), "file.bin"),
+		SHA256: hex.EncodeToString(sum[:]),
+		MD5:    "d41d8cd98f00b204e9800998ecf8427e",
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	err := downloader.downloadFromSource(context.Background(), file, progress)
+	if !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch on md5, got %v", err)
+	}
+
+	if _, err := os.Stat(file.Dest); !os.IsNotExist(err) {
+		t.Errorf("expected no dest after the mismatch, got %v", err)
+	}
+
+	// With the right md5 both digests pass.
+	file.MD5 = fmt.Sprintf("%x", md5.Sum(content)) //nolint:gosec // checked next to sha256
+
+	err = downloader.downloadFromSource(context.Background(), file, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDownloadFromSourceSHA512Only(t *testing.T) {
+	content := []byte("published with a sha512 only")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Settings: config.Settings{Retries: 1, SingleStream: "true", HTTPVersion: config.HTTPVersion1}}
+	file := config.FileEntry{
+		URL:    server.URL + "/file.bin",
+		Dest:   filepath.Join(t.TempDir(), "file.bin"),
+		SHA512: strings.Repeat("0", 128),
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	err := downloader.downloadFromSource(context.Background(), file, progress)
+	if !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch on sha512, got %v", err)
+	}
+
+	file.SHA512 = fmt.Sprintf("%x", sha512.Sum512(content))
+
+	err = downloader.downloadFromSource(context.Background(), file, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exists, err := downloader.checkExistingFile(context.Background(), file)
+	if err != nil || !exists {
+		t.Errorf("expected the dest to be recognized by its sha512, got %v, %v", exists, err)
+	}
+}
+
+func TestDownloadResumeOnly(t *testing.T) {
+	content := []byte("only the started file is finished")
+	sum := sha256.Sum256(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	started := filepath.Join(dir, "started.bin")
+	fresh := filepath.Join(dir, "fresh.bin")
+
+	err := os.WriteFile(started+".partial", content[:10], 0o644)
+	if err != nil {
+		t.Fatalf("writing partial: %v", err)
+	}
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel:        2,
+			Retries:         1,
+			MetadataRetries: 1,
+			Resume:          "true",
+			HTTPVersion:     config.HTTPVersion1,
+			ProgressMode:    config.ProgressModeCI,
+		},
+		Files: []config.FileEntry{
+			{URL: server.URL + "/started.bin", Dest: started, SHA256: hex.EncodeToString(sum[:])},
+			{URL: server.URL + "/fresh.bin", Dest: fresh, SHA256: hex.EncodeToString(sum[:])},
+		},
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	downloader.SetResumeOnly()
+
+	results := downloader.Download(context.Background())
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("%s: unexpected error: %v", result.File.Dest, result.Error)
+		}
+	}
+
+	if got, err := os.ReadFile(started); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("expected the partial to be finished, got %q, %v", got, err)
+	}
+
+	if _, err := os.Stat(fresh); !os.IsNotExist(err) {
+		t.Errorf("expected the file without a partial to be deferred, got %v", err)
+	}
+
+	deferred := countDeferred(results)
+	if deferred != 1 || !results[1].Deferred {
+		t.Errorf("expected the file without a partial to be the one deferred file, got %d", deferred)
+	}
+
+	entries := downloader.FailedEntries(results)
+	if len(entries) != 1 || entries[0].Dest != fresh {
+		t.Errorf("expected the deferred file in the failure report, got %+v", entries)
+	}
+}
+
+func TestDownloadSequential(t *testing.T) {
+	content := []byte("downloaded in config order")
+	sum := sha256.Sum256(content)
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			order = append(order, r.URL.Path)
+			mu.Unlock()
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel:        1,
+			Retries:         1,
+			MetadataRetries: 1,
+			SingleStream:    "true",
+			HTTPVersion:     config.HTTPVersion1,
+			ProgressMode:    config.ProgressModeCI,
+		},
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		cfg.Files = append(cfg.Files, config.FileEntry{
+			URL:    server.URL + "/" + name,
+			Dest:   filepath.Join(dir, name),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	// Priority would start c first.
+	cfg.Files[2].Priority = 10
+
+	downloader := NewDownloader(cfg, nil)
+	downloader.SetSequential()
+
+	for _, result := range downloader.Download(context.Background()) {
+		if result.Error != nil {
+			t.Errorf("%s: unexpected error: %v", result.File.Dest, result.Error)
+		}
+	}
+
+	got := strings.Join(order, ",")
+	if got != "/a,/b,/c" {
+		t.Errorf("expected downloads in config order /a,/b,/c, got %s", got)
+	}
+}
+
+func TestDownloadWithFallbackAlias(t *testing.T) {
+	content := []byte("object behind rotated credentials")
+	sum := sha256.Sum256(content)
+
+	// A path-style S3 endpoint that only accepts the "current" access key.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=current/") {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	alias := config.Alias{Endpoint: server.URL, Region: "us-east-1", Bucket: "artifacts", SecretKey: "secret"}
+
+	primary := alias
+	primary.AccessKey = "rotated"
+	primary.FallbackAlias = "backup"
+
+	backup := alias
+	backup.AccessKey = "current"
+
+	cfg := &config.Config{
+		Aliases:  map[string]config.Alias{"primary": primary, "backup": backup},
+		Settings: config.Settings{Retries: 1, SingleStream: "true", MetadataRetries: 1},
+	}
+	file := config.FileEntry{
+		URL:    "s3://primary/file.bin",
+		Dest:   filepath.Join(t.TempDir(), "file.bin"),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	err := downloader.downloadWithFallback(context.Background(), file, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	progress.Wait()
+
+	data, err := os.ReadFile(file.Dest)
+	if err != nil {
+		t.Fatalf("reading dest: %v", err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("expected %q, got %q", content, data)
+	}
+
+	if len(downloader.Warnings()) != 1 {
+		t.Errorf("expected one fallback warning, got %q", downloader.Warnings())
+	}
+}
+
+func TestDownloadOffline(t *testing.T) {
+	present := []byte("already in place")
+	presentSum := sha256.Sum256(present)
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	presentDest := filepath.Join(dir, "present.bin")
+
+	err := os.WriteFile(presentDest, present, 0o644)
+	if err != nil {
+		t.Fatalf("writing dest: %v", err)
+	}
+
+	cfg := &config.Config{
+		Settings: config.Settings{Parallel: 2, Retries: 3, MetadataRetries: 1, ProgressMode: config.ProgressModeCI},
+		Files: []config.FileEntry{
+			{URL: server.URL + "/present.bin", Dest: presentDest, SHA256: hex.EncodeToString(presentSum[:])},
+			{URL: server.URL + "/missing.bin", Dest: filepath.Join(dir, "missing.bin"), SHA256: strings.Repeat("a", 64)},
+			{URL: server.URL + "/checksum.bin", Dest: filepath.Join(dir, "checksum.bin"), SHA256URL: server.URL + "/SHA256SUMS"},
+		},
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	downloader.checksums = newChecksumResolver(filepath.Join(dir, "checksums.json"), time.Second)
+	downloader.SetOffline()
+
+	results := downloader.Download(context.Background())
+
+	if results[0].Error != nil {
+		t.Errorf("expected the present file to be kept, got %v", results[0].Error)
+	}
+
+	for _, result := range results[1:] {
+		if !errors.Is(result.Error, errNotCached) {
+			t.Errorf("%s: expected errNotCached, got %v", result.File.Dest, result.Error)
+		}
+	}
+
+	if requests.Load() != 0 {
+		t.Errorf("expected no requests offline, got %d", requests.Load())
+	}
+}
+
+func TestDownloadHTTPRetries(t *testing.T) {
+	var gets atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel: 1, Retries: 5, HTTPRetries: 2, S3Retries: 4, RetryDelay: time.Millisecond,
+			MetadataRetries: 1, HTTPVersion: config.HTTPVersion1, ProgressMode: config.ProgressModeCI,
+		},
+		Files: []config.FileEntry{
+			{URL: server.URL + "/file.bin", Dest: filepath.Join(t.TempDir(), "file.bin"), SHA256: strings.Repeat("a", 64)},
+		},
+	}
+
+	results := NewDownloader(cfg, nil).Download(context.Background())
+	if results[0].Error == nil {
+		t.Fatal("expected the download to fail")
+	}
+
+	if !strings.Contains(results[0].Error.Error(), "all 2 attempts") {
+		t.Errorf("expected http_retries to bound the attempts, got %v", results[0].Error)
+	}
+
+	if gets.Load() != 2 {
+		t.Errorf("expected 2 GET requests, got %d", gets.Load())
+	}
+}
+
+func TestDownloadCacheOptOut(t *testing.T) {
+	content := []byte("not for the cache")
+	sum := sha256.Sum256(content)
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer source.Close()
+
+	tests := []struct {
+		name          string
+		cache         string
+		wantCacheUsed bool
+	}{
+		{name: "global setting", cache: "", wantCacheUsed: true},
+		{name: "opted in", cache: "true", wantCacheUsed: true},
+		{name: "opted out", cache: "false", wantCacheUsed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cacheRequests atomic.Int32
+
+			// The cache holds nothing, so a participating file is looked up,
+			// downloaded from the source and then uploaded.
+			cacheServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				cacheRequests.Add(1)
+
+				if r.Method == http.MethodPut {
+					_, _ = io.Copy(io.Discard, r.Body)
+
+					return
+				}
+
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer cacheServer.Close()
+
+			cfg := &config.Config{
+				Settings: config.Settings{Parallel: 1, Retries: 1, MetadataRetries: 1, ProgressMode: config.ProgressModeCI},
+				Files: []config.FileEntry{{
+					URL:    source.URL + "/file.bin",
+					Dest:   filepath.Join(t.TempDir(), "file.bin"),
+					SHA256: hex.EncodeToString(sum[:]),
+					Cache:  tt.cache,
+				}},
+			}
+
+			cache := &Cache{
+				alias: config.Alias{
+					Endpoint: cacheServer.URL, Region: "us-east-1", Bucket: "cache", AccessKey: "key", SecretKey: "secret",
+				},
+				settings: config.Settings{MetadataRetries: 1},
+			}
+
+			results := NewDownloader(cfg, cache).Download(context.Background())
+			if results[0].Error != nil {
+				t.Fatalf("unexpected error: %v", results[0].Error)
+			}
+
+			if got := cacheRequests.Load() > 0; got != tt.wantCacheUsed {
+				t.Errorf("expected cache used %t, got %d cache requests", tt.wantCacheUsed, cacheRequests.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// etagSidecarSuffix is appended to a dest to name the file recording the
+// ETag of the object it was downloaded from.
+const etagSidecarSuffix = ".etag"
+
+// normalizeETag strips the weak validator prefix and the quotes servers put
+// around ETags, so a configured etag matches with or without them.
+func normalizeETag(etag string) string {
+	etag = strings.TrimSpace(etag)
+	etag = strings.TrimPrefix(etag, "W/")
+
+	return strings.Trim(etag, `"`)
+}
+
+// usableETag reports whether etag can stand in for a content hash. S3
+// multipart ETags ("<md5>-<parts>") depend on the part size used for the
+// upload rather than on the content alone, so they are not trusted.
+func usableETag(etag string) bool {
+	return etag != "" && !strings.Contains(etag, "-")
+}
+
+// etagMatches is the cheap pre-check for files with an etag: the dest is
+// trusted without hashing when its sidecar records the expected ETag. A dest
+// modified after the sidecar was written falls back to hashing.
+func etagMatches(file config.FileEntry, destInfo fs.FileInfo) bool {
+	expected := normalizeETag(file.ETag)
+	if !usableETag(expected) {
+		return false
+	}
+
+	return sidecarRecords(file.Dest, destInfo, expected)
+}
+
+// sidecarRecords reports whether the ETag sidecar of dest records expected
+// and was written no earlier than the dest was last modified.
+func sidecarRecords(dest string, destInfo fs.FileInfo, expected string) bool {
+	sidecarPath := dest + etagSidecarSuffix
+
+	sidecarInfo, err := os.Stat(sidecarPath)
+	if err != nil || sidecarInfo.ModTime().Before(destInfo.ModTime()) {
+		return false
+	}
+
+	recorded, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return false
+	}
+
+	return normalizeETag(string(recorded)) == expected
+}
+
+// recordETag writes the sidecar for a file with an etag once the dest is in
+// place and verified against its checksum. The sidecar records the
+// configured etag, and only when the source still reports it: an object
+// replaced since the dest was verified must not vouch for the old dest once
+// the config moves to its new etag. Errors are reported as warnings: without
+// a sidecar the next run simply hashes the file. Mirrored objects record the
+// ETag of their listing instead.
+func (downloader *Downloader) recordETag(ctx context.Context, file config.FileEntry) {
+	mirrored, ok := downloader.mirrored[file.Dest]
+	if ok {
+		etag := normalizeETag(mirrored.object.ETag)
+		if etag == "" {
+			return
+		}
+
+		err := writeETagSidecar(file.Dest, etag)
+		if err != nil {
+			downloader.warn("%s: %v", file.Dest, err)
+		}
+
+		return
+	}
+
+	// Without a checksum the dest was never verified.
+	if file.ETag == "" || !file.HasChecksum() || downloader.offline {
+		return
+	}
+
+	expected := normalizeETag(file.ETag)
+	if !usableETag(expected) {
+		return
+	}
+
+	info, err := os.Stat(file.Dest)
+	if err != nil || etagMatches(file, info) {
+		return
+	}
+
+	source, err := downloader.newSource(file)
+	if err != nil {
+		return
+	}
+
+	etagSource, ok := source.(storage.ETagSource)
+	if !ok {
+		return
+	}
+
+	etag, err := retryMetadata(ctx, downloader.cfg.Settings, func() (string, error) {
+		return etagSource.GetETag(ctx)
+	})
+	if err != nil {
+		downloader.warn("could not get etag of %s: %v", redactURL(file.URL), err)
+
+		return
+	}
+
+	if normalizeETag(etag) != expected {
+		return
+	}
+
+	err = writeETagSidecar(file.Dest, expected)
+	if err != nil {
+		downloader.warn("%s: %v", file.Dest, err)
+	}
+}
+
+func writeETagSidecar(dest, etag string) error {
+	data := []byte(etag + "\n")
+
+	err := os.WriteFile(dest+etagSidecarSuffix, data, 0o644) //nolint:gosec // sidecar is as readable as the file
+	if err != nil {
+		return fmt.Errorf("writing etag sidecar: %w", err)
+	}
+
+	return nil
+}
+
+// discardETagSidecar removes the sidecar of a dest that is about to be
+// replaced, so it cannot vouch for the new content.
+func discardETagSidecar(dest string) {
+	os.Remove(dest + etagSidecarSuffix)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		etag     string
+		recorded string
+		modified bool
+		want     bool
+	}{
+		{name: "matching", etag: "9b2cf535f27731c974343645a3985328", recorded: "9b2cf535f27731c974343645a3985328\n", want: true},
+		{name: "quoted", etag: `"9b2cf535f27731c974343645a3985328"`, recorded: "9b2cf535f27731c974343645a3985328\n", want: true},
+		{name: "different", etag: "9b2cf535f27731c974343645a3985328", recorded: "0cc175b9c0f1b6a831c399e269772661\n"},
+		{name: "multipart", etag: "9b2cf535f27731c974343645a3985328-4", recorded: "9b2cf535f27731c974343645a3985328-4\n"},
+		{name: "no sidecar", etag: "9b2cf535f27731c974343645a3985328"},
+		{name: "dest modified after sidecar", etag: "9b2cf535f27731c974343645a3985328", recorded: "9b2cf535f27731c974343645a3985328\n", modified: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "file.bin")
+
+			err := os.WriteFile(dest, []byte("content"), 0o644)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.recorded != "" {
+				err = os.WriteFile(dest+etagSidecarSuffix, []byte(tt.recorded), 0o644)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if tt.modified {
+				later := time.Now().Add(time.Hour)
+
+				err = os.Chtimes(dest, later, later)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			info, err := os.Stat(dest)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := etagMatches(config.FileEntry{Dest: dest, ETag: tt.etag}, info)
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRecordETagOnlyWhenSourceMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverETag string
+		wantFile   bool
+	}{
+		{name: "unchanged object", serverETag: `"9b2cf535f27731c974343645a3985328"`, wantFile: true},
+		{name: "object replaced since", serverETag: `"0cc175b9c0f1b6a831c399e269772661"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("ETag", tt.serverETag)
+			}))
+			defer server.Close()
+
+			dest := filepath.Join(t.TempDir(), "file.bin")
+
+			err := os.WriteFile(dest, []byte("content"), 0o644)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			file := config.FileEntry{
+				URL:    server.URL + "/file.bin",
+				Dest:   dest,
+				SHA256: "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+				ETag:   "9b2cf535f27731c974343645a3985328",
+			}
+			cfg := &config.Config{Settings: config.Settings{MetadataRetries: 1, HTTPVersion: config.HTTPVersion1}}
+
+			NewDownloader(cfg, nil).recordETag(context.Background(), file)
+
+			recorded, err := os.ReadFile(dest + etagSidecarSuffix)
+			if tt.wantFile != (err == nil) {
+				t.Fatalf("expected sidecar %v, got %q, %v", tt.wantFile, recorded, err)
+			}
+
+			if tt.wantFile && string(recorded) != "9b2cf535f27731c974343645a3985328\n" {
+				t.Errorf("expected the configured etag to be recorded, got %q", recorded)
+			}
+		})
+	}
+}
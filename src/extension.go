@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// contentTypeExtensions maps the media types settings.infer_extension knows
+// to the extension appended to a dest. The table is fixed rather than taken
+// from the mime package, whose answers depend on the mime.types files of the
+// host. Generic types such as application/octet-stream are left out on
+// purpose.
+var contentTypeExtensions = map[string]string{
+	"application/gzip":                      ".gz",
+	"application/json":                      ".json",
+	"application/pdf":                       ".pdf",
+	"application/vnd.debian.binary-package": ".deb",
+	"application/wasm":                      ".wasm",
+	"application/x-7z-compressed":           ".7z",
+	"application/x-bzip2":                   ".bz2",
+	"application/x-gzip":                    ".gz",
+	"application/x-rpm":                     ".rpm",
+	"application/x-tar":                     ".tar",
+	"application/x-xz":                      ".xz",
+	"application/xml":                       ".xml",
+	"application/yaml":                      ".yaml",
+	"application/zip":                       ".zip",
+	"application/zstd":                      ".zst",
+	"image/gif":                             ".gif",
+	"image/jpeg":                            ".jpg",
+	"image/png":                             ".png",
+	"image/svg+xml":                         ".svg",
+	"image/webp":                            ".webp",
+	"text/csv":                              ".csv",
+	"text/html":                             ".html",
+	"text/plain":                            ".txt",
+	"text/xml":                              ".xml",
+}
+
+// extensionForContentType returns the extension for a Content-Type header
+// value, ignoring parameters such as charset, or "" when it is unknown.
+func extensionForContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return contentTypeExtensions[strings.ToLower(mediaType)]
+}
+
+// inferExtension implements settings.infer_extension: a dest without an
+// extension gets the one matching the Content-Type of its source. Dests
+// with an extension, split files and objects of a prefix entry are left
+// alone. A dest already on disk under its own name or, unambiguously, under
+// an inferred one is kept without asking the source, so later runs and
+// offline runs find it. A failed lookup, or an inferred dest that another
+// file downloads to, is reported as a warning and keeps the dest.
+func (downloader *Downloader) inferExtension(ctx context.Context, file config.FileEntry) config.FileEntry {
+	if !downloader.cfg.Settings.IsInferExtension() {
+		return file
+	}
+
+	if filepath.Ext(file.Dest) != "" || len(file.Parts) > 0 || file.URL == config.StdinURL {
+		return file
+	}
+
+	_, ok := downloader.mirrored[file.Dest]
+	if ok {
+		return file
+	}
+
+	existing := existingInferredDest(file.Dest)
+	if existing != "" {
+		return downloader.renameDest(file, existing, "found on disk")
+	}
+
+	if downloader.offline {
+		return file
+	}
+
+	source, err := downloader.newSource(file)
+	if err != nil {
+		return file
+	}
+
+	typeSource, ok := source.(storage.ContentTypeSource)
+	if !ok {
+		return file
+	}
+
+	contentType, err := retryMetadata(ctx, downloader.cfg.Settings, func() (string, error) {
+		return typeSource.GetContentType(ctx)
+	})
+	if err != nil {
+		downloader.warn("could not get content type of %s: %v", redactURL(file.URL), err)
+
+		return file
+	}
+
+	ext := extensionForContentType(contentType)
+	if ext == "" {
+		return file
+	}
+
+	return downloader.renameDest(file, file.Dest+ext, contentType)
+}
+
+// renameDest moves file to dest, unless another file of the run downloads
+// there, which keeps the original dest with a warning. reason is printed
+// with the change.
+func (downloader *Downloader) renameDest(file config.FileEntry, dest, reason string) config.FileEntry {
+	if dest == file.Dest {
+		return file
+	}
+
+	if !downloader.inferredDests.claim(dest) {
+		downloader.warn("keeping %s: %s is the dest of another file", file.Dest, dest)
+
+		return file
+	}
+
+	fmt.Printf("saving %s as %s (%s)\n", file.Dest, dest, reason)
+	file.Dest = dest
+
+	return file
+}
+
+// existingInferredDest returns dest when a file exists there, else the one
+// file dest plus a known extension names, or "" when there is none or more
+// than one.
+func existingInferredDest(dest string) string {
+	_, err := os.Stat(dest)
+	if err == nil {
+		return dest
+	}
+
+	var found []string
+
+	for _, ext := range inferredExtensions() {
+		info, err := os.Stat(dest + ext)
+		if err == nil && info.Mode().IsRegular() {
+			found = append(found, dest+ext)
+		}
+	}
+
+	if len(found) != 1 {
+		return ""
+	}
+
+	return found[0]
+}
+
+// inferredExtensions returns the distinct extensions of
+// contentTypeExtensions.
+func inferredExtensions() []string {
+	exts := slices.Collect(maps.Values(contentTypeExtensions))
+	slices.Sort(exts)
+
+	return slices.Compact(exts)
+}
+
+// destClaims records the dests of a run, so an inferred dest never takes
+// the path another file downloads to.
+type destClaims struct {
+	mu    sync.Mutex
+	dests map[string]bool
+}
+
+func newDestClaims(files []config.FileEntry) *destClaims {
+	claims := &destClaims{dests: make(map[string]bool, len(files))}
+
+	for _, file := range files {
+		claims.dests[filepath.Clean(file.Dest)] = true
+	}
+
+	return claims
+}
+
+// claim records dest and reports whether it was free. A nil *destClaims
+// allows every dest.
+func (claims *destClaims) claim(dest string) bool {
+	if claims == nil {
+		return true
+	}
+
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+
+	dest = filepath.Clean(dest)
+	if claims.dests[dest] {
+		return false
+	}
+
+	claims.dests[dest] = true
+
+	return true
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestExtensionForContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"application/zip", ".zip"},
+		{"application/json; charset=utf-8", ".json"},
+		{"Image/PNG", ".png"},
+		{"application/octet-stream", ""},
+		{"", ""},
+		{"not a media type;;", ""},
+	}
+
+	for _, tt := range tests {
+		got := extensionForContentType(tt.contentType)
+		if got != tt.want {
+			t.Errorf("extensionForContentType(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadInferExtension(t *testing.T) {
+	content := []byte("PK generated archive")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	sum := sha256Hex(string(content))
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel:        2,
+			Retries:         1,
+			MetadataRetries: 1,
+			HTTPVersion:     config.HTTPVersion1,
+			ProgressMode:    config.ProgressModeCI,
+			InferExtension:  "true",
+		},
+		Files: []config.FileEntry{
+			{URL: server.URL + "/export?id=1", Dest: filepath.Join(dir, "export"), SHA256: sum},
+			{URL: server.URL + "/export?id=2", Dest: filepath.Join(dir, "export.bin"), SHA256: sum},
+		},
+	}
+
+	results := NewDownloader(cfg, nil).Download(context.Background())
+
+	want := []string{filepath.Join(dir, "export.zip"), filepath.Join(dir, "export.bin")}
+
+	for i, result := range results {
+		if result.Error != nil {
+			t.Fatalf("%s: unexpected error: %v", result.File.Dest, result.Error)
+		}
+
+		if result.File.Dest != want[i] {
+			t.Errorf("expected dest %s, got %s", want[i], result.File.Dest)
+		}
+
+		_, err := os.Stat(want[i])
+		if err != nil {
+			t.Errorf("expected %s to be written: %v", want[i], err)
+		}
+	}
+}
+
+func TestInferExtensionReusesDestOnDisk(t *testing.T) {
+	content := []byte("PK generated archive")
+
+	var heads atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Settings: config.Settings{
+				Parallel:        1,
+				Retries:         1,
+				MetadataRetries: 1,
+				HTTPVersion:     config.HTTPVersion1,
+				ProgressMode:    config.ProgressModeCI,
+				InferExtension:  "true",
+			},
+			Files: []config.FileEntry{
+				{URL: server.URL + "/export", Dest: filepath.Join(dir, "export"), SHA256: sha256Hex(string(content))},
+			},
+		}
+	}
+
+	results := NewDownloader(newConfig(), nil).Download(context.Background())
+	if results[0].Error != nil || heads.Load() != 1 {
+		t.Fatalf("expected the first run to ask for the content type once, got %v after %d HEAD requests",
+			results[0].Error, heads.Load())
+	}
+
+	results = NewDownloader(newConfig(), nil).Download(context.Background())
+	if results[0].Error != nil || heads.Load() != 1 {
+		t.Errorf("expected a later run to reuse the dest on disk, got %v after %d HEAD requests",
+			results[0].Error, heads.Load())
+	}
+
+	offline := NewDownloader(newConfig(), nil)
+	offline.SetOffline()
+
+	results = offline.Download(context.Background())
+	if results[0].Error != nil || results[0].File.Dest != filepath.Join(dir, "export.zip") {
+		t.Errorf("expected an offline run to find %s, got %s: %v", filepath.Join(dir, "export.zip"),
+			results[0].File.Dest, results[0].Error)
+	}
+}
+
+func TestInferExtensionKeepsDestOfAnotherFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(r.URL.Path)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel:        1,
+			Retries:         1,
+			MetadataRetries: 1,
+			HTTPVersion:     config.HTTPVersion1,
+			ProgressMode:    config.ProgressModeCI,
+			InferExtension:  "true",
+		},
+		Files: []config.FileEntry{
+			{URL: server.URL + "/a", Dest: filepath.Join(dir, "export"), SHA256: sha256Hex("/a")},
+			{URL: server.URL + "/b", Dest: filepath.Join(dir, "export.zip"), SHA256: sha256Hex("/b")},
+		},
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	results := downloader.Download(context.Background())
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("%s: unexpected error: %v", result.File.Dest, result.Error)
+		}
+	}
+
+	if results[0].File.Dest != filepath.Join(dir, "export") {
+		t.Errorf("expected the dest of another file not to be taken, got %s", results[0].File.Dest)
+	}
+
+	if len(downloader.Warnings()) != 1 {
+		t.Errorf("expected one warning, got %v", downloader.Warnings())
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+
+	"xget/src/config"
+)
+
+// cacheUploadOpenFiles is what a cache upload counts against
+// settings.max_open_files: the file it reads and its connection.
+const cacheUploadOpenFiles = 2
+
+// fdBudget implements settings.max_open_files: every download and cache
+// upload takes tokens for the files and connections it may hold open, and
+// waits until enough are free.
+type fdBudget struct {
+	tokens chan struct{}
+
+	// taking serializes acquisitions, so two of them cannot each hold part
+	// of the tokens the other one waits for.
+	taking sync.Mutex
+}
+
+// newFDBudget returns a budget of limit open files, or nil for no limit.
+func newFDBudget(limit int) *fdBudget {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &fdBudget{tokens: make(chan struct{}, limit)}
+}
+
+// acquire blocks until n tokens are free, or ctx is done, and returns the
+// function that frees them. Requests above the whole budget take all of it
+// rather than waiting forever. A nil budget admits everything at once.
+func (budget *fdBudget) acquire(ctx context.Context, n int) (func(), error) {
+	if budget == nil {
+		return func() {}, nil
+	}
+
+	n = min(n, cap(budget.tokens))
+
+	budget.taking.Lock()
+	defer budget.taking.Unlock()
+
+	for i := range n {
+		select {
+		case budget.tokens <- struct{}{}:
+		case <-ctx.Done():
+			budget.release(i)
+
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() { budget.release(n) }, nil
+}
+
+func (budget *fdBudget) release(n int) {
+	for range n {
+		<-budget.tokens
+	}
+}
+
+// downloadOpenFiles returns what a download counts against
+// settings.max_open_files: its partial plus its connections.
+func downloadOpenFiles(settings config.Settings) int {
+	return downloadConnections(settings) + 1
+}
+
+// downloadConnections returns how many connections a download may open: one
+// per segment, as it may turn out to be segmented once its size is known.
+func downloadConnections(settings config.Settings) int {
+	if !settings.IsSingleStream() && settings.SegmentsPerFile > 1 {
+		return settings.SegmentsPerFile
+	}
+
+	return 1
+}
+
+// checkOpenFileLimit rejects a settings.max_open_files the process cannot
+// reach, so the run fails up front rather than with EMFILE halfway through.
+func checkOpenFileLimit(maxOpenFiles int) error {
+	limit, ok := openFileLimit()
+	if !ok || maxOpenFiles == 0 || maxOpenFiles <= limit {
+		return nil
+	}
+
+	return fmt.Errorf("settings.max_open_files is %d, but the process may open only %d files (ulimit -n); "+
+		"lower it or raise the hard limit", maxOpenFiles, limit)
+}
+
+// explainOpenFileError adds a hint to errors caused by running out of file
+// descriptors, which otherwise only read "too many open files".
+func explainOpenFileError(err error, settings config.Settings) error {
+	if !errors.Is(err, syscall.EMFILE) {
+		return err
+	}
+
+	hint := "set settings.max_open_files"
+	if settings.MaxOpenFiles > 0 {
+		hint = "lower settings.max_open_files"
+	}
+
+	limit, ok := openFileLimit()
+	if ok {
+		hint += fmt.Sprintf(" below the process limit of %d", limit)
+	}
+
+	return fmt.Errorf("%w: the process ran out of file descriptors, %s or reduce parallel and segments_per_file",
+		err, hint)
+}
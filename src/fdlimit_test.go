@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestFDBudget(t *testing.T) {
+	budget := newFDBudget(4)
+
+	release, err := budget.acquire(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Two more do not fit next to the three held.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = budget.acquire(ctx, 2)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the acquisition to wait, got %v", err)
+	}
+
+	held := len(budget.tokens)
+	if held != 3 {
+		t.Errorf("expected a cancelled acquisition to give its tokens back, %d held", held)
+	}
+
+	release()
+
+	// A request above the whole budget takes all of it instead of waiting forever.
+	releaseAll, err := budget.acquire(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	held = len(budget.tokens)
+	if held != 4 {
+		t.Errorf("expected the whole budget to be held, %d held", held)
+	}
+
+	releaseAll()
+
+	var unlimited *fdBudget
+
+	_, err = unlimited.acquire(context.Background(), 100)
+	if err != nil {
+		t.Errorf("expected a nil budget to admit everything, got %v", err)
+	}
+}
+
+func TestDownloadOpenFiles(t *testing.T) {
+	tests := []struct {
+		settings config.Settings
+		want     int
+	}{
+		{config.Settings{SegmentsPerFile: 4}, 5},
+		{config.Settings{SegmentsPerFile: 4, SingleStream: "true"}, 2},
+		{config.Settings{SegmentsPerFile: 1}, 2},
+	}
+
+	for _, tt := range tests {
+		got := downloadOpenFiles(tt.settings)
+		if got != tt.want {
+			t.Errorf("downloadOpenFiles(%+v) = %d, want %d", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestExplainOpenFileError(t *testing.T) {
+	if err := explainOpenFileError(nil, config.Settings{}); err != nil {
+		t.Errorf("expected nil to stay nil, got %v", err)
+	}
+
+	other := errors.New("connection refused")
+	if err := explainOpenFileError(other, config.Settings{}); err != other { //nolint:errorlint // identity is the point
+		t.Errorf("expected unrelated errors to pass through, got %v", err)
+	}
+
+	emfile := fmt.Errorf("creating destination file: %w", syscall.EMFILE)
+
+	err := explainOpenFileError(emfile, config.Settings{})
+	if !errors.Is(err, syscall.EMFILE) || !strings.Contains(err.Error(), "set settings.max_open_files") {
+		t.Errorf("expected a max_open_files hint, got %v", err)
+	}
+
+	err = explainOpenFileError(emfile, config.Settings{MaxOpenFiles: 512})
+	if !strings.Contains(err.Error(), "lower settings.max_open_files") {
+		t.Errorf("expected a hint to lower max_open_files, got %v", err)
+	}
+}
+
+func TestCheckOpenFileLimit(t *testing.T) {
+	err := checkOpenFileLimit(0)
+	if err != nil {
+		t.Errorf("expected no check without max_open_files, got %v", err)
+	}
+
+	err = checkOpenFileLimit(8)
+	if err != nil {
+		t.Errorf("expected a small budget to fit, got %v", err)
+	}
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return
+	}
+
+	err = checkOpenFileLimit(1 << 30)
+	if err == nil || !strings.Contains(err.Error(), "ulimit -n") {
+		t.Errorf("expected a budget above the process limit to fail, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+// openFileLimit returns the soft RLIMIT_NOFILE of the process. The Go
+// runtime has already raised it to the hard limit at startup.
+func openFileLimit() (int, bool) {
+	var limit syscall.Rlimit
+
+	err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit)
+	if err != nil || limit.Cur > 1<<30 {
+		return 0, false
+	}
+
+	return int(limit.Cur), true //nolint:gosec // bounded above
+}
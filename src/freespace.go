@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// freeSpaceCheckInterval is how many bytes a download writes between two
+// checks of settings.min_free_space.
+const freeSpaceCheckInterval = 16 << 20
+
+// errLowDiskSpace marks a download aborted by settings.min_free_space. It is
+// not retried: the disk will not have more room a second later.
+var errLowDiskSpace = errors.New("not enough free disk space")
+
+// freeSpaceGuard implements settings.min_free_space. It is placed before the
+// partial file in the copy loop of a download, and fails the write that
+// would start while the file system of the dest has less than min bytes
+// free. Once tripped, it fails every later write. It is safe for concurrent
+// use by the segments of one download.
+type freeSpaceGuard struct {
+	dir string
+	min int64
+
+	mu        sync.Mutex
+	unchecked int
+	err       error
+}
+
+// newFreeSpaceGuard returns the guard for a download to dest, or nil when
+// settings.min_free_space is not set.
+func (downloader *Downloader) newFreeSpaceGuard(dest string) *freeSpaceGuard {
+	if downloader.cfg.Settings.MinFreeSpace <= 0 {
+		return nil
+	}
+
+	return &freeSpaceGuard{dir: filepath.Dir(dest), min: downloader.cfg.Settings.MinFreeSpace}
+}
+
+// Write checks the free space before the first write and then after every
+// freeSpaceCheckInterval bytes. File systems whose free space cannot be
+// read, e.g. on platforms without statfs, are not checked.
+func (guard *freeSpaceGuard) Write(p []byte) (int, error) {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	if guard.err != nil {
+		return 0, guard.err
+	}
+
+	if guard.unchecked <= 0 {
+		free, err := freeSpace(guard.dir)
+		if err == nil && free < guard.min {
+			guard.err = fmt.Errorf("%w: %s has %d bytes free, settings.min_free_space is %d",
+				errLowDiskSpace, guard.dir, free, guard.min)
+
+			return 0, guard.err
+		}
+
+		guard.unchecked = freeSpaceCheckInterval
+	}
+
+	guard.unchecked -= len(p)
+
+	return len(p), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// freeSpace reports that free space cannot be read here, so
+// settings.min_free_space is not enforced.
+func freeSpace(string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestFreeSpaceGuard(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := freeSpace(dir); err != nil {
+		t.Skipf("free space unavailable here: %v", err)
+	}
+
+	roomy := &freeSpaceGuard{dir: dir, min: 1}
+
+	for range 3 {
+		if _, err := roomy.Write(make([]byte, freeSpaceCheckInterval)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	full := &freeSpaceGuard{dir: dir, min: math.MaxInt64}
+
+	_, err := full.Write([]byte("data"))
+	if !errors.Is(err, errLowDiskSpace) {
+		t.Fatalf("expected errLowDiskSpace, got %v", err)
+	}
+
+	// A tripped guard stays tripped.
+	full.min = 1
+
+	if _, err := full.Write([]byte("data")); !errors.Is(err, errLowDiskSpace) {
+		t.Errorf("expected errLowDiskSpace again, got %v", err)
+	}
+}
+
+func TestDownloadMinFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := freeSpace(dir); err != nil {
+		t.Skipf("free space unavailable here: %v", err)
+	}
+
+	content := []byte("more than the disk can take")
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			requests.Add(1)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(dir, "file.bin")
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel:        1,
+			Retries:         3,
+			MetadataRetries: 1,
+			SingleStream:    "true",
+			MinFreeSpace:    math.MaxInt64,
+			ProgressMode:    config.ProgressModeCI,
+		},
+		Files: []config.FileEntry{{URL: server.URL + "/file.bin", Dest: dest, SHA256: sha256Hex(string(content))}},
+	}
+
+	results := NewDownloader(cfg, nil).Download(context.Background())
+	if !errors.Is(results[0].Error, errLowDiskSpace) {
+		t.Fatalf("expected errLowDiskSpace, got %v", results[0].Error)
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("expected no retries, got %d requests", requests.Load())
+	}
+
+	if _, err := os.Stat(dest + ".partial"); !os.IsNotExist(err) {
+		t.Errorf("expected the partial to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace returns the bytes available to unprivileged users on the file
+// system holding dir.
+func freeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), nil //nolint:gosec,unconvert // field types differ by platform
+}
@@ -1,26 +1,67 @@
 package main
 
 import (
+	"crypto/sha1" //nolint:gosec // emitted on request, for tools that expect it
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/vbauerster/mpb/v8"
 	"gopkg.in/yaml.v3"
 
 	"xget/src/config"
 )
 
+// defaultGenerateWorkers is how many files generate hashes at once by default.
+const defaultGenerateWorkers = 4
+
+// defaultGenerateBufferSize is the read size generate hashes files with by
+// default; far larger than the 32 KiB of io.Copy, it cuts the read calls on
+// multi-GB files.
+const defaultGenerateBufferSize = 1 << 20
+
+// checksumAlgorithms are the digests generate -algo can emit. Each is written
+// to the file field of the same name, which the downloader verifies.
+var checksumAlgorithms = []string{"sha256", "sha512", "sha1"}
+
 // GenerateOutput represents the output structure for generated config.
 type GenerateOutput struct {
 	Files []config.FileEntry `yaml:"files"`
 }
 
+// generateOptions holds the settings of the generate command.
+type generateOptions struct {
+	strict     bool
+	workers    int
+	since      time.Duration
+	bufferSize int
+	progress   bool
+
+	// algorithm is the checksumAlgorithms entry to emit; empty means sha256.
+	algorithm string
+}
+
+// checksumField returns the file field generate writes the digest to.
+func (opts generateOptions) checksumField() string {
+	if opts.algorithm == "" {
+		return "sha256"
+	}
+
+	return opts.algorithm
+}
+
 // generateConfig generates a config file by scanning a directory.
-func generateConfig(dirPath string) ([]byte, error) {
+// Warnings about skipped files are printed to stderr; in strict mode they
+// also fail the command, so an incomplete config is never written.
+func generateConfig(dirPath string, opts generateOptions) ([]byte, error) {
 	dirPath = filepath.Clean(dirPath)
 
 	info, err := os.Stat(dirPath)
@@ -32,11 +73,23 @@ func generateConfig(dirPath string) ([]byte, error) {
 		return nil, fmt.Errorf("path is not a directory: %s", dirPath)
 	}
 
-	entries, err := walkDirectory(dirPath)
+	entries, warnings, err := walkDirectory(dirPath, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	if opts.strict && len(warnings) > 0 {
+		return nil, fmt.Errorf("%d warnings in strict mode", len(warnings))
+	}
+
+	if len(entries) == 0 && opts.since > 0 {
+		return nil, fmt.Errorf("no files modified within %s in directory: %s", opts.since, dirPath)
+	}
+
 	if len(entries) == 0 {
 		return nil, fmt.Errorf("no files found in directory: %s", dirPath)
 	}
@@ -51,18 +104,39 @@ func generateConfig(dirPath string) ([]byte, error) {
 	return data, nil
 }
 
-// walkDirectory walks a directory tree and returns file entries.
-func walkDirectory(baseDir string) ([]config.FileEntry, error) {
+// walkResult is the outcome for one path found by walkDirectory: an entry,
+// or a warning when the path was skipped.
+type walkResult struct {
+	entry   *config.FileEntry
+	warning string
+}
+
+// walkDirectory walks a directory tree and returns file entries, along with
+// warnings for paths that were skipped. Up to opts.workers files are hashed
+// at once, which hides per-file latency on network filesystems; entries and
+// warnings keep the walk order, so the output does not depend on timing.
+// With opts.since, files last modified before that window are left out.
+func walkDirectory(baseDir string, opts generateOptions) ([]config.FileEntry, []string, error) {
 	baseDir = filepath.Clean(baseDir)
 
-	var entries []config.FileEntry
+	var cutoff time.Time
+	if opts.since > 0 {
+		cutoff = time.Now().Add(-opts.since)
+	}
 
-	var warnings []string
+	// Workers fill results through the pointers, so appending is safe
+	// while they run.
+	var results []*walkResult
+
+	var wg sync.WaitGroup
+
+	slots := make(chan struct{}, max(opts.workers, 1))
+
+	hasher := newFileHasher(opts)
 
 	err := filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			warning := fmt.Sprintf("warning: cannot access %s: %v", path, err)
-			warnings = append(warnings, warning)
+			results = append(results, &walkResult{warning: fmt.Sprintf("warning: cannot access %s: %v", path, err)})
 
 			return nil
 		}
@@ -72,48 +146,117 @@ func walkDirectory(baseDir string) ([]config.FileEntry, error) {
 		}
 
 		if !d.Type().IsRegular() {
+			results = append(results, &walkResult{warning: "warning: skipping non-regular file " + path})
+
 			return nil
 		}
 
-		relPath, err := makeRelativePath(baseDir, path)
-		if err != nil {
-			warning := fmt.Sprintf("warning: cannot compute relative path for %s: %v", path, err)
-			warnings = append(warnings, warning)
+		if !cutoff.IsZero() {
+			info, err := d.Info()
+			if err != nil {
+				results = append(results, &walkResult{warning: fmt.Sprintf("warning: cannot access %s: %v", path, err)})
 
-			return nil
+				return nil
+			}
+
+			if info.ModTime().Before(cutoff) {
+				return nil
+			}
 		}
 
-		hash, err := computeFileHash(path)
+		relPath, err := makeRelativePath(baseDir, path)
 		if err != nil {
-			warning := fmt.Sprintf("warning: cannot compute hash for %s: %v", path, err)
-			warnings = append(warnings, warning)
+			results = append(results, &walkResult{
+				warning: fmt.Sprintf("warning: cannot compute relative path for %s: %v", path, err),
+			})
 
 			return nil
 		}
 
-		entry := config.FileEntry{
-			URL:    "",
-			Dest:   relPath,
-			SHA256: hash,
-		}
-		entries = append(entries, entry)
+		result := &walkResult{}
+		results = append(results, result)
+
+		slots <- struct{}{}
+
+		wg.Go(func() {
+			defer func() { <-slots }()
+
+			*result = hasher.hashEntry(path, relPath)
+		})
 
 		return nil
 	})
 
-	for _, warning := range warnings {
-		fmt.Fprintln(os.Stderr, warning)
+	wg.Wait()
+	hasher.finish()
+
+	var entries []config.FileEntry
+
+	var warnings []string
+
+	for _, result := range results {
+		if result.entry != nil {
+			entries = append(entries, *result.entry)
+		} else {
+			warnings = append(warnings, result.warning)
+		}
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("walking directory: %w", err)
+		return nil, warnings, fmt.Errorf("walking directory: %w", err)
 	}
 
-	return entries, nil
+	return entries, warnings, nil
 }
 
-// computeFileHash computes the SHA256 hash of a file.
-func computeFileHash(path string) (string, error) {
+// fileHasher hashes the files of generate, reading each through a buffer of
+// the configured size. With -progress, every file gets a progress bar on
+// stderr, the config may be on stdout, and a running total of the bytes
+// hashed is shown below them.
+type fileHasher struct {
+	bufferSize int
+	algorithm  string
+
+	progress *mpb.Progress
+	start    time.Time
+
+	// total is shared by the workers, so its writes are serialized.
+	totalMu sync.Mutex
+	total   *ProgressWriter
+	bytes   int64
+}
+
+func newFileHasher(opts generateOptions) *fileHasher {
+	hasher := &fileHasher{bufferSize: opts.bufferSize, algorithm: opts.checksumField()}
+	if hasher.bufferSize <= 0 {
+		hasher.bufferSize = defaultGenerateBufferSize
+	}
+
+	if opts.progress {
+		hasher.progress = mpb.New(mpb.WithOutput(os.Stderr))
+		hasher.total = NewProgressWriter(hasher.progress, 0, "total", 0)
+		hasher.start = time.Now()
+	}
+
+	return hasher
+}
+
+// hashEntry hashes the file at path into an entry with dest relPath.
+func (hasher *fileHasher) hashEntry(path, relPath string) walkResult {
+	hash, err := hasher.hash(path, relPath)
+	if err != nil {
+		return walkResult{warning: fmt.Sprintf("warning: cannot compute hash for %s: %v", path, err)}
+	}
+
+	entry := &config.FileEntry{URL: "", Dest: relPath}
+	setChecksum(entry, hasher.algorithm, hash)
+
+	return walkResult{entry: entry}
+}
+
+// hash computes the digest of the file at path in the algorithm of the
+// hasher, showing its progress under name.
+func (hasher *fileHasher) hash(path, name string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", fmt.Errorf("opening file: %w", err)
@@ -121,16 +264,105 @@ func computeFileHash(path string) (string, error) {
 
 	defer file.Close()
 
-	h := sha256.New()
+	h := newChecksumHash(hasher.algorithm)
+
+	var (
+		writer io.Writer = h
+		bar    *ProgressWriter
+	)
+
+	if hasher.progress != nil {
+		info, err := file.Stat()
+		if err != nil {
+			return "", fmt.Errorf("reading file: %w", err)
+		}
+
+		bar = NewProgressWriter(hasher.progress, info.Size(), name, 0)
+		defer bar.Abort()
+
+		writer = io.MultiWriter(h, bar, writerFunc(hasher.addTotal))
+	}
+
+	// Hide the file's WriteTo, which would read through a 32 KiB buffer of
+	// its own instead of ours.
+	buf := make([]byte, hasher.bufferSize)
 
-	_, err = io.Copy(h, file)
+	_, err = io.CopyBuffer(writer, struct{ io.Reader }{file}, buf)
 	if err != nil {
 		return "", fmt.Errorf("reading file: %w", err)
 	}
 
-	hash := hex.EncodeToString(h.Sum(nil))
+	if bar != nil {
+		bar.Remove()
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// addTotal counts data hashed by any worker into the running total.
+func (hasher *fileHasher) addTotal(data []byte) (int, error) {
+	hasher.totalMu.Lock()
+	defer hasher.totalMu.Unlock()
+
+	hasher.bytes += int64(len(data))
+
+	return hasher.total.Write(data)
+}
+
+// finish completes the progress display and prints the totals, once every
+// file is hashed.
+func (hasher *fileHasher) finish() {
+	if hasher.progress == nil {
+		return
+	}
+
+	hasher.total.Finish()
+	hasher.progress.Wait()
+
+	fmt.Fprintf(os.Stderr, "hashed %d bytes in %s\n", hasher.bytes, time.Since(hasher.start).Round(time.Millisecond))
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func([]byte) (int, error)
+
+func (fn writerFunc) Write(data []byte) (int, error) {
+	return fn(data)
+}
 
-	return hash, nil
+// newChecksumHash returns a new hash for a checksumAlgorithms entry.
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha512":
+		return sha512.New()
+	case "sha1":
+		return sha1.New() //nolint:gosec // see import
+	default:
+		return sha256.New()
+	}
+}
+
+// setChecksum stores sum in the field of file named by algorithm.
+func setChecksum(file *config.FileEntry, algorithm, sum string) {
+	switch algorithm {
+	case "sha512":
+		file.SHA512 = sum
+	case "sha1":
+		file.SHA1 = sum
+	default:
+		file.SHA256 = sum
+	}
+}
+
+// checksumOf returns the field of file named by algorithm.
+func checksumOf(file config.FileEntry, algorithm string) string {
+	switch algorithm {
+	case "sha512":
+		return file.SHA512
+	case "sha1":
+		return file.SHA1
+	default:
+		return file.SHA256
+	}
 }
 
 // makeRelativePath computes a relative path from base directory to file path.
@@ -5,13 +5,15 @@ import (
 	"encoding/hex"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-func TestComputeFileHash(t *testing.T) {
+func TestFileHasherHash(t *testing.T) {
 	tests := []struct {
 		name     string
 		content  string
@@ -48,20 +50,20 @@ func TestComputeFileHash(t *testing.T) {
 			h.Write([]byte(tt.content))
 			expectedHash := hex.EncodeToString(h.Sum(nil))
 
-			hash, err := computeFileHash(filePath)
+			hash, err := newFileHasher(generateOptions{}).hash(filePath, filePath)
 			if err != nil {
-				t.Fatalf("computeFileHash() error = %v", err)
+				t.Fatalf("hash() error = %v", err)
 			}
 
 			if hash != expectedHash {
-				t.Errorf("computeFileHash() = %v, want %v", hash, expectedHash)
+				t.Errorf("hash() = %v, want %v", hash, expectedHash)
 			}
 		})
 	}
 }
 
-func TestComputeFileHash_NonExistentFile(t *testing.T) {
-	_, err := computeFileHash("/nonexistent/file.txt")
+func TestFileHasherHash_NonExistentFile(t *testing.T) {
+	_, err := newFileHasher(generateOptions{}).hash("/nonexistent/file.txt", "file.txt")
 	if err == nil {
 		t.Error("expected error for non-existent file, got nil")
 	}
@@ -124,7 +126,7 @@ func TestWalkDirectory_SingleFile(t *testing.T) {
 		t.Fatalf("failed to create test file: %v", err)
 	}
 
-	entries, err := walkDirectory(tmpDir)
+	entries, _, err := walkDirectory(tmpDir, generateOptions{workers: defaultGenerateWorkers})
 	if err != nil {
 		t.Fatalf("walkDirectory() error = %v", err)
 	}
@@ -146,6 +148,62 @@ func TestWalkDirectory_SingleFile(t *testing.T) {
 	}
 }
 
+func TestGenerateConfig_Algorithm(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("hello"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{algorithm: "sha512", want: "sha512: 9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca7" +
+			"2323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"},
+		{algorithm: "sha1", want: "sha1: aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			data, err := generateConfig(tmpDir, generateOptions{workers: 1, algorithm: tt.algorithm})
+			if err != nil {
+				t.Fatalf("generateConfig() error = %v", err)
+			}
+
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("expected %q in:\n%s", tt.want, data)
+			}
+
+			if strings.Contains(string(data), "sha256") {
+				t.Errorf("expected no sha256 field in:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestWalkDirectory_BufferedProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := strings.Repeat("hashed in small chunks ", 100)
+
+	err := os.WriteFile(filepath.Join(tmpDir, "large.bin"), []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	// A buffer that does not divide the file size leaves a short last read.
+	entries, _, err := walkDirectory(tmpDir, generateOptions{workers: 2, bufferSize: 7, progress: true})
+	if err != nil {
+		t.Fatalf("walkDirectory() error = %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].SHA256 != sha256Hex(content) {
+		t.Errorf("expected the sha256 of the content, got %+v", entries)
+	}
+}
+
 //nolint:cyclop // test function complexity is acceptable
 func TestWalkDirectory_NestedStructure(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -173,7 +231,7 @@ func TestWalkDirectory_NestedStructure(t *testing.T) {
 		}
 	}
 
-	entries, err := walkDirectory(tmpDir)
+	entries, _, err := walkDirectory(tmpDir, generateOptions{workers: defaultGenerateWorkers})
 	if err != nil {
 		t.Fatalf("walkDirectory() error = %v", err)
 	}
@@ -212,7 +270,7 @@ func TestWalkDirectory_NestedStructure(t *testing.T) {
 func TestWalkDirectory_EmptyDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	entries, err := walkDirectory(tmpDir)
+	entries, _, err := walkDirectory(tmpDir, generateOptions{workers: defaultGenerateWorkers})
 	if err != nil {
 		t.Fatalf("walkDirectory() error = %v", err)
 	}
@@ -246,7 +304,7 @@ func TestGenerateConfig_Integration(t *testing.T) {
 		}
 	}
 
-	data, err := generateConfig(tmpDir)
+	data, err := generateConfig(tmpDir, generateOptions{})
 	if err != nil {
 		t.Fatalf("generateConfig() error = %v", err)
 	}
@@ -291,7 +349,7 @@ func TestGenerateConfig_Integration(t *testing.T) {
 }
 
 func TestGenerateConfig_NonExistentDirectory(t *testing.T) {
-	_, err := generateConfig("/nonexistent/directory")
+	_, err := generateConfig("/nonexistent/directory", generateOptions{})
 	if err == nil {
 		t.Error("expected error for non-existent directory, got nil")
 	}
@@ -306,7 +364,7 @@ func TestGenerateConfig_FileInsteadOfDirectory(t *testing.T) {
 		t.Fatalf("failed to create test file: %v", err)
 	}
 
-	_, err = generateConfig(filePath)
+	_, err = generateConfig(filePath, generateOptions{})
 	if err == nil {
 		t.Error("expected error when path is a file, got nil")
 	}
@@ -319,7 +377,7 @@ func TestGenerateConfig_FileInsteadOfDirectory(t *testing.T) {
 func TestGenerateConfig_EmptyDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	_, err := generateConfig(tmpDir)
+	_, err := generateConfig(tmpDir, generateOptions{})
 	if err == nil {
 		t.Error("expected error for empty directory, got nil")
 	}
@@ -328,3 +386,101 @@ func TestGenerateConfig_EmptyDirectory(t *testing.T) {
 		t.Errorf("expected 'no files found' error, got: %v", err)
 	}
 }
+
+func TestGenerateConfig_Strict(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	err = os.Symlink("file.txt", filepath.Join(tmpDir, "link.txt"))
+	if err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	_, warnings, err := walkDirectory(tmpDir, generateOptions{workers: defaultGenerateWorkers})
+	if err != nil {
+		t.Fatalf("walkDirectory() error = %v", err)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning for the symlink, got %v", warnings)
+	}
+
+	_, err = generateConfig(tmpDir, generateOptions{})
+	if err != nil {
+		t.Fatalf("generateConfig() without strict error = %v", err)
+	}
+
+	_, err = generateConfig(tmpDir, generateOptions{strict: true})
+	if err == nil {
+		t.Fatal("expected strict generateConfig() to fail on warnings")
+	}
+}
+
+func TestWalkDirectory_OrderIndependentOfWorkers(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, name := range []string{"b.txt", "a/z.txt", "a/b/c.txt", "a-c.txt", "d/e.txt", "0.txt"} {
+		path := filepath.Join(tmpDir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+
+		err = os.WriteFile(path, []byte(name), 0o600)
+		if err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	serial, _, err := walkDirectory(tmpDir, generateOptions{workers: 1})
+	if err != nil {
+		t.Fatalf("walkDirectory() error = %v", err)
+	}
+
+	for range 5 {
+		concurrent, _, err := walkDirectory(tmpDir, generateOptions{workers: 8})
+		if err != nil {
+			t.Fatalf("walkDirectory() error = %v", err)
+		}
+
+		if !reflect.DeepEqual(concurrent, serial) {
+			t.Fatalf("concurrent walk = %v, want serial order %v", concurrent, serial)
+		}
+	}
+}
+
+func TestWalkDirectory_Since(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, name := range []string{"old.bin", "new.bin"} {
+		err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0o600)
+		if err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+
+	err := os.Chtimes(filepath.Join(tmpDir, "old.bin"), old, old)
+	if err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+
+	entries, warnings, err := walkDirectory(tmpDir, generateOptions{workers: 1, since: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("walkDirectory() error = %v", err)
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings for files outside the window, got %v", warnings)
+	}
+
+	if len(entries) != 1 || entries[0].Dest != "new.bin" {
+		t.Errorf("expected only new.bin, got %v", entries)
+	}
+}
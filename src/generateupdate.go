@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/md5" //nolint:gosec // only rewrites an md5 the config already has
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"xget/src/config"
+)
+
+// updateReport lists what generate -update found, by dest as written in the
+// config, and extra files by their path relative to the directory.
+type updateReport struct {
+	Changed []string
+	Removed []string
+	Added   []string
+}
+
+// updateConfig implements generate -update: the sha256 (or the field of
+// -algo) of every entry whose dest is a file under dirPath is recomputed, and
+// only that value is rewritten in the config text, so comments, quoting,
+// order and every other field stay as they are. The other checksums of a
+// changed entry (sha256, sha512, sha1, md5) are recomputed as well, so none
+// is left stale. Relative dests are resolved against dirPath, as with diff.
+// Entries without that field, with a sha256_url or with a prefix url are
+// left alone; entries whose file is gone are kept and reported, and so are
+// files no entry refers to, since there is no url to add them with.
+func updateConfig(configPath, dirPath string, opts generateOptions) ([]byte, updateReport, error) {
+	var report updateReport
+
+	data, err := os.ReadFile(configPath) //nolint:gosec // path is from CLI argument
+	if err != nil {
+		return nil, report, fmt.Errorf("reading config: %w", err)
+	}
+
+	var root yaml.Node
+
+	err = yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, report, fmt.Errorf("parsing %s: %w", configPath, err)
+	}
+
+	files := mappingValue(&root, "files")
+	if files == nil || files.Kind != yaml.SequenceNode {
+		return nil, report, fmt.Errorf("%s has no files list", configPath)
+	}
+
+	dirPath = filepath.Clean(dirPath)
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, report, fmt.Errorf("accessing directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, report, fmt.Errorf("path is not a directory: %s", dirPath)
+	}
+
+	entries, warnings, err := walkDirectory(dirPath, opts)
+	if err != nil {
+		return nil, report, err
+	}
+
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	if opts.strict && len(warnings) > 0 {
+		return nil, report, fmt.Errorf("%d warnings in strict mode", len(warnings))
+	}
+
+	onDisk := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		onDisk[filepath.Join(dirPath, entry.Dest)] = checksumOf(entry, opts.checksumField())
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	dests := make(map[string]bool, len(files.Content))
+
+	for _, item := range files.Content {
+		dest := scalarValue(mappingValue(item, "dest"))
+		if dest == "" {
+			continue
+		}
+
+		path := dest
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dirPath, path)
+		}
+
+		path = filepath.Clean(path)
+		dests[path] = true
+
+		sum := mappingValue(item, opts.checksumField())
+		if sum == nil {
+			continue
+		}
+
+		hasChecksumURL := mappingValue(item, "sha256_url") != nil
+		isPrefix := config.IsPrefixURL(scalarValue(mappingValue(item, "url")))
+
+		if hasChecksumURL || isPrefix {
+			continue
+		}
+
+		actual, ok := onDisk[path]
+		if !ok {
+			report.Removed = append(report.Removed, dest)
+
+			continue
+		}
+
+		if actual == sum.Value {
+			continue
+		}
+
+		err = replaceScalar(lines, sum, actual)
+		if err != nil {
+			return nil, report, fmt.Errorf("updating %s of %s: %w", opts.checksumField(), dest, err)
+		}
+
+		err = updateOtherChecksums(lines, item, path, opts.checksumField())
+		if err != nil {
+			return nil, report, fmt.Errorf("updating checksums of %s: %w", dest, err)
+		}
+
+		report.Changed = append(report.Changed, dest)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dirPath, entry.Dest)
+		if !dests[path] && !isStateFile(path, dests) {
+			report.Added = append(report.Added, entry.Dest)
+		}
+	}
+
+	return []byte(strings.Join(lines, "")), report, nil
+}
+
+// runGenerateUpdate runs generate -update, writing the updated config back
+// to the file it was read from, or to -o.
+func runGenerateUpdate(args generateArgs) int {
+	data, report, err := updateConfig(args.updateFile, args.dirPath, args.options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error updating config: %v\n", err)
+
+		return 1
+	}
+
+	target := args.updateFile
+	if args.outputFile != "" {
+		target = args.outputFile
+	}
+
+	err = writeFileAtomic(target, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing output file: %v\n", err)
+
+		return 1
+	}
+
+	printUpdateReport(report, target)
+
+	return 0
+}
+
+// updateOtherChecksums rewrites every checksum of item besides field to the
+// digest of the file at path, hashing the file once for all of them.
+func updateOtherChecksums(lines []string, item *yaml.Node, path, field string) error {
+	var (
+		nodes  []*yaml.Node
+		hashes []hash.Hash
+	)
+
+	for _, other := range []string{"sha256", "sha512", "sha1", "md5"} {
+		node := mappingValue(item, other)
+		if other == field || node == nil {
+			continue
+		}
+
+		nodes = append(nodes, node)
+
+		if other == "md5" {
+			hashes = append(hashes, md5.New()) //nolint:gosec // see import
+		} else {
+			hashes = append(hashes, newChecksumHash(other))
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	file, err := os.Open(path) //nolint:gosec // path is under the CLI directory
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+
+	defer file.Close()
+
+	writers := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		writers[i] = h
+	}
+
+	_, err = io.CopyBuffer(io.MultiWriter(writers...), struct{ io.Reader }{file}, make([]byte, defaultGenerateBufferSize))
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	for i, node := range nodes {
+		err = replaceScalar(lines, node, hex.EncodeToString(hashes[i].Sum(nil)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file in the same directory, so an interrupted write never leaves a
+// truncated config. An existing file keeps its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o600)
+
+	info, err := os.Stat(path)
+	if err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Chmod(mode)
+	}
+
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(temp.Name())
+
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// mappingValue returns the value of key in the mapping node, or in the
+// mapping of a document node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+
+	return node.Value
+}
+
+// replaceScalar rewrites the single-line scalar node in lines, the config
+// text split after each newline, to value, keeping its quotes.
+func replaceScalar(lines []string, node *yaml.Node, value string) error {
+	if node.Kind != yaml.ScalarNode || node.Line < 1 || node.Line > len(lines) {
+		return fmt.Errorf("line %d: not a scalar", node.Line)
+	}
+
+	line := []rune(lines[node.Line-1])
+
+	start := node.Column - 1
+	if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		start++
+	}
+
+	end := start + len([]rune(node.Value))
+	if start < 0 || end > len(line) || string(line[start:end]) != node.Value {
+		return fmt.Errorf("line %d: cannot locate the value", node.Line)
+	}
+
+	lines[node.Line-1] = string(line[:start]) + value + string(line[end:])
+
+	return nil
+}
+
+// printUpdateReport prints the changes generate -update made and found.
+func printUpdateReport(report updateReport, target string) {
+	for _, dest := range report.Changed {
+		fmt.Printf("changed  %s\n", dest)
+	}
+
+	for _, dest := range report.Removed {
+		fmt.Printf("removed  %s (entry kept)\n", dest)
+	}
+
+	for _, path := range report.Added {
+		fmt.Printf("added    %s (not in config)\n", path)
+	}
+
+	fmt.Printf("updated %s: %d changed, %d removed, %d added\n",
+		target, len(report.Changed), len(report.Removed), len(report.Added))
+}
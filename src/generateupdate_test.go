@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUpdateConfig_RewritesOnlyHashes(t *testing.T) {
+	dir := t.TempDir()
+
+	writeDiffFile(t, filepath.Join(dir, "same.bin"), "same")
+	writeDiffFile(t, filepath.Join(dir, "sub", "changed.bin"), "new content")
+	writeDiffFile(t, filepath.Join(dir, "new.bin"), "new")
+	writeDiffFile(t, filepath.Join(dir, "remote.bin"), "remote")
+
+	original := `# hand-curated
+settings:
+  retries: 5
+files:
+  - url: https://example.com/same.bin
+    dest: same.bin
+    sha256: ` + sha256Hex("same") + `
+  - url: https://example.com/changed.bin # mirrored nightly
+    dest: sub/changed.bin
+    sha256: "` + sha256Hex("old content") + `"
+    metadata:
+      owner: data
+  - {url: "https://example.com/gone.bin", dest: gone.bin, sha256: ` + sha256Hex("gone") + `}
+  - url: https://example.com/remote.bin
+    dest: remote.bin
+    sha256_url: https://example.com/SHA256SUMS
+`
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeDiffFile(t, configPath, original)
+
+	data, report, err := updateConfig(configPath, dir, generateOptions{workers: 2})
+	if err != nil {
+		t.Fatalf("updateConfig: %v", err)
+	}
+
+	want := strings.Replace(original, sha256Hex("old content"), sha256Hex("new content"), 1)
+	if string(data) != want {
+		t.Errorf("unexpected config:\n%s\nwant:\n%s", data, want)
+	}
+
+	if !slices.Equal(report.Changed, []string{"sub/changed.bin"}) {
+		t.Errorf("changed = %v, want [sub/changed.bin]", report.Changed)
+	}
+
+	if !slices.Equal(report.Removed, []string{"gone.bin"}) {
+		t.Errorf("removed = %v, want [gone.bin]", report.Removed)
+	}
+
+	if !slices.Equal(report.Added, []string{"new.bin"}) {
+		t.Errorf("added = %v, want [new.bin]", report.Added)
+	}
+}
+
+func TestUpdateConfig_Algorithm(t *testing.T) {
+	dir := t.TempDir()
+
+	writeDiffFile(t, filepath.Join(dir, "app.bin"), "hello")
+
+	original := `files:
+  - url: https://example.com/app.bin
+    dest: app.bin
+    sha1: 0000000000000000000000000000000000000000
+`
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeDiffFile(t, configPath, original)
+
+	data, report, err := updateConfig(configPath, dir, generateOptions{workers: 1, algorithm: "sha1"})
+	if err != nil {
+		t.Fatalf("updateConfig: %v", err)
+	}
+
+	want := strings.Replace(original, strings.Repeat("0", 40), "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", 1)
+	if string(data) != want {
+		t.Errorf("unexpected config:\n%s\nwant:\n%s", data, want)
+	}
+
+	if !slices.Equal(report.Changed, []string{"app.bin"}) {
+		t.Errorf("changed = %v, want [app.bin]", report.Changed)
+	}
+}
+
+func TestUpdateConfig_NoFiles(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(configPath, []byte("settings:\n  retries: 3\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = updateConfig(configPath, t.TempDir(), generateOptions{workers: 1})
+	if err == nil || !strings.Contains(err.Error(), "no files list") {
+		t.Errorf("expected a missing files list to be reported, got %v", err)
+	}
+}
+
+func TestUpdateConfig_RecomputesOtherChecksums(t *testing.T) {
+	dir := t.TempDir()
+
+	writeDiffFile(t, filepath.Join(dir, "app.bin"), "hello")
+
+	original := `files:
+  - url: https://example.com/app.bin
+    dest: app.bin
+    sha256: ` + sha256Hex("old") + `
+    md5: '00000000000000000000000000000000'
+`
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeDiffFile(t, configPath, original)
+
+	data, _, err := updateConfig(configPath, dir, generateOptions{workers: 1})
+	if err != nil {
+		t.Fatalf("updateConfig: %v", err)
+	}
+
+	want := strings.Replace(original, sha256Hex("old"), sha256Hex("hello"), 1)
+	want = strings.Replace(want, strings.Repeat("0", 32), "5d41402abc4b2a76b9719d911017c592", 1)
+
+	if string(data) != want {
+		t.Errorf("unexpected config:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	err := os.WriteFile(path, []byte("old"), 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFileAtomic(path, []byte("new"))
+	if err != nil {
+		t.Fatalf("writeFileAtomic: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("content = %q, %v, want new", data, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"xget/src/config"
+)
+
+// hashStateSuffix is appended to a partial path to name the file holding the
+// hash state of the bytes already in the partial.
+const hashStateSuffix = ".sha256state"
+
+func hashStatePath(partialPath string) string {
+	return partialPath + hashStateSuffix
+}
+
+// partialHash hashes the bytes appended to a partial file during a
+// single-stream download with every checksum of its file, so the checksums
+// are known once the last byte is written instead of by reading the partial
+// again. Its state is saved next to the partial when a download is
+// interrupted and picked up on resume.
+type partialHash struct {
+	*checksumVerifier
+
+	size int64
+}
+
+// Write implements io.Writer.
+func (partial *partialHash) Write(p []byte) (int, error) {
+	partial.checksumVerifier.Write(p)
+	partial.size += int64(len(p))
+
+	return len(p), nil
+}
+
+// save persists the state as the number of bytes hashed followed by the
+// length and marshaled state of each hash.
+func (partial *partialHash) save(partialPath string) error {
+	data := binary.BigEndian.AppendUint64(nil, uint64(partial.size)) //nolint:gosec // size is never negative
+
+	for _, expected := range partial.hashes {
+		marshaler, ok := expected.hash.(encoding.BinaryMarshaler)
+		if !ok {
+			return errors.New("hash state cannot be saved")
+		}
+
+		state, err := marshaler.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("saving hash state: %w", err)
+		}
+
+		data = binary.BigEndian.AppendUint32(data, uint32(len(state))) //nolint:gosec // states are a few hundred bytes
+		data = append(data, state...)
+	}
+
+	err := os.WriteFile(hashStatePath(partialPath), data, 0o644) //nolint:gosec // state is as readable as the partial
+	if err != nil {
+		return fmt.Errorf("saving hash state: %w", err)
+	}
+
+	return nil
+}
+
+// resumePartialHash returns a hash of every checksum of file covering the
+// first offset bytes of the partial. It continues from the saved state when
+// there is one and hashes only the bytes written after it was saved, e.g. by
+// a process that was killed before it could save again; otherwise it hashes
+// the partial from the start.
+func resumePartialHash(partialPath string, file config.FileEntry, offset int64) (*partialHash, error) {
+	partial := loadPartialHash(partialPath, file, offset)
+
+	if partial.size == offset {
+		return partial, nil
+	}
+
+	f, err := os.Open(partialPath)
+	if err != nil {
+		return nil, fmt.Errorf("hashing partial: %w", err)
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(partial, io.NewSectionReader(f, partial.size, offset-partial.size))
+	if err != nil {
+		return nil, fmt.Errorf("hashing partial: %w", err)
+	}
+
+	return partial, nil
+}
+
+// loadPartialHash restores the saved state of the partial, or returns an
+// empty hash when there is none, it describes more bytes than the partial
+// holds, or it was saved for other checksums.
+func loadPartialHash(partialPath string, file config.FileEntry, offset int64) *partialHash {
+	empty := &partialHash{checksumVerifier: newChecksumVerifier(file)}
+
+	data, err := os.ReadFile(hashStatePath(partialPath))
+	if err != nil || len(data) < 8 {
+		return empty
+	}
+
+	size := int64(binary.BigEndian.Uint64(data[:8])) //nolint:gosec // checked against offset below
+	if size < 0 || size > offset {
+		return empty
+	}
+
+	partial := &partialHash{checksumVerifier: newChecksumVerifier(file), size: size}
+	data = data[8:]
+
+	for _, expected := range partial.hashes {
+		if len(data) < 4 {
+			return empty
+		}
+
+		length := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+
+		if uint64(len(data)) < uint64(length) {
+			return empty
+		}
+
+		unmarshaler, ok := expected.hash.(encoding.BinaryUnmarshaler)
+		if !ok || unmarshaler.UnmarshalBinary(data[:length]) != nil {
+			return empty
+		}
+
+		data = data[length:]
+	}
+
+	if len(data) != 0 {
+		return empty
+	}
+
+	return partial
+}
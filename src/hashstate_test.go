@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/md5" //nolint:gosec // see checksum.go
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestResumePartialHash(t *testing.T) {
+	content := []byte("the quick brown fox jumps over the lazy dog")
+	sum := sha256.Sum256(content)
+	md5Sum := md5.Sum(content) //nolint:gosec // md5 is one of the checksums a file can have
+	file := config.FileEntry{SHA256: hex.EncodeToString(sum[:]), MD5: hex.EncodeToString(md5Sum[:])}
+
+	tests := []struct {
+		name  string
+		saved int // bytes covered by the saved state, -1 for none
+		state []byte
+	}{
+		{name: "no state", saved: -1},
+		{name: "state covers partial", saved: 20},
+		{name: "partial grew after save", saved: 10},
+		{name: "corrupt state", saved: -1, state: []byte("garbage")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partialPath := filepath.Join(t.TempDir(), "file.bin.partial")
+			written := content[:20]
+
+			err := os.WriteFile(partialPath, written, 0o644)
+			if err != nil {
+				t.Fatalf("writing partial: %v", err)
+			}
+
+			if tt.saved >= 0 {
+				saved, err := resumePartialHash(partialPath, file, int64(tt.saved))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				err = saved.save(partialPath)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if tt.state != nil {
+				err = os.WriteFile(hashStatePath(partialPath), tt.state, 0o644)
+				if err != nil {
+					t.Fatalf("writing state: %v", err)
+				}
+			}
+
+			hasher, err := resumePartialHash(partialPath, file, int64(len(written)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			hasher.Write(content[len(written):])
+
+			if !hasher.matches() {
+				t.Error("expected the resumed hashes to match the content")
+			}
+		})
+	}
+}
+
+func TestResumePartialHashIgnoresStateBeyondPartial(t *testing.T) {
+	partialPath := filepath.Join(t.TempDir(), "file.bin.partial")
+
+	err := os.WriteFile(partialPath, []byte("0123456789"), 0o644)
+	if err != nil {
+		t.Fatalf("writing partial: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("01234"))
+	file := config.FileEntry{SHA256: hex.EncodeToString(sum[:])}
+
+	full, err := resumePartialHash(partialPath, file, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = full.save(partialPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The partial was truncated after the state was saved.
+	err = os.WriteFile(partialPath, []byte("01234"), 0o644)
+	if err != nil {
+		t.Fatalf("writing partial: %v", err)
+	}
+
+	hasher, err := resumePartialHash(partialPath, file, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !hasher.matches() {
+		t.Error("expected the hash to cover only the truncated partial")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// errHeaderMismatch is returned when the first bytes of a source differ from
+// the magic of its file. A retry would fetch the same bytes, so it is not
+// retried.
+var errHeaderMismatch = errors.New("header mismatch")
+
+// checkHeader implements settings.header_check: it fetches as many bytes as
+// the magic of file holds from the start of its content, the start of its
+// range if it has one, and fails with errHeaderMismatch when they differ, so
+// an obviously wrong file is not downloaded in full. Files without a magic
+// are not checked.
+func checkHeader(ctx context.Context, source storage.Source, file config.FileEntry) error {
+	magic, err := file.MagicBytes()
+	if err != nil || magic == nil {
+		return err
+	}
+
+	var start int64
+
+	if file.Range != "" {
+		byteRange, err := config.ParseByteRange(file.Range)
+		if err != nil {
+			return err
+		}
+
+		start = byteRange.Start
+	}
+
+	reader, err := openHeader(ctx, source, start, int64(len(magic)))
+	if err != nil {
+		return fmt.Errorf("fetching header: %w", err)
+	}
+
+	defer reader.Close()
+
+	header := make([]byte, len(magic))
+
+	n, err := io.ReadFull(reader, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	if !bytes.Equal(header[:n], magic) {
+		return fmt.Errorf("%w: expected %x, got %x", errHeaderMismatch, magic, header[:n])
+	}
+
+	return nil
+}
+
+// openHeader returns a reader of the length bytes of source from start on,
+// with a range request when the source supports them. Other sources are
+// read from the start of a full download, which is closed after the header.
+func openHeader(ctx context.Context, source storage.Source, start, length int64) (io.ReadCloser, error) {
+	rangeSource, ok := source.(storage.RangeSource)
+	if ok {
+		return rangeSource.DownloadRange(ctx, start, start+length-1)
+	}
+
+	reader, _, err := source.Download(ctx, start)
+
+	return reader, err
+}
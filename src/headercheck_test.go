@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+
+	"xget/src/config"
+)
+
+func TestHeaderCheck(t *testing.T) {
+	content := []byte("\x89PNG\r\n\x1a\n image data")
+	sum := sha256.Sum256(content)
+
+	tests := []struct {
+		name      string
+		magic     string
+		wantErr   bool
+		wantFull  bool
+		wantRange string
+	}{
+		{name: "matching magic", magic: "89504e470d0a1a0a", wantFull: true, wantRange: "bytes=0-7"},
+		{name: "mismatched magic", magic: "0x25504446", wantErr: true, wantRange: "bytes=0-3"},
+		{name: "no magic", wantFull: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				fullGets  atomic.Int32
+				rangeSeen atomic.Value
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					rangeSeen.Store(r.Header.Get("Range"))
+				} else if r.Method == http.MethodGet {
+					fullGets.Add(1)
+				}
+
+				http.ServeContent(w, r, "image.png", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{Settings: config.Settings{
+				Retries:      3,
+				HTTPVersion:  config.HTTPVersion1,
+				HeaderCheck:  "true",
+				SingleStream: "true",
+			}}
+			file := config.FileEntry{
+				URL:    server.URL + "/image.png",
+				Dest:   filepath.Join(t.TempDir(), "image.png"),
+				SHA256: hex.EncodeToString(sum[:]),
+				Magic:  tt.magic,
+			}
+
+			downloader := NewDownloader(cfg, nil)
+			progress := mpb.New(mpb.WithOutput(io.Discard))
+
+			err := downloader.downloadWithRetry(context.Background(), file, progress, &timingTrace{})
+			if tt.wantErr != errors.Is(err, errHeaderMismatch) {
+				t.Fatalf("expected header mismatch %v, got %v", tt.wantErr, err)
+			}
+
+			seen, _ := rangeSeen.Load().(string)
+			if tt.wantRange != "" && seen != tt.wantRange {
+				t.Errorf("expected header request %q, got %q", tt.wantRange, seen)
+			}
+
+			got := fullGets.Load() > 0
+			if got != tt.wantFull {
+				t.Errorf("expected full download %v, got %v", tt.wantFull, got)
+			}
+
+			_, statErr := os.Stat(file.Dest)
+			if (statErr == nil) != tt.wantFull {
+				t.Errorf("expected dest written %v, got %v", tt.wantFull, statErr)
+			}
+		})
+	}
+}
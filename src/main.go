@@ -2,12 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"xget/src/config"
+	"xget/src/tracing"
+)
+
+// tracingFlushTimeout bounds how long exiting waits for buffered spans.
+const tracingFlushTimeout = 5 * time.Second
+
+// Exit codes of the download command. The other commands exit with 1 on
+// any failure, except diff, which has codes of its own.
+const (
+	exitOK          = 0
+	exitFailed      = 1   // every download failed, or the run could not finish
+	exitPartial     = 2   // some downloads failed, or -strict found warnings
+	exitConfigError = 3   // bad flags or a config that does not load
+	exitInterrupted = 130 // SIGINT or SIGTERM, as shells report 128+SIGINT
 )
 
 var (
@@ -24,30 +41,76 @@ func run() int {
 	fmt.Printf("xget %s (commit: %s, built: %s)\n", version, commit, date)
 
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "       %s generate <directory> [-o output.yaml]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "       %s -version\n", os.Args[0])
+		printUsage()
 
-		return 1
+		return exitConfigError
 	}
 
 	if os.Args[1] == "generate" {
 		return runGenerate()
 	}
 
+	if os.Args[1] == "doctor" {
+		return runDoctor()
+	}
+
+	if os.Args[1] == "config" {
+		return runConfig()
+	}
+
+	if os.Args[1] == "check" {
+		return runCheck()
+	}
+
+	if os.Args[1] == "diff" {
+		return runDiff()
+	}
+
+	if os.Args[1] == "push" {
+		return runPush()
+	}
+
 	if os.Args[1] == "-version" || os.Args[1] == "--version" {
 		fmt.Printf("xget version %s (commit: %s, built: %s)\n", version, commit, date)
 
 		return 0
 	}
 
-	configPaths := os.Args[1:]
+	opts, err := parseRunArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		printUsage()
+
+		return exitConfigError
+	}
+
+	configPaths := opts.configPaths
+
+	// A run without failures removes its failure report, so a retry job
+	// finds nothing to do.
+	if opts.retryFrom != "" {
+		_, statErr := os.Stat(opts.retryFrom)
+		if errors.Is(statErr, fs.ErrNotExist) {
+			fmt.Printf("No failure report at %s, nothing to retry\n", opts.retryFrom)
 
-	cfg, err := config.LoadMultiple(configPaths)
+			return exitOK
+		}
+	}
+
+	cfg, err := loadRunConfig(opts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 
-		return 1
+		return exitConfigError
+	}
+
+	opts.apply(cfg)
+
+	err = cfg.ApplyDestDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+
+		return exitConfigError
 	}
 
 	if len(configPaths) > 1 {
@@ -58,6 +121,13 @@ func run() int {
 
 	printConfig(*cfg)
 
+	// The marker vouches for the whole set, so runs over a subset of the
+	// files neither trust nor write it.
+	marker := cfg.Settings.VersionMarker
+	if !opts.coversAllFiles() {
+		marker = config.VersionMarker{}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -70,71 +140,304 @@ func run() int {
 		cancel()
 	}()
 
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: setting up tracing: %v\n", err)
+
+		return exitConfigError
+	}
+
+	defer flushTracing(shutdownTracing)
+
+	ctx, span := tracing.Start(ctx, "xget", tracing.Int("xget.files", len(cfg.Files)))
+	defer span.End()
+
+	code := runDownloads(ctx, cfg, opts, marker)
+	if !opts.watch {
+		return code
+	}
+
+	return watchConfigs(ctx, cfg, opts, code)
+}
+
+// runDownloads downloads the files of cfg and reports the results. It
+// returns the exit code of the run.
+func runDownloads(ctx context.Context, cfg *config.Config, opts runOptions, marker config.VersionMarker) int {
+	if versionMarkerCurrent(marker) {
+		fmt.Printf("\nUp to date: %s records version %s\n", marker.Path, marker.Value)
+
+		return exitOK
+	}
+
 	cache := NewCache(cfg)
 	if cache != nil {
 		fmt.Println("Cache enabled")
 	}
 
+	err := checkOpenFileLimit(cfg.Settings.MaxOpenFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+		return exitConfigError
+	}
+
 	downloader := NewDownloader(cfg, cache)
+
+	if opts.offline {
+		if cache == nil {
+			fmt.Println("Offline without a cache: only files already in place can be used")
+		}
+
+		downloader.SetOffline()
+	}
+
+	if opts.retryFailedMirrorsLast {
+		downloader.SetRetryFailedMirrorsLast()
+	}
+
+	if opts.resumeOnly {
+		downloader.SetResumeOnly()
+	}
+
+	if opts.sequential {
+		downloader.SetSequential()
+	}
+
+	if cfg.Settings.ProgressFD != "" {
+		stream, err := openProgressStream(cfg.Settings.ProgressFD)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+			return exitConfigError
+		}
+
+		defer stream.Close()
+
+		downloader.SetProgressStream(stream)
+	}
+
+	// Offline, no source is contacted, so there is nothing to check.
+	if cfg.Settings.IsPreflight() && !opts.offline {
+		if !runPreflight(ctx, downloader) {
+			if ctx.Err() != nil {
+				return exitInterrupted
+			}
+
+			return exitFailed
+		}
+	}
+
+	if opts.reloadOnHUP {
+		stopReload := reloadOnHangup(ctx, downloader, opts)
+		defer stopReload()
+	}
+
 	results := downloader.Download(ctx)
 
-	failed := reportResults(results)
+	failed := reportResults(results, opts.sortBy)
+
+	if opts.offline {
+		printNotCached(results)
+	}
+
+	if opts.timings {
+		printTimings(results)
+	}
+
+	if opts.jsonReport != "" {
+		err := writeJSONReport(opts.jsonReport, results)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing json report: %v\n", err)
+
+			return exitFailed
+		}
+	}
+
+	if cfg.Settings.FailureReport != "" {
+		err := writeFailureReport(cfg.Settings.FailureReport, downloader.FailedEntries(results))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing failure report: %v\n", err)
+
+			return exitFailed
+		}
+	}
+
 	if failed > 0 {
 		fmt.Fprintf(os.Stderr, "\n%d/%d downloads failed\n", failed, len(results))
+	}
 
-		return 1
+	code := failureExitCode(ctx, failed, len(results))
+	if code != exitOK {
+		return code
 	}
 
-	fmt.Printf("\nAll %d downloads completed successfully\n", len(results))
+	warnings := downloader.Warnings()
+	if opts.strict && len(warnings) > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d warnings in strict mode:\n", len(warnings))
 
-	return 0
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "  %s\n", warning)
+		}
+
+		return exitPartial
+	}
+
+	if marker.Path != "" {
+		err := writeVersionMarker(marker)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+			return exitFailed
+		}
+	}
+
+	deferred := countDeferred(results)
+	if deferred > 0 {
+		fmt.Printf("\n%d files without a partial deferred by -resume-only\n", deferred)
+	}
+
+	fmt.Printf("\nAll %d downloads completed successfully\n", len(results)-deferred)
+
+	return exitOK
 }
 
-func reportResults(results []DownloadResult) int {
-	var failed int
+// countDeferred returns the number of results -resume-only deferred.
+func countDeferred(results []DownloadResult) int {
+	var deferred int
 
 	for _, result := range results {
-		if result.Error != nil {
-			fmt.Fprintf(os.Stderr, "error downloading %s: %v\n", result.File.URL, result.Error)
-
-			failed++
+		if result.Deferred {
+			deferred++
 		}
 	}
 
-	return failed
+	return deferred
 }
 
-func runGenerate() int {
-	args := os.Args[2:]
+// failureExitCode maps the outcome of a run to its exit code: interrupted
+// runs take precedence over their failures, which they usually cause.
+func failureExitCode(ctx context.Context, failed, total int) int {
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case failed == 0:
+		return exitOK
+	case failed == total:
+		return exitFailed
+	default:
+		return exitPartial
+	}
+}
 
-	var outputFile string
+// runPreflight checks every source before the downloads start and prints
+// all problems at once. It reports whether the downloads may start.
+func runPreflight(ctx context.Context, downloader *Downloader) bool {
+	fmt.Println("Checking sources...")
 
-	i := 0
-	for i < len(args) {
-		if args[i] == "-o" {
-			if i+1 >= len(args) {
-				fmt.Fprintf(os.Stderr, "error: -o flag requires an argument\n")
+	problems := downloader.Preflight(ctx)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Preflight interrupted")
 
-				return 1
-			}
+		return false
+	}
+
+	if len(problems) == 0 {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "\nPreflight found %d unusable sources:\n", len(problems))
 
-			outputFile = args[i+1]
-			args = append(args[:i], args[i+2:]...)
-		} else {
-			i++
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "  %v\n", problem)
+	}
+
+	return false
+}
+
+// loadRunConfig loads the configs of the download command, restricted to
+// the entries of the -retry-from report if one is given. Otherwise the
+// remote manifest, if any, is merged into the files, as those of the
+// report already carry its checksums.
+func loadRunConfig(opts runOptions) (*config.Config, error) {
+	if opts.retryFrom != "" {
+		return config.LoadRetry(opts.configPaths, opts.retryFrom)
+	}
+
+	cfg, err := config.LoadMultiple(opts.configPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyRemoteManifest(context.Background(), cfg, opts.offline)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] -retry-from failures.yaml [<config.yaml> ...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s %s\n", os.Args[0], generateUsage)
+	fmt.Fprintf(os.Stderr, "       %s doctor <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s config <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s check <config.yaml> [<config2.yaml> ...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s %s\n", os.Args[0], diffUsage)
+	fmt.Fprintf(os.Stderr, "       %s %s\n", os.Args[0], pushUsage)
+	fmt.Fprintf(os.Stderr, "       %s -version\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	printRunFlags(os.Stderr)
+	fmt.Fprintf(os.Stderr, "\nExit codes:\n")
+	fmt.Fprintf(os.Stderr, "  %d    all downloads succeeded\n", exitOK)
+	fmt.Fprintf(os.Stderr, "  %d    every download failed, or the run could not finish\n", exitFailed)
+	fmt.Fprintf(os.Stderr, "  %d    some downloads failed, or -strict found warnings\n", exitPartial)
+	fmt.Fprintf(os.Stderr, "  %d    invalid flags or config\n", exitConfigError)
+	fmt.Fprintf(os.Stderr, "  %d  interrupted\n", exitInterrupted)
+}
+
+// reportResults prints the error of every failed download and returns the
+// failure count. With a sort key, a per-file status table is printed first
+// and errors follow the same order.
+func reportResults(results []DownloadResult, sortBy string) int {
+	var failed int
+
+	if sortBy != "" {
+		results = sortResults(results, sortBy)
+		printResults(results)
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			fmt.Fprintf(os.Stderr, "error downloading %s: %v\n", redactURL(result.File.URL), result.Error)
+
+			failed++
 		}
 	}
 
-	if len(args) != 1 {
-		fmt.Fprintf(os.Stderr, "error: generate command requires exactly one directory argument\n")
-		fmt.Fprintf(os.Stderr, "Usage: %s generate <directory> [-o output.yaml]\n", os.Args[0])
+	return failed
+}
+
+// generateUsage is the synopsis of the generate command.
+const generateUsage = "generate <directory> [-o output.yaml] [-update existing.yaml] [-strict] [-j N] " +
+	"[-since 7d] [-buffer-size N] [-progress] [-algo sha256|sha512|sha1]"
+
+func runGenerate() int {
+	args, err := parseGenerateArgs(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], generateUsage)
 
 		return 1
 	}
 
-	dirPath := args[0]
+	if args.updateFile != "" {
+		return runGenerateUpdate(args)
+	}
+
+	outputFile := args.outputFile
 
-	data, err := generateConfig(dirPath)
+	data, err := generateConfig(args.dirPath, args.options)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error generating config: %v\n", err)
 
@@ -156,3 +459,15 @@ func runGenerate() int {
 
 	return 0
 }
+
+// flushTracing exports the spans still buffered, giving up after
+// tracingFlushTimeout so an unreachable collector cannot hold up the exit.
+func flushTracing(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancel()
+
+	err := shutdown(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: flushing traces: %v\n", err)
+	}
+}
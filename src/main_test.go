@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFailureExitCode(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context //nolint:containedctx // test table input
+		failed int
+		total  int
+		want   int
+	}{
+		{"all succeeded", context.Background(), 0, 3, exitOK},
+		{"some failed", context.Background(), 1, 3, exitPartial},
+		{"all failed", context.Background(), 3, 3, exitFailed},
+		{"interrupted", cancelled, 2, 3, exitInterrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := failureExitCode(tt.ctx, tt.failed, tt.total)
+			if got != tt.want {
+				t.Errorf("failureExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"xget/src/config"
+)
+
+// maxManifestSize caps how much of a remote manifest is read, so a
+// remote_manifest_url pointing at an artifact is not downloaded whole.
+const maxManifestSize = 64 << 20
+
+// manifestEntry is one file of a remote manifest: a slash-separated path
+// relative to the manifest, and its checksum.
+type manifestEntry struct {
+	path   string
+	sha256 string
+}
+
+// applyRemoteManifest implements settings.remote_manifest_url: the manifest
+// is fetched and merged into the files of cfg before -limit and dest_dir
+// apply. Offline, the manifest cannot be fetched and the config is used as
+// it is.
+func applyRemoteManifest(ctx context.Context, cfg *config.Config, offline bool) error {
+	manifestURL := cfg.Settings.RemoteManifestURL
+	if manifestURL == "" {
+		return nil
+	}
+
+	if offline {
+		fmt.Printf("Offline: not fetching remote manifest %s\n", redactURL(manifestURL))
+
+		return nil
+	}
+
+	entries, err := fetchManifest(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("remote manifest %s: %w", redactURL(manifestURL), err)
+	}
+
+	updated, added, err := mergeManifest(cfg, manifestURL, entries)
+	if err != nil {
+		return fmt.Errorf("remote manifest %s: %w", redactURL(manifestURL), err)
+	}
+
+	// The added entries were not part of the loaded config.
+	err = cfg.ValidateFiles()
+	if err != nil {
+		return fmt.Errorf("remote manifest %s: %w", redactURL(manifestURL), err)
+	}
+
+	fmt.Printf("Remote manifest %s: %d files, %d checksums updated, %d files added\n",
+		redactURL(manifestURL), len(entries), updated, added)
+
+	return nil
+}
+
+// fetchManifest downloads and parses the manifest, with the source options
+// of a download and metadata_retries.
+func fetchManifest(ctx context.Context, cfg *config.Config) ([]manifestEntry, error) {
+	source, err := newSource(cfg, config.FileEntry{URL: cfg.Settings.RemoteManifestURL})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := retryMetadata(ctx, cfg.Settings, func() ([]byte, error) {
+		reader, _, err := source.Download(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		defer reader.Close()
+
+		return io.ReadAll(io.LimitReader(reader, maxManifestSize+1))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching: %w", err)
+	}
+
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxManifestSize)
+	}
+
+	return parseManifest(bytes.NewReader(data))
+}
+
+// parseManifest parses a manifest in sha256sum format: "<sha256>  <path>"
+// per line, with '*' marking binary mode. Blank lines and lines starting
+// with '#' are skipped. The manifest is remote input, so paths that are
+// absolute or leave its directory are rejected.
+func parseManifest(reader io.Reader) ([]manifestEntry, error) {
+	scanner := bufio.NewScanner(reader)
+
+	var entries []manifestEntry
+
+	seen := make(map[string]bool)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"<sha256>  <path>\"", lineNumber)
+		}
+
+		sum, err := validChecksum(sum)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+
+		cleaned := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+		if name == "" || path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return nil, fmt.Errorf("line %d: path %q is not inside the manifest directory", lineNumber, name)
+		}
+
+		if seen[cleaned] {
+			return nil, fmt.Errorf("line %d: duplicate path %q", lineNumber, name)
+		}
+
+		seen[cleaned] = true
+
+		entries = append(entries, manifestEntry{path: cleaned, sha256: sum})
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	return entries, nil
+}
+
+// mergeManifest merges the manifest entries into the files of cfg. An entry
+// matches the file with the same dest, or else the same url; the file then
+// takes the manifest checksum in place of its sha256 or sha256_url, and its
+// other checksums (md5, sha512, sha1) are dropped when the sha256 changes,
+// as they describe the old content. Files with parts or a range, and prefix entries,
+// keep their own checksums. Entries no file matches are added, downloaded
+// from next to the manifest to their path. Files missing from the manifest
+// are kept.
+func mergeManifest(cfg *config.Config, manifestURL string, entries []manifestEntry) (int, int, error) {
+	byDest := make(map[string]int, len(cfg.Files))
+	byURL := make(map[string]int, len(cfg.Files))
+
+	for i, file := range cfg.Files {
+		byDest[filepath.Clean(file.Dest)] = i
+
+		if file.URL != "" {
+			byURL[file.URL] = i
+		}
+	}
+
+	var updated, added int
+
+	for _, entry := range entries {
+		fileURL, err := manifestFileURL(manifestURL, entry.path)
+		if err != nil {
+			return updated, added, err
+		}
+
+		dest := filepath.FromSlash(entry.path)
+
+		index, ok := byDest[dest]
+		if !ok {
+			index, ok = byURL[fileURL]
+		}
+
+		if !ok {
+			cfg.Files = append(cfg.Files, config.FileEntry{URL: fileURL, Dest: dest, SHA256: entry.sha256})
+			added++
+
+			continue
+		}
+
+		file := &cfg.Files[index]
+		if len(file.Parts) > 0 || file.Range != "" || config.IsPrefixURL(file.URL) {
+			continue
+		}
+
+		if file.SHA256 == entry.sha256 && file.SHA256URL == "" {
+			continue
+		}
+
+		if file.SHA256 != entry.sha256 {
+			file.MD5 = ""
+			file.SHA512 = ""
+			file.SHA1 = ""
+		}
+
+		file.SHA256 = entry.sha256
+		file.SHA256URL = ""
+		updated++
+	}
+
+	return updated, added, nil
+}
+
+// manifestFileURL returns the url of the file at the slash-separated path
+// relative to the manifest at manifestURL. The query of an http(s) manifest
+// url, e.g. a signature, is not carried over.
+func manifestFileURL(manifestURL, name string) (string, error) {
+	if strings.HasPrefix(manifestURL, "s3://") {
+		return manifestURL[:strings.LastIndex(manifestURL, "/")+1] + name, nil
+	}
+
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing url: %w", err)
+	}
+
+	return base.ResolveReference(&url.URL{Path: name}).String(), nil
+}
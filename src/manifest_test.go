@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestParseManifest(t *testing.T) {
+	sum := sha256Hex("a")
+
+	entries, err := parseManifest(strings.NewReader("# release 1.2\n\n" +
+		sum + "  tools/a.bin\n" +
+		strings.ToUpper(sum) + " *b file.bin\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []manifestEntry{{path: "tools/a.bin", sha256: sum}, {path: "b file.bin", sha256: sum}}
+	if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+
+	for _, manifest := range []string{
+		sum + "  ../etc/passwd\n",
+		sum + "  /etc/passwd\n",
+		sum + "  a/../../b\n",
+		sum + "  a.bin\n" + sum + "  ./a.bin\n",
+		"not-a-hash  a.bin\n",
+		sum + "\n",
+	} {
+		_, err := parseManifest(strings.NewReader(manifest))
+		if err == nil {
+			t.Errorf("expected %q to be rejected", manifest)
+		}
+	}
+}
+
+func TestMergeManifest(t *testing.T) {
+	oldSum, newSum := sha256Hex("old"), sha256Hex("new")
+
+	cfg := &config.Config{Files: []config.FileEntry{
+		{
+			URL: "https://mirror.example.com/a.bin", Dest: "a.bin", SHA256: oldSum, MD5: "5d41402abc4b2a76b9719d911017c592",
+			SHA512: strings.Repeat("a", 128), SHA1: strings.Repeat("b", 40),
+		},
+		{URL: "https://example.com/dist/b.bin", Dest: "renamed.bin", SHA256URL: "https://example.com/dist/SHA256SUMS"},
+		{URL: "https://example.com/dist/c.bin", Dest: "c.bin", SHA256: oldSum, Range: "0-9"},
+		{URL: "https://example.com/kept.bin", Dest: "kept.bin", SHA256: oldSum},
+	}}
+
+	updated, added, err := mergeManifest(cfg, "https://example.com/dist/SHA256SUMS?token=x", []manifestEntry{
+		{path: "a.bin", sha256: newSum},
+		{path: "b.bin", sha256: newSum},
+		{path: "c.bin", sha256: newSum},
+		{path: "sub/d.bin", sha256: newSum},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if updated != 2 || added != 1 {
+		t.Errorf("expected 2 updated and 1 added, got %d and %d", updated, added)
+	}
+
+	first := cfg.Files[0]
+	stale := first.MD5 != "" || first.SHA512 != "" || first.SHA1 != ""
+
+	if first.SHA256 != newSum || stale || first.URL != "https://mirror.example.com/a.bin" {
+		t.Errorf("expected a.bin matched by dest to take the manifest checksum, got %+v", cfg.Files[0])
+	}
+
+	if cfg.Files[1].SHA256 != newSum || cfg.Files[1].SHA256URL != "" {
+		t.Errorf("expected b.bin matched by url to take the manifest checksum, got %+v", cfg.Files[1])
+	}
+
+	if cfg.Files[2].SHA256 != oldSum {
+		t.Errorf("expected the range entry to keep its checksum, got %s", cfg.Files[2].SHA256)
+	}
+
+	if cfg.Files[3].SHA256 != oldSum {
+		t.Errorf("expected a file missing from the manifest to be kept, got %+v", cfg.Files[3])
+	}
+
+	want := config.FileEntry{URL: "https://example.com/dist/sub/d.bin", Dest: "sub/d.bin", SHA256: newSum}
+	if len(cfg.Files) != 5 || cfg.Files[4].URL != want.URL || cfg.Files[4].Dest != want.Dest || cfg.Files[4].SHA256 != want.SHA256 {
+		t.Errorf("expected %+v to be added, got %+v", want, cfg.Files[len(cfg.Files)-1])
+	}
+}
+
+func TestManifestFileURL(t *testing.T) {
+	tests := []struct {
+		manifest, name, want string
+	}{
+		{"s3://store/releases/SHA256SUMS", "a/b.bin", "s3://store/releases/a/b.bin"},
+		{"https://example.com/dist/SHA256SUMS", "a b.bin", "https://example.com/dist/a%20b.bin"},
+	}
+
+	for _, tt := range tests {
+		got, err := manifestFileURL(tt.manifest, tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("manifestFileURL(%q, %q) = %q, %v, want %q", tt.manifest, tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyRemoteManifest(t *testing.T) {
+	sum := sha256Hex("content")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/SHA256SUMS" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(sum + "  file.bin\n"))
+	}))
+	defer server.Close()
+
+	newConfig := func() *config.Config {
+		return &config.Config{Settings: config.Settings{
+			Retries: 1, MetadataRetries: 1, HTTPVersion: config.HTTPVersion1,
+			RemoteManifestURL: server.URL + "/SHA256SUMS",
+		}}
+	}
+
+	cfg := newConfig()
+
+	err := applyRemoteManifest(context.Background(), cfg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Files) != 1 || cfg.Files[0].URL != server.URL+"/file.bin" || cfg.Files[0].SHA256 != sum {
+		t.Errorf("expected file.bin from the manifest, got %+v", cfg.Files)
+	}
+
+	cfg = newConfig()
+
+	err = applyRemoteManifest(context.Background(), cfg, true)
+	if err != nil || len(cfg.Files) != 0 {
+		t.Errorf("expected the manifest to be skipped offline, got %+v, %v", cfg.Files, err)
+	}
+
+	cfg = newConfig()
+	cfg.Settings.RemoteManifestURL = server.URL + "/missing"
+
+	err = applyRemoteManifest(context.Background(), cfg, false)
+	if err == nil {
+		t.Error("expected a missing manifest to fail the run")
+	}
+
+	// The added file.bin would have to be a file inside the dest of a
+	// configured file.
+	cfg = newConfig()
+	cfg.Files = []config.FileEntry{{URL: server.URL + "/other.bin", Dest: filepath.Join("file.bin", "other.bin"), SHA256: sum}}
+
+	err = applyRemoteManifest(context.Background(), cfg, false)
+	if err == nil || !strings.Contains(err.Error(), "needs") {
+		t.Errorf("expected the added entry to fail the dest layout check, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// retryMetadata runs op, a metadata request such as a HEAD or a cache
+// existence check, up to settings.metadata_retries times. These retries are
+// separate from the download retries, so a transient HEAD failure costs a
+// short delay rather than a re-download or a spurious cache miss. Auth
+// errors are returned at once, as repeating the request cannot fix them.
+func retryMetadata[T any](ctx context.Context, settings config.Settings, op func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := op()
+		if err == nil || attempt >= settings.MetadataRetries || storage.IsAuthError(err) {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(settings.MetadataRetryDelay):
+		}
+	}
+}
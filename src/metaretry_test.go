@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestRetryMetadata(t *testing.T) {
+	settings := config.Settings{MetadataRetries: 3, MetadataRetryDelay: time.Millisecond}
+
+	calls := 0
+
+	size, err := retryMetadata(context.Background(), settings, func() (int64, error) {
+		calls++
+		if calls < 3 {
+			return 0, errors.New("connection reset")
+		}
+
+		return 42, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if size != 42 || calls != 3 {
+		t.Errorf("expected size 42 after 3 calls, got %d after %d", size, calls)
+	}
+}
+
+func TestRetryMetadataGivesUp(t *testing.T) {
+	settings := config.Settings{MetadataRetries: 2, MetadataRetryDelay: time.Millisecond}
+
+	calls := 0
+
+	_, err := retryMetadata(context.Background(), settings, func() (bool, error) {
+		calls++
+
+		return false, errors.New("connection reset")
+	})
+	if err == nil {
+		t.Fatal("expected error after exhausting metadata retries")
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// mirroredObject is an object expanded from a prefix entry.
+type mirroredObject struct {
+	prefix config.FileEntry
+	object storage.ObjectInfo
+}
+
+// expandPrefixes replaces every prefix entry, s3://alias/prefix/, with one
+// entry per object listed under the prefix, so the objects are downloaded,
+// resumed and limited like any other file. Entries whose listing fails are
+// returned as failed results.
+func (downloader *Downloader) expandPrefixes(ctx context.Context) []DownloadResult {
+	var (
+		files    []config.FileEntry
+		failures []DownloadResult
+	)
+
+	for _, file := range downloader.cfg.Files {
+		if !config.IsPrefixURL(file.URL) {
+			files = append(files, file)
+
+			continue
+		}
+
+		expanded, err := downloader.expandPrefix(ctx, file)
+		if err != nil {
+			failures = append(failures, DownloadResult{File: file, Error: err})
+
+			continue
+		}
+
+		files = append(files, expanded...)
+	}
+
+	downloader.cfg.Files = files
+
+	return failures
+}
+
+// expandPrefix lists the objects of a prefix entry and records each in
+// downloader.mirrored under its dest, which is the object key relative to
+// the prefix below the entry's dest directory. With settings.flatten only
+// the basename of the key is used, and with settings.strip_components its
+// first path segments are dropped, skipping keys with nothing left. Two keys
+// that then map to the same path fail the entry rather than overwriting
+// each other.
+func (downloader *Downloader) expandPrefix(ctx context.Context, file config.FileEntry) ([]config.FileEntry, error) {
+	if downloader.offline {
+		return nil, fmt.Errorf("%w: listing a prefix needs the network", errNotCached)
+	}
+
+	err := downloader.cfg.Settings.CheckURLAllowed(file.URL)
+	if err != nil {
+		return nil, fmt.Errorf("listing prefix: %w", err)
+	}
+
+	aliasName, prefix, _ := strings.Cut(strings.TrimPrefix(file.URL, "s3://"), "/")
+
+	alias, ok := sourceAliases(downloader.cfg.Aliases, file)[aliasName]
+	if !ok {
+		return nil, fmt.Errorf("listing prefix: alias %q not found", aliasName)
+	}
+
+	objects, err := retryMetadata(ctx, downloader.cfg.Settings, func() ([]storage.ObjectInfo, error) {
+		return storage.ListPrefix(ctx, alias, prefix)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing prefix: %w", err)
+	}
+
+	if downloader.mirrored == nil {
+		downloader.mirrored = make(map[string]mirroredObject)
+	}
+
+	settings := downloader.cfg.Settings
+	entries := make([]config.FileEntry, 0, len(objects))
+	mapped := make(map[string]string)
+
+	for _, object := range objects {
+		relative := strings.TrimPrefix(object.Key, prefix)
+
+		// Keys ending in "/" are the empty directory markers some consoles
+		// create; the tree gets its directories from the objects in them.
+		if relative == "" || strings.HasSuffix(relative, "/") {
+			continue
+		}
+
+		var rewrite string
+
+		switch {
+		case settings.IsFlatten():
+			rewrite = "flatten"
+			relative = path.Base(relative)
+		case settings.StripComponents > 0:
+			rewrite = "strip_components"
+
+			segments := strings.SplitN(relative, "/", settings.StripComponents+1)
+			if len(segments) <= settings.StripComponents {
+				downloader.warn("skipping %s: nothing is left of the key after strip_components %d",
+					object.Key, settings.StripComponents)
+
+				continue
+			}
+
+			relative = segments[settings.StripComponents]
+		}
+
+		if rewrite != "" {
+			other, ok := mapped[relative]
+			if ok {
+				return nil, fmt.Errorf("%s: keys %s and %s both map to %s", rewrite, other, object.Key, relative)
+			}
+
+			mapped[relative] = object.Key
+		}
+
+		if !filepath.IsLocal(filepath.FromSlash(relative)) {
+			downloader.warn("skipping %s: key escapes the dest directory %s", object.Key, file.Dest)
+
+			continue
+		}
+
+		entry := file
+		entry.URL = "s3://" + aliasName + "/" + object.Key
+		entry.Dest = filepath.Join(file.Dest, filepath.FromSlash(relative))
+
+		downloader.mirrored[entry.Dest] = mirroredObject{prefix: file, object: object}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// FailedEntries returns the config entries of the failed and deferred
+// results, for settings.failure_report, as neither is in place. A failed object of a prefix is reported as its
+// prefix entry, once, as the objects have no checksum of their own and a
+// new run of the prefix skips the objects already in place.
+func (downloader *Downloader) FailedEntries(results []DownloadResult) []config.FileEntry {
+	var (
+		entries  []config.FileEntry
+		prefixes = make(map[string]bool)
+	)
+
+	for _, result := range results {
+		if result.Error == nil && !result.Deferred {
+			continue
+		}
+
+		entry := result.File
+
+		mirrored, ok := downloader.mirrored[entry.Dest]
+		if ok {
+			entry = mirrored.prefix
+		}
+
+		if config.IsPrefixURL(entry.URL) {
+			if prefixes[entry.Dest] {
+				continue
+			}
+
+			prefixes[entry.Dest] = true
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// mirrorUpToDate reports whether the dest of a mirrored object still matches
+// its listing: the size is the same, and the ETag sidecar, not older than
+// the dest, records the listed ETag. Unlike the etag pre-check, multipart
+// ETags are accepted, as they are compared with an earlier listing of the
+// same object rather than standing in for a content hash.
+func mirrorUpToDate(dest string, object storage.ObjectInfo) bool {
+	info, err := os.Stat(dest)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != object.Size {
+		return false
+	}
+
+	etag := normalizeETag(object.ETag)
+
+	return etag != "" && sidecarRecords(dest, info, etag)
+}
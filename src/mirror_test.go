@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"xget/src/config"
+)
+
+// newFakeBucket serves a path-style S3 bucket "artifacts" holding objects,
+// answering ListObjectsV2 and GetObject. gets counts object downloads.
+func newFakeBucket(t *testing.T, objects map[string]string, gets *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+
+			var contents strings.Builder
+
+			for key, body := range objects {
+				if strings.HasPrefix(key, prefix) {
+					fmt.Fprintf(&contents, "<Contents><Key>%s</Key><Size>%d</Size><ETag>&quot;etag-%s&quot;</ETag></Contents>",
+						key, len(body), key)
+				}
+			}
+
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>`+
+				`<ListBucketResult><Name>artifacts</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>%s</ListBucketResult>`,
+				prefix, contents.String())
+
+			return
+		}
+
+		body, ok := objects[strings.TrimPrefix(r.URL.Path, "/artifacts/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestDownloadPrefix(t *testing.T) {
+	objects := map[string]string{
+		"releases/v1/app.bin":      "application",
+		"releases/v1/docs/README":  "readme",
+		"releases/v1/docs/":        "",
+		"releases/v1/../escape":    "outside",
+		"releases/v2/unrelated.md": "not mirrored",
+	}
+
+	var gets atomic.Int32
+
+	server := newFakeBucket(t, objects, &gets)
+	dest := filepath.Join(t.TempDir(), "mirror")
+
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Aliases: map[string]config.Alias{
+				"store": {Endpoint: server.URL, Region: "us-east-1", Bucket: "artifacts", AccessKey: "key", SecretKey: "secret"},
+			},
+			Settings: config.Settings{Parallel: 2, Retries: 1, MetadataRetries: 1, SingleStream: "true", ProgressMode: config.ProgressModeCI},
+			Files:    []config.FileEntry{{URL: "s3://store/releases/v1/", Dest: dest}},
+		}
+	}
+
+	downloader := NewDownloader(newConfig(), nil)
+
+	results := downloader.Download(context.Background())
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+	}
+
+	for path, want := range map[string]string{"app.bin": "application", "docs/README": "readme"} {
+		data, err := os.ReadFile(filepath.Join(dest, path))
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+
+		if string(data) != want {
+			t.Errorf("%s: expected %q, got %q", path, want, data)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "escape")); !os.IsNotExist(err) {
+		t.Errorf("expected key escaping the dest to be skipped, got %v", err)
+	}
+
+	if len(downloader.Warnings()) != 1 {
+		t.Errorf("expected one warning for the escaping key, got %q", downloader.Warnings())
+	}
+
+	// A second run finds every object up to date by ETag and size.
+	gets.Store(0)
+
+	results = NewDownloader(newConfig(), nil).Download(context.Background())
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+	}
+
+	if gets.Load() != 0 {
+		t.Errorf("expected no downloads on the second run, got %d", gets.Load())
+	}
+
+	// A local copy of the wrong size is fetched again.
+	err := os.WriteFile(filepath.Join(dest, "app.bin"), []byte("stale"), 0o644)
+	if err != nil {
+		t.Fatalf("writing stale copy: %v", err)
+	}
+
+	NewDownloader(newConfig(), nil).Download(context.Background())
+
+	if gets.Load() != 1 {
+		t.Errorf("expected the stale copy to be downloaded again, got %d downloads", gets.Load())
+	}
+}
+
+func TestDownloadPrefixFlatten(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   map[string]string
+		wantFiles []string
+		wantErr   string
+	}{
+		{
+			name:      "distinct basenames",
+			objects:   map[string]string{"releases/app.bin": "application", "releases/docs/README": "readme"},
+			wantFiles: []string{"app.bin", "README"},
+		},
+		{
+			name:    "collision",
+			objects: map[string]string{"releases/linux/app.bin": "linux", "releases/darwin/app.bin": "darwin"},
+			wantErr: "both map to app.bin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets atomic.Int32
+
+			server := newFakeBucket(t, tt.objects, &gets)
+			dest := filepath.Join(t.TempDir(), "mirror")
+
+			cfg := &config.Config{
+				Aliases: map[string]config.Alias{
+					"store": {Endpoint: server.URL, Region: "us-east-1", Bucket: "artifacts", AccessKey: "key", SecretKey: "secret"},
+				},
+				Settings: config.Settings{
+					Parallel: 2, Retries: 1, MetadataRetries: 1, SingleStream: "true", Flatten: "true",
+					ProgressMode: config.ProgressModeCI,
+				},
+				Files: []config.FileEntry{{URL: "s3://store/releases/", Dest: dest}},
+			}
+
+			results := NewDownloader(cfg, nil).Download(context.Background())
+
+			if tt.wantErr != "" {
+				if len(results) != 1 || results[0].Error == nil || !strings.Contains(results[0].Error.Error(), tt.wantErr) {
+					t.Fatalf("expected one result failing with %q, got %+v", tt.wantErr, results)
+				}
+
+				if gets.Load() != 0 {
+					t.Errorf("expected no downloads, got %d", gets.Load())
+				}
+
+				return
+			}
+
+			for _, result := range results {
+				if result.Error != nil {
+					t.Fatalf("unexpected error: %v", result.Error)
+				}
+			}
+
+			for _, name := range tt.wantFiles {
+				if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+					t.Errorf("expected %s directly in the dest: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadPrefixStripComponents(t *testing.T) {
+	tests := []struct {
+		name         string
+		objects      map[string]string
+		wantFiles    []string
+		wantWarnings int
+		wantErr      string
+	}{
+		{
+			name: "strip the version",
+			objects: map[string]string{
+				"releases/v1/linux/app.bin": "linux",
+				"releases/v1/docs/README":   "readme",
+				"releases/NOTES":            "too shallow",
+			},
+			wantFiles:    []string{"linux/app.bin", "docs/README"},
+			wantWarnings: 1,
+		},
+		{
+			name:    "collision",
+			objects: map[string]string{"releases/v1/app.bin": "v1", "releases/v2/app.bin": "v2"},
+			wantErr: "strip_components: keys",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets atomic.Int32
+
+			server := newFakeBucket(t, tt.objects, &gets)
+			dest := filepath.Join(t.TempDir(), "mirror")
+
+			cfg := &config.Config{
+				Aliases: map[string]config.Alias{
+					"store": {Endpoint: server.URL, Region: "us-east-1", Bucket: "artifacts", AccessKey: "key", SecretKey: "secret"},
+				},
+				Settings: config.Settings{
+					Parallel: 2, Retries: 1, MetadataRetries: 1, SingleStream: "true", StripComponents: 1,
+					ProgressMode: config.ProgressModeCI,
+				},
+				Files: []config.FileEntry{{URL: "s3://store/releases/", Dest: dest}},
+			}
+
+			downloader := NewDownloader(cfg, nil)
+			results := downloader.Download(context.Background())
+
+			if tt.wantErr != "" {
+				if len(results) != 1 || results[0].Error == nil || !strings.Contains(results[0].Error.Error(), tt.wantErr) {
+					t.Fatalf("expected one result failing with %q, got %+v", tt.wantErr, results)
+				}
+
+				if gets.Load() != 0 {
+					t.Errorf("expected no downloads, got %d", gets.Load())
+				}
+
+				return
+			}
+
+			if len(results) != len(tt.wantFiles) {
+				t.Errorf("expected %d results, got %d", len(tt.wantFiles), len(results))
+			}
+
+			for _, result := range results {
+				if result.Error != nil {
+					t.Fatalf("unexpected error: %v", result.Error)
+				}
+			}
+
+			for _, name := range tt.wantFiles {
+				_, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name)))
+				if err != nil {
+					t.Errorf("expected %s below the dest: %v", name, err)
+				}
+			}
+
+			if len(downloader.Warnings()) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got %q", tt.wantWarnings, downloader.Warnings())
+			}
+		})
+	}
+}
+
+func TestDownloadPrefixListingFails(t *testing.T) {
+	cfg := &config.Config{
+		Aliases:  map[string]config.Alias{},
+		Settings: config.Settings{Parallel: 1, Retries: 1, MetadataRetries: 1, ProgressMode: config.ProgressModeCI},
+		Files:    []config.FileEntry{{URL: "s3://missing/prefix/", Dest: t.TempDir()}},
+	}
+
+	results := NewDownloader(cfg, nil).Download(context.Background())
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("expected one failed result, got %+v", results)
+	}
+}
+
+func TestFailedEntries(t *testing.T) {
+	prefix := config.FileEntry{URL: "s3://store/releases/", Dest: "/tmp/mirror"}
+	plain := config.FileEntry{URL: "https://example.com/a.bin", Dest: "/tmp/a.bin", SHA256: "abc123"}
+
+	downloader := NewDownloader(&config.Config{}, nil)
+	downloader.mirrored = map[string]mirroredObject{
+		"/tmp/mirror/x": {prefix: prefix},
+		"/tmp/mirror/y": {prefix: prefix},
+		"/tmp/mirror/z": {prefix: prefix},
+	}
+
+	boom := errors.New("boom")
+	results := []DownloadResult{
+		{File: config.FileEntry{URL: "s3://store/releases/x", Dest: "/tmp/mirror/x"}, Error: boom},
+		{File: config.FileEntry{URL: "s3://store/releases/y", Dest: "/tmp/mirror/y"}, Error: boom},
+		{File: config.FileEntry{URL: "s3://store/releases/z", Dest: "/tmp/mirror/z"}},
+		{File: plain, Error: boom},
+		{File: config.FileEntry{URL: "https://example.com/b.bin", Dest: "/tmp/b.bin"}},
+	}
+
+	entries := downloader.FailedEntries(results)
+	if !reflect.DeepEqual(entries, []config.FileEntry{prefix, plain}) {
+		t.Errorf("expected the prefix entry once and the plain entry, got %+v", entries)
+	}
+}
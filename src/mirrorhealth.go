@@ -0,0 +1,75 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"xget/src/config"
+)
+
+// mirrorHealth tracks, for -retry-failed-mirrors-last, which aliases of the
+// fallback_alias chains failed during the run, with rejected credentials or
+// an endpoint failure. It is
+// shared by all files, so once an alias fails, retries and other files
+// sharing it start with the aliases that have not failed.
+type mirrorHealth struct {
+	mu sync.Mutex
+
+	// failed maps an alias name to the sequence number of its last
+	// failure. Larger numbers are more recent.
+	failed map[string]uint64
+	seq    uint64
+}
+
+func newMirrorHealth() *mirrorHealth {
+	return &mirrorHealth{failed: make(map[string]uint64)}
+}
+
+// order returns urls with the aliases that failed moved to the end, the
+// most recently failed last. Healthy aliases keep their chain order.
+func (health *mirrorHealth) order(urls []string) []string {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	failedAt := func(url string) uint64 {
+		aliasName, _ := config.URLAlias(url)
+
+		return health.failed[aliasName]
+	}
+
+	ordered := slices.Clone(urls)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		return cmp.Compare(failedAt(a), failedAt(b))
+	})
+
+	return ordered
+}
+
+// markFailed records that the alias of url failed.
+func (health *mirrorHealth) markFailed(url string) {
+	aliasName, ok := config.URLAlias(url)
+	if !ok {
+		return
+	}
+
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	health.seq++
+	health.failed[aliasName] = health.seq
+}
+
+// markHealthy clears the failure of the alias of url after a download from
+// it succeeded.
+func (health *mirrorHealth) markHealthy(url string) {
+	aliasName, ok := config.URLAlias(url)
+	if !ok {
+		return
+	}
+
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	delete(health.failed, aliasName)
+}
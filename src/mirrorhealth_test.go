@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"xget/src/config"
+
+	"github.com/vbauerster/mpb/v8"
+)
+
+func TestMirrorHealthOrder(t *testing.T) {
+	health := newMirrorHealth()
+	chain := []string{"s3://a/key", "s3://b/key", "s3://c/key"}
+
+	got := health.order(chain)
+	if !slices.Equal(got, chain) {
+		t.Errorf("expected chain order without failures, got %q", got)
+	}
+
+	health.markFailed("s3://b/key")
+	health.markFailed("s3://a/key")
+
+	want := []string{"s3://c/key", "s3://b/key", "s3://a/key"}
+
+	got = health.order(chain)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// A success restores an alias.
+	health.markHealthy("s3://a/key")
+
+	want = []string{"s3://a/key", "s3://c/key", "s3://b/key"}
+
+	got = health.order(chain)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestDownloadRetryFailedMirrorsLast(t *testing.T) {
+	content := []byte("object behind rotated credentials")
+	sum := sha256.Sum256(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=current/") {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	alias := config.Alias{Endpoint: server.URL, Region: "us-east-1", Bucket: "artifacts", SecretKey: "secret"}
+
+	primary := alias
+	primary.AccessKey = "rotated"
+	primary.FallbackAlias = "backup"
+
+	backup := alias
+	backup.AccessKey = "current"
+
+	cfg := &config.Config{
+		Aliases:  map[string]config.Alias{"primary": primary, "backup": backup},
+		Settings: config.Settings{Retries: 1, SingleStream: "true", MetadataRetries: 1},
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	downloader.SetRetryFailedMirrorsLast()
+
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+	dir := t.TempDir()
+
+	for _, name := range []string{"first.bin", "second.bin", "third.bin"} {
+		file := config.FileEntry{
+			URL:    "s3://primary/file.bin",
+			Dest:   filepath.Join(dir, name),
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+
+		err := downloader.downloadWithFallback(context.Background(), file, progress)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	progress.Wait()
+
+	// Only the first file tries the rejected alias; the others start with
+	// its fallback.
+	if len(downloader.Warnings()) != 1 {
+		t.Errorf("expected one fallback warning, got %q", downloader.Warnings())
+	}
+}
+
+func TestDownloadRetryFailedMirrorsLastEndpointFailure(t *testing.T) {
+	content := []byte("object on the healthy mirror")
+	sum := sha256.Sum256(content)
+
+	// The primary endpoint is down. 501 is not retried by the SDK, which
+	// keeps the test fast; other 5xx responses fail over the same way.
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer up.Close()
+
+	primary := config.Alias{Endpoint: down.URL, Region: "us-east-1", Bucket: "artifacts", AccessKey: "key", SecretKey: "secret", FallbackAlias: "backup"}
+	backup := config.Alias{Endpoint: up.URL, Region: "us-east-1", Bucket: "artifacts", AccessKey: "key", SecretKey: "secret"}
+
+	cfg := &config.Config{
+		Aliases:  map[string]config.Alias{"primary": primary, "backup": backup},
+		Settings: config.Settings{Retries: 1, SingleStream: "true", MetadataRetries: 1},
+	}
+
+	downloader := NewDownloader(cfg, nil)
+	downloader.SetRetryFailedMirrorsLast()
+
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+	dir := t.TempDir()
+
+	for _, name := range []string{"first.bin", "second.bin"} {
+		file := config.FileEntry{
+			URL:    "s3://primary/file.bin",
+			Dest:   filepath.Join(dir, name),
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+
+		err := downloader.downloadWithFallback(context.Background(), file, progress)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	progress.Wait()
+
+	// The second file starts with the healthy mirror.
+	if len(downloader.Warnings()) != 1 {
+		t.Errorf("expected one fallback warning, got %q", downloader.Warnings())
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"xget/src/config"
+)
+
+// runOptions holds the command-line flags of the download command.
+type runOptions struct {
+	configPaths []string
+	noResume    bool
+	timings     bool
+	jsonReport  string
+	maxErrors   int
+	perAlias    int
+	sortBy      string
+	strict      bool
+	limit       int
+	shuffle     bool
+	outputDir   string
+	retryFrom   string
+	offline     bool
+	watch       bool
+	reloadOnHUP bool
+	resumeOnly  bool
+	sequential  bool
+
+	retryFailedMirrorsLast bool
+}
+
+// newRunFlagSet declares the download flags, bound to opts.
+func newRunFlagSet(opts *runOptions) *flag.FlagSet {
+	flags := flag.NewFlagSet("xget", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	flags.BoolVar(&opts.noResume, "no-resume", false, "ignore existing partial files and download from scratch")
+	flags.BoolVar(&opts.timings, "timings", false, "print per-file connect, ttfb and total timings")
+	flags.StringVar(&opts.jsonReport, "json", "", "write per-file results as JSON to `file`")
+	flags.IntVar(&opts.maxErrors, "max-errors", 0, "cancel the run once `N` downloads have failed")
+	flags.IntVar(&opts.perAlias, "parallel-per-alias", 0,
+		"open at most `N` connections to each s3:// alias at once, overriding settings.per_alias_parallel")
+	flags.BoolVar(&opts.sequential, "sequential", false,
+		"download one file at a time in config order, ignoring priority and the parallel settings")
+	flags.BoolVar(&opts.strict, "strict", false, "exit non-zero if any warning was reported")
+	flags.StringVar(&opts.sortBy, "sort", "", "print a results table ordered by `key`: status, name, size or duration")
+	flags.IntVar(&opts.limit, "limit", 0, "download only the first `N` files")
+	flags.StringVar(&opts.outputDir, "output-dir", "", "prefix relative dests with `dir`, overriding settings.dest_dir")
+	flags.StringVar(&opts.outputDir, "O", "", "shorthand for -output-dir")
+	flags.BoolVar(&opts.shuffle, "shuffle", false, "randomize the file order, so -limit picks a random sample")
+	flags.BoolVar(&opts.offline, "offline", false, "use only existing files and the cache, never the origins")
+	flags.BoolVar(&opts.resumeOnly, "resume-only", false, "only finish files with an existing .partial and defer the rest")
+	flags.BoolVar(&opts.retryFailedMirrorsLast, "retry-failed-mirrors-last", false,
+		"try fallback_alias aliases whose credentials were rejected earlier in the run last")
+	flags.BoolVar(&opts.watch, "watch", false,
+		"keep running and download new or changed entries whenever a config file changes")
+	flags.BoolVar(&opts.reloadOnHUP, "reload-on-hup", false,
+		"on SIGHUP, reload the configs and add their new entries to the running downloads")
+	flags.StringVar(&opts.retryFrom, "retry-from", "",
+		"download only the entries of the failure report `file`, using the configs for aliases and settings")
+
+	return flags
+}
+
+// parseRunArgs separates download flags from config file paths.
+// Flags may appear anywhere among the config paths.
+func parseRunArgs(args []string) (runOptions, error) {
+	var opts runOptions
+
+	flags := newRunFlagSet(&opts)
+
+	// flag stops at the first positional argument, so keep parsing after
+	// each config path to accept flags on either side of it.
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return opts, err
+		}
+
+		if flags.NArg() == 0 {
+			break
+		}
+
+		opts.configPaths = append(opts.configPaths, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if opts.maxErrors < 0 {
+		return opts, fmt.Errorf("-max-errors must not be negative, got %d", opts.maxErrors)
+	}
+
+	if opts.perAlias < 0 {
+		return opts, fmt.Errorf("-parallel-per-alias must not be negative, got %d", opts.perAlias)
+	}
+
+	if opts.limit < 0 {
+		return opts, fmt.Errorf("-limit must not be negative, got %d", opts.limit)
+	}
+
+	if opts.sortBy != "" && !slices.Contains(resultSortKeys, opts.sortBy) {
+		return opts, fmt.Errorf("-sort must be one of %s, got %q", strings.Join(resultSortKeys, ", "), opts.sortBy)
+	}
+
+	if len(opts.configPaths) == 0 && opts.retryFrom == "" {
+		return opts, fmt.Errorf("no config files specified")
+	}
+
+	if opts.resumeOnly && opts.noResume {
+		return opts, fmt.Errorf("-resume-only cannot be combined with -no-resume")
+	}
+
+	if opts.sequential && opts.perAlias > 0 {
+		return opts, fmt.Errorf("-sequential cannot be combined with -parallel-per-alias")
+	}
+
+	if opts.watch && opts.retryFrom != "" {
+		return opts, fmt.Errorf("-watch cannot be combined with -retry-from")
+	}
+
+	return opts, nil
+}
+
+// generateArgs holds the parsed arguments of the generate command.
+type generateArgs struct {
+	dirPath    string
+	outputFile string
+	updateFile string
+	options    generateOptions
+}
+
+// newGenerateFlagSet declares the generate flags, bound to args.
+func newGenerateFlagSet(args *generateArgs) *flag.FlagSet {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	flags.StringVar(&args.outputFile, "o", "", "write the config to `file` instead of stdout")
+	flags.StringVar(&args.updateFile, "update", "",
+		"recompute the sha256 (or -algo field) of the entries of an existing `config` in place")
+	flags.BoolVar(&args.options.strict, "strict", false, "fail without output if any file was skipped")
+	flags.IntVar(&args.options.workers, "j", defaultGenerateWorkers, "hash up to `N` files at once")
+	flags.IntVar(&args.options.bufferSize, "buffer-size", defaultGenerateBufferSize,
+		"read files in chunks of `bytes` while hashing")
+	flags.BoolVar(&args.options.progress, "progress", false,
+		"show a progress bar per file and the running total on stderr")
+	flags.Func("algo", "emit `algorithm` digests: sha256 (default), sha512 or sha1", func(value string) error {
+		if !slices.Contains(checksumAlgorithms, value) {
+			return fmt.Errorf("unsupported algorithm %q, want one of %s", value, strings.Join(checksumAlgorithms, ", "))
+		}
+
+		args.options.algorithm = value
+
+		return nil
+	})
+	flags.Func("since", "include only files modified within `window`, e.g. 7d or 36h", func(value string) error {
+		since, err := parseSince(value)
+		if err != nil {
+			return err
+		}
+
+		args.options.since = since
+
+		return nil
+	})
+
+	return flags
+}
+
+// parseGenerateArgs parses the generate arguments: exactly one directory, with
+// flags before or after it.
+func parseGenerateArgs(args []string) (generateArgs, error) {
+	var parsed generateArgs
+
+	flags := newGenerateFlagSet(&parsed)
+
+	var dirs []string
+
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return parsed, err
+		}
+
+		if flags.NArg() == 0 {
+			break
+		}
+
+		dirs = append(dirs, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(dirs) != 1 {
+		return parsed, fmt.Errorf("generate command requires exactly one directory argument")
+	}
+
+	if parsed.options.workers < 1 {
+		return parsed, fmt.Errorf("-j must be at least 1, got %d", parsed.options.workers)
+	}
+
+	if parsed.options.bufferSize < 1 {
+		return parsed, fmt.Errorf("-buffer-size must be at least 1, got %d", parsed.options.bufferSize)
+	}
+
+	// Files outside the window would look removed from the directory.
+	if parsed.updateFile != "" && parsed.options.since > 0 {
+		return parsed, fmt.Errorf("-update cannot be combined with -since")
+	}
+
+	parsed.dirPath = dirs[0]
+
+	return parsed, nil
+}
+
+// diffArgs holds the parsed arguments of the diff command.
+type diffArgs struct {
+	configPath string
+	dirPath    string
+	format     string
+}
+
+// parseDiffArgs parses the diff arguments: a config and a directory, with
+// flags before or after them.
+func parseDiffArgs(args []string) (diffArgs, error) {
+	parsed := diffArgs{format: "text"}
+
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&parsed.format, "o", parsed.format, "report `format`: text or json")
+
+	var positional []string
+
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return parsed, err
+		}
+
+		if flags.NArg() == 0 {
+			break
+		}
+
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(positional) != 2 {
+		return parsed, fmt.Errorf("diff command requires a config file and a directory")
+	}
+
+	if parsed.format != "text" && parsed.format != "json" {
+		return parsed, fmt.Errorf("-o must be text or json, got %q", parsed.format)
+	}
+
+	parsed.configPath = positional[0]
+	parsed.dirPath = positional[1]
+
+	return parsed, nil
+}
+
+// pushArgs holds the parsed arguments of the push command.
+type pushArgs struct {
+	configPath string
+	dirPath    string
+	alias      string
+	dryRun     bool
+}
+
+// parsePushArgs parses the push arguments: a config and a directory, with
+// flags before or after them.
+func parsePushArgs(args []string) (pushArgs, error) {
+	var parsed pushArgs
+
+	flags := flag.NewFlagSet("push", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&parsed.alias, "alias", "", "push to the alias `name` instead of the one the config downloads from")
+	flags.BoolVar(&parsed.dryRun, "dry-run", false, "report what would be uploaded without uploading")
+
+	var positional []string
+
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return parsed, err
+		}
+
+		if flags.NArg() == 0 {
+			break
+		}
+
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(positional) != 2 {
+		return parsed, fmt.Errorf("push command requires a config file and a directory")
+	}
+
+	parsed.configPath = positional[0]
+	parsed.dirPath = positional[1]
+
+	return parsed, nil
+}
+
+// parseSince parses a -since window: a Go duration such as "36h", or a
+// whole number of days such as "7d".
+func parseSince(value string) (time.Duration, error) {
+	var since time.Duration
+
+	days, ok := strings.CutSuffix(value, "d")
+	if ok {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+
+		since = time.Duration(count) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+
+		since = parsed
+	}
+
+	if since <= 0 {
+		return 0, fmt.Errorf("window must be positive, got %q", value)
+	}
+
+	return since, nil
+}
+
+// printRunFlags writes the download flag descriptions to w.
+func printRunFlags(w io.Writer) {
+	flags := newRunFlagSet(&runOptions{})
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// coversAllFiles reports whether the run downloads every file of the
+// configs, rather than a -limit sample, the entries of a -retry-from report
+// or the partials of -resume-only.
+func (opts runOptions) coversAllFiles() bool {
+	return opts.limit == 0 && opts.retryFrom == "" && !opts.resumeOnly
+}
+
+// apply overrides config settings with values given on the command line.
+func (opts runOptions) apply(cfg *config.Config) {
+	if opts.noResume {
+		cfg.Settings.Resume = "false"
+	}
+
+	if opts.maxErrors > 0 {
+		cfg.Settings.MaxErrors = opts.maxErrors
+	}
+
+	if opts.perAlias > 0 {
+		cfg.Settings.PerAliasParallel = opts.perAlias
+	}
+
+	// One slot in a single pool: no size probes, and no alias pools whose
+	// files would take their slot in another order than they were started.
+	if opts.sequential {
+		cfg.Settings.Parallel = 1
+		cfg.Settings.ParallelSmall = 1
+		cfg.Settings.ParallelLarge = 1
+		cfg.Settings.SizeThreshold = 0
+		cfg.Settings.PerAliasParallel = 0
+	}
+
+	if opts.outputDir != "" {
+		cfg.Settings.DestDir = opts.outputDir
+	}
+
+	if opts.shuffle {
+		rand.Shuffle(len(cfg.Files), func(i, j int) {
+			cfg.Files[i], cfg.Files[j] = cfg.Files[j], cfg.Files[i]
+		})
+	}
+
+	if opts.limit > 0 && opts.limit < len(cfg.Files) {
+		cfg.Files = cfg.Files[:opts.limit]
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantPaths   []string
+		wantResume  bool
+		wantMaxErr  int
+		expectError bool
+	}{
+		{
+			name:       "config paths only",
+			args:       []string{"a.yaml", "b.yaml"},
+			wantPaths:  []string{"a.yaml", "b.yaml"},
+			wantResume: true,
+		},
+		{
+			name:       "no-resume before paths",
+			args:       []string{"-no-resume", "a.yaml"},
+			wantPaths:  []string{"a.yaml"},
+			wantResume: false,
+		},
+		{
+			name:       "no-resume after paths",
+			args:       []string{"a.yaml", "--no-resume"},
+			wantPaths:  []string{"a.yaml"},
+			wantResume: false,
+		},
+		{
+			name:        "unknown flag",
+			args:        []string{"-bogus", "a.yaml"},
+			expectError: true,
+		},
+		{
+			name:       "json report path consumed",
+			args:       []string{"-json", "out.json", "a.yaml"},
+			wantPaths:  []string{"a.yaml"},
+			wantResume: true,
+		},
+		{
+			name:        "json without argument",
+			args:        []string{"a.yaml", "-json"},
+			expectError: true,
+		},
+		{
+			name:       "max-errors between paths",
+			args:       []string{"a.yaml", "-max-errors", "3", "b.yaml"},
+			wantPaths:  []string{"a.yaml", "b.yaml"},
+			wantResume: true,
+			wantMaxErr: 3,
+		},
+		{
+			name:        "max-errors not a number",
+			args:        []string{"-max-errors", "many", "a.yaml"},
+			expectError: true,
+		},
+		{
+			name:        "negative max-errors",
+			args:        []string{"-max-errors=-1", "a.yaml"},
+			expectError: true,
+		},
+		{
+			name:       "sort key",
+			args:       []string{"-sort", "duration", "a.yaml"},
+			wantPaths:  []string{"a.yaml"},
+			wantResume: true,
+		},
+		{
+			name:        "unknown sort key",
+			args:        []string{"-sort=color", "a.yaml"},
+			expectError: true,
+		},
+		{
+			name:        "negative limit",
+			args:        []string{"-limit=-2", "a.yaml"},
+			expectError: true,
+		},
+		{
+			name:        "no config paths",
+			args:        []string{"-no-resume"},
+			expectError: true,
+		},
+		{
+			name:       "watch",
+			args:       []string{"a.yaml", "-watch"},
+			wantPaths:  []string{"a.yaml"},
+			wantResume: true,
+		},
+		{
+			name:        "watch with retry-from",
+			args:        []string{"-watch", "-retry-from", "failures.yaml", "a.yaml"},
+			expectError: true,
+		},
+		{
+			name:       "resume-only",
+			args:       []string{"-resume-only", "a.yaml"},
+			wantPaths:  []string{"a.yaml"},
+			wantResume: true,
+		},
+		{
+			name:        "resume-only with no-resume",
+			args:        []string{"-resume-only", "-no-resume", "a.yaml"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseRunArgs(tt.args)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(opts.configPaths, tt.wantPaths) {
+				t.Errorf("configPaths = %v, want %v", opts.configPaths, tt.wantPaths)
+			}
+
+			var cfg config.Config
+
+			opts.apply(&cfg)
+
+			if cfg.Settings.IsResume() != tt.wantResume {
+				t.Errorf("IsResume() = %v, want %v", cfg.Settings.IsResume(), tt.wantResume)
+			}
+
+			if cfg.Settings.MaxErrors != tt.wantMaxErr {
+				t.Errorf("MaxErrors = %d, want %d", cfg.Settings.MaxErrors, tt.wantMaxErr)
+			}
+		})
+	}
+}
+
+func TestRunOptionsLimitShuffle(t *testing.T) {
+	newConfig := func() *config.Config {
+		cfg := &config.Config{}
+		for _, dest := range []string{"a", "b", "c", "d", "e"} {
+			cfg.Files = append(cfg.Files, config.FileEntry{Dest: dest})
+		}
+
+		return cfg
+	}
+
+	dests := func(cfg *config.Config) []string {
+		var names []string
+		for _, file := range cfg.Files {
+			names = append(names, file.Dest)
+		}
+
+		return names
+	}
+
+	cfg := newConfig()
+	runOptions{limit: 2}.apply(cfg)
+
+	if got := dests(cfg); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("limit kept %v, want the first two files", got)
+	}
+
+	cfg = newConfig()
+	runOptions{limit: 10}.apply(cfg)
+
+	if len(cfg.Files) != 5 {
+		t.Errorf("limit above the file count kept %d files, want 5", len(cfg.Files))
+	}
+
+	cfg = newConfig()
+	runOptions{limit: 3, shuffle: true}.apply(cfg)
+
+	sample := dests(cfg)
+	if len(sample) != 3 {
+		t.Fatalf("shuffled limit kept %d files, want 3", len(sample))
+	}
+
+	slices.Sort(sample)
+	if len(slices.Compact(sample)) != 3 {
+		t.Errorf("shuffled sample %v contains duplicates", sample)
+	}
+}
+
+func TestParseRunArgsOutputDir(t *testing.T) {
+	for _, args := range [][]string{
+		{"-output-dir", "/tmp/out", "a.yaml"},
+		{"a.yaml", "-O", "/tmp/out"},
+	} {
+		opts, err := parseRunArgs(args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		cfg := &config.Config{Settings: config.Settings{DestDir: "/from/config"}}
+		opts.apply(cfg)
+
+		if cfg.Settings.DestDir != "/tmp/out" {
+			t.Errorf("%v: expected the flag to override dest_dir, got %q", args, cfg.Settings.DestDir)
+		}
+	}
+}
+
+func TestParseRunArgsParallelPerAlias(t *testing.T) {
+	opts, err := parseRunArgs([]string{"a.yaml", "-parallel-per-alias", "2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := &config.Config{Settings: config.Settings{PerAliasParallel: 8}}
+	opts.apply(cfg)
+
+	if cfg.Settings.PerAliasParallel != 2 {
+		t.Errorf("expected the flag to override per_alias_parallel, got %d", cfg.Settings.PerAliasParallel)
+	}
+
+	_, err = parseRunArgs([]string{"-parallel-per-alias=-1", "a.yaml"})
+	if err == nil {
+		t.Error("expected a negative -parallel-per-alias to be rejected")
+	}
+}
+
+func TestParseRunArgsSequential(t *testing.T) {
+	opts, err := parseRunArgs([]string{"-sequential", "a.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := &config.Config{Settings: config.Settings{
+		Parallel:         8,
+		ParallelSmall:    8,
+		ParallelLarge:    2,
+		SizeThreshold:    1 << 20,
+		PerAliasParallel: 4,
+	}}
+	opts.apply(cfg)
+
+	settings := cfg.Settings
+	if settings.Parallel != 1 || settings.ParallelSmall != 1 || settings.ParallelLarge != 1 ||
+		settings.SizeThreshold != 0 || settings.PerAliasParallel != 0 {
+		t.Errorf("expected -sequential to leave a single download slot, got %+v", settings)
+	}
+
+	_, err = parseRunArgs([]string{"-sequential", "-parallel-per-alias", "2", "a.yaml"})
+	if err == nil {
+		t.Error("expected -sequential with -parallel-per-alias to be rejected")
+	}
+}
+
+func TestParseGenerateArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		want        generateArgs
+		expectError bool
+	}{
+		{
+			name: "directory only",
+			args: []string{"dist"},
+			want: generateArgs{dirPath: "dist", options: generateOptions{workers: defaultGenerateWorkers, bufferSize: defaultGenerateBufferSize}},
+		},
+		{
+			name: "flags around directory",
+			args: []string{"-o", "out.yaml", "dist", "-strict", "-j", "16"},
+			want: generateArgs{dirPath: "dist", outputFile: "out.yaml", options: generateOptions{strict: true, workers: 16, bufferSize: defaultGenerateBufferSize}},
+		},
+		{name: "no directory", args: []string{"-strict"}, expectError: true},
+		{name: "two directories", args: []string{"a", "b"}, expectError: true},
+		{name: "zero workers", args: []string{"-j", "0", "dist"}, expectError: true},
+		{
+			name: "since in days",
+			args: []string{"dist", "-since", "7d"},
+			want: generateArgs{dirPath: "dist", options: generateOptions{
+				workers: defaultGenerateWorkers, since: 7 * 24 * time.Hour, bufferSize: defaultGenerateBufferSize,
+			}},
+		},
+		{
+			name: "since as duration",
+			args: []string{"-since", "36h", "dist"},
+			want: generateArgs{dirPath: "dist", options: generateOptions{
+				workers: defaultGenerateWorkers, since: 36 * time.Hour, bufferSize: defaultGenerateBufferSize,
+			}},
+		},
+		{
+			name: "buffer size and progress",
+			args: []string{"dist", "-buffer-size", "4194304", "-progress"},
+			want: generateArgs{dirPath: "dist", options: generateOptions{
+				workers: defaultGenerateWorkers, bufferSize: 4 << 20, progress: true,
+			}},
+		},
+		{name: "zero buffer size", args: []string{"-buffer-size", "0", "dist"}, expectError: true},
+		{
+			name: "update",
+			args: []string{"-update", "config.yaml", "dist"},
+			want: generateArgs{dirPath: "dist", updateFile: "config.yaml", options: generateOptions{
+				workers: defaultGenerateWorkers, bufferSize: defaultGenerateBufferSize,
+			}},
+		},
+		{name: "update with since", args: []string{"-update", "config.yaml", "-since", "7d", "dist"}, expectError: true},
+		{
+			name: "sha512",
+			args: []string{"dist", "-algo", "sha512"},
+			want: generateArgs{dirPath: "dist", options: generateOptions{
+				workers: defaultGenerateWorkers, bufferSize: defaultGenerateBufferSize, algorithm: "sha512",
+			}},
+		},
+		{name: "unsupported algorithm", args: []string{"-algo", "blake2b", "dist"}, expectError: true},
+		{name: "malformed since", args: []string{"-since", "week", "dist"}, expectError: true},
+		{name: "zero since", args: []string{"-since", "0d", "dist"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGenerateArgs(tt.args)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("parseGenerateArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDiffArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		want        diffArgs
+		expectError bool
+	}{
+		{
+			name: "config and directory",
+			args: []string{"config.yaml", "dist"},
+			want: diffArgs{configPath: "config.yaml", dirPath: "dist", format: "text"},
+		},
+		{
+			name: "json after positionals",
+			args: []string{"config.yaml", "dist", "-o", "json"},
+			want: diffArgs{configPath: "config.yaml", dirPath: "dist", format: "json"},
+		},
+		{name: "directory missing", args: []string{"config.yaml"}, expectError: true},
+		{name: "too many arguments", args: []string{"a.yaml", "b.yaml", "dist"}, expectError: true},
+		{name: "unknown format", args: []string{"-o", "yaml", "config.yaml", "dist"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDiffArgs(tt.args)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("parseDiffArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePushArgs(t *testing.T) {
+	got, err := parsePushArgs([]string{"config.yaml", "-dry-run", "dist", "-alias", "store"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := pushArgs{configPath: "config.yaml", dirPath: "dist", alias: "store", dryRun: true}
+	if got != want {
+		t.Errorf("parsePushArgs() = %+v, want %+v", got, want)
+	}
+
+	for _, args := range [][]string{{"config.yaml"}, {"a.yaml", "b.yaml", "dist"}, {"-alias"}} {
+		_, err := parsePushArgs(args)
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", args)
+		}
+	}
+}
+
+func TestParseRunArgsRetryFrom(t *testing.T) {
+	opts, err := parseRunArgs([]string{"-retry-from", "failures.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.retryFrom != "failures.yaml" || len(opts.configPaths) != 0 {
+		t.Errorf("expected retry-from failures.yaml without configs, got %+v", opts)
+	}
+
+	opts, err = parseRunArgs([]string{"base.yaml", "-retry-from", "failures.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Equal(opts.configPaths, []string{"base.yaml"}) {
+		t.Errorf("expected config path base.yaml, got %v", opts.configPaths)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"xget/src/config"
+
+	"github.com/vbauerster/mpb/v8"
+)
+
+// partEntries returns the entries the parts of file are fetched as. A part
+// follows the cache choice, headers and timeouts of its file.
+func partEntries(file config.FileEntry) []config.FileEntry {
+	entries := make([]config.FileEntry, 0, len(file.Parts))
+
+	for i, part := range file.Parts {
+		entries = append(entries, config.FileEntry{
+			URL:     part.URL,
+			Dest:    config.PartDest(file.Dest, i),
+			SHA256:  part.SHA256,
+			Cache:   file.Cache,
+			Headers: file.Headers,
+
+			ConnectTimeout:  file.ConnectTimeout,
+			DownloadTimeout: file.DownloadTimeout,
+		})
+	}
+
+	return entries
+}
+
+// downloadParts fetches every part of file like a file of its own, from an
+// existing verified copy, the cache or its source, then joins them into the
+// dest. The part files are removed once the joined dest is in place; until
+// then they let a failed run resume where it stopped.
+func (downloader *Downloader) downloadParts(
+	ctx context.Context,
+	file config.FileEntry,
+	progress *mpb.Progress,
+	trace *timingTrace,
+) error {
+	parts := partEntries(file)
+
+	for i, part := range parts {
+		err := downloader.fetchFile(ctx, part, progress, trace)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", i+1, err)
+		}
+	}
+
+	err := downloader.joinParts(file, parts)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		os.Remove(part.Dest)
+	}
+
+	downloader.uploadToCache(ctx, file)
+
+	return nil
+}
+
+// joinParts concatenates the parts in order into the partial file of the
+// dest, hashing as it goes, and moves it into place if the whole-file
+// checksums match. On a mismatch the verified parts are kept, as the
+// configured sha256 rather than the parts is likely wrong.
+func (downloader *Downloader) joinParts(file config.FileEntry, parts []config.FileEntry) error {
+	partialPath := file.Dest + ".partial"
+
+	joined, err := os.Create(partialPath)
+	if err != nil {
+		return fmt.Errorf("creating joined file: %w", err)
+	}
+
+	verifier := newChecksumVerifier(file)
+
+	err = appendParts(io.MultiWriter(joined, verifier), parts)
+
+	closeErr := joined.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("closing joined file: %w", closeErr)
+	}
+
+	if err != nil {
+		discardPartial(partialPath)
+
+		return err
+	}
+
+	return downloader.finalizeDownload(partialPath, file, verifier)
+}
+
+func appendParts(out io.Writer, parts []config.FileEntry) error {
+	for _, part := range parts {
+		in, err := os.Open(part.Dest)
+		if err != nil {
+			return fmt.Errorf("opening part: %w", err)
+		}
+
+		_, err = io.Copy(out, in)
+		in.Close()
+
+		if err != nil {
+			return fmt.Errorf("joining %s: %w", part.Dest, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadParts(t *testing.T) {
+	parts := []string{"first part, ", "second part, ", "third part"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i, part := range parts {
+			if r.URL.Path == config.PartDest("/data.zip", i) {
+				http.ServeContent(w, r, "part", time.Time{}, bytes.NewReader([]byte(part)))
+
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	filesParts := make([]config.FilePart, 0, len(parts))
+
+	for i, part := range parts {
+		filesParts = append(filesParts, config.FilePart{URL: server.URL + config.PartDest("/data.zip", i), SHA256: sha256Hex(part)})
+	}
+
+	tests := []struct {
+		name        string
+		sha256      string
+		wantErr     error
+		wantJoined  bool
+		wantPartsOn bool
+	}{
+		{name: "joined", sha256: sha256Hex(strings.Join(parts, "")), wantJoined: true},
+		{name: "whole-file mismatch", sha256: strings.Repeat("a", 64), wantErr: errChecksumMismatch, wantPartsOn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "data.zip")
+
+			cfg := &config.Config{
+				Settings: config.Settings{Parallel: 1, Retries: 1, MetadataRetries: 1, ProgressMode: config.ProgressModeCI},
+				Files:    []config.FileEntry{{Dest: dest, SHA256: tt.sha256, Parts: filesParts}},
+			}
+
+			results := NewDownloader(cfg, nil).Download(context.Background())
+			if !errors.Is(results[0].Error, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, results[0].Error)
+			}
+
+			content, err := os.ReadFile(dest)
+			if tt.wantJoined && (err != nil || string(content) != strings.Join(parts, "")) {
+				t.Errorf("expected the joined parts in dest, got %q, %v", content, err)
+			}
+
+			if !tt.wantJoined && err == nil {
+				t.Error("expected no dest")
+			}
+
+			for i := range parts {
+				_, err := os.Stat(config.PartDest(dest, i))
+				if got := err == nil; got != tt.wantPartsOn {
+					t.Errorf("part %d: expected kept %t, got %t", i+1, tt.wantPartsOn, got)
+				}
+			}
+		})
+	}
+}
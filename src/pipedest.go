@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vbauerster/mpb/v8"
+
+	"xget/src/config"
+)
+
+// errSpecialDest is returned for dests that are neither regular files nor
+// named pipes, such as device nodes and sockets.
+var errSpecialDest = errors.New("unsupported special file")
+
+// isPipeDest reports whether dest is an existing named pipe. Other special
+// files are refused: they can neither be renamed over nor streamed to
+// safely. Missing dests, regular files and directories are left to the
+// normal download path.
+func isPipeDest(dest string) (bool, error) {
+	info, err := os.Stat(dest)
+	if err != nil {
+		return false, nil //nolint:nilerr // missing dests are created by the download.
+	}
+
+	mode := info.Mode()
+
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return true, nil
+	case mode.IsRegular() || mode.IsDir():
+		return false, nil
+	default:
+		return false, fmt.Errorf("destination %s: %w (%s)", dest, errSpecialDest, mode.Type())
+	}
+}
+
+// streamToPipe downloads file straight into the named pipe at its dest, for
+// pipe-based assembly lines. There is no partial to resume, rename or
+// re-read, so the checksum is computed while streaming and a mismatch is
+// only reported after the reader has consumed the data. For the same reason
+// the download is attempted once and bypasses the cache. Opening the pipe
+// waits until a reader opens the other end, or ctx is done.
+func (downloader *Downloader) streamToPipe(ctx context.Context, file config.FileEntry, progress *mpb.Progress) error {
+	switch {
+	case len(file.Parts) > 0:
+		return fmt.Errorf("destination %s is a named pipe, which entries with parts cannot be streamed to", file.Dest)
+	case file.Range != "":
+		return fmt.Errorf("destination %s is a named pipe, which entries with a range cannot be streamed to", file.Dest)
+	case downloader.offline:
+		return fmt.Errorf("%w, and -offline forbids streaming it to named pipe %s", errNotCached, file.Dest)
+	}
+
+	source, err := downloader.newSource(file)
+	if err != nil {
+		return err
+	}
+
+	source = downloader.limitSource(file.URL, source)
+
+	pipe, err := openPipe(ctx, file.Dest)
+	if err != nil {
+		return fmt.Errorf("opening named pipe: %w", err)
+	}
+
+	defer pipe.Close()
+
+	verifier := newChecksumVerifier(file)
+	dest := struct {
+		io.Writer
+		io.Closer
+	}{io.MultiWriter(pipe, verifier), pipe}
+
+	err = downloader.performDownload(ctx, source, dest, file, 0, progress, nil)
+	if err != nil {
+		return err
+	}
+
+	if !verifier.matches() {
+		return fmt.Errorf("%w for %s (already streamed to the pipe)", errChecksumMismatch, file.Dest)
+	}
+
+	fmt.Printf("streamed %s into named pipe\n", file.Dest)
+
+	return nil
+}
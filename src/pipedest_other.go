@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// openPipe opens the named pipe at path for writing. Named pipes cannot be
+// created here, so there is no reader to wait for.
+func openPipe(_ context.Context, path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY, 0)
+}
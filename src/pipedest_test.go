@@ -0,0 +1,131 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestIsPipeDest(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "fifo")
+
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	regular := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(regular, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dest := range []string{regular, dir, filepath.Join(dir, "missing.bin")} {
+		if pipe, err := isPipeDest(dest); pipe || err != nil {
+			t.Errorf("%s: expected a normal dest, got %v, %v", dest, pipe, err)
+		}
+	}
+
+	if pipe, err := isPipeDest(fifo); !pipe || err != nil {
+		t.Errorf("expected the fifo to be a pipe dest, got %v, %v", pipe, err)
+	}
+
+	if _, err := isPipeDest(os.DevNull); !errors.Is(err, errSpecialDest) {
+		t.Errorf("expected errSpecialDest for %s, got %v", os.DevNull, err)
+	}
+}
+
+func TestDownloadToNamedPipe(t *testing.T) {
+	content := []byte("streamed through a pipe")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		sha256  string
+		wantErr error
+	}{
+		{"checksum matches", sha256Hex(string(content)), nil},
+		{"checksum mismatch", sha256Hex("other"), errChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fifo := filepath.Join(t.TempDir(), "fifo")
+			if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			received := make(chan []byte, 1)
+
+			go func() {
+				reader, err := os.Open(fifo)
+				if err != nil {
+					received <- nil
+
+					return
+				}
+
+				defer reader.Close()
+
+				data, _ := io.ReadAll(reader)
+				received <- data
+			}()
+
+			cfg := &config.Config{
+				Settings: config.Settings{
+					Parallel:        1,
+					Retries:         3,
+					MetadataRetries: 1,
+					HTTPVersion:     config.HTTPVersion1,
+					ProgressMode:    config.ProgressModeCI,
+				},
+				Files: []config.FileEntry{{URL: server.URL + "/file.bin", Dest: fifo, SHA256: tt.sha256}},
+			}
+
+			results := NewDownloader(cfg, nil).Download(context.Background())
+			if !errors.Is(results[0].Error, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, results[0].Error)
+			}
+
+			if data := <-received; !bytes.Equal(data, content) {
+				t.Errorf("expected the reader to get %q, got %q", content, data)
+			}
+
+			if _, err := os.Stat(fifo + ".partial"); !os.IsNotExist(err) {
+				t.Errorf("expected no partial next to the pipe, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenPipeWithoutReaderHonoursContext(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "fifo")
+
+	err := syscall.Mkfifo(fifo, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	_, err = openPipe(ctx, fifo)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the open to end with the context, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// pipeOpenInterval is how often opening a named pipe without a reader is
+// tried again.
+const pipeOpenInterval = 100 * time.Millisecond
+
+// openPipe opens the named pipe at path for writing once a reader has opened
+// its other end. A blocking open would wait for the reader beyond ctx, so the
+// pipe is opened non-blocking, which fails with ENXIO while there is no
+// reader, and tried again until ctx is done. Writes block again once open.
+func openPipe(ctx context.Context, path string) (*os.File, error) {
+	for {
+		pipe, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			err = syscall.SetNonblock(int(pipe.Fd()), false)
+			if err != nil {
+				pipe.Close()
+
+				return nil, fmt.Errorf("clearing O_NONBLOCK: %w", err)
+			}
+
+			return pipe, nil
+		}
+
+		if !errors.Is(err, syscall.ENXIO) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for a reader: %w", ctx.Err())
+		case <-time.After(pipeOpenInterval):
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// preflightTargets returns the entries whose sources the preflight checks:
+// every file, and every part of a split file. Stdin and data: urls have no
+// source to check, and prefixes are listed at the start of the download anyway.
+func preflightTargets(files []config.FileEntry) []config.FileEntry {
+	var targets []config.FileEntry
+
+	for _, file := range files {
+		switch {
+		case file.URL == config.StdinURL || config.IsDataURL(file.URL) || config.IsPrefixURL(file.URL):
+			continue
+		case len(file.Parts) > 0:
+			targets = append(targets, partEntries(file)...)
+		default:
+			targets = append(targets, file)
+		}
+	}
+
+	return targets
+}
+
+// Preflight implements settings.preflight: before anything is downloaded,
+// the source of every file is checked with a HEAD request, or HeadObject for
+// s3:// urls, settings.parallel at a time. It returns one error per source
+// that is unreachable, missing or refused, in config order. Sources not
+// checked because ctx was cancelled are not reported.
+func (downloader *Downloader) Preflight(ctx context.Context) []error {
+	targets := preflightTargets(downloader.cfg.Files)
+	problems := make([]error, len(targets))
+	slots := make(chan struct{}, max(downloader.cfg.Settings.Parallel, 1))
+
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		wg.Go(func() {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			defer func() { <-slots }()
+
+			err := downloader.preflightSource(ctx, target)
+			if err != nil && ctx.Err() == nil {
+				problems[i] = fmt.Errorf("%s (%s): %w", redactURL(target.URL), target.Dest, err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	var found []error
+
+	for _, problem := range problems {
+		if problem != nil {
+			found = append(found, problem)
+		}
+	}
+
+	return found
+}
+
+// preflightSource checks the source of file, following fallback_alias when
+// the credentials of an s3:// alias are rejected, as the download would.
+func (downloader *Downloader) preflightSource(ctx context.Context, file config.FileEntry) error {
+	err := downloader.checkSource(ctx, file)
+
+	for err != nil && storage.IsAuthError(err) {
+		fallbackURL, ok := downloader.cfg.FallbackURL(file.URL)
+		if !ok {
+			break
+		}
+
+		file.URL = fallbackURL
+		err = downloader.checkSource(ctx, file)
+	}
+
+	return err
+}
+
+// checkSource sends one metadata request for file. Any HTTP status below
+// 400 counts as reachable, as does 405 from servers that refuse HEAD.
+func (downloader *Downloader) checkSource(ctx context.Context, file config.FileEntry) error {
+	source, err := downloader.newSource(file)
+	if err != nil {
+		return err
+	}
+
+	switch source := source.(type) {
+	case *storage.S3Source:
+		exists, err := retryMetadata(ctx, downloader.cfg.Settings, func() (bool, error) {
+			return source.Exists(ctx)
+		})
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return fmt.Errorf("object not found")
+		}
+	case *storage.HTTPSource:
+		status, err := retryMetadata(ctx, downloader.cfg.Settings, func() (int, error) {
+			return source.Probe(ctx)
+		})
+		if err != nil {
+			return err
+		}
+
+		if status >= http.StatusBadRequest && status != http.StatusMethodNotAllowed {
+			return fmt.Errorf("HTTP %d", status)
+		}
+	}
+
+	return nil
+}
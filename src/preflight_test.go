@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestPreflight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok.bin", "/data.zip.001":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head.bin":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Settings: config.Settings{Parallel: 2, MetadataRetries: 1},
+		Files: []config.FileEntry{
+			{URL: server.URL + "/ok.bin", Dest: "/tmp/ok.bin"},
+			{URL: server.URL + "/missing.bin", Dest: "/tmp/missing.bin"},
+			{URL: server.URL + "/no-head.bin", Dest: "/tmp/no-head.bin"},
+			{URL: config.StdinURL, Dest: "/tmp/stdin.bin"},
+			{Dest: "/tmp/data.zip", Parts: []config.FilePart{
+				{URL: server.URL + "/data.zip.001"},
+				{URL: server.URL + "/data.zip.002"},
+			}},
+		},
+	}
+
+	problems := NewDownloader(cfg, nil).Preflight(context.Background())
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", problems)
+	}
+
+	for i, want := range []string{"/missing.bin (/tmp/missing.bin): HTTP 404", "/data.zip.002 (/tmp/data.zip.part002): HTTP 404"} {
+		if !strings.Contains(problems[i].Error(), want) {
+			t.Errorf("problem %d: expected %q, got %q", i, want, problems[i])
+		}
+	}
+}
+
+func TestPreflightCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cfg := &config.Config{
+		Settings: config.Settings{Parallel: 1, MetadataRetries: 1},
+		Files:    []config.FileEntry{{URL: "http://127.0.0.1:1/file.bin", Dest: "/tmp/file.bin"}},
+	}
+
+	if problems := NewDownloader(cfg, nil).Preflight(ctx); len(problems) != 0 {
+		t.Errorf("expected no problems after cancellation, got %v", problems)
+	}
+}
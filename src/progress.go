@@ -3,6 +3,8 @@ package main
 import (
 	"time"
 
+	"xget/src/segment"
+
 	"github.com/vbauerster/mpb/v8"
 	"github.com/vbauerster/mpb/v8/decor"
 )
@@ -12,29 +14,76 @@ type ProgressWriter struct {
 	bar      *mpb.Bar
 	lastTime time.Time
 	started  bool
+	tap      segment.ProgressTap
+	total    int64
+	counted  int64
+	finished bool
 }
 
 // NewProgressWriter adds a new progress bar to the given mpb container and returns
-// a ProgressWriter that updates it as data is written.
-func NewProgressWriter(container *mpb.Progress, total int64, description string) *ProgressWriter {
-	bar := container.AddBar(total,
-		mpb.PrependDecorators(
-			decor.Name(description, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
-		),
+// a ProgressWriter that updates it as data is written. A total of zero or less
+// means the size is unknown, e.g. for chunked HTTP responses or stdin; such
+// downloads get a spinner showing the bytes so far and the speed. Speed and
+// ETA are moving averages over settings.progress_smoothing samples, see
+// segment.SmoothingAge.
+func NewProgressWriter(container *mpb.Progress, total int64, description string, smoothing int) *ProgressWriter {
+	age := segment.SmoothingAge(smoothing)
+
+	name := mpb.PrependDecorators(
+		decor.Name(description, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
+	)
+
+	if total <= 0 {
+		bar := container.New(0, mpb.SpinnerStyle(), name,
+			mpb.AppendDecorators(
+				decor.CurrentKibiByte("% .2f"),
+				decor.Name(" "),
+				decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", age),
+			),
+		)
+
+		return &ProgressWriter{bar: bar, total: -1}
+	}
+
+	bar := container.AddBar(total, name,
 		mpb.AppendDecorators(
 			decor.CountersKibiByte("% .2f / % .2f"),
 			decor.Name(" "),
-			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 30),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", age),
 			decor.Name(" ETA:"),
-			decor.EwmaETA(decor.ET_STYLE_GO, 30),
+			decor.EwmaETA(decor.ET_STYLE_GO, age),
 		),
 	)
 
 	return &ProgressWriter{
-		bar: bar,
+		bar:   bar,
+		total: total,
+	}
+}
+
+// SetTap mirrors the bar's byte counts to tap. Bars of unknown size add no
+// total, only the bytes written.
+func (progressWriter *ProgressWriter) SetTap(tap segment.ProgressTap) {
+	if tap == nil {
+		return
+	}
+
+	progressWriter.tap = tap
+
+	if progressWriter.total > 0 {
+		progressWriter.tap.AddTotal(progressWriter.total)
 	}
 }
 
+func (progressWriter *ProgressWriter) countDone(done int64) {
+	if progressWriter.tap == nil {
+		return
+	}
+
+	progressWriter.counted += done
+	progressWriter.tap.AddDone(done)
+}
+
 // Write implements io.Writer and updates the progress bar.
 // Elapsed time is measured between successive Write calls, which reflects
 // the real network read rate from the upstream io.Copy.
@@ -42,6 +91,8 @@ func NewProgressWriter(container *mpb.Progress, total int64, description string)
 func (progressWriter *ProgressWriter) Write(data []byte) (int, error) {
 	now := time.Now()
 
+	progressWriter.countDone(int64(len(data)))
+
 	if !progressWriter.started {
 		progressWriter.started = true
 		progressWriter.lastTime = now
@@ -60,18 +111,39 @@ func (progressWriter *ProgressWriter) Write(data []byte) (int, error) {
 }
 
 // SetCurrent sets the current progress value (useful for resume).
+// It must be called before any Write.
 func (progressWriter *ProgressWriter) SetCurrent(current int64) {
+	progressWriter.countDone(current)
 	progressWriter.bar.SetCurrent(current)
 }
 
-// Finish marks the bar as complete.
+// Finish marks the bar as complete. For a bar of unknown size, the bytes
+// written become its total.
 func (progressWriter *ProgressWriter) Finish() {
+	progressWriter.finished = true
 	progressWriter.bar.SetTotal(-1, true)
 }
 
+// Remove marks the bar as complete and takes it off the display, for bars
+// that only matter while they run, such as the per-file bars of generate.
+func (progressWriter *ProgressWriter) Remove() {
+	progressWriter.finished = true
+	progressWriter.bar.Abort(true)
+}
+
 // Abort terminates the bar so the mpb container's Wait does not block on an
 // incomplete bar after a download error. It is a no-op once the bar has
 // completed, so it is safe to defer right after creation.
 func (progressWriter *ProgressWriter) Abort() {
+	if progressWriter.tap != nil && !progressWriter.finished {
+		progressWriter.tap.AddDone(-progressWriter.counted)
+
+		if progressWriter.total > 0 {
+			progressWriter.tap.AddTotal(-progressWriter.total)
+		}
+
+		progressWriter.tap = nil
+	}
+
 	progressWriter.bar.Abort(true)
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"xget/src/config"
+
+	"github.com/vbauerster/mpb/v8"
+)
+
+func TestProgressWriterUnknownTotal(t *testing.T) {
+	container := mpb.New(mpb.WithOutput(io.Discard))
+	writer := NewProgressWriter(container, -1, "chunked.bin", 0)
+
+	var out bytes.Buffer
+
+	stream := newProgressStream(nopWriteCloser{&out})
+	downloader := &Downloader{events: stream, ci: newCIProgress(io.Discard)}
+	writer.SetTap(downloader.progressTap(config.FileEntry{Dest: "chunked.bin"}, -1))
+
+	for range 3 {
+		_, err := writer.Write(make([]byte, 1024))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got := writer.bar.Current()
+	if got != 3072 {
+		t.Errorf("expected 3072 bytes counted, got %d", got)
+	}
+
+	if downloader.ci.total.Load() != 0 || downloader.ci.done.Load() != 0 {
+		t.Errorf("expected a bar of unknown size not to count towards the ci percentage, got %d/%d",
+			downloader.ci.done.Load(), downloader.ci.total.Load())
+	}
+
+	events := readProgressEvents(t, out.Bytes())
+	if len(events) != 1 || events[0].Bytes != 1024 || events[0].Total != 0 {
+		t.Errorf("expected a progress event without a total, got %+v", events)
+	}
+
+	writer.Finish()
+
+	// Wait returns only once every bar has completed.
+	done := make(chan struct{})
+
+	go func() {
+		container.Wait()
+		close(done)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("expected Finish to complete the bar of unknown size")
+	}
+
+	if !writer.bar.Completed() {
+		t.Error("expected the bar to be completed")
+	}
+}
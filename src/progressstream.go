@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xget/src/config"
+	"xget/src/segment"
+)
+
+// progressEventInterval is the minimum time between two progress events of
+// the same file, so a fast download does not flood the consumer.
+const progressEventInterval = 500 * time.Millisecond
+
+// Progress event types written to settings.progress_fd.
+const (
+	progressEventProgress = "progress"
+	progressEventDone     = "done"
+	progressEventFailed   = "failed"
+	progressEventDeferred = "deferred"
+)
+
+// progressEvent is one line of the settings.progress_fd stream.
+type progressEvent struct {
+	Event string  `json:"event"`
+	URL   string  `json:"url"`
+	Dest  string  `json:"dest"`
+	Bytes int64   `json:"bytes"`
+	Total int64   `json:"total"`
+	Speed float64 `json:"speed"`
+	Error string  `json:"error,omitempty"`
+}
+
+// progressStream writes newline-delimited JSON progress events for GUI
+// wrappers, separately from the human-readable output on stdout and stderr.
+type progressStream struct {
+	mu      sync.Mutex
+	out     io.WriteCloser
+	encoder *json.Encoder
+	failed  bool
+}
+
+// openProgressStream opens settings.progress_fd: a number is taken as an
+// inherited file descriptor, anything else as the path of a file or named
+// pipe. Opening a named pipe blocks until the consumer opens it for reading.
+func openProgressStream(target string) (*progressStream, error) {
+	var out io.WriteCloser
+
+	fd, err := strconv.Atoi(target)
+	if err == nil {
+		out = os.NewFile(uintptr(fd), "progress_fd")
+	} else {
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644) //nolint:gosec // path is from the config
+		if err != nil {
+			return nil, fmt.Errorf("opening progress_fd: %w", err)
+		}
+
+		out = file
+	}
+
+	return newProgressStream(out), nil
+}
+
+func newProgressStream(out io.WriteCloser) *progressStream {
+	return &progressStream{out: out, encoder: json.NewEncoder(out)}
+}
+
+// emit writes one event. After a write error, e.g. because the consumer
+// went away, further events are dropped rather than failing the downloads.
+func (stream *progressStream) emit(event progressEvent) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.failed {
+		return
+	}
+
+	err := stream.encoder.Encode(event)
+	if err != nil {
+		stream.failed = true
+	}
+}
+
+// tap returns a progress tap reporting the byte counts of file.
+func (stream *progressStream) tap(file config.FileEntry) *fileProgressTap {
+	return &fileProgressTap{stream: stream, file: file, start: time.Now()}
+}
+
+// finish writes the final event of file.
+func (stream *progressStream) finish(result DownloadResult) {
+	event := progressEvent{
+		Event: progressEventDone,
+		URL:   redactURL(result.File.URL),
+		Dest:  result.File.Dest,
+		Bytes: result.Size,
+		Total: result.Size,
+	}
+
+	if result.Timings.Total > 0 {
+		event.Speed = float64(result.Size) / result.Timings.Total.Seconds()
+	}
+
+	if result.Deferred {
+		event.Event = progressEventDeferred
+		event.Bytes = 0
+		event.Total = 0
+	}
+
+	if result.Error != nil {
+		event.Event = progressEventFailed
+		event.Bytes = 0
+		event.Total = 0
+		event.Error = result.Error.Error()
+	}
+
+	stream.emit(event)
+}
+
+// Close closes the underlying file descriptor or pipe.
+func (stream *progressStream) Close() error {
+	return stream.out.Close()
+}
+
+// fileProgressTap implements segment.ProgressTap for one download attempt,
+// turning its byte counts into throttled progress events.
+type fileProgressTap struct {
+	stream *progressStream
+	file   config.FileEntry
+	start  time.Time
+	total  atomic.Int64
+	done   atomic.Int64
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// AddTotal implements segment.ProgressTap.
+func (tap *fileProgressTap) AddTotal(total int64) {
+	tap.total.Add(total)
+}
+
+// AddDone implements segment.ProgressTap.
+func (tap *fileProgressTap) AddDone(done int64) {
+	tap.done.Add(done)
+
+	now := time.Now()
+
+	tap.mu.Lock()
+
+	if now.Sub(tap.last) < progressEventInterval {
+		tap.mu.Unlock()
+
+		return
+	}
+
+	tap.last = now
+	tap.mu.Unlock()
+
+	bytes := tap.done.Load()
+
+	event := progressEvent{
+		Event: progressEventProgress,
+		URL:   redactURL(tap.file.URL),
+		Dest:  tap.file.Dest,
+		Bytes: bytes,
+		Total: tap.total.Load(),
+	}
+
+	elapsed := now.Sub(tap.start).Seconds()
+	if elapsed > 0 {
+		event.Speed = float64(bytes) / elapsed
+	}
+
+	tap.stream.emit(event)
+}
+
+// multiTap mirrors byte counts to several taps.
+type multiTap []segment.ProgressTap
+
+// AddTotal implements segment.ProgressTap.
+func (taps multiTap) AddTotal(total int64) {
+	for _, tap := range taps {
+		tap.AddTotal(total)
+	}
+}
+
+// AddDone implements segment.ProgressTap.
+func (taps multiTap) AddDone(done int64) {
+	for _, tap := range taps {
+		tap.AddDone(done)
+	}
+}
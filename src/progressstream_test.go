@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func readProgressEvents(t *testing.T, data []byte) []progressEvent {
+	t.Helper()
+
+	var events []progressEvent
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event progressEvent
+
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", scanner.Text(), err)
+		}
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestProgressStreamThrottlesEvents(t *testing.T) {
+	var out bytes.Buffer
+
+	stream := newProgressStream(nopWriteCloser{&out})
+	file := config.FileEntry{URL: "https://example.com/app.tar.gz", Dest: "/tmp/app.tar.gz"}
+
+	tap := stream.tap(file)
+	tap.AddTotal(300)
+
+	// Writes in quick succession produce a single event.
+	tap.AddDone(100)
+	tap.AddDone(100)
+	tap.AddDone(100)
+
+	stream.finish(DownloadResult{File: file, Size: 300, Timings: Timings{Total: time.Second}})
+	stream.finish(DownloadResult{File: file, Error: errors.New("checksum mismatch")})
+
+	events := readProgressEvents(t, out.Bytes())
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d: %+v", len(events), events)
+	}
+
+	progress := events[0]
+	if progress.Event != progressEventProgress || progress.Bytes != 100 || progress.Total != 300 || progress.Dest != file.Dest {
+		t.Errorf("unexpected progress event %+v", progress)
+	}
+
+	done := events[1]
+	if done.Event != progressEventDone || done.Bytes != 300 || done.Speed != 300 {
+		t.Errorf("unexpected done event %+v", done)
+	}
+
+	failed := events[2]
+	if failed.Event != progressEventFailed || failed.Error != "checksum mismatch" {
+		t.Errorf("unexpected failed event %+v", failed)
+	}
+}
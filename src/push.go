@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// pushUsage is the synopsis of the push command.
+const pushUsage = "push <config.yaml> <directory> [-alias name] [-dry-run]"
+
+// pushResult is the outcome of pushing one file: "uploaded", "unchanged" or,
+// with -dry-run, "would upload"; or an error.
+type pushResult struct {
+	url    string
+	status string
+	err    error
+}
+
+func runPush() int {
+	args, err := parsePushArgs(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], pushUsage)
+
+		return 1
+	}
+
+	cfg, err := config.LoadMultiple([]string{args.configPath})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+
+		return 1
+	}
+
+	aliasName, err := pushAlias(cfg, args.alias)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+		return 1
+	}
+
+	results, err := pushDirectory(context.Background(), cfg, aliasName, args.dirPath, args.dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+		return 1
+	}
+
+	if printPushResults(results, args.dirPath, aliasName, args.dryRun) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// pushAlias picks the alias to push to: the one named by -alias, else the
+// one alias the s3:// files of the config download from, else the only
+// alias of the config.
+func pushAlias(cfg *config.Config, name string) (string, error) {
+	if name != "" {
+		_, ok := cfg.GetAlias(name)
+		if !ok {
+			return "", fmt.Errorf("alias %q not found in aliases", name)
+		}
+
+		return name, nil
+	}
+
+	used := make(map[string]bool)
+
+	for _, file := range cfg.Files {
+		alias, ok := config.URLAlias(file.URL)
+		if ok {
+			used[alias] = true
+		}
+	}
+
+	if len(used) == 1 {
+		for alias := range used {
+			return alias, nil
+		}
+	}
+
+	if len(used) == 0 && len(cfg.Aliases) == 1 {
+		for alias := range cfg.Aliases {
+			return alias, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot tell which alias to push to, choose one with -alias")
+}
+
+// pushDirectory implements push: every file under dirPath is uploaded to
+// the key of its path relative to dirPath, below the prefix of the alias,
+// unless an object already holds it. An object holds the file when the
+// sha256 recorded in its metadata, as the cache records it, and its size
+// match; objects without a recorded sha256 are replaced. Files xget keeps
+// next to another file of the directory, such as its partial and sidecars,
+// are not pushed; a file that only looks like one is. Up to
+// settings.parallel files are pushed at once.
+func pushDirectory(
+	ctx context.Context,
+	cfg *config.Config,
+	aliasName, dirPath string,
+	dryRun bool,
+) ([]pushResult, error) {
+	alias, _ := cfg.GetAlias(aliasName)
+
+	dirPath = filepath.Clean(dirPath)
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("accessing directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("path is not a directory: %s", dirPath)
+	}
+
+	entries, warnings, err := walkDirectory(dirPath, generateOptions{
+		workers:    defaultGenerateWorkers,
+		bufferSize: defaultGenerateBufferSize,
+	})
+
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	walked := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		walked[entry.Dest] = true
+	}
+
+	var files []config.FileEntry
+
+	for _, entry := range entries {
+		if !isStateFile(entry.Dest, walked) {
+			files = append(files, entry)
+		}
+	}
+
+	results := make([]pushResult, len(files))
+	slots := make(chan struct{}, max(cfg.Settings.Parallel, 1))
+
+	var wg sync.WaitGroup
+
+	for i, file := range files {
+		key := filepath.ToSlash(file.Dest)
+		results[i].url = "s3://" + aliasName + "/" + key
+
+		slots <- struct{}{}
+
+		wg.Go(func() {
+			defer func() { <-slots }()
+
+			results[i].status, results[i].err = pushFile(ctx, cfg.Settings, alias, key,
+				filepath.Join(dirPath, file.Dest), file.SHA256, dryRun)
+		})
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
+
+// pushFile uploads the file at path with checksum sha256Hash to key of
+// alias, unless the object already holds it.
+func pushFile(
+	ctx context.Context,
+	settings config.Settings,
+	alias config.Alias,
+	key, path, sha256Hash string,
+	dryRun bool,
+) (string, error) {
+	source, err := storage.NewS3SourceFromAlias(ctx, alias, key)
+	if err != nil {
+		return "", fmt.Errorf("creating S3 source: %w", err)
+	}
+
+	held, err := objectHolds(ctx, settings, source, path, sha256Hash)
+	if err != nil {
+		return "", err
+	}
+
+	if held {
+		return "unchanged", nil
+	}
+
+	if dryRun {
+		return "would upload", nil
+	}
+
+	file, err := os.Open(path) //nolint:gosec // path is below the directory from the CLI argument
+	if err != nil {
+		return "", fmt.Errorf("opening file: %w", err)
+	}
+
+	defer file.Close()
+
+	err = uploadFile(ctx, settings, source, file, sha256Hash)
+	if err != nil {
+		return "", fmt.Errorf("uploading: %w", err)
+	}
+
+	return "uploaded", nil
+}
+
+// objectHolds reports whether the object of source exists with sha256Hash
+// recorded in its metadata and the size of the file at path.
+func objectHolds(
+	ctx context.Context,
+	settings config.Settings,
+	source *storage.S3Source,
+	path, sha256Hash string,
+) (bool, error) {
+	exists, err := retryMetadata(ctx, settings, func() (bool, error) {
+		return source.Exists(ctx)
+	})
+	if err != nil || !exists {
+		return false, err
+	}
+
+	metadata, err := retryMetadata(ctx, settings, func() (map[string]string, error) {
+		return source.GetMetadata(ctx)
+	})
+	if err != nil {
+		return false, fmt.Errorf("reading object metadata: %w", err)
+	}
+
+	if metadata[cacheHashMetadataKey] != sha256Hash {
+		return false, nil
+	}
+
+	size, err := retryMetadata(ctx, settings, func() (int64, error) {
+		return source.GetSize(ctx)
+	})
+	if err != nil {
+		return false, fmt.Errorf("reading object size: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("reading file size: %w", err)
+	}
+
+	return size == info.Size(), nil
+}
+
+// printPushResults prints the outcome of every pushed file, failures last,
+// and returns the failure count.
+func printPushResults(results []pushResult, dirPath, aliasName string, dryRun bool) int {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].err == nil && results[j].err != nil
+	})
+
+	counts := make(map[string]int)
+
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Printf("failed        %s: %v\n", result.url, result.err)
+			counts["failed"]++
+
+			continue
+		}
+
+		fmt.Printf("%-13s %s\n", result.status, result.url)
+		counts[result.status]++
+	}
+
+	if dryRun {
+		fmt.Printf("\ndry run: %d files would be uploaded to %s, %d unchanged, %d failed\n",
+			counts["would upload"], aliasName, counts["unchanged"], counts["failed"])
+
+		return counts["failed"]
+	}
+
+	fmt.Printf("\npushed %s to %s: %d uploaded, %d unchanged, %d failed\n",
+		dirPath, aliasName, counts["uploaded"], counts["unchanged"], counts["failed"])
+
+	return counts["failed"]
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"xget/src/config"
+)
+
+// fakeObject is an object of newPushBucket: its size and recorded sha256.
+type fakeObject struct {
+	size   int
+	sha256 string
+}
+
+// newPushBucket serves a path-style S3 bucket "artifacts" answering
+// HeadObject and PutObject from objects. puts records the uploaded keys.
+func newPushBucket(t *testing.T, objects map[string]fakeObject) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		puts []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/artifacts/")
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method == http.MethodPut {
+			_, _ = io.Copy(io.Discard, r.Body)
+
+			puts = append(puts, key)
+			objects[key] = fakeObject{sha256: r.Header.Get("X-Amz-Meta-Sha256")}
+
+			return
+		}
+
+		object, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if object.sha256 != "" {
+			w.Header().Set("X-Amz-Meta-Sha256", object.sha256)
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(object.size))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sorted := slices.Clone(puts)
+		slices.Sort(sorted)
+
+		return sorted
+	}
+}
+
+func TestPushDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	for path, content := range map[string]string{
+		"a.bin":             "unchanged",
+		"sub/b.bin":         "new",
+		"c.bin":             "changed",
+		"a.bin.partial":     "in progress",
+		"c.bin.sha256":      "sidecar",
+		"sub/b.bin.part001": "part",
+		"notes.sha256":      "no sibling",
+		"sub/.hidden-state": "kept",
+	} {
+		writeDiffFile(t, filepath.Join(dir, path), content)
+	}
+
+	objects := map[string]fakeObject{
+		"builds/a.bin": {size: len("unchanged"), sha256: sha256Hex("unchanged")},
+		"builds/c.bin": {size: len("changed"), sha256: sha256Hex("stale")},
+	}
+
+	server, puts := newPushBucket(t, objects)
+
+	cfg := &config.Config{
+		Aliases: map[string]config.Alias{
+			"store": {Endpoint: server.URL, Region: "us-east-1", Bucket: "artifacts", Prefix: "builds/", AccessKey: "key", SecretKey: "secret"},
+		},
+		Settings: config.Settings{Parallel: 2, MetadataRetries: 1},
+	}
+
+	results, err := pushDirectory(context.Background(), cfg, "store", dir, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(puts()) != 0 {
+		t.Errorf("expected a dry run not to upload, got %v", puts())
+	}
+
+	statuses := make(map[string]string)
+	for _, result := range results {
+		if result.err != nil {
+			t.Fatalf("%s: unexpected error: %v", result.url, result.err)
+		}
+
+		statuses[result.url] = result.status
+	}
+
+	want := map[string]string{
+		"s3://store/a.bin":             "unchanged",
+		"s3://store/c.bin":             "would upload",
+		"s3://store/notes.sha256":      "would upload",
+		"s3://store/sub/.hidden-state": "would upload",
+		"s3://store/sub/b.bin":         "would upload",
+	}
+	if len(statuses) != len(want) {
+		t.Errorf("expected %v, got %v", want, statuses)
+	}
+
+	for url, status := range want {
+		if statuses[url] != status {
+			t.Errorf("%s: expected %q, got %q", url, status, statuses[url])
+		}
+	}
+
+	_, err = pushDirectory(context.Background(), cfg, "store", dir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantPuts := []string{"builds/c.bin", "builds/notes.sha256", "builds/sub/.hidden-state", "builds/sub/b.bin"}
+	if !slices.Equal(puts(), wantPuts) {
+		t.Errorf("expected uploads %v, got %v", wantPuts, puts())
+	}
+
+	if objects["builds/sub/b.bin"].sha256 != sha256Hex("new") {
+		t.Errorf("expected the sha256 to be recorded, got %q", objects["builds/sub/b.bin"].sha256)
+	}
+}
+
+func TestPushAlias(t *testing.T) {
+	aliases := map[string]config.Alias{"store": {}, "backup": {}}
+
+	tests := []struct {
+		name    string
+		aliases map[string]config.Alias
+		files   []string
+		flag    string
+		want    string
+	}{
+		{name: "flag", aliases: aliases, flag: "backup", want: "backup"},
+		{name: "unknown flag", aliases: aliases, flag: "missing"},
+		{name: "alias of the files", aliases: aliases, files: []string{"s3://store/a", "https://example.com/b"}, want: "store"},
+		{name: "files of two aliases", aliases: aliases, files: []string{"s3://store/a", "s3://backup/b"}},
+		{name: "only alias", aliases: map[string]config.Alias{"store": {}}, want: "store"},
+		{name: "no files, two aliases", aliases: aliases},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Aliases: tt.aliases}
+			for _, url := range tt.files {
+				cfg.Files = append(cfg.Files, config.FileEntry{URL: url})
+			}
+
+			got, err := pushAlias(cfg, tt.flag)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("expected %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"xget/src/config"
+)
+
+// errRunFinished is returned by Enqueue when no Download is running, or the
+// running one has already finished all of its files.
+var errRunFinished = errors.New("no download run in progress")
+
+// downloadQueue holds the files of a running Download. Files may be added
+// until every queued file has finished; the run then ends and later
+// additions are refused.
+type downloadQueue struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+
+	// files lists every file of the run, indexed like its results.
+	files []config.FileEntry
+	dests map[string]bool
+
+	// next is the index of the first file not yet handed out by take, and
+	// active counts the files handed out that have not finished.
+	next   int
+	active int
+	closed bool
+}
+
+func newDownloadQueue(files []config.FileEntry) *downloadQueue {
+	queue := &downloadQueue{
+		files: slices.Clip(files),
+		dests: make(map[string]bool, len(files)),
+	}
+	queue.changed = sync.NewCond(&queue.mu)
+
+	for _, file := range files {
+		queue.dests[file.Dest] = true
+	}
+
+	return queue
+}
+
+// take blocks until files are waiting or every file handed out has
+// finished. It returns the waiting files with the index of the first one,
+// or false once the queue is drained and closed.
+func (queue *downloadQueue) take() (int, []config.FileEntry, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	for queue.next == len(queue.files) && queue.active > 0 {
+		queue.changed.Wait()
+	}
+
+	if queue.next == len(queue.files) {
+		queue.closed = true
+
+		return 0, nil, false
+	}
+
+	start := queue.next
+	files := queue.files[start:len(queue.files):len(queue.files)]
+
+	queue.next = len(queue.files)
+	queue.active += len(files)
+
+	return start, files, true
+}
+
+// finished records that a file handed out by take is done.
+func (queue *downloadQueue) finished() {
+	queue.mu.Lock()
+	queue.active--
+	queue.mu.Unlock()
+
+	queue.changed.Broadcast()
+}
+
+// add queues the files whose dest is not yet part of the run and returns
+// them. Prefix entries are skipped, as they are expanded only at the start
+// of a run. prepare is called with the new files before any worker can take
+// them.
+func (queue *downloadQueue) add(
+	files []config.FileEntry,
+	prepare func([]config.FileEntry),
+) ([]config.FileEntry, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if queue.closed {
+		return nil, errRunFinished
+	}
+
+	var added []config.FileEntry
+
+	for _, file := range files {
+		if queue.dests[file.Dest] || config.IsPrefixURL(file.URL) {
+			continue
+		}
+
+		queue.dests[file.Dest] = true
+		added = append(added, file)
+	}
+
+	if len(added) > 0 {
+		prepare(added)
+
+		queue.files = append(queue.files, added...)
+		queue.changed.Broadcast()
+	}
+
+	return added, nil
+}
+
+// Enqueue adds the files whose dest is not yet part of the running Download
+// to it, without touching the downloads in flight, and returns the number
+// added. Entries already in the run, including changed ones, are left
+// alone. The files use the aliases and settings the run started with.
+func (downloader *Downloader) Enqueue(files []config.FileEntry) (int, error) {
+	queue := downloader.queue.Load()
+	if queue == nil {
+		return 0, errRunFinished
+	}
+
+	added, err := queue.add(files, downloader.initChecksums)
+
+	return len(added), err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestDownloadQueue(t *testing.T) {
+	queue := newDownloadQueue([]config.FileEntry{{Dest: "a.bin"}})
+
+	start, files, ok := queue.take()
+	if !ok || start != 0 || len(files) != 1 {
+		t.Fatalf("expected the initial file, got %d %v %v", start, files, ok)
+	}
+
+	added, err := queue.add([]config.FileEntry{
+		{Dest: "a.bin"},
+		{Dest: "b.bin"},
+		{URL: "s3://alias/prefix/", Dest: "mirror"},
+	}, func([]config.FileEntry) {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(added) != 1 || added[0].Dest != "b.bin" {
+		t.Fatalf("expected only b.bin to be added, got %v", added)
+	}
+
+	start, files, ok = queue.take()
+	if !ok || start != 1 || len(files) != 1 || files[0].Dest != "b.bin" {
+		t.Fatalf("expected b.bin at index 1, got %d %v %v", start, files, ok)
+	}
+
+	queue.finished()
+	queue.finished()
+
+	if _, _, ok := queue.take(); ok {
+		t.Fatal("expected the drained queue to close")
+	}
+
+	if _, err := queue.add([]config.FileEntry{{Dest: "c.bin"}}, func([]config.FileEntry) {}); !errors.Is(err, errRunFinished) {
+		t.Errorf("expected errRunFinished after close, got %v", err)
+	}
+}
+
+func TestDownloadEnqueue(t *testing.T) {
+	content := []byte("enqueued content")
+	requested := make(chan struct{})
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.bin" {
+			close(requested)
+			<-release
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	sum := sha256Hex(string(content))
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel:        2,
+			Retries:         1,
+			MetadataRetries: 1,
+			HTTPVersion:     config.HTTPVersion1,
+			ProgressMode:    config.ProgressModeCI,
+		},
+		Files: []config.FileEntry{
+			{URL: server.URL + "/slow.bin", Dest: filepath.Join(dir, "slow.bin"), SHA256: sum},
+		},
+	}
+
+	downloader := NewDownloader(cfg, nil)
+
+	go func() {
+		<-requested
+
+		added, err := downloader.Enqueue([]config.FileEntry{
+			cfg.Files[0],
+			{URL: server.URL + "/fast.bin", Dest: filepath.Join(dir, "fast.bin"), SHA256: sum},
+		})
+		if err != nil || added != 1 {
+			t.Errorf("expected one entry to be enqueued, got %d, %v", added, err)
+		}
+
+		close(release)
+	}()
+
+	results := downloader.Download(context.Background())
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("%s: unexpected error: %v", result.File.Dest, result.Error)
+		}
+	}
+
+	if results[1].File.Dest != filepath.Join(dir, "fast.bin") {
+		t.Errorf("expected the enqueued file last, got %s", results[1].File.Dest)
+	}
+
+	if _, err := downloader.Enqueue(cfg.Files); !errors.Is(err, errRunFinished) {
+		t.Errorf("expected errRunFinished after the run, got %v", err)
+	}
+}
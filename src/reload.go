@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadOnHangup reloads the configs on every SIGHUP while the run lasts and
+// adds their new entries to downloader, for -reload-on-hup. The returned
+// function stops handling the signal.
+func reloadOnHangup(ctx context.Context, downloader *Downloader, opts runOptions) func() {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupCh:
+				reloadEntries(downloader, opts)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		signal.Stop(hupCh)
+	}
+}
+
+// reloadEntries loads and merges the configs again and enqueues the entries
+// whose dest is not yet part of the run.
+func reloadEntries(downloader *Downloader, opts runOptions) {
+	cfg, err := loadRunConfig(opts)
+	if err != nil {
+		// The run goes on with the entries it has.
+		fmt.Fprintf(os.Stderr, "Error reloading config: %v\n", err)
+
+		return
+	}
+
+	opts.apply(cfg)
+
+	err = cfg.ApplyDestDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reloading config: %v\n", err)
+
+		return
+	}
+
+	added, err := downloader.Enqueue(cfg.Files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reload ignored: %v\n", err)
+
+		return
+	}
+
+	fmt.Printf("Config reloaded: %d new entries queued\n", added)
+}
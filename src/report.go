@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vbauerster/mpb/v8/decor"
+	"gopkg.in/yaml.v3"
+
+	"xget/src/config"
+)
+
+// Result orderings accepted by the -sort flag.
+const (
+	sortByStatus   = "status"
+	sortByName     = "name"
+	sortBySize     = "size"
+	sortByDuration = "duration"
+)
+
+// resultSortKeys lists the valid -sort values.
+var resultSortKeys = []string{sortByStatus, sortByName, sortBySize, sortByDuration}
+
+// resultReport is the JSON representation of a DownloadResult.
+type resultReport struct {
+	URL       string `json:"url"`
+	Dest      string `json:"dest"`
+	SHA256    string `json:"sha256"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	ConnectMs int64  `json:"connect_ms"`
+	TTFBMs    int64  `json:"ttfb_ms"`
+	TotalMs   int64  `json:"total_ms"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// newResultReport converts a DownloadResult for JSON output, redacting any
+// userinfo embedded in the URL.
+func newResultReport(result DownloadResult) resultReport {
+	report := resultReport{
+		URL:       redactURL(result.File.URL),
+		Dest:      result.File.Dest,
+		SHA256:    result.File.SHA256,
+		Status:    "ok",
+		ConnectMs: result.Timings.Connect.Milliseconds(),
+		TTFBMs:    result.Timings.TTFB.Milliseconds(),
+		TotalMs:   result.Timings.Total.Milliseconds(),
+		Metadata:  result.File.Metadata,
+	}
+
+	if result.Deferred {
+		report.Status = "deferred"
+	}
+
+	if result.Error != nil {
+		report.Status = "failed"
+		report.Error = result.Error.Error()
+	}
+
+	return report
+}
+
+// writeJSONReport writes the results as a JSON array to path, in config order.
+func writeJSONReport(path string, results []DownloadResult) error {
+	reports := make([]resultReport, 0, len(results))
+	for _, result := range results {
+		reports = append(reports, newResultReport(result))
+	}
+
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling results: %w", err)
+	}
+
+	err = os.WriteFile(path, append(data, '\n'), 0o600) //nolint:gosec // path is from CLI argument
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeFailureReport implements settings.failure_report: it writes the
+// failed entries as a config with only a files section, for -retry-from. When
+// nothing failed, a report left by an earlier run is removed, so a retry job
+// does not download stale failures again.
+func writeFailureReport(path string, failed []config.FileEntry) error {
+	if len(failed) == 0 {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s: %w", path, err)
+		}
+
+		return nil
+	}
+
+	// Absolute dests keep the report independent of the working directory
+	// and of dest_dir, which has already been applied.
+	files := make([]config.FileEntry, len(failed))
+
+	for i, file := range failed {
+		files[i] = file
+
+		dest, err := filepath.Abs(file.Dest)
+		if err == nil {
+			files[i].Dest = dest
+		}
+	}
+
+	data, err := yaml.Marshal(GenerateOutput{Files: files})
+	if err != nil {
+		return fmt.Errorf("marshaling failures: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0o600) //nolint:gosec // path is from the config
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// printNotCached lists the files that -offline could not restore, so the
+// cache can be filled with exactly those before the next disconnected run.
+func printNotCached(results []DownloadResult) {
+	var missing []DownloadResult
+
+	for _, result := range results {
+		if errors.Is(result.Error, errNotCached) {
+			missing = append(missing, result)
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%d files are not in the cache:\n", len(missing))
+
+	for _, result := range missing {
+		fmt.Fprintf(os.Stderr, "  %s (%s)\n", result.File.Dest, redactURL(result.File.URL))
+	}
+}
+
+// printTimings prints a per-file timing table, slowest files first.
+// Files that never reached the source (skipped or cached) show "-" for
+// connect and time-to-first-byte.
+func printTimings(results []DownloadResult) {
+	sorted := make([]DownloadResult, len(results))
+	copy(sorted, results)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timings.Total > sorted[j].Timings.Total
+	})
+
+	fmt.Println("\ntimings:")
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "  DEST\tCONNECT\tTTFB\tTOTAL")
+
+	for _, result := range sorted {
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\n",
+			result.File.Dest,
+			formatTiming(result.Timings.Connect),
+			formatTiming(result.Timings.TTFB),
+			formatTiming(result.Timings.Total),
+		)
+	}
+
+	table.Flush()
+}
+
+// formatTiming renders a duration rounded to milliseconds, or "-" when unset.
+func formatTiming(duration time.Duration) string {
+	if duration == 0 {
+		return "-"
+	}
+
+	return duration.Round(time.Millisecond).String()
+}
+
+// sortResults returns a copy of results ordered by key: failures first for
+// status, dest path for name, and largest or slowest first for size and
+// duration. Ties keep config order.
+func sortResults(results []DownloadResult, key string) []DownloadResult {
+	sorted := make([]DownloadResult, len(results))
+	copy(sorted, results)
+
+	less := map[string]func(a, b DownloadResult) bool{
+		sortByStatus:   func(a, b DownloadResult) bool { return a.Error != nil && b.Error == nil },
+		sortByName:     func(a, b DownloadResult) bool { return a.File.Dest < b.File.Dest },
+		sortBySize:     func(a, b DownloadResult) bool { return a.Size > b.Size },
+		sortByDuration: func(a, b DownloadResult) bool { return a.Timings.Total > b.Timings.Total },
+	}[key]
+
+	if less != nil {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return less(sorted[i], sorted[j])
+		})
+	}
+
+	return sorted
+}
+
+// printResults prints a per-file status table in the given order.
+func printResults(results []DownloadResult) {
+	fmt.Println("\nresults:")
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "  STATUS\tDEST\tSIZE\tDURATION")
+
+	for _, result := range results {
+		status := "ok"
+		if result.Deferred {
+			status = "deferred"
+		}
+
+		if result.Error != nil {
+			status = "failed"
+		}
+
+		size := "-"
+		if status == "ok" {
+			size = fmt.Sprintf("% .1f", decor.SizeB1024(result.Size))
+		}
+
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\n", status, result.File.Dest, size, formatTiming(result.Timings.Total))
+	}
+
+	table.Flush()
+}
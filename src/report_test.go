@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestSortResults(t *testing.T) {
+	results := []DownloadResult{
+		{File: config.FileEntry{Dest: "b"}, Size: 10, Timings: Timings{Total: 3 * time.Second}},
+		{File: config.FileEntry{Dest: "c"}, Error: errors.New("boom"), Timings: Timings{Total: time.Second}},
+		{File: config.FileEntry{Dest: "a"}, Size: 30, Timings: Timings{Total: 2 * time.Second}},
+		{File: config.FileEntry{Dest: "d"}, Error: errors.New("boom")},
+	}
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{key: sortByStatus, want: []string{"c", "d", "b", "a"}},
+		{key: sortByName, want: []string{"a", "b", "c", "d"}},
+		{key: sortBySize, want: []string{"a", "b", "c", "d"}},
+		{key: sortByDuration, want: []string{"b", "a", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			sorted := sortResults(results, tt.key)
+
+			for i, result := range sorted {
+				if result.File.Dest != tt.want[i] {
+					t.Fatalf("expected order %v, got dest %q at %d", tt.want, result.File.Dest, i)
+				}
+			}
+
+			if results[0].File.Dest != "b" {
+				t.Error("expected input slice to keep config order")
+			}
+		})
+	}
+}
+
+func TestWriteFailureReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures.yaml")
+	failed := []config.FileEntry{
+		{URL: "https://example.com/a.bin", Dest: "/tmp/a.bin", SHA256: "abc123"},
+		{URL: "s3://store/releases/", Dest: "/tmp/mirror"},
+	}
+
+	err := writeFailureReport(path, failed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The report is a valid config on its own.
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Files) != 2 || cfg.Files[0].URL != failed[0].URL || cfg.Files[1].Dest != failed[1].Dest {
+		t.Errorf("expected %+v, got %+v", failed, cfg.Files)
+	}
+
+	relative := []config.FileEntry{{URL: "https://example.com/c.bin", Dest: "out/c.bin", SHA256: "abc123"}}
+
+	err = writeFailureReport(path, relative)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg, err = config.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !filepath.IsAbs(cfg.Files[0].Dest) || !strings.HasSuffix(cfg.Files[0].Dest, filepath.Join("out", "c.bin")) {
+		t.Errorf("expected an absolute dest, got %q", cfg.Files[0].Dest)
+	}
+
+	// A run without failures removes the stale report.
+	err = writeFailureReport(path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected report to be removed, got %v", err)
+	}
+
+	err = writeFailureReport(path, nil)
+	if err != nil {
+		t.Errorf("unexpected error without a report: %v", err)
+	}
+}
+
+func TestWriteJSONReportMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	results := []DownloadResult{
+		{File: config.FileEntry{URL: "https://example.com/a.bin", Dest: "a.bin", Metadata: map[string]string{"component": "kernel", "license": "GPL-2.0"}}},
+		{File: config.FileEntry{URL: "https://example.com/b.bin", Dest: "b.bin"}, Error: errors.New("boom")},
+	}
+
+	err := writeJSONReport(path, results)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []resultReport
+
+	err = json.Unmarshal(data, &reports)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := reports[0].Metadata; got["component"] != "kernel" || got["license"] != "GPL-2.0" {
+		t.Errorf("expected the metadata of a.bin, got %v", got)
+	}
+
+	// Entries without metadata leave the key out.
+	if strings.Count(string(data), `"metadata"`) != 1 {
+		t.Errorf("expected metadata only for a.bin, got %s", data)
+	}
+}
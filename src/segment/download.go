@@ -30,6 +30,9 @@ type Downloader struct {
 	stateMu      sync.Mutex
 	attempts     int
 	retryDelay   time.Duration
+	tap          ProgressTap
+	guard        io.Writer
+	smoothing    int
 }
 
 // NewDownloader creates a new segmented Downloader.
@@ -53,6 +56,62 @@ func NewDownloader(
 	}
 }
 
+// SetProgressSmoothing sets the progress_smoothing of the progress bar, see
+// SmoothingAge.
+func (downloader *Downloader) SetProgressSmoothing(smoothing int) {
+	downloader.smoothing = smoothing
+}
+
+// SetRetryPolicy sets how often each segment is attempted and the delay
+// between its attempts. Values below 1 and negative delays are ignored.
+func (downloader *Downloader) SetRetryPolicy(attempts int, delay time.Duration) {
+	if attempts >= 1 {
+		downloader.attempts = attempts
+	}
+
+	if delay >= 0 {
+		downloader.retryDelay = delay
+	}
+}
+
+// SetProgressTap mirrors the download's progress to tap.
+func (downloader *Downloader) SetProgressTap(tap ProgressTap) {
+	downloader.tap = tap
+}
+
+// SetWriteGuard makes every write to the partial pass through guard first,
+// from all segments at once. An error from guard fails its segment without
+// retrying it.
+func (downloader *Downloader) SetWriteGuard(guard io.Writer) {
+	downloader.guard = guard
+}
+
+// guardError marks a write refused by the write guard.
+type guardError struct {
+	err error
+}
+
+func (guarded guardError) Error() string {
+	return guarded.err.Error()
+}
+
+func (guarded guardError) Unwrap() error {
+	return guarded.err
+}
+
+type guardWriter struct {
+	guard io.Writer
+}
+
+func (writer guardWriter) Write(p []byte) (int, error) {
+	n, err := writer.guard.Write(p)
+	if err != nil {
+		return n, guardError{err: err}
+	}
+
+	return n, nil
+}
+
 // Download executes the segmented download.
 func (downloader *Downloader) Download(ctx context.Context) error {
 	statePath := StatePath(downloader.partialPath)
@@ -77,9 +136,12 @@ func (downloader *Downloader) Download(ctx context.Context) error {
 	defer file.Close()
 
 	// Create shared progress writer.
-	progressWriter := NewSharedProgressWriter(downloader.progress, downloader.totalSize, downloader.fileName)
+	progressWriter := NewSharedProgressWriter(downloader.progress, downloader.totalSize, downloader.fileName,
+		downloader.smoothing)
 	defer progressWriter.Abort()
 
+	progressWriter.SetTap(downloader.tap)
+
 	completedBytes := state.CompletedBytes()
 	if completedBytes > 0 {
 		progressWriter.SetCurrent(completedBytes)
@@ -176,14 +238,14 @@ func (downloader *Downloader) downloadSegment(
 	statePath string,
 ) error {
 	expectedBytes := seg.End - seg.Start + 1
-
-	var written int64
+	written := seg.Written
 
 	var lastErr error
 
 	// Transient mid-stream failures (e.g. CDN connection resets) are retried
 	// here, resuming from the bytes already written instead of failing the
-	// whole file.
+	// whole file. The written offset is saved after each failed attempt, so
+	// a later run resumes the segment too.
 	for attempt := 1; attempt <= downloader.attempts; attempt++ {
 		n, err := downloader.transferSegment(ctx, seg, file, progressWriter, written)
 		written += n
@@ -198,12 +260,21 @@ func (downloader *Downloader) downloadSegment(
 
 		lastErr = err
 
-		if ctx.Err() != nil {
+		saveErr := downloader.recordSegmentProgress(seg, written, state, statePath)
+		if saveErr != nil {
+			return saveErr
+		}
+
+		if ctx.Err() != nil || errors.As(err, new(guardError)) {
 			return lastErr
 		}
 
 		if attempt < downloader.attempts {
-			time.Sleep(downloader.retryDelay)
+			select {
+			case <-ctx.Done():
+				return lastErr
+			case <-time.After(downloader.retryDelay):
+			}
 		}
 	}
 
@@ -226,9 +297,12 @@ func (downloader *Downloader) transferSegment(
 
 	defer reader.Close()
 
-	offsetWriter := io.NewOffsetWriter(file, seg.Start+written)
+	var writer io.Writer = io.MultiWriter(io.NewOffsetWriter(file, seg.Start+written), progressWriter)
+	if downloader.guard != nil {
+		writer = io.MultiWriter(guardWriter{guard: downloader.guard}, writer)
+	}
 
-	n, err := io.Copy(io.MultiWriter(offsetWriter, progressWriter), reader)
+	n, err := io.Copy(writer, reader)
 	if err != nil {
 		if errors.Is(err, io.ErrUnexpectedEOF) {
 			return n, fmt.Errorf("short read: %w", err)
@@ -240,6 +314,21 @@ func (downloader *Downloader) transferSegment(
 	return n, nil
 }
 
+// recordSegmentProgress saves the bytes of seg written so far.
+func (downloader *Downloader) recordSegmentProgress(seg *Segment, written int64, state *State, statePath string) error {
+	downloader.stateMu.Lock()
+	defer downloader.stateMu.Unlock()
+
+	seg.Written = written
+
+	err := SaveState(statePath, state)
+	if err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+
+	return nil
+}
+
 func (downloader *Downloader) markSegmentDone(seg *Segment, state *State, statePath string) error {
 	downloader.stateMu.Lock()
 	defer downloader.stateMu.Unlock()
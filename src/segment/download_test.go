@@ -2,13 +2,16 @@ package segment
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -267,6 +270,86 @@ func TestSegmentedDownloadShortReadRecovers(t *testing.T) {
 	}
 }
 
+func TestSegmentedDownloadResumesWithinSegment(t *testing.T) {
+	content := []byte(strings.Repeat("abcdefghij", 100)) // 1000 bytes.
+
+	dir := t.TempDir()
+	partialPath := filepath.Join(dir, "testfile.partial")
+
+	// A single attempt against a server that drops the last 10 bytes of each
+	// range leaves every segment 240 of its 250 bytes written.
+	shortServer := newShortReadServer(t, content, 10)
+	defer shortServer.Close()
+
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+
+	downloader := NewDownloader(storage.NewHTTPSource(shortServer.URL, 30*time.Second),
+		int64(len(content)), partialPath, 4, progress, "testfile")
+	downloader.SetRetryPolicy(1, 0)
+
+	err := downloader.Download(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "all 1 attempts") {
+		t.Fatalf("expected the single attempt to fail, got %v", err)
+	}
+
+	progress.Wait()
+
+	state, err := LoadState(StatePath(partialPath))
+	if err != nil {
+		t.Fatalf("loading state: %v", err)
+	}
+
+	for _, seg := range state.Segments {
+		if seg.Done || seg.Written != 240 {
+			t.Fatalf("segment %d: expected 240 bytes written, got %+v", seg.Index, seg)
+		}
+	}
+
+	var (
+		rangesMu sync.Mutex
+		ranges   []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			rangesMu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			rangesMu.Unlock()
+		}
+
+		http.ServeContent(w, r, "testfile", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	progress = mpb.New(mpb.WithOutput(io.Discard))
+
+	downloader = NewDownloader(storage.NewHTTPSource(server.URL, 30*time.Second),
+		int64(len(content)), partialPath, 4, progress, "testfile")
+
+	err = downloader.Download(context.Background())
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	progress.Wait()
+
+	slices.Sort(ranges)
+
+	want := []string{"bytes=240-249", "bytes=490-499", "bytes=740-749", "bytes=990-999"}
+	if strings.Join(ranges, ",") != strings.Join(want, ",") {
+		t.Errorf("expected ranges %v, got %v", want, ranges)
+	}
+
+	got, err := os.ReadFile(partialPath)
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+
+	if string(got) != string(content) {
+		t.Error("content mismatch after resuming the segments")
+	}
+}
+
 // newEmptyRangeServer returns a test server that declares the full range
 // length but never writes a body, so every range request fails mid-stream.
 func newEmptyRangeServer(t *testing.T, content []byte) *httptest.Server {
@@ -604,3 +687,50 @@ func TestSegmentedDownloadTwoSegments(t *testing.T) {
 		t.Errorf("content mismatch: got %d bytes, want %d bytes", len(got), len(content))
 	}
 }
+
+// refusingWriter fails every write with err.
+type refusingWriter struct {
+	err error
+}
+
+func (writer refusingWriter) Write([]byte) (int, error) {
+	return 0, writer.err
+}
+
+func TestSegmentedDownloadWriteGuard(t *testing.T) {
+	content := []byte(strings.Repeat("abcdefghij", 100)) // 1000 bytes.
+
+	var gets atomic.Int32
+
+	testServer := newTestServer(t, content)
+	defer testServer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+
+		testServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	progress := mpb.New(mpb.WithOutput(io.Discard))
+	refused := errors.New("disk full")
+
+	downloader := NewDownloader(storage.NewHTTPSource(server.URL, 30*time.Second),
+		int64(len(content)), filepath.Join(t.TempDir(), "testfile.partial"), 4, progress, "testfile")
+	downloader.SetRetryPolicy(3, 0)
+	downloader.SetWriteGuard(refusingWriter{err: refused})
+
+	err := downloader.Download(context.Background())
+	if !errors.Is(err, refused) {
+		t.Fatalf("expected the guard error, got %v", err)
+	}
+
+	progress.Wait()
+
+	// Refused writes are not retried.
+	if gets.Load() != 4 {
+		t.Errorf("expected one request per segment, got %d", gets.Load())
+	}
+}
@@ -8,6 +8,30 @@ import (
 	"github.com/vbauerster/mpb/v8/decor"
 )
 
+// ProgressTap receives the byte counts of progress bars, e.g. to report
+// aggregate progress across all downloads. A bar that is aborted withdraws
+// what it contributed, so a retried download is not counted twice.
+type ProgressTap interface {
+	AddTotal(total int64)
+	AddDone(done int64)
+}
+
+// DefaultProgressSmoothing is the age, in samples, of the moving averages
+// behind the speed and ETA of progress bars when settings.progress_smoothing
+// is unset.
+const DefaultProgressSmoothing = 30
+
+// SmoothingAge returns the moving-average age for a progress_smoothing
+// value, the default for zero or less. Larger ages give steadier but
+// laggier speed and ETA readings.
+func SmoothingAge(smoothing int) float64 {
+	if smoothing <= 0 {
+		return DefaultProgressSmoothing
+	}
+
+	return float64(smoothing)
+}
+
 // SharedProgressWriter is a thread-safe progress writer for segmented downloads.
 // Multiple goroutines can write to it concurrently, updating a single progress bar.
 type SharedProgressWriter struct {
@@ -15,10 +39,22 @@ type SharedProgressWriter struct {
 	mu       sync.Mutex
 	lastTime time.Time
 	started  bool
+	tap      ProgressTap
+	total    int64
+	counted  int64
+	finished bool
 }
 
-// NewSharedProgressWriter creates a new SharedProgressWriter with a single progress bar.
-func NewSharedProgressWriter(container *mpb.Progress, total int64, description string) *SharedProgressWriter {
+// NewSharedProgressWriter creates a new SharedProgressWriter with a single
+// progress bar, whose speed and ETA are averaged per SmoothingAge.
+func NewSharedProgressWriter(
+	container *mpb.Progress,
+	total int64,
+	description string,
+	smoothing int,
+) *SharedProgressWriter {
+	age := SmoothingAge(smoothing)
+
 	bar := container.AddBar(total,
 		mpb.PrependDecorators(
 			decor.Name(description, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
@@ -26,17 +62,39 @@ func NewSharedProgressWriter(container *mpb.Progress, total int64, description s
 		mpb.AppendDecorators(
 			decor.CountersKibiByte("% .2f / % .2f"),
 			decor.Name(" "),
-			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 30),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", age),
 			decor.Name(" ETA:"),
-			decor.EwmaETA(decor.ET_STYLE_GO, 30),
+			decor.EwmaETA(decor.ET_STYLE_GO, age),
 		),
 	)
 
 	return &SharedProgressWriter{
-		bar: bar,
+		bar:   bar,
+		total: total,
 	}
 }
 
+// SetTap mirrors the bar's byte counts to tap. Bars of unknown size are not
+// mirrored, as they cannot contribute to a percentage.
+func (writer *SharedProgressWriter) SetTap(tap ProgressTap) {
+	if tap == nil || writer.total <= 0 {
+		return
+	}
+
+	writer.tap = tap
+	writer.tap.AddTotal(writer.total)
+}
+
+// countDone forwards done bytes to the tap. The caller must hold mu.
+func (writer *SharedProgressWriter) countDone(done int64) {
+	if writer.tap == nil {
+		return
+	}
+
+	writer.counted += done
+	writer.tap.AddDone(done)
+}
+
 // Write implements io.Writer and updates the progress bar in a thread-safe manner.
 func (writer *SharedProgressWriter) Write(data []byte) (int, error) {
 	writer.mu.Lock()
@@ -44,6 +102,8 @@ func (writer *SharedProgressWriter) Write(data []byte) (int, error) {
 
 	now := time.Now()
 
+	writer.countDone(int64(len(data)))
+
 	if !writer.started {
 		writer.started = true
 		writer.lastTime = now
@@ -62,12 +122,21 @@ func (writer *SharedProgressWriter) Write(data []byte) (int, error) {
 }
 
 // SetCurrent sets the current progress value for already-completed bytes.
+// It must be called before any Write.
 func (writer *SharedProgressWriter) SetCurrent(current int64) {
+	writer.mu.Lock()
+	writer.countDone(current)
+	writer.mu.Unlock()
+
 	writer.bar.SetCurrent(current)
 }
 
 // Finish marks the progress bar as complete.
 func (writer *SharedProgressWriter) Finish() {
+	writer.mu.Lock()
+	writer.finished = true
+	writer.mu.Unlock()
+
 	writer.bar.SetTotal(-1, true)
 }
 
@@ -75,5 +144,15 @@ func (writer *SharedProgressWriter) Finish() {
 // incomplete bar after a download error. It is a no-op once the bar has
 // completed, so it is safe to defer right after creation.
 func (writer *SharedProgressWriter) Abort() {
+	writer.mu.Lock()
+
+	if writer.tap != nil && !writer.finished {
+		writer.tap.AddDone(-writer.counted)
+		writer.tap.AddTotal(-writer.total)
+		writer.tap = nil
+	}
+
+	writer.mu.Unlock()
+
 	writer.bar.Abort(true)
 }
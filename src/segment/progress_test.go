@@ -0,0 +1,13 @@
+package segment
+
+import "testing"
+
+func TestSmoothingAge(t *testing.T) {
+	tests := map[int]float64{-1: DefaultProgressSmoothing, 0: DefaultProgressSmoothing, 5: 5, 120: 120}
+
+	for smoothing, want := range tests {
+		if got := SmoothingAge(smoothing); got != want {
+			t.Errorf("SmoothingAge(%d) = %v, want %v", smoothing, got, want)
+		}
+	}
+}
@@ -15,11 +15,14 @@ type State struct {
 }
 
 // Segment represents a single byte range within a segmented download.
+// Written counts the bytes from Start already in the partial file, so an
+// interrupted segment resumes within its range.
 type Segment struct {
-	Index int   `json:"index"`
-	Start int64 `json:"start"`
-	End   int64 `json:"end"`
-	Done  bool  `json:"done"`
+	Index   int   `json:"index"`
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"`
+	Done    bool  `json:"done"`
+	Written int64 `json:"written,omitempty"`
 }
 
 // NewState creates a new State by dividing totalSize into count equal segments.
@@ -45,13 +48,16 @@ func NewState(totalSize int64, count int) *State {
 	}
 }
 
-// CompletedBytes returns the total number of bytes in completed segments.
+// CompletedBytes returns the total number of bytes in completed segments
+// and in the written prefixes of incomplete ones.
 func (state *State) CompletedBytes() int64 {
 	var total int64
 
 	for i := range state.Segments {
 		if state.Segments[i].Done {
 			total += state.Segments[i].End - state.Segments[i].Start + 1
+		} else {
+			total += state.Segments[i].Written
 		}
 	}
 
@@ -123,6 +123,13 @@ func TestCompletedBytes(t *testing.T) {
 	if got := state.CompletedBytes(); got != 50 {
 		t.Errorf("CompletedBytes() = %d, want 50", got)
 	}
+
+	// The written prefix of an incomplete segment counts too.
+	state.Segments[1].Written = 10
+
+	if got := state.CompletedBytes(); got != 60 {
+		t.Errorf("CompletedBytes() = %d, want 60", got)
+	}
 }
 
 func TestSaveLoadState(t *testing.T) {
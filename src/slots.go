@@ -0,0 +1,236 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"xget/src/config"
+)
+
+// downloadSlots limits how many files download at once. When large is set,
+// files at or above threshold bytes use the large pool and all others the
+// small pool, so many tiny files and a few huge ones get separate limits.
+type downloadSlots struct {
+	small     chan struct{}
+	large     chan struct{}
+	threshold int64
+}
+
+// reserve blocks until a small slot is free and takes it.
+func (slots *downloadSlots) reserve() {
+	slots.small <- struct{}{}
+}
+
+// admit moves a file holding a reserved small slot to its pool and returns
+// the function that frees its slot. The size probe runs while holding the
+// small slot, which bounds the number of concurrent probes; files whose size
+// is unknown stay small.
+func (slots *downloadSlots) admit(
+	ctx context.Context,
+	file config.FileEntry,
+	probeSize func(context.Context, config.FileEntry) int64,
+) func() {
+	if slots.large == nil || probeSize(ctx, file) < slots.threshold {
+		return func() { <-slots.small }
+	}
+
+	<-slots.small
+	slots.large <- struct{}{}
+
+	return func() { <-slots.large }
+}
+
+// fileSlot is the download slot of one file. take waits for the slot and
+// returns the function that frees it. Files that hash their existing dest
+// first, for settings.verify_parallel, take it only once the dest turns out
+// to need fetching, so waiting for or running a hash holds no download slot.
+type fileSlot struct {
+	take    func() (func(), error)
+	release func()
+}
+
+// acquire takes the slot unless it is already held.
+func (slot *fileSlot) acquire() error {
+	if slot.release != nil {
+		return nil
+	}
+
+	release, err := slot.take()
+	if err != nil {
+		return err
+	}
+
+	slot.release = release
+
+	return nil
+}
+
+// free frees the slot if it is held.
+func (slot *fileSlot) free() {
+	if slot.release != nil {
+		slot.release()
+		slot.release = nil
+	}
+}
+
+type fileSlotKey struct{}
+
+// withFileSlot returns ctx carrying the slot of the file downloaded under it.
+func withFileSlot(ctx context.Context, slot *fileSlot) context.Context {
+	return context.WithValue(ctx, fileSlotKey{}, slot)
+}
+
+// acquireFileSlot takes the slot of the file downloaded under ctx, if it
+// does not hold it yet. Without a slot in ctx it does nothing.
+func acquireFileSlot(ctx context.Context) error {
+	slot, ok := ctx.Value(fileSlotKey{}).(*fileSlot)
+	if !ok {
+		return nil
+	}
+
+	return slot.acquire()
+}
+
+// aliasSlots limits how many connections download from each s3:// alias at
+// once, for settings.per_alias_parallel. Every alias gets its own pool of
+// limit slots, created on first use. A nil *aliasSlots is unlimited.
+type aliasSlots struct {
+	limit int
+
+	mu    sync.Mutex
+	pools map[string]*aliasPool
+}
+
+func newAliasSlots(limit int) *aliasSlots {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &aliasSlots{limit: limit, pools: make(map[string]*aliasPool)}
+}
+
+// pool returns the pool of the alias of file, or nil when file is not an
+// s3:// url or aliases are unlimited. Files are limited by the alias of
+// their url, even once they fail over to a fallback_alias.
+func (slots *aliasSlots) pool(file config.FileEntry) *aliasPool {
+	if slots == nil {
+		return nil
+	}
+
+	alias, ok := config.URLAlias(file.URL)
+	if !ok {
+		return nil
+	}
+
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+
+	pool, ok := slots.pools[alias]
+	if !ok {
+		pool = &aliasPool{size: slots.limit, free: slots.limit}
+		slots.pools[alias] = pool
+	}
+
+	return pool
+}
+
+// aliasPool is the pool of one alias. A file claims as many slots as it may
+// open connections, segments_per_file for a segmented download, and claims
+// are granted strictly in the order they were queued, so files start in
+// dispatch order and a segmented file is not starved by single-stream ones.
+type aliasPool struct {
+	size int
+
+	mu      sync.Mutex
+	free    int
+	waiters []*aliasClaim
+}
+
+// aliasClaim is a queued claim on weight slots of a pool; granted is closed
+// once they are taken.
+type aliasClaim struct {
+	weight  int
+	granted chan struct{}
+}
+
+// enqueue queues a claim on weight slots, capped at the size of the pool so
+// it can always be granted.
+func (pool *aliasPool) enqueue(weight int) *aliasClaim {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	claim := &aliasClaim{weight: min(max(weight, 1), pool.size), granted: make(chan struct{})}
+	pool.waiters = append(pool.waiters, claim)
+	pool.grant()
+
+	return claim
+}
+
+// wait blocks until claim is granted and returns the function that frees
+// its slots. When ctx is done first, the claim is withdrawn and the error
+// of ctx returned.
+func (pool *aliasPool) wait(ctx context.Context, claim *aliasClaim) (func(), error) {
+	select {
+	case <-claim.granted:
+		return func() { pool.release(claim.weight) }, nil
+	case <-ctx.Done():
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	select {
+	case <-claim.granted:
+		pool.free += claim.weight
+	default:
+		pool.waiters = slices.DeleteFunc(pool.waiters, func(waiter *aliasClaim) bool { return waiter == claim })
+	}
+
+	pool.grant()
+
+	return nil, ctx.Err()
+}
+
+func (pool *aliasPool) release(weight int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.free += weight
+	pool.grant()
+}
+
+// grant takes slots for the claims at the head of the queue while they fit.
+// The caller holds mu.
+func (pool *aliasPool) grant() {
+	for len(pool.waiters) > 0 && pool.waiters[0].weight <= pool.free {
+		claim := pool.waiters[0]
+		pool.waiters = pool.waiters[1:]
+		pool.free -= claim.weight
+		close(claim.granted)
+	}
+}
+
+// dispatchOrder returns the indices of files in the order they are started:
+// by descending priority, and in config order among equal priorities.
+func dispatchOrder(files []config.FileEntry) []int {
+	order := configOrder(files)
+
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(files[b].Priority, files[a].Priority)
+	})
+
+	return order
+}
+
+// configOrder returns the indices of files in config order, ignoring their
+// priorities.
+func configOrder(files []config.FileEntry) []int {
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+
+	return order
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestDownloadSlotsAdmit(t *testing.T) {
+	sizes := map[string]int64{"tiny.bin": 10, "huge.bin": 1000, "unknown.bin": -1}
+	probe := func(_ context.Context, file config.FileEntry) int64 { return sizes[file.URL] }
+
+	tests := []struct {
+		name      string
+		url       string
+		large     bool
+		wantLarge bool
+	}{
+		{name: "small file", url: "tiny.bin", large: true, wantLarge: false},
+		{name: "large file", url: "huge.bin", large: true, wantLarge: true},
+		{name: "unknown size", url: "unknown.bin", large: true, wantLarge: false},
+		{name: "split disabled", url: "huge.bin", large: false, wantLarge: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots := &downloadSlots{small: make(chan struct{}, 1), threshold: 100}
+			if tt.large {
+				slots.large = make(chan struct{}, 1)
+			}
+
+			slots.reserve()
+			release := slots.admit(context.Background(), config.FileEntry{URL: tt.url}, probe)
+
+			heldLarge := len(slots.large) == 1
+			if heldLarge != tt.wantLarge {
+				t.Errorf("expected large slot held = %v, got %v", tt.wantLarge, heldLarge)
+			}
+
+			heldSmall := len(slots.small) == 1
+			if heldSmall == tt.wantLarge {
+				t.Errorf("expected small slot held = %v, got %v", !tt.wantLarge, heldSmall)
+			}
+
+			release()
+
+			if len(slots.small)+len(slots.large) != 0 {
+				t.Error("expected release to free the slot")
+			}
+		})
+	}
+}
+
+func TestDispatchOrder(t *testing.T) {
+	files := []config.FileEntry{
+		{URL: "background-1"},
+		{URL: "critical", Priority: 10},
+		{URL: "background-2"},
+		{URL: "deferred", Priority: -1},
+		{URL: "important", Priority: 5},
+		{URL: "critical-2", Priority: 10},
+	}
+
+	got := dispatchOrder(files)
+
+	want := []int{1, 5, 4, 0, 2, 3}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected order %v, got %v", want, got)
+	}
+}
+
+func TestAliasSlotsPool(t *testing.T) {
+	slots := newAliasSlots(2)
+
+	store := slots.pool(config.FileEntry{URL: "s3://store/a.bin"})
+	if store == nil || store.size != 2 {
+		t.Fatalf("expected a pool of 2 slots for store, got %v", store)
+	}
+
+	if slots.pool(config.FileEntry{URL: "s3://store/b/c.bin"}) != store {
+		t.Error("expected files of one alias to share a pool")
+	}
+
+	if slots.pool(config.FileEntry{URL: "s3://backup/a.bin"}) == store {
+		t.Error("expected each alias to get its own pool")
+	}
+
+	if slots.pool(config.FileEntry{URL: "https://example.com/a.bin"}) != nil {
+		t.Error("expected http files not to be limited")
+	}
+
+	unlimited := newAliasSlots(0)
+	if unlimited.pool(config.FileEntry{URL: "s3://store/a.bin"}) != nil {
+		t.Error("expected no pool when per_alias_parallel is unset")
+	}
+}
+
+func TestAliasPoolGrantsInQueueOrder(t *testing.T) {
+	pool := newAliasSlots(4).pool(config.FileEntry{URL: "s3://store/a.bin"})
+
+	running := pool.enqueue(3)
+	segmented := pool.enqueue(4)
+	single := pool.enqueue(1)
+
+	release, err := pool.wait(context.Background(), running)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The single-stream file fits next to the running one, but queued
+	// behind the segmented file it must not overtake it.
+	select {
+	case <-single.granted:
+		t.Fatal("expected a later claim not to overtake a waiting one")
+	default:
+	}
+
+	release()
+
+	releaseSegmented, err := pool.wait(context.Background(), segmented)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	releaseSegmented()
+
+	releaseSingle, err := pool.wait(context.Background(), single)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	releaseSingle()
+
+	if pool.free != 4 {
+		t.Errorf("expected every slot back, got %d free", pool.free)
+	}
+
+	if pool.enqueue(10).weight != 4 {
+		t.Error("expected a claim to be capped at the pool size")
+	}
+}
+
+func TestAliasPoolWaitCancelled(t *testing.T) {
+	pool := newAliasSlots(1).pool(config.FileEntry{URL: "s3://store/a.bin"})
+
+	held := pool.enqueue(1)
+	waiting := pool.enqueue(1)
+	next := pool.enqueue(1)
+
+	release, err := pool.wait(context.Background(), held)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = pool.wait(ctx, waiting)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with its context, got %v", err)
+	}
+
+	release()
+
+	select {
+	case <-next.granted:
+	case <-time.After(time.Second):
+		t.Fatal("expected a withdrawn claim to let the next one through")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// speedCheckInterval is how often a speed floor samples the bytes of its
+// download. Windows shorter than four intervals are sampled four times, but
+// never more often than every minSpeedCheckInterval, which also keeps the
+// ticker interval positive for windows of a few nanoseconds.
+const (
+	speedCheckInterval    = time.Second
+	minSpeedCheckInterval = 10 * time.Millisecond
+)
+
+// errTooSlow marks a download aborted by settings.min_speed. Unlike
+// errLowDiskSpace it is retried: a new connection may reach a faster node.
+var errTooSlow = errors.New("download too slow")
+
+// speedFloor implements settings.min_speed. It is placed before the partial
+// file in the copy loop of one download attempt, counting the bytes written
+// by all its segments, and cancels the context of the attempt with
+// errTooSlow once fewer than min_speed bytes per second arrived over the
+// last min_speed_window. Unlike a write error, the cancellation also ends a
+// read that receives nothing at all.
+type speedFloor struct {
+	written atomic.Int64
+	cancel  context.CancelCauseFunc
+	done    chan struct{}
+}
+
+type speedSample struct {
+	at      time.Time
+	written int64
+}
+
+// watchSpeed returns the context of a download attempt and its speed floor,
+// or ctx and nil when settings.min_speed is not set. The floor must be
+// stopped once the attempt is over.
+func (downloader *Downloader) watchSpeed(ctx context.Context) (context.Context, *speedFloor) {
+	settings := downloader.cfg.Settings
+	if settings.MinSpeed <= 0 || settings.MinSpeedWindow <= 0 {
+		return ctx, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	floor := &speedFloor{cancel: cancel, done: make(chan struct{})}
+
+	go floor.watch(settings.MinSpeed, settings.MinSpeedWindow)
+
+	return ctx, floor
+}
+
+// Write counts p; it never fails.
+func (floor *speedFloor) Write(p []byte) (int, error) {
+	floor.written.Add(int64(len(p)))
+
+	return len(p), nil
+}
+
+// watch samples the bytes written until the floor is stopped or trips. The
+// rate is measured over a sliding window, so a download only trips once it
+// has been slow for a whole window, not for a moment.
+func (floor *speedFloor) watch(minSpeed int64, window time.Duration) {
+	ticker := time.NewTicker(max(min(speedCheckInterval, window/4), minSpeedCheckInterval))
+	defer ticker.Stop()
+
+	samples := []speedSample{{at: time.Now()}}
+
+	for {
+		select {
+		case <-floor.done:
+			return
+		case now := <-ticker.C:
+			written := floor.written.Load()
+			samples = append(samples, speedSample{at: now, written: written})
+
+			// The window starts at the newest sample at least window old.
+			for len(samples) > 1 && now.Sub(samples[1].at) >= window {
+				samples = samples[1:]
+			}
+
+			elapsed := now.Sub(samples[0].at)
+			if elapsed < window {
+				continue
+			}
+
+			rate := float64(written-samples[0].written) / elapsed.Seconds()
+			if rate < float64(minSpeed) {
+				floor.cancel(fmt.Errorf("%w: %.0f B/s over the last %s, settings.min_speed is %d B/s",
+					errTooSlow, rate, window, minSpeed))
+
+				return
+			}
+		}
+	}
+}
+
+// stop ends the watch and releases the context of the attempt. It is a
+// no-op on a nil floor.
+func (floor *speedFloor) stop() {
+	if floor == nil {
+		return
+	}
+
+	close(floor.done)
+	floor.cancel(nil)
+}
+
+// tooSlow returns the errTooSlow cause of ctx in place of err when the speed
+// floor aborted the attempt, as the copy loop only sees a cancelled read.
+func tooSlow(ctx context.Context, err error) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, errTooSlow) {
+		return cause
+	}
+
+	return err
+}
+
+// writeGuard returns the writer every write to the partial of dest passes
+// through first: the guard of settings.min_free_space and the speed floor,
+// or nil when there is neither.
+func (downloader *Downloader) writeGuard(dest string, floor *speedFloor) io.Writer {
+	var guards []io.Writer
+
+	guard := downloader.newFreeSpaceGuard(dest)
+	if guard != nil {
+		guards = append(guards, guard)
+	}
+
+	if floor != nil {
+		guards = append(guards, floor)
+	}
+
+	switch len(guards) {
+	case 0:
+		return nil
+	case 1:
+		return guards[0]
+	default:
+		return io.MultiWriter(guards...)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xget/src/config"
+)
+
+func TestSpeedFloor(t *testing.T) {
+	downloader := NewDownloader(&config.Config{Settings: config.Settings{MinSpeed: 1000, MinSpeedWindow: 100 * time.Millisecond}}, nil)
+
+	ctx, floor := downloader.watchSpeed(context.Background())
+	defer floor.stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a download receiving nothing to be aborted")
+	}
+
+	if err := tooSlow(ctx, context.Canceled); !errors.Is(err, errTooSlow) {
+		t.Errorf("expected errTooSlow, got %v", err)
+	}
+
+	ctx, fast := downloader.watchSpeed(context.Background())
+
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		_, _ = fast.Write(make([]byte, 100))
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if ctx.Err() != nil {
+		t.Errorf("expected a download above min_speed to go on, got %v", context.Cause(ctx))
+	}
+
+	fast.stop()
+
+	if tooSlow(ctx, context.Canceled) != context.Canceled {
+		t.Error("expected a stopped floor not to be reported as too slow")
+	}
+
+	unset := NewDownloader(&config.Config{}, nil)
+
+	_, floor = unset.watchSpeed(context.Background())
+	if floor != nil {
+		t.Error("expected no floor without min_speed")
+	}
+}
+
+func TestSpeedFloorTinyWindow(t *testing.T) {
+	downloader := NewDownloader(&config.Config{Settings: config.Settings{MinSpeed: 1000, MinSpeedWindow: time.Nanosecond}}, nil)
+
+	ctx, floor := downloader.watchSpeed(context.Background())
+	defer floor.stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a download receiving nothing to be aborted")
+	}
+}
+
+func TestDownloadMinSpeed(t *testing.T) {
+	content := []byte("a slow node, then a fast one")
+	sum := sha256.Sum256(content)
+
+	var gets atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt stalls after a few bytes; the second resumes the
+		// partial and is served at once.
+		if r.Method == http.MethodGet && gets.Add(1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:4])
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	cfg := &config.Config{
+		Settings: config.Settings{
+			Parallel: 1, Retries: 2, RetryDelay: time.Millisecond, MetadataRetries: 1,
+			MinSpeed: 1000, MinSpeedWindow: 200 * time.Millisecond,
+			SingleStream: "true", HTTPVersion: config.HTTPVersion1, ProgressMode: config.ProgressModeCI,
+		},
+		Files: []config.FileEntry{{URL: server.URL + "/file.bin", Dest: dest, SHA256: hex.EncodeToString(sum[:])}},
+	}
+
+	results := NewDownloader(cfg, nil).Download(context.Background())
+	if results[0].Error != nil {
+		t.Fatalf("expected the retry to succeed, got %v", results[0].Error)
+	}
+
+	if gets.Load() != 2 {
+		t.Errorf("expected the stalled attempt to be retried, got %d GET requests", gets.Load())
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil || string(data) != string(content) {
+		t.Errorf("expected %q, got %q, %v", content, data, err)
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"xget/src/config"
+)
+
+// DataSource serves the content inlined in a data: URL. It is held in
+// memory, so it supports resuming and range requests without any I/O.
+type DataSource struct {
+	mediaType string
+	content   []byte
+}
+
+// NewDataSource decodes rawURL into a DataSource.
+func NewDataSource(rawURL string) (*DataSource, error) {
+	mediaType, content, err := config.ParseDataURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataSource{mediaType: mediaType, content: content}, nil
+}
+
+// Download returns the content from offset on, along with its total size.
+func (data *DataSource) Download(_ context.Context, offset int64) (io.ReadCloser, int64, error) {
+	size := int64(len(data.content))
+	if offset < 0 || offset > size {
+		return nil, 0, fmt.Errorf("offset %d is outside the %d bytes of the data url", offset, size)
+	}
+
+	return io.NopCloser(bytes.NewReader(data.content[offset:])), size, nil
+}
+
+// GetSize returns the size of the decoded content.
+func (data *DataSource) GetSize(_ context.Context) (int64, error) {
+	return int64(len(data.content)), nil
+}
+
+// DownloadRange returns bytes [start, end] inclusive of the content.
+func (data *DataSource) DownloadRange(_ context.Context, start, end int64) (io.ReadCloser, error) {
+	size := int64(len(data.content))
+	if start < 0 || start > end || end >= size {
+		return nil, fmt.Errorf("range %d-%d is outside the %d bytes of the data url", start, end, size)
+	}
+
+	return io.NopCloser(bytes.NewReader(data.content[start : end+1])), nil
+}
+
+// AcceptsRanges always reports true.
+func (data *DataSource) AcceptsRanges(_ context.Context) (bool, error) {
+	return true, nil
+}
+
+// GetContentType returns the media type named by the data: URL.
+func (data *DataSource) GetContentType(_ context.Context) (string, error) {
+	return data.mediaType, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestDataSourceDecodesBase64(t *testing.T) {
+	source, err := NewSource("data:application/x-pem-file;base64,aGVs\n  bG8=", nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, size, err := source.Download(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if size != 5 {
+		t.Errorf("expected size 5, got %d", size)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(data) != "ello" {
+		t.Errorf("expected %q, got %q", "ello", data)
+	}
+
+	contentType, err := source.(ContentTypeSource).GetContentType(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contentType != "application/x-pem-file" {
+		t.Errorf("expected application/x-pem-file, got %q", contentType)
+	}
+}
+
+func TestDataSourceRange(t *testing.T) {
+	source, err := NewDataSource("data:,hello%20world")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, err := source.DownloadRange(context.Background(), 6, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(data) != "world" {
+		t.Errorf("expected %q, got %q", "world", data)
+	}
+
+	_, err = source.DownloadRange(context.Background(), 6, 11)
+	if err == nil {
+		t.Fatal("expected error for a range past the end")
+	}
+}
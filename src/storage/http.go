@@ -5,29 +5,203 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"xget/src/config"
+	"xget/src/tracing"
 )
 
 // HTTPSource implements Source for HTTP/HTTPS URLs.
 type HTTPSource struct {
 	url              string
 	client           *http.Client
+	presigned        bool
+	headers          map[string]string
 	rangeOnce        sync.Once
 	acceptsRangesVal bool
 	acceptsRangesErr error
 }
 
+// HTTPOption configures optional HTTPSource behavior.
+type HTTPOption func(*httpOptions)
+
+// httpOptions holds the values set by HTTPOption functions.
+type httpOptions struct {
+	version        string
+	connectTimeout time.Duration
+	checkRedirect  func(req *http.Request, via []*http.Request) error
+	headers        map[string]string
+}
+
+// WithHTTPVersion selects the protocol negotiation of the transport:
+// config.HTTPVersion1 (the default), config.HTTPVersionAuto or config.HTTPVersion2.
+func WithHTTPVersion(version string) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.version = version
+	}
+}
+
+// WithConnectTimeout bounds how long establishing a TCP connection may take.
+func WithConnectTimeout(timeout time.Duration) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.connectTimeout = timeout
+	}
+}
+
+// WithCheckRedirect sets the redirect policy of the client, e.g. to refuse
+// redirects to hosts outside an allowlist.
+func WithCheckRedirect(checkRedirect func(req *http.Request, via []*http.Request) error) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.checkRedirect = checkRedirect
+	}
+}
+
+// WithHeaders sets headers sent with every request of the source, e.g. an
+// API token. They are not sent on past a redirect to another host, where
+// they could leak a credential to a server it was not meant for.
+func WithHeaders(headers map[string]string) HTTPOption {
+	return func(opts *httpOptions) {
+		opts.headers = headers
+	}
+}
+
 // NewHTTPSource creates an HTTPSource for the given URL and timeout.
-func NewHTTPSource(url string, timeout time.Duration) *HTTPSource {
+func NewHTTPSource(url string, timeout time.Duration, options ...HTTPOption) *HTTPSource {
+	opts := httpOptions{version: config.HTTPVersion1}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	transport := newHTTPTransport(opts.version)
+
+	if opts.connectTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   opts.connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &HTTPSource{
+		url: url,
+		client: &http.Client{
+			Timeout:       timeout,
+			Transport:     tracing.WrapTransport(transport),
+			CheckRedirect: stripHeadersOnRedirect(opts.headers, opts.checkRedirect),
+		},
+		presigned: IsPresignedURL(url),
+		headers:   opts.headers,
+	}
+}
+
+// maxRedirects is the redirect limit of the default client policy, kept
+// when the headers are stripped without another policy.
+const maxRedirects = 10
+
+// stripHeadersOnRedirect returns a redirect policy that removes headers from
+// redirects to a host other than the one first requested, then applies
+// next, or the default policy when next is nil. The client copies every
+// header of the first request to its redirects and only drops Authorization
+// and cookies on its own.
+func stripHeadersOnRedirect(
+	headers map[string]string,
+	next func(req *http.Request, via []*http.Request) error,
+) func(req *http.Request, via []*http.Request) error {
+	if len(headers) == 0 {
+		return next
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host != via[0].URL.Host {
+			for name := range headers {
+				req.Header.Del(name)
+			}
+		}
+
+		if next != nil {
+			return next(req, via)
+		}
+
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		return nil
+	}
+}
+
+// newRequest creates a request for the source URL carrying its headers.
+func (httpSource *HTTPSource) newRequest(ctx context.Context, method string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, httpSource.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range httpSource.headers {
+		if name == "Host" {
+			req.Host = value
+
+			continue
+		}
+
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+// IsPresignedURL reports whether rawURL carries a query-string signature
+// (AWS SigV4 or SigV2, or a GCS V4 signature). Such URLs are typically valid
+// for GET only and expire, so xget neither resumes nor segments them.
+func IsPresignedURL(rawURL string) bool {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	for key := range parsed.Query() {
+		switch strings.ToLower(key) {
+		case "x-amz-signature", "x-goog-signature":
+			return true
+		case "signature":
+			if parsed.Query().Has("AWSAccessKeyId") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// newHTTPTransport clones the default transport with the requested protocol
+// negotiation. Unknown versions fall back to HTTP/1.1.
+func newHTTPTransport(version string) *http.Transport {
 	baseTransport, ok := http.DefaultTransport.(*http.Transport)
 	if !ok {
 		baseTransport = &http.Transport{}
 	}
 
+	switch version {
+	case config.HTTPVersionAuto:
+		// Offer both h2 and http/1.1 in ALPN and let the server choose.
+		return baseTransport.Clone()
+	case config.HTTPVersion2:
+		// Require HTTP/2, including prior-knowledge h2c for plain http:// URLs.
+		http2Transport := baseTransport.Clone()
+		http2Transport.ForceAttemptHTTP2 = true
+		http2Transport.Protocols = new(http.Protocols)
+		http2Transport.Protocols.SetHTTP2(true)
+		http2Transport.Protocols.SetUnencryptedHTTP2(true)
+
+		return http2Transport
+	}
+
 	// Force HTTP/1.1: some CDNs (e.g. Cloudflare R2) reset multiplexed HTTP/2
 	// streams under concurrent range-request load (RST_STREAM INTERNAL_ERROR).
 	// With HTTP/1.1 each range request gets its own connection.
@@ -45,18 +219,12 @@ func NewHTTPSource(url string, timeout time.Duration) *HTTPSource {
 
 	http1Transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
 
-	return &HTTPSource{
-		url: url,
-		client: &http.Client{
-			Timeout:   timeout,
-			Transport: http1Transport,
-		},
-	}
+	return http1Transport
 }
 
 // Download retrieves the file content starting from the given offset.
 func (httpSource *HTTPSource) Download(ctx context.Context, offset int64) (io.ReadCloser, int64, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpSource.url, nil)
+	req, err := httpSource.newRequest(ctx, http.MethodGet)
 	if err != nil {
 		return nil, 0, fmt.Errorf("creating request: %w", err)
 	}
@@ -71,10 +239,23 @@ func (httpSource *HTTPSource) Download(ctx context.Context, offset int64) (io.Re
 		return nil, 0, fmt.Errorf("executing request: %w", err)
 	}
 
+	// A resume offset at the end of the file means the partial is already
+	// complete; the server answers "bytes */<size>".
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 &&
+		unsatisfiedRangeSize(resp) == offset {
+		resp.Body.Close()
+
+		return io.NopCloser(strings.NewReader("")), offset, nil
+	}
+
 	// Check for successful response.
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		resp.Body.Close()
 
+		if httpSource.presigned && resp.StatusCode == http.StatusForbidden {
+			return nil, 0, fmt.Errorf("presigned URL rejected with status 403: the signature has likely expired")
+		}
+
 		return nil, 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
@@ -83,30 +264,45 @@ func (httpSource *HTTPSource) Download(ctx context.Context, offset int64) (io.Re
 	return resp.Body, totalSize, nil
 }
 
+// unsatisfiedRangeSize returns the size from the "bytes */<size>"
+// Content-Range of a 416 response, or -1 when it is absent.
+func unsatisfiedRangeSize(resp *http.Response) int64 {
+	var size int64
+
+	_, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &size)
+	if err != nil {
+		return -1
+	}
+
+	return size
+}
+
+// parseTotalSize returns the full size of the file a download response is
+// part of, or -1 when it is unknown, e.g. for a chunked response without a
+// Content-Length or a Content-Range of "bytes 0-99/*".
 func parseTotalSize(resp *http.Response, offset int64) int64 {
 	if resp.StatusCode != http.StatusPartialContent {
 		return resp.ContentLength
 	}
 
-	contentRange := resp.Header.Get("Content-Range")
-	if contentRange == "" {
-		return offset + resp.ContentLength
-	}
-
 	// Format: bytes start-end/total.
 	var start, end, total int64
 
-	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
-	if err != nil {
-		return offset + resp.ContentLength
+	_, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+	if err == nil {
+		return total
+	}
+
+	if resp.ContentLength < 0 {
+		return -1
 	}
 
-	return total
+	return offset + resp.ContentLength
 }
 
 // GetSize returns the total size of the file using HEAD request.
 func (httpSource *HTTPSource) GetSize(ctx context.Context) (int64, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, httpSource.url, nil)
+	req, err := httpSource.newRequest(ctx, http.MethodHead)
 	if err != nil {
 		return 0, fmt.Errorf("creating HEAD request: %w", err)
 	}
@@ -135,9 +331,127 @@ func (httpSource *HTTPSource) GetSize(ctx context.Context) (int64, error) {
 	return size, nil
 }
 
+// GetModTime returns the Last-Modified time using HEAD request.
+// It returns the zero time when the header is absent or malformed.
+func (httpSource *HTTPSource) GetModTime(ctx context.Context) (time.Time, error) {
+	req, err := httpSource.newRequest(ctx, http.MethodHead)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("creating HEAD request: %w", err)
+	}
+
+	resp, err := httpSource.client.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("executing HEAD request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}, nil //nolint:nilerr // a missing Last-Modified is not an error.
+	}
+
+	return modTime, nil
+}
+
+// GetETag returns the ETag header using HEAD request, or "" when it is absent.
+func (httpSource *HTTPSource) GetETag(ctx context.Context) (string, error) {
+	req, err := httpSource.newRequest(ctx, http.MethodHead)
+	if err != nil {
+		return "", fmt.Errorf("creating HEAD request: %w", err)
+	}
+
+	resp, err := httpSource.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("executing HEAD request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// GetContentType returns the Content-Type header using HEAD request, or ""
+// when it is absent.
+func (httpSource *HTTPSource) GetContentType(ctx context.Context) (string, error) {
+	req, err := httpSource.newRequest(ctx, http.MethodHead)
+	if err != nil {
+		return "", fmt.Errorf("creating HEAD request: %w", err)
+	}
+
+	resp, err := httpSource.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("executing HEAD request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.Header.Get("Content-Type"), nil
+}
+
+// GetState returns the ETag, Last-Modified time and size of the file from a
+// single HEAD request.
+func (httpSource *HTTPSource) GetState(ctx context.Context) (RemoteState, error) {
+	req, err := httpSource.newRequest(ctx, http.MethodHead)
+	if err != nil {
+		return RemoteState{}, fmt.Errorf("creating HEAD request: %w", err)
+	}
+
+	resp, err := httpSource.client.Do(req)
+	if err != nil {
+		return RemoteState{}, fmt.Errorf("executing HEAD request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return RemoteState{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	state := RemoteState{ETag: resp.Header.Get("ETag"), Size: resp.ContentLength}
+
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err == nil {
+		state.ModTime = modTime
+	}
+
+	return state, nil
+}
+
+// Probe issues a HEAD request and returns the response status code.
+// Unlike GetSize it does not treat non-200 responses as errors, so callers
+// can tell an unreachable host from one that rejects the request.
+func (httpSource *HTTPSource) Probe(ctx context.Context) (int, error) {
+	req, err := httpSource.newRequest(ctx, http.MethodHead)
+	if err != nil {
+		return 0, fmt.Errorf("creating HEAD request: %w", err)
+	}
+
+	resp, err := httpSource.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("executing HEAD request: %w", err)
+	}
+
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
 // DownloadRange downloads bytes [start, end] inclusive.
 func (httpSource *HTTPSource) DownloadRange(ctx context.Context, start, end int64) (io.ReadCloser, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpSource.url, nil)
+	req, err := httpSource.newRequest(ctx, http.MethodGet)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
@@ -199,9 +513,14 @@ func (limited *limitedReadCloser) Close() error {
 }
 
 // AcceptsRanges reports whether the server accepts Range requests.
+// Presigned URLs always report false, which keeps them on a single stream.
 func (httpSource *HTTPSource) AcceptsRanges(ctx context.Context) (bool, error) {
+	if httpSource.presigned {
+		return false, nil
+	}
+
 	httpSource.rangeOnce.Do(func() {
-		req, err := http.NewRequestWithContext(ctx, http.MethodHead, httpSource.url, nil)
+		req, err := httpSource.newRequest(ctx, http.MethodHead)
 		if err != nil {
 			httpSource.acceptsRangesErr = fmt.Errorf("creating HEAD request: %w", err)
 
@@ -3,13 +3,17 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"xget/src/config"
 )
 
 func TestNewHTTPSourceDisablesHTTP2(t *testing.T) {
@@ -90,6 +94,67 @@ func TestHTTPSourceUsesHTTP1AgainstHTTP2Server(t *testing.T) {
 	}
 }
 
+func TestHTTPSourceVersionNegotiation(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		wantProto string
+	}{
+		{name: "default forces HTTP/1.1", version: "", wantProto: "HTTP/1.1"},
+		{name: "explicit 1.1", version: config.HTTPVersion1, wantProto: "HTTP/1.1"},
+		{name: "auto negotiates HTTP/2", version: config.HTTPVersionAuto, wantProto: "HTTP/2.0"},
+		{name: "forced HTTP/2", version: config.HTTPVersion2, wantProto: "HTTP/2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proto atomic.Value
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proto.Store(r.Proto)
+				_, _ = w.Write([]byte("ok"))
+			}))
+			server.EnableHTTP2 = true
+			server.StartTLS()
+
+			defer server.Close()
+
+			var options []HTTPOption
+			if tt.version != "" {
+				options = append(options, WithHTTPVersion(tt.version))
+			}
+
+			source := NewHTTPSource(server.URL, 5*time.Second, options...)
+
+			transport, ok := source.client.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("got transport type %T, want *http.Transport", source.client.Transport)
+			}
+
+			certPool := x509.NewCertPool()
+			certPool.AddCert(server.Certificate())
+
+			if transport.TLSClientConfig == nil {
+				transport.TLSClientConfig = &tls.Config{} //nolint:gosec // test server only
+			}
+
+			transport.TLSClientConfig.RootCAs = certPool
+
+			reader, _, err := source.Download(context.Background(), 0)
+			if err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+
+			reader.Close()
+
+			gotProto, _ := proto.Load().(string)
+			if gotProto != tt.wantProto {
+				t.Fatalf("got protocol %q, want %q", gotProto, tt.wantProto)
+			}
+		})
+	}
+}
+
 func TestDownloadRange(t *testing.T) {
 	content := []byte("0123456789abcdefghij")
 
@@ -185,3 +250,264 @@ func TestDownloadRange(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPSourceGetModTime(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{name: "last-modified present", modTime: modTime},
+		{name: "last-modified absent", modTime: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "file.bin", tt.modTime, bytes.NewReader([]byte("content")))
+			}))
+			defer server.Close()
+
+			source := NewHTTPSource(server.URL+"/file.bin", 5*time.Second)
+
+			got, err := source.GetModTime(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !got.Equal(tt.modTime) {
+				t.Errorf("expected mod time %v, got %v", tt.modTime, got)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceGetState(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader([]byte("content")))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL+"/file.bin", 5*time.Second)
+
+	state, err := source.GetState(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if state.ETag != `"v1"` || !state.ModTime.Equal(modTime) || state.Size != int64(len("content")) {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
+
+func TestHTTPSourceGetContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "report.json", time.Time{}, bytes.NewReader([]byte("{}")))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL+"/report.json", 5*time.Second)
+
+	contentType, err := source.GetContentType(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contentType != "application/json" {
+		t.Errorf("expected application/json, got %q", contentType)
+	}
+}
+
+func TestHTTPSourceHeaders(t *testing.T) {
+	var gotAuth, gotAgent []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		gotAgent = append(gotAgent, r.UserAgent())
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader([]byte("content")))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL+"/file.bin", 5*time.Second, WithHeaders(map[string]string{
+		"Authorization": "Bearer token",
+		"User-Agent":    "xget-test",
+	}))
+
+	_, err := source.GetSize(context.Background())
+	if err != nil {
+		t.Fatalf("GetSize: %v", err)
+	}
+
+	body, _, err := source.Download(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	body.Close()
+
+	for i := range gotAuth {
+		if gotAuth[i] != "Bearer token" || gotAgent[i] != "xget-test" {
+			t.Errorf("request %d: expected the headers, got Authorization %q and User-Agent %q", i, gotAuth[i], gotAgent[i])
+		}
+	}
+
+	if len(gotAuth) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(gotAuth))
+	}
+}
+
+func TestHTTPSourceHeadersNotSentToRedirectHost(t *testing.T) {
+	var gotToken []string
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = append(gotToken, r.Header.Get("X-Api-Key"))
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader([]byte("content")))
+	}))
+	defer other.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = append(gotToken, r.Header.Get("X-Api-Key"))
+
+		switch r.URL.Path {
+		case "/moved.bin":
+			http.Redirect(w, r, "/file.bin", http.StatusFound)
+		case "/elsewhere.bin":
+			http.Redirect(w, r, other.URL+"/file.bin", http.StatusFound)
+		default:
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader([]byte("content")))
+		}
+	}))
+	defer origin.Close()
+
+	for _, path := range []string{"/moved.bin", "/elsewhere.bin"} {
+		source := NewHTTPSource(origin.URL+path, 5*time.Second, WithHeaders(map[string]string{"X-Api-Key": "secret"}))
+
+		body, _, err := source.Download(context.Background(), 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+
+		body.Close()
+	}
+
+	// The same-host redirect keeps the header, the one to another host
+	// drops it.
+	want := []string{"secret", "secret", "secret", ""}
+	if strings.Join(gotToken, ",") != strings.Join(want, ",") {
+		t.Errorf("expected X-Api-Key %q, got %q", want, gotToken)
+	}
+}
+
+func TestIsPresignedURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://bucket.s3.amazonaws.com/key?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abc", want: true},
+		{url: "https://bucket.s3.amazonaws.com/key?x-amz-signature=abc", want: true},
+		{url: "https://bucket.s3.amazonaws.com/key?AWSAccessKeyId=AKIA&Expires=1&Signature=abc", want: true},
+		{url: "https://storage.googleapis.com/b/o?X-Goog-Signature=abc", want: true},
+		{url: "https://example.com/file.bin?signature=abc", want: false},
+		{url: "https://example.com/file.bin", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPresignedURL(tt.url); got != tt.want {
+			t.Errorf("IsPresignedURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPSourcePresigned(t *testing.T) {
+	var rangeRequests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL+"/file.bin?X-Amz-Signature=abc", 5*time.Second)
+
+	acceptsRanges, err := source.AcceptsRanges(context.Background())
+	if err != nil || acceptsRanges {
+		t.Errorf("expected presigned source to refuse ranges, got %v, %v", acceptsRanges, err)
+	}
+
+	_, _, err = source.Download(context.Background(), 0)
+	if err == nil || !strings.Contains(err.Error(), "presigned URL rejected") {
+		t.Errorf("expected presigned 403 error, got %v", err)
+	}
+
+	if rangeRequests.Load() != 0 {
+		t.Error("expected no Range requests for a presigned URL")
+	}
+}
+
+func TestParseTotalSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		contentLength int64
+		contentRange  string
+		offset        int64
+		want          int64
+	}{
+		{name: "full response", status: http.StatusOK, contentLength: 100, want: 100},
+		{name: "chunked full response", status: http.StatusOK, contentLength: -1, want: -1},
+		{name: "partial with range", status: http.StatusPartialContent, contentLength: 60, contentRange: "bytes 40-99/100", offset: 40, want: 100},
+		{name: "partial without range", status: http.StatusPartialContent, contentLength: 60, offset: 40, want: 100},
+		{name: "chunked partial", status: http.StatusPartialContent, contentLength: -1, offset: 40, want: -1},
+		{name: "unknown complete length", status: http.StatusPartialContent, contentLength: -1, contentRange: "bytes 40-99/*", offset: 40, want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, ContentLength: tt.contentLength, Header: http.Header{}}
+			if tt.contentRange != "" {
+				resp.Header.Set("Content-Range", tt.contentRange)
+			}
+
+			if got := parseTotalSize(resp, tt.offset); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceChunkedDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Flushing before the body is complete forces chunked encoding.
+		_, _ = w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer server.Close()
+
+	reader, size, err := NewHTTPSource(server.URL, 5*time.Second).Download(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer reader.Close()
+
+	if size != -1 {
+		t.Errorf("expected unknown size -1, got %d", size)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(data) != "first second" {
+		t.Errorf("expected %q, got %q", "first second", data)
+	}
+}
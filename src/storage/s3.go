@@ -2,23 +2,40 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
 	"xget/src/config"
+	"xget/src/tracing"
 )
 
 // S3Source implements Source for S3/MinIO storage.
 type S3Source struct {
-	client *s3.Client
+	alias  config.Alias
 	bucket string
 	key    string
+
+	// mu guards client, which is replaced when the bucket turns out to be
+	// in another region than the alias names.
+	mu     sync.Mutex
+	client *s3.Client
+
+	uploadAttempts   int
+	uploadRetryDelay time.Duration
+	onUploadRetry    func(attempt, attempts int, err error)
 }
 
 func newS3Source(url string, aliases map[string]config.Alias) (*S3Source, error) {
@@ -45,6 +62,7 @@ func newS3Source(url string, aliases map[string]config.Alias) (*S3Source, error)
 	}
 
 	return &S3Source{
+		alias:  alias,
 		client: client,
 		bucket: alias.Bucket,
 		key:    fullKey,
@@ -64,6 +82,7 @@ func NewS3SourceFromAlias(ctx context.Context, alias config.Alias, key string) (
 	}
 
 	return &S3Source{
+		alias:  alias,
 		client: client,
 		bucket: alias.Bucket,
 		key:    fullKey,
@@ -83,22 +102,34 @@ func parseS3URL(url string) (string, string, error) {
 	return parts[0], parts[1], nil
 }
 
+// createS3Client builds the client of alias. A bucket found to be in another
+// region than the alias names is signed for the region it is in.
 func createS3Client(ctx context.Context, alias config.Alias) (*s3.Client, error) {
 	var opts []func(*awsconfig.LoadOptions) error
 
+	region, ok := knownRegion(alias)
+	if ok {
+		alias.Region = region
+	}
+
 	// Set region if provided.
 	if alias.Region != "" {
 		opts = append(opts, awsconfig.WithRegion(alias.Region))
 	}
 
-	if alias.IsNoSignRequest() {
+	switch {
+	case alias.IsNoSignRequest():
 		opts = append(opts, awsconfig.WithCredentialsProvider(aws.AnonymousCredentials{}))
-	} else if alias.AccessKey != "" && alias.SecretKey != "" {
+	case alias.CredentialProcess != "":
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentialProcess(alias.CredentialProcess)))
+	case alias.AccessKey != "" && alias.SecretKey != "":
 		opts = append(opts, awsconfig.WithCredentialsProvider(
 			credentials.NewStaticCredentialsProvider(alias.AccessKey, alias.SecretKey, ""),
 		))
 	}
 
+	opts = append(opts, awsconfig.WithHTTPClient(tracing.WrapClient(newS3HTTPClient(alias))))
+
 	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("loading AWS config: %w", err)
@@ -116,6 +147,190 @@ func createS3Client(ctx context.Context, alias config.Alias) (*s3.Client, error)
 	return s3.NewFromConfig(cfg, clientOpts...), nil
 }
 
+// credentialProcesses shares one provider per credential_process command
+// across clients, so the helper runs once and again only when the
+// credentials it printed expire, rather than once per client.
+var credentialProcesses = struct {
+	mu        sync.Mutex
+	providers map[string]*aws.CredentialsCache
+}{providers: make(map[string]*aws.CredentialsCache)}
+
+// credentialProcess returns the provider running command, which must print
+// credentials in the AWS CLI credential_process JSON format. Credentials
+// with an Expiration are fetched again shortly before they expire.
+func credentialProcess(command string) *aws.CredentialsCache {
+	credentialProcesses.mu.Lock()
+	defer credentialProcesses.mu.Unlock()
+
+	provider, ok := credentialProcesses.providers[command]
+	if !ok {
+		provider = aws.NewCredentialsCache(processcreds.NewProvider(command))
+		credentialProcesses.providers[command] = provider
+	}
+
+	return provider
+}
+
+// ObjectInfo describes an object found by ListPrefix.
+type ObjectInfo struct {
+	// Key is relative to the alias prefix, so s3://alias/<Key> names it.
+	Key  string
+	Size int64
+	ETag string
+}
+
+// ListPrefix lists every object under prefix in the alias bucket, following
+// continuation tokens until the listing is complete.
+func ListPrefix(ctx context.Context, alias config.Alias, prefix string) ([]ObjectInfo, error) {
+	client, err := createS3Client(ctx, alias)
+	if err != nil {
+		return nil, fmt.Errorf("creating S3 client: %w", err)
+	}
+
+	objects, err := listPrefix(ctx, client, alias, prefix)
+
+	corrected, ok := regionClient(ctx, alias, client.Options().Region, err)
+	if ok {
+		return listPrefix(ctx, corrected, alias, prefix)
+	}
+
+	return objects, err
+}
+
+func listPrefix(ctx context.Context, client *s3.Client, alias config.Alias, prefix string) ([]ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(alias.Bucket),
+		Prefix: aws.String(alias.Prefix + prefix),
+	})
+
+	var objects []ObjectInfo
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s/%s: %w", alias.Bucket, alias.Prefix+prefix, err)
+		}
+
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:  strings.TrimPrefix(aws.ToString(object.Key), alias.Prefix),
+				Size: aws.ToInt64(object.Size),
+				ETag: aws.ToString(object.ETag),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// CheckAlias verifies that the alias endpoint is reachable and that its
+// credentials may list the bucket, using a ListObjectsV2 limited to one key.
+func CheckAlias(ctx context.Context, alias config.Alias) error {
+	client, err := createS3Client(ctx, alias)
+	if err != nil {
+		return fmt.Errorf("creating S3 client: %w", err)
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(alias.Bucket),
+		MaxKeys: aws.Int32(1),
+	}
+
+	if alias.Prefix != "" {
+		input.Prefix = aws.String(alias.Prefix)
+	}
+
+	_, err = client.ListObjectsV2(ctx, input)
+
+	corrected, ok := regionClient(ctx, alias, client.Options().Region, err)
+	if ok {
+		_, err = corrected.ListObjectsV2(ctx, input)
+	}
+
+	if err != nil {
+		return fmt.Errorf("listing bucket %s: %w", alias.Bucket, err)
+	}
+
+	return nil
+}
+
+// IsAuthError reports whether err is an S3 response rejected as
+// unauthenticated or forbidden (HTTP 401 or 403).
+func IsAuthError(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized) || hasStatus(err, http.StatusForbidden)
+}
+
+// IsTransientError reports whether err is a failure of the S3 endpoint
+// rather than of the request: a 5xx response, or a network error such as a
+// refused connection, a timeout or a dropped response.
+func IsTransientError(err error) bool {
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.HTTPStatusCode() >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// hasStatus reports whether err is an S3 response error with the given HTTP
+// status code.
+func hasStatus(err error, status int) bool {
+	var responseErr *awshttp.ResponseError
+	if !errors.As(err, &responseErr) {
+		return false
+	}
+
+	return responseErr.HTTPStatusCode() == status
+}
+
+// newS3HTTPClient builds the SDK HTTP client with the alias request and
+// connect timeouts, so an unresponsive endpoint cannot block forever.
+// Zero timeouts keep the SDK defaults.
+func newS3HTTPClient(alias config.Alias) *awshttp.BuildableClient {
+	client := awshttp.NewBuildableClient()
+
+	timeout := alias.TimeoutDuration()
+	if timeout > 0 {
+		client = client.WithTimeout(timeout)
+	}
+
+	connectTimeout := alias.ConnectTimeoutDuration()
+	if connectTimeout > 0 {
+		client = client.WithDialerOptions(func(dialer *net.Dialer) {
+			dialer.Timeout = connectTimeout
+		})
+	}
+
+	return client
+}
+
+func (s3Source *S3Source) currentClient() *s3.Client {
+	s3Source.mu.Lock()
+	defer s3Source.mu.Unlock()
+
+	return s3Source.client
+}
+
+func (s3Source *S3Source) headObject(ctx context.Context) (*s3.HeadObjectOutput, error) {
+	return inRegion(ctx, s3Source, func(client *s3.Client) (*s3.HeadObjectOutput, error) {
+		return client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(s3Source.bucket),
+			Key:    aws.String(s3Source.key),
+		})
+	})
+}
+
+func (s3Source *S3Source) getObject(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return inRegion(ctx, s3Source, func(client *s3.Client) (*s3.GetObjectOutput, error) {
+		return client.GetObject(ctx, input)
+	})
+}
+
 // Download retrieves the file content starting from the given offset.
 func (s3Source *S3Source) Download(ctx context.Context, offset int64) (io.ReadCloser, int64, error) {
 	input := &s3.GetObjectInput{
@@ -128,7 +343,15 @@ func (s3Source *S3Source) Download(ctx context.Context, offset int64) (io.ReadCl
 		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
 	}
 
-	result, err := s3Source.client.GetObject(ctx, input)
+	result, err := s3Source.getObject(ctx, input)
+	if err != nil && offset > 0 && hasStatus(err, http.StatusRequestedRangeNotSatisfiable) {
+		// The partial may already hold the whole object.
+		size, sizeErr := s3Source.GetSize(ctx)
+		if sizeErr == nil && size == offset {
+			return io.NopCloser(strings.NewReader("")), size, nil
+		}
+	}
+
 	if err != nil {
 		return nil, 0, fmt.Errorf("getting object: %w", err)
 	}
@@ -153,12 +376,7 @@ func (s3Source *S3Source) Download(ctx context.Context, offset int64) (io.ReadCl
 
 // GetSize returns the total size of the file.
 func (s3Source *S3Source) GetSize(ctx context.Context) (int64, error) {
-	input := &s3.HeadObjectInput{
-		Bucket: aws.String(s3Source.bucket),
-		Key:    aws.String(s3Source.key),
-	}
-
-	result, err := s3Source.client.HeadObject(ctx, input)
+	result, err := s3Source.headObject(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("head object: %w", err)
 	}
@@ -170,6 +388,61 @@ func (s3Source *S3Source) GetSize(ctx context.Context) (int64, error) {
 	return *result.ContentLength, nil
 }
 
+// GetModTime returns the LastModified time of the object.
+func (s3Source *S3Source) GetModTime(ctx context.Context) (time.Time, error) {
+	result, err := s3Source.headObject(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("head object: %w", err)
+	}
+
+	if result.LastModified == nil {
+		return time.Time{}, nil
+	}
+
+	return *result.LastModified, nil
+}
+
+// GetETag returns the ETag of the object.
+func (s3Source *S3Source) GetETag(ctx context.Context) (string, error) {
+	result, err := s3Source.headObject(ctx)
+	if err != nil {
+		return "", fmt.Errorf("head object: %w", err)
+	}
+
+	return aws.ToString(result.ETag), nil
+}
+
+// GetContentType returns the ContentType of the object.
+func (s3Source *S3Source) GetContentType(ctx context.Context) (string, error) {
+	result, err := s3Source.headObject(ctx)
+	if err != nil {
+		return "", fmt.Errorf("head object: %w", err)
+	}
+
+	return aws.ToString(result.ContentType), nil
+}
+
+// GetState returns the ETag, LastModified time and size of the object from
+// a single HeadObject request.
+func (s3Source *S3Source) GetState(ctx context.Context) (RemoteState, error) {
+	result, err := s3Source.headObject(ctx)
+	if err != nil {
+		return RemoteState{}, fmt.Errorf("head object: %w", err)
+	}
+
+	state := RemoteState{ETag: aws.ToString(result.ETag), Size: -1}
+
+	if result.LastModified != nil {
+		state.ModTime = *result.LastModified
+	}
+
+	if result.ContentLength != nil {
+		state.Size = *result.ContentLength
+	}
+
+	return state, nil
+}
+
 // DownloadRange downloads bytes [start, end] inclusive.
 func (s3Source *S3Source) DownloadRange(ctx context.Context, start, end int64) (io.ReadCloser, error) {
 	input := &s3.GetObjectInput{
@@ -178,7 +451,7 @@ func (s3Source *S3Source) DownloadRange(ctx context.Context, start, end int64) (
 		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
 	}
 
-	result, err := s3Source.client.GetObject(ctx, input)
+	result, err := s3Source.getObject(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("getting object range: %w", err)
 	}
@@ -192,26 +465,35 @@ func (s3Source *S3Source) AcceptsRanges(_ context.Context) (bool, error) {
 	return true, nil
 }
 
-// Upload uploads content to S3.
-func (s3Source *S3Source) Upload(ctx context.Context, reader io.Reader) error {
-	_, err := s3Source.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s3Source.bucket),
-		Key:    aws.String(s3Source.key),
-		Body:   reader,
+// Delete removes the object.
+func (s3Source *S3Source) Delete(ctx context.Context) error {
+	_, err := inRegion(ctx, s3Source, func(client *s3.Client) (*s3.DeleteObjectOutput, error) {
+		return client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s3Source.bucket),
+			Key:    aws.String(s3Source.key),
+		})
 	})
 	if err != nil {
-		return fmt.Errorf("putting object: %w", err)
+		return fmt.Errorf("deleting object: %w", err)
 	}
 
 	return nil
 }
 
+// GetMetadata returns the user-defined metadata of the object, with keys in
+// lower case as S3 returns them.
+func (s3Source *S3Source) GetMetadata(ctx context.Context) (map[string]string, error) {
+	output, err := s3Source.headObject(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("head object: %w", err)
+	}
+
+	return output.Metadata, nil
+}
+
 // Exists checks if the object exists in S3.
 func (s3Source *S3Source) Exists(ctx context.Context) (bool, error) {
-	_, err := s3Source.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(s3Source.bucket),
-		Key:    aws.String(s3Source.key),
-	})
+	_, err := s3Source.headObject(ctx)
 	if err != nil {
 		// Check if it's a "not found" error.
 		if strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "404") {
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestCredentialProcess(t *testing.T) {
+	var authorized atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Authorization"), "Credential=AKIDPROCESS/") &&
+			r.Header.Get("X-Amz-Security-Token") == "token" {
+			authorized.Add(1)
+		}
+
+		w.Header().Set("Content-Length", "7")
+	}))
+	defer server.Close()
+
+	alias := config.Alias{
+		Endpoint: server.URL,
+		Region:   "us-east-1",
+		Bucket:   "artifacts",
+		CredentialProcess: `echo '{"Version": 1, "AccessKeyId": "AKIDPROCESS", ` +
+			`"SecretAccessKey": "secret", "SessionToken": "token"}'`,
+	}
+
+	for range 2 {
+		source, err := NewS3SourceFromAlias(context.Background(), alias, "file.bin")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		size, err := source.GetSize(context.Background())
+		if err != nil || size != 7 {
+			t.Fatalf("expected size 7, got %d, %v", size, err)
+		}
+	}
+
+	if authorized.Load() != 2 {
+		t.Errorf("expected both requests signed with the process credentials, got %d", authorized.Load())
+	}
+
+	if credentialProcess(alias.CredentialProcess) != credentialProcess(alias.CredentialProcess) {
+		t.Error("expected clients to share the provider of a command")
+	}
+}
+
+func TestRegionMismatch(t *testing.T) {
+	content := "object in eu-west-1"
+
+	var mismatched atomic.Int32
+
+	// The bucket lives in eu-west-1. HEAD requests signed for another region
+	// are redirected without a body; GETs are refused as S3 does.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/s3/") {
+			mismatched.Add(1)
+
+			if r.Method == http.MethodHead {
+				w.Header().Set("X-Amz-Bucket-Region", "eu-west-1")
+				w.WriteHeader(http.StatusMovedPermanently)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `<Error><Code>AuthorizationHeaderMalformed</Code>`+
+				`<Message>The authorization header is malformed; the region 'us-east-1' is wrong; `+
+				`expecting 'eu-west-1'</Message></Error>`)
+
+			return
+		}
+
+		w.Header().Set("Content-Length", "19")
+
+		if r.Method == http.MethodGet {
+			_, _ = io.WriteString(w, content)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	get := config.Alias{Endpoint: server.URL, Region: "us-east-1", Bucket: "get", AccessKey: "key", SecretKey: "secret"}
+
+	source, err := NewS3SourceFromAlias(ctx, get, "file.bin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, _, err := source.Download(ctx, 0)
+	if err != nil {
+		t.Fatalf("expected the download to follow the region, got %v", err)
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+
+	if err != nil || string(data) != content {
+		t.Fatalf("expected %q, got %q, %v", content, data, err)
+	}
+
+	head := get
+	head.Bucket = "head"
+
+	for range 2 {
+		source, err := NewS3SourceFromAlias(ctx, head, "file.bin")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exists, err := source.Exists(ctx)
+		if err != nil || !exists {
+			t.Fatalf("expected the object to exist, got %v, %v", exists, err)
+		}
+	}
+
+	// One mismatch per bucket: later clients of the alias sign for the
+	// region found.
+	if mismatched.Load() != 2 {
+		t.Errorf("expected 2 mismatched requests, got %d", mismatched.Load())
+	}
+}
+
+func TestUploadMultipartRetriesFailedPart(t *testing.T) {
+	defer func(size int64) { uploadPartSize = size }(uploadPartSize)
+
+	uploadPartSize = 4
+
+	var (
+		mu        sync.Mutex
+		parts     = map[string]string{}
+		failed    bool
+		completed string
+		aborted   bool
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		query := r.URL.Query()
+
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			_, _ = io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && query.Get("partNumber") != "":
+			body, _ := io.ReadAll(r.Body)
+
+			// The second part fails once with an error the SDK does not retry.
+			if query.Get("partNumber") == "2" && !failed {
+				failed = true
+
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = io.WriteString(w, `<Error><Code>BadDigest</Code><Message>transient</Message></Error>`)
+
+				return
+			}
+
+			parts[query.Get("partNumber")] = string(body)
+			w.Header().Set("ETag", `"etag-`+query.Get("partNumber")+`"`)
+		case r.Method == http.MethodPost && query.Get("uploadId") != "":
+			completed = parts["1"] + parts["2"] + parts["3"]
+			_, _ = io.WriteString(w, `<CompleteMultipartUploadResult><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodDelete:
+			aborted = true
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer server.Close()
+
+	alias := config.Alias{Endpoint: server.URL, Region: "us-east-1", Bucket: "cache", AccessKey: "key", SecretKey: "secret"}
+
+	source, err := NewS3SourceFromAlias(context.Background(), alias, "file.bin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var retries int
+
+	source.SetUploadRetryPolicy(2, 0, func(_, _ int, _ error) { retries++ })
+
+	content := "0123456789"
+
+	err = source.Upload(context.Background(), strings.NewReader(content), int64(len(content)), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if completed != content {
+		t.Errorf("expected the parts to assemble %q, got %q", content, completed)
+	}
+
+	if retries != 1 || aborted {
+		t.Errorf("expected one retried part and no abort, got %d retries, aborted %v", retries, aborted)
+	}
+}
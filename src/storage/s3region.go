@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sync"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"xget/src/config"
+)
+
+// expectedRegionPattern finds the region named by the message of an
+// AuthorizationHeaderMalformed error, e.g. "the region 'us-east-1' is
+// wrong; expecting 'eu-west-1'".
+var expectedRegionPattern = regexp.MustCompile(`expecting '([a-z0-9-]+)'`)
+
+// bucketRegions remembers the region each alias bucket turned out to be in,
+// keyed by regionKey, so clients created later for the alias sign for the
+// right region from the first request.
+var bucketRegions = struct {
+	mu      sync.Mutex
+	regions map[string]string
+}{regions: make(map[string]string)}
+
+func regionKey(alias config.Alias) string {
+	return alias.Endpoint + "\x00" + alias.Bucket + "\x00" + alias.Region
+}
+
+// knownRegion returns the region recorded for the bucket of alias.
+func knownRegion(alias config.Alias) (string, bool) {
+	bucketRegions.mu.Lock()
+	defer bucketRegions.mu.Unlock()
+
+	region, ok := bucketRegions.regions[regionKey(alias)]
+
+	return region, ok
+}
+
+func rememberRegion(alias config.Alias, region string) {
+	bucketRegions.mu.Lock()
+	defer bucketRegions.mu.Unlock()
+
+	bucketRegions.regions[regionKey(alias)] = region
+}
+
+// regionFromError returns the region an S3 error says the bucket is in: the
+// x-amz-bucket-region header of a 301 or 307 redirect or of a 400
+// AuthorizationHeaderMalformed response, or the region its message expects.
+func regionFromError(err error) (string, bool) {
+	var responseErr *awshttp.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.Response == nil {
+		return "", false
+	}
+
+	switch responseErr.HTTPStatusCode() {
+	case http.StatusMovedPermanently, http.StatusTemporaryRedirect, http.StatusBadRequest:
+	default:
+		return "", false
+	}
+
+	region := responseErr.Response.Header.Get("X-Amz-Bucket-Region")
+	if region != "" {
+		return region, true
+	}
+
+	match := expectedRegionPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+// regionClient returns a client for the region err says the bucket of alias
+// is in, when that differs from the region the failed request was signed
+// for, and records the region for later clients.
+func regionClient(ctx context.Context, alias config.Alias, signedRegion string, err error) (*s3.Client, bool) {
+	region, ok := regionFromError(err)
+	if !ok || region == signedRegion {
+		return nil, false
+	}
+
+	rememberRegion(alias, region)
+
+	client, clientErr := createS3Client(ctx, alias)
+	if clientErr != nil {
+		return nil, false
+	}
+
+	return client, true
+}
+
+// inRegion runs call with the client of s3Source. When the bucket turns out
+// to be in another region than the client signs for, the client is replaced
+// by one for that region and call is run once more.
+func inRegion[T any](ctx context.Context, s3Source *S3Source, call func(*s3.Client) (T, error)) (T, error) {
+	client := s3Source.currentClient()
+
+	result, err := call(client)
+	if err == nil {
+		return result, nil
+	}
+
+	corrected, ok := regionClient(ctx, s3Source.alias, client.Options().Region, err)
+	if !ok {
+		return result, err
+	}
+
+	s3Source.mu.Lock()
+	s3Source.client = corrected
+	s3Source.mu.Unlock()
+
+	return call(corrected)
+}
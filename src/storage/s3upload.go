@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxUploadParts is the most parts S3 accepts in one multipart upload.
+const maxUploadParts = 10000
+
+// uploadPartSize is the size of each part of a multipart upload. Objects
+// larger than one part are uploaded in parts, so a failed part is sent again
+// on its own rather than with the whole object. A variable for tests.
+var uploadPartSize int64 = 64 << 20
+
+// SetUploadRetryPolicy sets how often Upload attempts the object, or each
+// part of a multipart upload, and the delay between attempts. report, when
+// not nil, is called with each failed attempt that is retried. Values below
+// 1 and negative delays are ignored.
+func (s3Source *S3Source) SetUploadRetryPolicy(
+	attempts int,
+	delay time.Duration,
+	report func(attempt, attempts int, err error),
+) {
+	if attempts >= 1 {
+		s3Source.uploadAttempts = attempts
+	}
+
+	if delay >= 0 {
+		s3Source.uploadRetryDelay = delay
+	}
+
+	s3Source.onUploadRetry = report
+}
+
+// Upload uploads the size bytes of body to S3, storing metadata as
+// user-defined object metadata (x-amz-meta-*). metadata may be nil. Bodies
+// larger than one part use a multipart upload. Failed requests are retried
+// per the upload retry policy, except for rejected credentials.
+func (s3Source *S3Source) Upload(ctx context.Context, body io.ReaderAt, size int64, metadata map[string]string) error {
+	if size > uploadPartSize {
+		return s3Source.uploadMultipart(ctx, body, size, metadata)
+	}
+
+	// Uploads are not retried in another region; the HeadObject that
+	// precedes them corrects the client.
+	return s3Source.retryUpload(ctx, func() error {
+		_, err := s3Source.currentClient().PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(s3Source.bucket),
+			Key:           aws.String(s3Source.key),
+			Body:          io.NewSectionReader(body, 0, size),
+			ContentLength: aws.Int64(size),
+			Metadata:      metadata,
+		})
+		if err != nil {
+			return fmt.Errorf("putting object: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// uploadMultipart uploads body in parts of at least uploadPartSize, retrying
+// each part on its own. A failed upload is aborted so its parts are not
+// left stored.
+func (s3Source *S3Source) uploadMultipart(
+	ctx context.Context,
+	body io.ReaderAt,
+	size int64,
+	metadata map[string]string,
+) error {
+	var uploadID *string
+
+	err := s3Source.retryUpload(ctx, func() error {
+		output, err := s3Source.currentClient().CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:   aws.String(s3Source.bucket),
+			Key:      aws.String(s3Source.key),
+			Metadata: metadata,
+		})
+		if err != nil {
+			return fmt.Errorf("creating multipart upload: %w", err)
+		}
+
+		uploadID = output.UploadId
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s3Source.uploadParts(ctx, uploadID, body, size)
+	if err != nil {
+		// The upload is aborted even when ctx was cancelled.
+		abortCtx := context.WithoutCancel(ctx)
+
+		_, abortErr := s3Source.currentClient().AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s3Source.bucket),
+			Key:      aws.String(s3Source.key),
+			UploadId: uploadID,
+		})
+		if abortErr != nil {
+			return errors.Join(err, fmt.Errorf("aborting multipart upload: %w", abortErr))
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s3Source *S3Source) uploadParts(ctx context.Context, uploadID *string, body io.ReaderAt, size int64) error {
+	partSize := max(uploadPartSize, (size+maxUploadParts-1)/maxUploadParts)
+
+	var completed []types.CompletedPart
+
+	for offset := int64(0); offset < size; offset += partSize {
+		partNumber := aws.Int32(int32(len(completed) + 1)) //nolint:gosec // at most maxUploadParts parts
+		length := min(partSize, size-offset)
+
+		err := s3Source.retryUpload(ctx, func() error {
+			output, err := s3Source.currentClient().UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        aws.String(s3Source.bucket),
+				Key:           aws.String(s3Source.key),
+				UploadId:      uploadID,
+				PartNumber:    partNumber,
+				Body:          io.NewSectionReader(body, offset, length),
+				ContentLength: aws.Int64(length),
+			})
+			if err != nil {
+				return fmt.Errorf("uploading part %d: %w", *partNumber, err)
+			}
+
+			completed = append(completed, types.CompletedPart{ETag: output.ETag, PartNumber: partNumber})
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s3Source.retryUpload(ctx, func() error {
+		_, err := s3Source.currentClient().CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(s3Source.bucket),
+			Key:             aws.String(s3Source.key),
+			UploadId:        uploadID,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+		})
+		if err != nil {
+			return fmt.Errorf("completing multipart upload: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// retryUpload runs op, one upload request, up to the upload attempts. Auth
+// errors are returned at once, as repeating the request cannot fix them.
+func (s3Source *S3Source) retryUpload(ctx context.Context, op func() error) error {
+	attempts := max(s3Source.uploadAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= attempts || IsAuthError(err) || ctx.Err() != nil {
+			return err
+		}
+
+		if s3Source.onUploadRetry != nil {
+			s3Source.onUploadRetry(attempt, attempts, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(s3Source.uploadRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// stdinSource is shared by every NewSource call for config.StdinURL, so a
+// retry sees that stdin was already consumed instead of reading nothing.
+var stdinSource = NewStdinSource(os.Stdin)
+
+// StdinSource serves file content from a pipe. It can be read only once and
+// its size is not known in advance.
+type StdinSource struct {
+	reader io.Reader
+
+	mu       sync.Mutex
+	consumed bool
+}
+
+// NewStdinSource creates a StdinSource reading from reader.
+func NewStdinSource(reader io.Reader) *StdinSource {
+	return &StdinSource{reader: reader}
+}
+
+// Download returns the remaining input. The total size is reported as -1.
+func (stdin *StdinSource) Download(_ context.Context, offset int64) (io.ReadCloser, int64, error) {
+	if offset > 0 {
+		return nil, 0, errors.New("stdin cannot be resumed")
+	}
+
+	stdin.mu.Lock()
+	defer stdin.mu.Unlock()
+
+	if stdin.consumed {
+		return nil, 0, errors.New("stdin was already read")
+	}
+
+	stdin.consumed = true
+
+	return io.NopCloser(stdin.reader), -1, nil
+}
+
+// GetSize always fails, as the size of piped input is not known in advance.
+func (stdin *StdinSource) GetSize(_ context.Context) (int64, error) {
+	return 0, errors.New("size of stdin is not known")
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStdinSourceReadsOnce(t *testing.T) {
+	source := NewStdinSource(strings.NewReader("piped content"))
+
+	reader, size, err := source.Download(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if size != -1 {
+		t.Errorf("expected unknown size -1, got %d", size)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(data) != "piped content" {
+		t.Errorf("expected %q, got %q", "piped content", data)
+	}
+
+	_, _, err = source.Download(context.Background(), 0)
+	if err == nil {
+		t.Fatal("expected error reading stdin twice")
+	}
+}
+
+func TestStdinSourceRejectsResume(t *testing.T) {
+	source := NewStdinSource(strings.NewReader("piped content"))
+
+	_, _, err := source.Download(context.Background(), 5)
+	if err == nil {
+		t.Fatal("expected error resuming stdin")
+	}
+}
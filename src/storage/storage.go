@@ -31,13 +31,70 @@ type RangeSource interface {
 	AcceptsRanges(ctx context.Context) (bool, error)
 }
 
+// ModTimeSource is implemented by sources that report when the remote file
+// was last modified.
+type ModTimeSource interface {
+	Source
+
+	// GetModTime returns the remote modification time, or the zero time when
+	// the source does not report one.
+	GetModTime(ctx context.Context) (time.Time, error)
+}
+
+// ETagSource is implemented by sources that report an entity tag for the
+// remote file.
+type ETagSource interface {
+	Source
+
+	// GetETag returns the remote ETag as sent by the server, or "" when the
+	// source does not report one.
+	GetETag(ctx context.Context) (string, error)
+}
+
+// ContentTypeSource is implemented by sources that report the media type of
+// the remote file.
+type ContentTypeSource interface {
+	Source
+
+	// GetContentType returns the Content-Type as sent by the server, or ""
+	// when the source does not report one.
+	GetContentType(ctx context.Context) (string, error)
+}
+
+// RemoteState is what one HEAD request reports about a remote file. ETag is
+// as sent by the server, ModTime is zero and Size -1 when not reported.
+type RemoteState struct {
+	ETag    string    `json:"etag"`
+	ModTime time.Time `json:"last_modified"`
+	Size    int64     `json:"size"`
+}
+
+// StateSource is implemented by sources that report the ETag, modification
+// time and size of the remote file in a single request.
+type StateSource interface {
+	Source
+
+	// GetState returns the current state of the remote file.
+	GetState(ctx context.Context) (RemoteState, error)
+}
+
 // NewSource creates a Source based on the URL scheme.
-func NewSource(url string, aliases map[string]config.Alias, timeout time.Duration) (Source, error) {
+// The HTTP options apply only to http:// and https:// URLs.
+func NewSource(
+	url string,
+	aliases map[string]config.Alias,
+	timeout time.Duration,
+	httpOptions ...HTTPOption,
+) (Source, error) {
 	switch {
+	case url == config.StdinURL:
+		return stdinSource, nil
+	case config.IsDataURL(url):
+		return NewDataSource(url)
 	case strings.HasPrefix(url, "s3://"):
 		return newS3Source(url, aliases)
 	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
-		return NewHTTPSource(url, timeout), nil
+		return NewHTTPSource(url, timeout, httpOptions...), nil
 	default:
 		return nil, fmt.Errorf("unsupported URL scheme: %s", url)
 	}
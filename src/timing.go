@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings holds per-file latency measurements.
+// Connect and TTFB describe the first request of the last source download
+// attempt; they stay zero when the file was skipped or restored from cache.
+type Timings struct {
+	Connect time.Duration
+	TTFB    time.Duration
+	Total   time.Duration
+}
+
+// timingTrace records connection and first-byte latency of the requests made
+// under a context. It relies on net/http/httptrace, which both the HTTP source
+// and the AWS SDK honour through the request context.
+type timingTrace struct {
+	mu      sync.Mutex
+	start   time.Time
+	connect time.Duration
+	ttfb    time.Duration
+}
+
+// attach resets the trace and returns a context that records into it.
+func (trace *timingTrace) attach(ctx context.Context) context.Context {
+	trace.mu.Lock()
+	trace.start = time.Now()
+	trace.connect = 0
+	trace.ttfb = 0
+	trace.mu.Unlock()
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			trace.record(&trace.connect)
+		},
+		GotFirstResponseByte: func() {
+			trace.record(&trace.ttfb)
+		},
+	})
+}
+
+// record stores the time elapsed since start into target unless it is
+// already set, so only the first event of concurrent requests counts.
+func (trace *timingTrace) record(target *time.Duration) {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	if *target == 0 {
+		*target = max(time.Since(trace.start), time.Nanosecond)
+	}
+}
+
+// fill copies the recorded latencies into timings.
+func (trace *timingTrace) fill(timings *Timings) {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	timings.Connect = trace.connect
+	timings.TTFB = trace.ttfb
+}
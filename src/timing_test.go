@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTimingTraceRecordsLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("payload"))
+	}))
+	defer server.Close()
+
+	trace := &timingTrace{}
+	ctx := trace.attach(t.Context())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("executing request: %v", err)
+	}
+
+	resp.Body.Close()
+
+	var timings Timings
+
+	trace.fill(&timings)
+
+	if timings.Connect <= 0 {
+		t.Errorf("expected connect time to be recorded, got %v", timings.Connect)
+	}
+
+	if timings.TTFB < timings.Connect {
+		t.Errorf("expected ttfb %v to be at least connect %v", timings.TTFB, timings.Connect)
+	}
+
+	// Re-attaching starts a fresh attempt with cleared measurements.
+	trace.attach(t.Context())
+	trace.fill(&timings)
+
+	if timings.Connect != 0 || timings.TTFB != 0 {
+		t.Errorf("expected timings reset on attach, got %+v", timings)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !otel
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+)
+
+// Setup reports that tracing is not compiled in. Build with -tags otel to
+// export spans.
+func Setup(context.Context) (func(context.Context) error, error) {
+	return func(context.Context) error { return nil }, nil
+}
+
+// Start returns ctx and a span that records nothing.
+func Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// FromContext returns a span that records nothing.
+func FromContext(context.Context) Span {
+	return noopSpan{}
+}
+
+// WrapClient returns client, as there is nothing to trace.
+func WrapClient(client Doer) Doer {
+	return client
+}
+
+// WrapTransport returns transport, as there is nothing to trace.
+func WrapTransport(transport http.RoundTripper) http.RoundTripper {
+	return transport
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+
+func (noopSpan) RecordError(error) {}
+
+func (noopSpan) End() {}
@@ -0,0 +1,37 @@
+//go:build !otel
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestNoopPassesThrough(t *testing.T) {
+	shutdown, err := Setup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = shutdown(context.Background())
+	if err != nil {
+		t.Errorf("unexpected shutdown error: %v", err)
+	}
+
+	if WrapTransport(http.DefaultTransport) != http.DefaultTransport {
+		t.Error("expected the transport to be returned unwrapped")
+	}
+
+	client := &http.Client{}
+	if WrapClient(client) != Doer(client) {
+		t.Error("expected the client to be returned unwrapped")
+	}
+
+	ctx := context.Background()
+
+	got, _ := Start(ctx, "span")
+	if got != ctx {
+		t.Error("expected Start to return the context unchanged")
+	}
+}
@@ -0,0 +1,211 @@
+//go:build otel
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "xget"
+
+// enabled is set once Setup has installed a tracer provider, so clients
+// created before, or without, tracing stay unwrapped.
+var enabled atomic.Bool
+
+// Setup installs a tracer provider exporting spans over OTLP/HTTP. The
+// exporter, sampler, batching and resource honor the standard OTEL_*
+// environment variables, e.g. OTEL_EXPORTER_OTLP_ENDPOINT and
+// OTEL_SERVICE_NAME. OTEL_SDK_DISABLED=true or OTEL_TRACES_EXPORTER=none
+// turn tracing off. The returned function flushes the pending spans.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return noop, nil
+	}
+
+	tracesExporter := os.Getenv("OTEL_TRACES_EXPORTER")
+
+	switch tracesExporter {
+	case "", "otlp":
+	case "none":
+		return noop, nil
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER %q is not supported, use otlp or none", tracesExporter)
+	}
+
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"} {
+		protocol := os.Getenv(name)
+		if protocol != "" && protocol != "http/protobuf" {
+			return nil, fmt.Errorf("%s %q is not supported, use http/protobuf", name, protocol)
+		}
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", tracerName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	enabled.Store(true)
+
+	return provider.Shutdown, nil
+}
+
+// Start begins a span named name as a child of the span in ctx.
+func Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(convert(attributes)...))
+
+	return ctx, otelSpan{span: span}
+}
+
+// FromContext returns the span in ctx, or one that records nothing.
+func FromContext(ctx context.Context) Span {
+	return otelSpan{span: trace.SpanFromContext(ctx)}
+}
+
+func inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (wrapped otelSpan) SetAttributes(attributes ...Attribute) {
+	wrapped.span.SetAttributes(convert(attributes)...)
+}
+
+func (wrapped otelSpan) RecordError(err error) {
+	wrapped.span.RecordError(err)
+	wrapped.span.SetStatus(codes.Error, err.Error())
+}
+
+func (wrapped otelSpan) End() {
+	wrapped.span.End()
+}
+
+func convert(attributes []Attribute) []attribute.KeyValue {
+	converted := make([]attribute.KeyValue, 0, len(attributes))
+
+	for _, attr := range attributes {
+		switch value := attr.Value.(type) {
+		case int64:
+			converted = append(converted, attribute.Int64(attr.Key, value))
+		default:
+			converted = append(converted, attribute.String(attr.Key, fmt.Sprint(value)))
+		}
+	}
+
+	return converted
+}
+
+// WrapClient returns client with each request in a span of its own, once
+// Setup has enabled tracing, and client itself otherwise.
+func WrapClient(client Doer) Doer {
+	if !enabled.Load() {
+		return client
+	}
+
+	return tracedClient{client: client}
+}
+
+// WrapTransport returns transport with each request in a span of its own,
+// once Setup has enabled tracing, and transport itself otherwise.
+func WrapTransport(transport http.RoundTripper) http.RoundTripper {
+	if !enabled.Load() {
+		return transport
+	}
+
+	return tracedTransport{transport: transport}
+}
+
+type tracedClient struct {
+	client Doer
+}
+
+func (traced tracedClient) Do(req *http.Request) (*http.Response, error) {
+	return traceRequest(req, traced.client.Do)
+}
+
+type tracedTransport struct {
+	transport http.RoundTripper
+}
+
+func (traced tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return traceRequest(req, traced.transport.RoundTrip)
+}
+
+// traceRequest sends req in a span that ends once the response headers
+// arrive; the body is accounted to the enclosing download span. The trace
+// context is propagated in the request headers.
+func traceRequest(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method,
+		String("http.request.method", req.Method),
+		String("url.full", redactURL(req.URL)),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	inject(ctx, req.Header)
+
+	resp, err := send(req)
+	if err != nil {
+		span.RecordError(err)
+
+		return resp, err
+	}
+
+	span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+
+	if resp.ContentLength >= 0 {
+		span.SetAttributes(Int64("http.response.body.size", resp.ContentLength))
+	}
+
+	return resp, nil
+}
+
+// redactURL returns u without userinfo and query, which may carry
+// credentials or presigned signatures.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+
+	return redacted.String()
+}
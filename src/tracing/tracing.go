@@ -0,0 +1,39 @@
+// Package tracing wraps downloads, cache operations and HTTP requests in
+// OpenTelemetry spans. Builds without the otel tag compile a no-op
+// implementation, so the default binary carries no tracing dependencies.
+package tracing
+
+import "net/http"
+
+// Attribute is a key-value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 returns an integer attribute.
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Span is an operation in progress. End must be called once.
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Doer sends HTTP requests, as *http.Client and the AWS SDK clients do.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
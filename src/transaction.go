@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+)
+
+// errRolledBack is the error of a file that was written, then removed again
+// because another file of its transactional run failed. Its dest is not in
+// place, so it is reported and retried like a failed file.
+var errRolledBack = errors.New("rolled back (settings.transactional)")
+
+// transaction records the dests written during one Download, for
+// settings.transactional. A nil transaction records nothing.
+type transaction struct {
+	mu      sync.Mutex
+	written []string
+}
+
+// newTransaction returns a transaction when enabled, and nil otherwise.
+func newTransaction(enabled bool) *transaction {
+	if !enabled {
+		return nil
+	}
+
+	return &transaction{}
+}
+
+// record notes that dest was written by this run.
+func (tx *transaction) record(dest string) {
+	if tx == nil {
+		return
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.written = append(tx.written, dest)
+}
+
+// rollback removes every recorded dest together with its sidecars, and
+// returns the dests removed, sorted. Dests that could not be removed are
+// returned as errors instead.
+func (tx *transaction) rollback() ([]string, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	var (
+		removed []string
+		errs    []error
+	)
+
+	for _, dest := range tx.written {
+		err := os.Remove(dest)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("rolling back %s: %w", dest, err))
+
+			continue
+		}
+
+		discardETagSidecar(dest)
+		discardHeadSidecar(dest)
+		os.Remove(dest + ".sha256")
+
+		removed = append(removed, dest)
+	}
+
+	tx.written = nil
+	slices.Sort(removed)
+
+	return removed, errors.Join(errs...)
+}
+
+// rollBack undoes the writes of a Download in which any file failed, for
+// settings.transactional, so the set is not left half updated. Dests that
+// were already up to date are never touched. The results of removed dests
+// are set to errRolledBack.
+func (downloader *Downloader) rollBack(tx *transaction, results []DownloadResult) {
+	if tx == nil || !slices.ContainsFunc(results, func(result DownloadResult) bool { return result.Error != nil }) {
+		return
+	}
+
+	removed, err := tx.rollback()
+	if err != nil {
+		downloader.warn("%v", err)
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+
+	for i := range results {
+		if results[i].Error != nil {
+			continue
+		}
+
+		_, found := slices.BinarySearch(removed, results[i].File.Dest)
+		if found {
+			results[i].Error = errRolledBack
+		}
+	}
+
+	fmt.Printf("rolling back %d files written this run (settings.transactional):\n", len(removed))
+
+	for _, dest := range removed {
+		fmt.Printf("  removed %s\n", dest)
+	}
+}
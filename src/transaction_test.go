@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestDownloadTransactional(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		corrupt      bool
+		wantFreshOut bool
+	}{
+		{name: "all verified", corrupt: false, wantFreshOut: false},
+		{name: "one mismatch", corrupt: true, wantFreshOut: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			kept := filepath.Join(dir, "kept.bin")
+			fresh := filepath.Join(dir, "fresh.bin")
+
+			err := os.WriteFile(kept, []byte("content of /kept.bin"), 0o644)
+			if err != nil {
+				t.Fatalf("writing dest: %v", err)
+			}
+
+			lastSum := sha256Hex("content of /last.bin")
+			if tt.corrupt {
+				lastSum = strings.Repeat("a", 64)
+			}
+
+			cfg := &config.Config{
+				Settings: config.Settings{
+					Parallel: 1, Retries: 1, MetadataRetries: 1, SingleStream: "true", Transactional: "true",
+					WriteChecksumSidecar: "true", ProgressMode: config.ProgressModeCI,
+				},
+				Files: []config.FileEntry{
+					{URL: server.URL + "/kept.bin", Dest: kept, SHA256: sha256Hex("content of /kept.bin")},
+					{URL: server.URL + "/fresh.bin", Dest: fresh, SHA256: sha256Hex("content of /fresh.bin")},
+					{URL: server.URL + "/last.bin", Dest: filepath.Join(dir, "last.bin"), SHA256: lastSum},
+				},
+			}
+
+			results := NewDownloader(cfg, nil).Download(context.Background())
+
+			if (results[2].Error != nil) != tt.corrupt {
+				t.Fatalf("unexpected result for the last file: %v", results[2].Error)
+			}
+
+			if results[0].Error != nil {
+				t.Errorf("expected the dest that was already in place to succeed, got %v", results[0].Error)
+			}
+
+			if errors.Is(results[1].Error, errRolledBack) != tt.corrupt {
+				t.Errorf("expected rolled back %t, got %v", tt.corrupt, results[1].Error)
+			}
+
+			if _, err := os.Stat(kept); err != nil {
+				t.Errorf("expected the dest that was already in place to be kept: %v", err)
+			}
+
+			for _, path := range []string{fresh, fresh + ".sha256"} {
+				_, err := os.Stat(path)
+				if os.IsNotExist(err) != tt.wantFreshOut {
+					t.Errorf("%s: expected removed %t, got stat error %v", path, tt.wantFreshOut, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+// headSidecarSuffix is appended to a dest to name the file recording the
+// remote state it was downloaded at, for settings.skip_if_unchanged.
+const headSidecarSuffix = ".head"
+
+// checkUnchanged implements settings.skip_if_unchanged. It returns the
+// current remote state, and whether it equals the state recorded in the
+// sidecar of an untouched dest. The dest is trusted without hashing, which
+// trades integrity for freshness. Errors fall through to a normal download.
+func (downloader *Downloader) checkUnchanged(ctx context.Context, file config.FileEntry) (storage.RemoteState, bool) {
+	if !downloader.cfg.Settings.IsSkipIfUnchanged() {
+		return storage.RemoteState{}, false
+	}
+
+	// Mirrored objects are compared with their listing instead.
+	_, ok := downloader.mirrored[file.Dest]
+	if ok {
+		return storage.RemoteState{}, false
+	}
+
+	recorded, ok := readHeadSidecar(file.Dest)
+
+	// Offline, the remote state is unknown, so a recorded copy is kept.
+	if downloader.offline {
+		return storage.RemoteState{}, ok
+	}
+
+	source, err := downloader.newSource(file)
+	if err != nil {
+		return storage.RemoteState{}, false
+	}
+
+	stateSource, isState := source.(storage.StateSource)
+	if !isState {
+		return storage.RemoteState{}, false
+	}
+
+	remote, err := retryMetadata(ctx, downloader.cfg.Settings, func() (storage.RemoteState, error) {
+		return stateSource.GetState(ctx)
+	})
+	if err != nil {
+		downloader.warn("could not get state of %s: %v", redactURL(file.URL), err)
+
+		return storage.RemoteState{}, false
+	}
+
+	return remote, ok && sameRemoteState(recorded, remote)
+}
+
+// sameRemoteState reports whether two states describe the same version of
+// a remote file. A source that reports neither an ETag nor a modification
+// time cannot be told apart from a changed one of the same size.
+func sameRemoteState(recorded, remote storage.RemoteState) bool {
+	if remote.ETag == "" && remote.ModTime.IsZero() {
+		return false
+	}
+
+	return normalizeETag(recorded.ETag) == normalizeETag(remote.ETag) &&
+		recorded.ModTime.Equal(remote.ModTime) &&
+		recorded.Size == remote.Size
+}
+
+// readHeadSidecar returns the state recorded for dest. A sidecar older than
+// the dest, or one without a dest, records nothing.
+func readHeadSidecar(dest string) (storage.RemoteState, bool) {
+	destInfo, err := os.Stat(dest)
+	if err != nil || !destInfo.Mode().IsRegular() {
+		return storage.RemoteState{}, false
+	}
+
+	sidecarPath := dest + headSidecarSuffix
+
+	sidecarInfo, err := os.Stat(sidecarPath)
+	if err != nil || sidecarInfo.ModTime().Before(destInfo.ModTime()) {
+		return storage.RemoteState{}, false
+	}
+
+	data, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return storage.RemoteState{}, false
+	}
+
+	var state storage.RemoteState
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return storage.RemoteState{}, false
+	}
+
+	return state, true
+}
+
+// recordRemoteState writes the state a dest was downloaded at. Errors are
+// reported as warnings: without a sidecar the next run downloads again.
+func (downloader *Downloader) recordRemoteState(file config.FileEntry, state storage.RemoteState) {
+	if state.ETag == "" && state.ModTime.IsZero() {
+		return
+	}
+
+	err := writeHeadSidecar(file.Dest, state)
+	if err != nil {
+		downloader.warn("%s: %v", file.Dest, err)
+	}
+}
+
+func writeHeadSidecar(dest string, state storage.RemoteState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding head sidecar: %w", err)
+	}
+
+	data = append(data, '\n')
+
+	err = os.WriteFile(dest+headSidecarSuffix, data, 0o644) //nolint:gosec // sidecar is as readable as the file
+	if err != nil {
+		return fmt.Errorf("writing head sidecar: %w", err)
+	}
+
+	return nil
+}
+
+// discardHeadSidecar removes the sidecar of a dest that is about to be
+// replaced, so it cannot vouch for the new content.
+func discardHeadSidecar(dest string) {
+	os.Remove(dest + headSidecarSuffix)
+}
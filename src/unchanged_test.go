@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xget/src/config"
+	"xget/src/storage"
+)
+
+func TestSameRemoteState(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	recorded := storage.RemoteState{ETag: `"v1"`, ModTime: modTime, Size: 7}
+
+	tests := []struct {
+		name   string
+		remote storage.RemoteState
+		want   bool
+	}{
+		{name: "unchanged", remote: recorded, want: true},
+		{name: "weak etag", remote: storage.RemoteState{ETag: `W/"v1"`, ModTime: modTime, Size: 7}, want: true},
+		{name: "etag changed", remote: storage.RemoteState{ETag: `"v2"`, ModTime: modTime, Size: 7}},
+		{name: "modified", remote: storage.RemoteState{ETag: `"v1"`, ModTime: modTime.Add(time.Second), Size: 7}},
+		{name: "resized", remote: storage.RemoteState{ETag: `"v1"`, ModTime: modTime, Size: 8}},
+		{name: "no validators", remote: storage.RemoteState{Size: 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameRemoteState(recorded, tt.remote); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDownloadSkipIfUnchanged(t *testing.T) {
+	var (
+		version atomic.Int32
+		gets    atomic.Int32
+	)
+
+	version.Store(1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := fmt.Sprintf("version %d", version.Load())
+
+		w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, version.Load()))
+		w.Header().Set("Last-Modified", "Fri, 01 Mar 2024 12:00:00 GMT")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+			fmt.Fprint(w, body)
+		}
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "mutable.bin")
+
+	download := func() {
+		t.Helper()
+
+		cfg := &config.Config{
+			Settings: config.Settings{
+				Parallel: 1, Retries: 1, MetadataRetries: 1, SingleStream: "true", SkipIfUnchanged: "true",
+				ProgressMode: config.ProgressModeCI,
+			},
+			Files: []config.FileEntry{{URL: server.URL + "/mutable.bin", Dest: dest}},
+		}
+
+		results := NewDownloader(cfg, nil).Download(context.Background())
+		if results[0].Error != nil {
+			t.Fatalf("unexpected error: %v", results[0].Error)
+		}
+	}
+
+	download()
+	download()
+
+	if gets.Load() != 1 {
+		t.Errorf("expected the unchanged file to be downloaded once, got %d downloads", gets.Load())
+	}
+
+	version.Store(2)
+	download()
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("reading dest: %v", err)
+	}
+
+	if string(data) != "version 2" || gets.Load() != 2 {
+		t.Errorf("expected the changed file to be downloaded again, got %q after %d downloads", data, gets.Load())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xget/src/config"
+)
+
+// versionMarkerCurrent reports whether the settings.version_marker file
+// records the configured value, in which case the whole file set is taken
+// to be in place and nothing is checked or downloaded.
+func versionMarkerCurrent(marker config.VersionMarker) bool {
+	if marker.Path == "" {
+		return false
+	}
+
+	data, err := os.ReadFile(marker.Path)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(data)) == marker.Value
+}
+
+// writeVersionMarker records the configured value once every file is in
+// place. It is written atomically, so an interrupted write never leaves a
+// marker that matches.
+func writeVersionMarker(marker config.VersionMarker) error {
+	err := os.MkdirAll(filepath.Dir(marker.Path), 0o755)
+	if err != nil {
+		return fmt.Errorf("creating version marker directory: %w", err)
+	}
+
+	tmpPath := marker.Path + ".tmp"
+
+	err = os.WriteFile(tmpPath, []byte(marker.Value+"\n"), 0o644) //nolint:gosec // marker is as readable as the files
+	if err != nil {
+		return fmt.Errorf("writing version marker: %w", err)
+	}
+
+	err = os.Rename(tmpPath, marker.Path)
+	if err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("writing version marker: %w", err)
+	}
+
+	return nil
+}
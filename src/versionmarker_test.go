@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"xget/src/config"
+)
+
+func TestVersionMarker(t *testing.T) {
+	marker := config.VersionMarker{Path: filepath.Join(t.TempDir(), "assets", ".version"), Value: "2026.10.1"}
+
+	if versionMarkerCurrent(marker) {
+		t.Fatal("expected a missing marker not to be current")
+	}
+
+	err := writeVersionMarker(marker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !versionMarkerCurrent(marker) {
+		t.Error("expected the written marker to be current")
+	}
+
+	if _, err := os.Stat(marker.Path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected no temporary marker left behind, got %v", err)
+	}
+
+	next := marker
+	next.Value = "2026.10.2"
+
+	if versionMarkerCurrent(next) {
+		t.Error("expected a changed version not to be current")
+	}
+
+	if versionMarkerCurrent(config.VersionMarker{}) {
+		t.Error("expected an unset marker never to be current")
+	}
+}
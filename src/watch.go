@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"xget/src/config"
+)
+
+// watchDebounce is how long the configs must stay quiet after a change
+// before they are reloaded, so an editor saving in several steps triggers
+// one run.
+const watchDebounce = 500 * time.Millisecond
+
+// watchConfigs reloads the configs whenever one of them changes and
+// downloads the entries that are new or changed since the previous load. It
+// runs until ctx is cancelled and returns the exit code of the last run.
+func watchConfigs(ctx context.Context, cfg *config.Config, opts runOptions, code int) int {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: watching configs: %v\n", err)
+
+		return exitFailed
+	}
+
+	defer watcher.Close()
+
+	paths, err := watchConfigPaths(watcher, opts.configPaths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: watching configs: %v\n", err)
+
+		return exitFailed
+	}
+
+	fmt.Printf("\nWatching %d config files for changes, press Ctrl+C to stop\n", len(paths))
+
+	previous := cfg.Files
+
+	for waitForChange(ctx, watcher, paths, watchDebounce) {
+		next, err := loadRunConfig(opts)
+		if err != nil {
+			// Keep watching: the next save may fix the config.
+			fmt.Fprintf(os.Stderr, "\nError reloading config: %v\n", err)
+
+			continue
+		}
+
+		opts.apply(next)
+
+		err = next.ApplyDestDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reloading config: %v\n", err)
+
+			continue
+		}
+
+		changed := changedEntries(previous, next.Files)
+		previous = next.Files
+
+		if len(changed) == 0 {
+			fmt.Println("\nConfig changed, no new or changed entries")
+
+			continue
+		}
+
+		fmt.Printf("\nConfig changed, downloading %d new or changed entries\n", len(changed))
+
+		// A subset of the files never vouches for the version marker.
+		next.Files = changed
+		code = runDownloads(ctx, next, opts, config.VersionMarker{})
+	}
+
+	return code
+}
+
+// watchConfigPaths watches the directories of the config files and returns
+// the cleaned absolute config paths. Directories are watched rather than the
+// files, because editors often save by replacing the file.
+func watchConfigPaths(watcher *fsnotify.Watcher, configPaths []string) (map[string]bool, error) {
+	paths := make(map[string]bool, len(configPaths))
+	dirs := make(map[string]bool)
+
+	for _, configPath := range configPaths {
+		absPath, err := filepath.Abs(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", configPath, err)
+		}
+
+		paths[absPath] = true
+
+		dir := filepath.Dir(absPath)
+		if dirs[dir] {
+			continue
+		}
+
+		err = watcher.Add(dir)
+		if err != nil {
+			return nil, fmt.Errorf("watching %s: %w", dir, err)
+		}
+
+		dirs[dir] = true
+	}
+
+	return paths, nil
+}
+
+// waitForChange blocks until one of paths changed and then stayed unchanged
+// for debounce. It returns false once ctx is cancelled or the watcher closes.
+func waitForChange(ctx context.Context, watcher *fsnotify.Watcher, paths map[string]bool, debounce time.Duration) bool {
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return false
+			}
+
+			if !paths[filepath.Clean(event.Name)] || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			settled = time.After(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return false
+			}
+
+			fmt.Fprintf(os.Stderr, "warning: watching configs: %v\n", err)
+		case <-settled:
+			return true
+		}
+	}
+}
+
+// changedEntries returns the entries of current that are not in previous
+// with the same dest and identical fields, in the order of current.
+func changedEntries(previous, current []config.FileEntry) []config.FileEntry {
+	byDest := make(map[string]config.FileEntry, len(previous))
+	for _, entry := range previous {
+		byDest[entry.Dest] = entry
+	}
+
+	var changed []config.FileEntry
+
+	for _, entry := range current {
+		old, found := byDest[entry.Dest]
+		if found && reflect.DeepEqual(old, entry) {
+			continue
+		}
+
+		changed = append(changed, entry)
+	}
+
+	return changed
+}
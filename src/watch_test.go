@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"xget/src/config"
+)
+
+func TestChangedEntries(t *testing.T) {
+	previous := []config.FileEntry{
+		{URL: "s3://bucket/a.bin", Dest: "a.bin", SHA256: "aaa"},
+		{URL: "s3://bucket/b.bin", Dest: "b.bin", SHA256: "bbb"},
+		{URL: "s3://bucket/c.bin", Dest: "c.bin", SHA256: "ccc"},
+	}
+
+	current := []config.FileEntry{
+		{URL: "s3://bucket/d.bin", Dest: "d.bin", SHA256: "ddd"},
+		{URL: "s3://bucket/a.bin", Dest: "a.bin", SHA256: "aaa"},
+		{URL: "s3://bucket/b.bin", Dest: "b.bin", SHA256: "bb2"},
+	}
+
+	changed := changedEntries(previous, current)
+	if len(changed) != 2 || changed[0].Dest != "d.bin" || changed[1].Dest != "b.bin" {
+		t.Fatalf("expected d.bin and b.bin, got %+v", changed)
+	}
+
+	if changed := changedEntries(current, current); len(changed) != 0 {
+		t.Errorf("expected no changes against itself, got %+v", changed)
+	}
+}
+
+func TestWaitForChange(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+
+	if err := os.WriteFile(configPath, []byte("files: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer watcher.Close()
+
+	paths, err := watchConfigPaths(watcher, []string{configPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Other files in the directory are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for range 3 {
+			_ = os.WriteFile(configPath, []byte("files: []\n# edited\n"), 0o600)
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	if !waitForChange(ctx, watcher, paths, 100*time.Millisecond) {
+		t.Fatal("expected a change to be reported")
+	}
+
+	// The burst of writes settles into one change.
+	quiet, cancelQuiet := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancelQuiet()
+
+	if waitForChange(quiet, watcher, paths, 100*time.Millisecond) {
+		t.Error("expected the burst of writes to be reported once")
+	}
+}